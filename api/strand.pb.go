@@ -14,6 +14,61 @@ It has these top-level messages:
 	WriteRequest
 	ReadRequest
 	WriteResponse
+	ReadResponse
+	SubscribeRequest
+	SubscribeResponse
+	OffsetForTimeRequest
+	OffsetForTimeResponse
+	RegisterProducerRequest
+	RegisterProducerResponse
+	WriteTransactionRequest
+	TransactionWrite
+	WriteTransactionResponse
+	WriteTopicRequest
+	WriteTopicResponse
+	PartitionWrite
+	CommitOffsetRequest
+	CommitOffsetResponse
+	FetchCommittedOffsetRequest
+	FetchCommittedOffsetResponse
+	JoinGroupRequest
+	JoinGroupResponse
+	Assignment
+	HeartbeatRequest
+	HeartbeatResponse
+	LeaveGroupRequest
+	LeaveGroupResponse
+	ReplicaFetchRequest
+	ReplicaFetchResponse
+	VoteRequest
+	VoteResponse
+	LogEntry
+	AppendEntriesRequest
+	AppendEntriesResponse
+	StreamProgress
+	InstallSnapshotRequest
+	InstallSnapshotResponse
+	AssignStreamRequest
+	AssignStreamResponse
+	DefineTopicRequest
+	DefineTopicResponse
+	ListStreamsRequest
+	ListStreamsResponse
+	StatStreamRequest
+	StatStreamResponse
+	DeleteStreamRequest
+	DeleteStreamResponse
+	TruncateStreamRequest
+	TruncateStreamResponse
+	CreateStreamRequest
+	CreateStreamResponse
+	StreamConfig
+	CreateTopicRequest
+	CreateTopicResponse
+	DescribeTopicRequest
+	DescribeTopicResponse
+	DeleteTopicRequest
+	DeleteTopicResponse
 */
 package api
 
@@ -37,6 +92,57 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type WriteRequest_Expect int32
+
+const (
+	WriteRequest_ANY       WriteRequest_Expect = 0
+	WriteRequest_OFFSET    WriteRequest_Expect = 1
+	WriteRequest_NO_STREAM WriteRequest_Expect = 2
+)
+
+var WriteRequest_Expect_name = map[int32]string{
+	0: "ANY",
+	1: "OFFSET",
+	2: "NO_STREAM",
+}
+var WriteRequest_Expect_value = map[string]int32{
+	"ANY":       0,
+	"OFFSET":    1,
+	"NO_STREAM": 2,
+}
+
+func (x WriteRequest_Expect) String() string {
+	return proto.EnumName(WriteRequest_Expect_name, int32(x))
+}
+func (WriteRequest_Expect) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{2, 0} }
+
+type StreamConfig_Durability int32
+
+const (
+	StreamConfig_DEFAULT     StreamConfig_Durability = 0
+	StreamConfig_SYNC_NONE   StreamConfig_Durability = 1
+	StreamConfig_SYNC_ALWAYS StreamConfig_Durability = 2
+	StreamConfig_SYNC_GROUP  StreamConfig_Durability = 3
+)
+
+var StreamConfig_Durability_name = map[int32]string{
+	0: "DEFAULT",
+	1: "SYNC_NONE",
+	2: "SYNC_ALWAYS",
+	3: "SYNC_GROUP",
+}
+var StreamConfig_Durability_value = map[string]int32{
+	"DEFAULT":     0,
+	"SYNC_NONE":   1,
+	"SYNC_ALWAYS": 2,
+	"SYNC_GROUP":  3,
+}
+
+func (x StreamConfig_Durability) String() string {
+	return proto.EnumName(StreamConfig_Durability_name, int32(x))
+}
+func (StreamConfig_Durability) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{53, 0} }
+
 type PingRequest struct {
 }
 
@@ -54,8 +160,14 @@ func (*PingResponse) ProtoMessage()               {}
 func (*PingResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
 
 type WriteRequest struct {
-	Stream   string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
-	Messages []byte `protobuf:"bytes,2,opt,name=messages,proto3" json:"messages,omitempty"`
+	Stream         string              `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+	Messages       []byte              `protobuf:"bytes,2,opt,name=messages,proto3" json:"messages,omitempty"`
+	Sync           bool                `protobuf:"varint,3,opt,name=sync" json:"sync,omitempty"`
+	Expect         WriteRequest_Expect `protobuf:"varint,4,opt,name=expect,enum=api.WriteRequest_Expect" json:"expect,omitempty"`
+	ExpectedOffset uint64              `protobuf:"varint,5,opt,name=expected_offset" json:"expected_offset,omitempty"`
+	ProducerId     uint64              `protobuf:"varint,6,opt,name=producer_id" json:"producer_id,omitempty"`
+	Sequence       uint64              `protobuf:"varint,7,opt,name=sequence" json:"sequence,omitempty"`
+	Acks           uint32              `protobuf:"varint,8,opt,name=acks" json:"acks,omitempty"`
 }
 
 func (m *WriteRequest) Reset()                    { *m = WriteRequest{} }
@@ -64,8 +176,11 @@ func (*WriteRequest) ProtoMessage()               {}
 func (*WriteRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
 
 type ReadRequest struct {
-	Stream string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
-	Offset uint64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Stream      string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+	Offset      uint64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	MaxMessages uint32 `protobuf:"varint,3,opt,name=max_messages" json:"max_messages,omitempty"`
+	MaxBytes    uint32 `protobuf:"varint,4,opt,name=max_bytes" json:"max_bytes,omitempty"`
+	Compressed  bool   `protobuf:"varint,5,opt,name=compressed" json:"compressed,omitempty"`
 }
 
 func (m *ReadRequest) Reset()                    { *m = ReadRequest{} }
@@ -74,7 +189,10 @@ func (*ReadRequest) ProtoMessage()               {}
 func (*ReadRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 type WriteResponse struct {
-	Ok bool `protobuf:"varint,1,opt,name=ok" json:"ok,omitempty"`
+	Ok           bool   `protobuf:"varint,1,opt,name=ok" json:"ok,omitempty"`
+	FirstOffset  uint64 `protobuf:"varint,2,opt,name=first_offset" json:"first_offset,omitempty"`
+	LastOffset   uint64 `protobuf:"varint,3,opt,name=last_offset" json:"last_offset,omitempty"`
+	MessageCount uint32 `protobuf:"varint,4,opt,name=message_count" json:"message_count,omitempty"`
 }
 
 func (m *WriteResponse) Reset()                    { *m = WriteResponse{} }
@@ -82,12 +200,729 @@ func (m *WriteResponse) String() string            { return proto.CompactTextStr
 func (*WriteResponse) ProtoMessage()               {}
 func (*WriteResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
 
+type ReadResponse struct {
+	Messages   []byte `protobuf:"bytes,1,opt,name=messages,proto3" json:"messages,omitempty"`
+	NextOffset uint64 `protobuf:"varint,2,opt,name=next_offset" json:"next_offset,omitempty"`
+}
+
+func (m *ReadResponse) Reset()                    { *m = ReadResponse{} }
+func (m *ReadResponse) String() string            { return proto.CompactTextString(m) }
+func (*ReadResponse) ProtoMessage()               {}
+func (*ReadResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+type SubscribeRequest struct {
+	Stream     string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+	FromOffset uint64 `protobuf:"varint,2,opt,name=from_offset" json:"from_offset,omitempty"`
+	MaxBytes   uint32 `protobuf:"varint,3,opt,name=max_bytes" json:"max_bytes,omitempty"`
+	Compressed bool   `protobuf:"varint,4,opt,name=compressed" json:"compressed,omitempty"`
+}
+
+func (m *SubscribeRequest) Reset()                    { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string            { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()               {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+type SubscribeResponse struct {
+	Messages   []byte `protobuf:"bytes,1,opt,name=messages,proto3" json:"messages,omitempty"`
+	NextOffset uint64 `protobuf:"varint,2,opt,name=next_offset" json:"next_offset,omitempty"`
+}
+
+func (m *SubscribeResponse) Reset()                    { *m = SubscribeResponse{} }
+func (m *SubscribeResponse) String() string            { return proto.CompactTextString(m) }
+func (*SubscribeResponse) ProtoMessage()               {}
+func (*SubscribeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+type OffsetForTimeRequest struct {
+	Stream    string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+	Timestamp int64  `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *OffsetForTimeRequest) Reset()                    { *m = OffsetForTimeRequest{} }
+func (m *OffsetForTimeRequest) String() string            { return proto.CompactTextString(m) }
+func (*OffsetForTimeRequest) ProtoMessage()               {}
+func (*OffsetForTimeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+type OffsetForTimeResponse struct {
+	Offset uint64 `protobuf:"varint,1,opt,name=offset" json:"offset,omitempty"`
+}
+
+func (m *OffsetForTimeResponse) Reset()                    { *m = OffsetForTimeResponse{} }
+func (m *OffsetForTimeResponse) String() string            { return proto.CompactTextString(m) }
+func (*OffsetForTimeResponse) ProtoMessage()               {}
+func (*OffsetForTimeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+type RegisterProducerRequest struct {
+}
+
+func (m *RegisterProducerRequest) Reset()                    { *m = RegisterProducerRequest{} }
+func (m *RegisterProducerRequest) String() string            { return proto.CompactTextString(m) }
+func (*RegisterProducerRequest) ProtoMessage()               {}
+func (*RegisterProducerRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+type RegisterProducerResponse struct {
+	ProducerId uint64 `protobuf:"varint,1,opt,name=producer_id" json:"producer_id,omitempty"`
+}
+
+func (m *RegisterProducerResponse) Reset()                    { *m = RegisterProducerResponse{} }
+func (m *RegisterProducerResponse) String() string            { return proto.CompactTextString(m) }
+func (*RegisterProducerResponse) ProtoMessage()               {}
+func (*RegisterProducerResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+type WriteTransactionRequest struct {
+	Writes []*TransactionWrite `protobuf:"bytes,1,rep,name=writes" json:"writes,omitempty"`
+}
+
+func (m *WriteTransactionRequest) Reset()                    { *m = WriteTransactionRequest{} }
+func (m *WriteTransactionRequest) String() string            { return proto.CompactTextString(m) }
+func (*WriteTransactionRequest) ProtoMessage()               {}
+func (*WriteTransactionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *WriteTransactionRequest) GetWrites() []*TransactionWrite {
+	if m != nil {
+		return m.Writes
+	}
+	return nil
+}
+
+type TransactionWrite struct {
+	Stream   string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+	Messages []byte `protobuf:"bytes,2,opt,name=messages,proto3" json:"messages,omitempty"`
+}
+
+func (m *TransactionWrite) Reset()                    { *m = TransactionWrite{} }
+func (m *TransactionWrite) String() string            { return proto.CompactTextString(m) }
+func (*TransactionWrite) ProtoMessage()               {}
+func (*TransactionWrite) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+type WriteTransactionResponse struct {
+	Writes []*WriteResponse `protobuf:"bytes,1,rep,name=writes" json:"writes,omitempty"`
+}
+
+func (m *WriteTransactionResponse) Reset()                    { *m = WriteTransactionResponse{} }
+func (m *WriteTransactionResponse) String() string            { return proto.CompactTextString(m) }
+func (*WriteTransactionResponse) ProtoMessage()               {}
+func (*WriteTransactionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *WriteTransactionResponse) GetWrites() []*WriteResponse {
+	if m != nil {
+		return m.Writes
+	}
+	return nil
+}
+
+type WriteTopicRequest struct {
+	Topic    string `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
+	Messages []byte `protobuf:"bytes,2,opt,name=messages,proto3" json:"messages,omitempty"`
+	Sync     bool   `protobuf:"varint,3,opt,name=sync" json:"sync,omitempty"`
+	Acks     uint32 `protobuf:"varint,4,opt,name=acks" json:"acks,omitempty"`
+}
+
+func (m *WriteTopicRequest) Reset()                    { *m = WriteTopicRequest{} }
+func (m *WriteTopicRequest) String() string            { return proto.CompactTextString(m) }
+func (*WriteTopicRequest) ProtoMessage()               {}
+func (*WriteTopicRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+type WriteTopicResponse struct {
+	Partitions []*PartitionWrite `protobuf:"bytes,1,rep,name=partitions" json:"partitions,omitempty"`
+}
+
+func (m *WriteTopicResponse) Reset()                    { *m = WriteTopicResponse{} }
+func (m *WriteTopicResponse) String() string            { return proto.CompactTextString(m) }
+func (*WriteTopicResponse) ProtoMessage()               {}
+func (*WriteTopicResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *WriteTopicResponse) GetPartitions() []*PartitionWrite {
+	if m != nil {
+		return m.Partitions
+	}
+	return nil
+}
+
+type PartitionWrite struct {
+	Partition uint32         `protobuf:"varint,1,opt,name=partition" json:"partition,omitempty"`
+	Stream    string         `protobuf:"bytes,2,opt,name=stream" json:"stream,omitempty"`
+	Write     *WriteResponse `protobuf:"bytes,3,opt,name=write" json:"write,omitempty"`
+}
+
+func (m *PartitionWrite) Reset()                    { *m = PartitionWrite{} }
+func (m *PartitionWrite) String() string            { return proto.CompactTextString(m) }
+func (*PartitionWrite) ProtoMessage()               {}
+func (*PartitionWrite) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *PartitionWrite) GetWrite() *WriteResponse {
+	if m != nil {
+		return m.Write
+	}
+	return nil
+}
+
+type CommitOffsetRequest struct {
+	Group    string `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+	Stream   string `protobuf:"bytes,2,opt,name=stream" json:"stream,omitempty"`
+	Offset   uint64 `protobuf:"varint,3,opt,name=offset" json:"offset,omitempty"`
+	Metadata string `protobuf:"bytes,4,opt,name=metadata" json:"metadata,omitempty"`
+}
+
+func (m *CommitOffsetRequest) Reset()                    { *m = CommitOffsetRequest{} }
+func (m *CommitOffsetRequest) String() string            { return proto.CompactTextString(m) }
+func (*CommitOffsetRequest) ProtoMessage()               {}
+func (*CommitOffsetRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+
+type CommitOffsetResponse struct {
+	Timestamp int64 `protobuf:"varint,1,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *CommitOffsetResponse) Reset()                    { *m = CommitOffsetResponse{} }
+func (m *CommitOffsetResponse) String() string            { return proto.CompactTextString(m) }
+func (*CommitOffsetResponse) ProtoMessage()               {}
+func (*CommitOffsetResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
+
+type FetchCommittedOffsetRequest struct {
+	Group  string `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+	Stream string `protobuf:"bytes,2,opt,name=stream" json:"stream,omitempty"`
+}
+
+func (m *FetchCommittedOffsetRequest) Reset()                    { *m = FetchCommittedOffsetRequest{} }
+func (m *FetchCommittedOffsetRequest) String() string            { return proto.CompactTextString(m) }
+func (*FetchCommittedOffsetRequest) ProtoMessage()               {}
+func (*FetchCommittedOffsetRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+
+type FetchCommittedOffsetResponse struct {
+	Found     bool   `protobuf:"varint,1,opt,name=found" json:"found,omitempty"`
+	Offset    uint64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Metadata  string `protobuf:"bytes,3,opt,name=metadata" json:"metadata,omitempty"`
+	Timestamp int64  `protobuf:"varint,4,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *FetchCommittedOffsetResponse) Reset()                    { *m = FetchCommittedOffsetResponse{} }
+func (m *FetchCommittedOffsetResponse) String() string            { return proto.CompactTextString(m) }
+func (*FetchCommittedOffsetResponse) ProtoMessage()               {}
+func (*FetchCommittedOffsetResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+
+type JoinGroupRequest struct {
+	Group          string `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+	Prefix         string `protobuf:"bytes,2,opt,name=prefix" json:"prefix,omitempty"`
+	MemberId       string `protobuf:"bytes,3,opt,name=member_id" json:"member_id,omitempty"`
+	SessionTimeout int64  `protobuf:"varint,4,opt,name=session_timeout" json:"session_timeout,omitempty"`
+}
+
+func (m *JoinGroupRequest) Reset()                    { *m = JoinGroupRequest{} }
+func (m *JoinGroupRequest) String() string            { return proto.CompactTextString(m) }
+func (*JoinGroupRequest) ProtoMessage()               {}
+func (*JoinGroupRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+
+type JoinGroupResponse struct {
+	MemberId   string      `protobuf:"bytes,1,opt,name=member_id" json:"member_id,omitempty"`
+	Assignment *Assignment `protobuf:"bytes,2,opt,name=assignment" json:"assignment,omitempty"`
+}
+
+func (m *JoinGroupResponse) Reset()                    { *m = JoinGroupResponse{} }
+func (m *JoinGroupResponse) String() string            { return proto.CompactTextString(m) }
+func (*JoinGroupResponse) ProtoMessage()               {}
+func (*JoinGroupResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+
+func (m *JoinGroupResponse) GetAssignment() *Assignment {
+	if m != nil {
+		return m.Assignment
+	}
+	return nil
+}
+
+type Assignment struct {
+	Generation uint64   `protobuf:"varint,1,opt,name=generation" json:"generation,omitempty"`
+	Streams    []string `protobuf:"bytes,2,rep,name=streams" json:"streams,omitempty"`
+}
+
+func (m *Assignment) Reset()                    { *m = Assignment{} }
+func (m *Assignment) String() string            { return proto.CompactTextString(m) }
+func (*Assignment) ProtoMessage()               {}
+func (*Assignment) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+
+type HeartbeatRequest struct {
+	Group    string `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+	MemberId string `protobuf:"bytes,2,opt,name=member_id" json:"member_id,omitempty"`
+}
+
+func (m *HeartbeatRequest) Reset()                    { *m = HeartbeatRequest{} }
+func (m *HeartbeatRequest) String() string            { return proto.CompactTextString(m) }
+func (*HeartbeatRequest) ProtoMessage()               {}
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
+
+type HeartbeatResponse struct {
+	Assignment *Assignment `protobuf:"bytes,1,opt,name=assignment" json:"assignment,omitempty"`
+}
+
+func (m *HeartbeatResponse) Reset()                    { *m = HeartbeatResponse{} }
+func (m *HeartbeatResponse) String() string            { return proto.CompactTextString(m) }
+func (*HeartbeatResponse) ProtoMessage()               {}
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
+
+func (m *HeartbeatResponse) GetAssignment() *Assignment {
+	if m != nil {
+		return m.Assignment
+	}
+	return nil
+}
+
+type LeaveGroupRequest struct {
+	Group    string `protobuf:"bytes,1,opt,name=group" json:"group,omitempty"`
+	MemberId string `protobuf:"bytes,2,opt,name=member_id" json:"member_id,omitempty"`
+}
+
+func (m *LeaveGroupRequest) Reset()                    { *m = LeaveGroupRequest{} }
+func (m *LeaveGroupRequest) String() string            { return proto.CompactTextString(m) }
+func (*LeaveGroupRequest) ProtoMessage()               {}
+func (*LeaveGroupRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
+
+type LeaveGroupResponse struct {
+}
+
+func (m *LeaveGroupResponse) Reset()                    { *m = LeaveGroupResponse{} }
+func (m *LeaveGroupResponse) String() string            { return proto.CompactTextString(m) }
+func (*LeaveGroupResponse) ProtoMessage()               {}
+func (*LeaveGroupResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
+
+type ReplicaFetchRequest struct {
+	FollowerId    string `protobuf:"bytes,1,opt,name=follower_id" json:"follower_id,omitempty"`
+	Stream        string `protobuf:"bytes,2,opt,name=stream" json:"stream,omitempty"`
+	Offset        uint64 `protobuf:"varint,3,opt,name=offset" json:"offset,omitempty"`
+	MaxBytes      uint32 `protobuf:"varint,4,opt,name=max_bytes" json:"max_bytes,omitempty"`
+	MaxWait       int64  `protobuf:"varint,5,opt,name=max_wait" json:"max_wait,omitempty"`
+	IncludeConfig bool   `protobuf:"varint,6,opt,name=include_config" json:"include_config,omitempty"`
+}
+
+func (m *ReplicaFetchRequest) Reset()                    { *m = ReplicaFetchRequest{} }
+func (m *ReplicaFetchRequest) String() string            { return proto.CompactTextString(m) }
+func (*ReplicaFetchRequest) ProtoMessage()               {}
+func (*ReplicaFetchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
+
+type ReplicaFetchResponse struct {
+	Messages   []byte        `protobuf:"bytes,1,opt,name=messages,proto3" json:"messages,omitempty"`
+	NextOffset uint64        `protobuf:"varint,2,opt,name=next_offset" json:"next_offset,omitempty"`
+	HeadOffset uint64        `protobuf:"varint,3,opt,name=head_offset" json:"head_offset,omitempty"`
+	Config     *StreamConfig `protobuf:"bytes,4,opt,name=config" json:"config,omitempty"`
+}
+
+func (m *ReplicaFetchResponse) Reset()                    { *m = ReplicaFetchResponse{} }
+func (m *ReplicaFetchResponse) String() string            { return proto.CompactTextString(m) }
+func (*ReplicaFetchResponse) ProtoMessage()               {}
+func (*ReplicaFetchResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
+
+func (m *ReplicaFetchResponse) GetConfig() *StreamConfig {
+	if m != nil {
+		return m.Config
+	}
+	return nil
+}
+
+type VoteRequest struct {
+	Term         uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	CandidateId  string `protobuf:"bytes,2,opt,name=candidate_id" json:"candidate_id,omitempty"`
+	LastLogIndex uint64 `protobuf:"varint,3,opt,name=last_log_index" json:"last_log_index,omitempty"`
+	LastLogTerm  uint64 `protobuf:"varint,4,opt,name=last_log_term" json:"last_log_term,omitempty"`
+}
+
+func (m *VoteRequest) Reset()                    { *m = VoteRequest{} }
+func (m *VoteRequest) String() string            { return proto.CompactTextString(m) }
+func (*VoteRequest) ProtoMessage()               {}
+func (*VoteRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
+
+type VoteResponse struct {
+	Term    uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Granted bool   `protobuf:"varint,2,opt,name=granted" json:"granted,omitempty"`
+}
+
+func (m *VoteResponse) Reset()                    { *m = VoteResponse{} }
+func (m *VoteResponse) String() string            { return proto.CompactTextString(m) }
+func (*VoteResponse) ProtoMessage()               {}
+func (*VoteResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{32} }
+
+type LogEntry struct {
+	Term       uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Stream     string `protobuf:"bytes,2,opt,name=stream" json:"stream,omitempty"`
+	Node       string `protobuf:"bytes,3,opt,name=node" json:"node,omitempty"`
+	Topic      string `protobuf:"bytes,4,opt,name=topic" json:"topic,omitempty"`
+	Partitions uint32 `protobuf:"varint,5,opt,name=partitions" json:"partitions,omitempty"`
+}
+
+func (m *LogEntry) Reset()                    { *m = LogEntry{} }
+func (m *LogEntry) String() string            { return proto.CompactTextString(m) }
+func (*LogEntry) ProtoMessage()               {}
+func (*LogEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{33} }
+
+type AppendEntriesRequest struct {
+	Term         uint64      `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	LeaderId     string      `protobuf:"bytes,2,opt,name=leader_id" json:"leader_id,omitempty"`
+	PrevLogIndex uint64      `protobuf:"varint,3,opt,name=prev_log_index" json:"prev_log_index,omitempty"`
+	PrevLogTerm  uint64      `protobuf:"varint,4,opt,name=prev_log_term" json:"prev_log_term,omitempty"`
+	Entries      []*LogEntry `protobuf:"bytes,5,rep,name=entries" json:"entries,omitempty"`
+	LeaderCommit uint64      `protobuf:"varint,6,opt,name=leader_commit" json:"leader_commit,omitempty"`
+}
+
+func (m *AppendEntriesRequest) Reset()                    { *m = AppendEntriesRequest{} }
+func (m *AppendEntriesRequest) String() string            { return proto.CompactTextString(m) }
+func (*AppendEntriesRequest) ProtoMessage()               {}
+func (*AppendEntriesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{34} }
+
+func (m *AppendEntriesRequest) GetEntries() []*LogEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type AppendEntriesResponse struct {
+	Term       uint64            `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Success    bool              `protobuf:"varint,2,opt,name=success" json:"success,omitempty"`
+	MatchIndex uint64            `protobuf:"varint,3,opt,name=match_index" json:"match_index,omitempty"`
+	Progress   []*StreamProgress `protobuf:"bytes,4,rep,name=progress" json:"progress,omitempty"`
+}
+
+func (m *AppendEntriesResponse) Reset()                    { *m = AppendEntriesResponse{} }
+func (m *AppendEntriesResponse) String() string            { return proto.CompactTextString(m) }
+func (*AppendEntriesResponse) ProtoMessage()               {}
+func (*AppendEntriesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{35} }
+
+func (m *AppendEntriesResponse) GetProgress() []*StreamProgress {
+	if m != nil {
+		return m.Progress
+	}
+	return nil
+}
+
+type StreamProgress struct {
+	Stream string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+	Offset uint64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+}
+
+func (m *StreamProgress) Reset()                    { *m = StreamProgress{} }
+func (m *StreamProgress) String() string            { return proto.CompactTextString(m) }
+func (*StreamProgress) ProtoMessage()               {}
+func (*StreamProgress) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{36} }
+
+type InstallSnapshotRequest struct {
+	Term              uint64      `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	LeaderId          string      `protobuf:"bytes,2,opt,name=leader_id" json:"leader_id,omitempty"`
+	LastIncludedIndex uint64      `protobuf:"varint,3,opt,name=last_included_index" json:"last_included_index,omitempty"`
+	LastIncludedTerm  uint64      `protobuf:"varint,4,opt,name=last_included_term" json:"last_included_term,omitempty"`
+	Assignments       []*LogEntry `protobuf:"bytes,5,rep,name=assignments" json:"assignments,omitempty"`
+	Topics            []*LogEntry `protobuf:"bytes,6,rep,name=topics" json:"topics,omitempty"`
+}
+
+func (m *InstallSnapshotRequest) Reset()                    { *m = InstallSnapshotRequest{} }
+func (m *InstallSnapshotRequest) String() string            { return proto.CompactTextString(m) }
+func (*InstallSnapshotRequest) ProtoMessage()               {}
+func (*InstallSnapshotRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{37} }
+
+func (m *InstallSnapshotRequest) GetAssignments() []*LogEntry {
+	if m != nil {
+		return m.Assignments
+	}
+	return nil
+}
+
+func (m *InstallSnapshotRequest) GetTopics() []*LogEntry {
+	if m != nil {
+		return m.Topics
+	}
+	return nil
+}
+
+type InstallSnapshotResponse struct {
+	Term uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+}
+
+func (m *InstallSnapshotResponse) Reset()                    { *m = InstallSnapshotResponse{} }
+func (m *InstallSnapshotResponse) String() string            { return proto.CompactTextString(m) }
+func (*InstallSnapshotResponse) ProtoMessage()               {}
+func (*InstallSnapshotResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{38} }
+
+type AssignStreamRequest struct {
+	Stream string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+}
+
+func (m *AssignStreamRequest) Reset()                    { *m = AssignStreamRequest{} }
+func (m *AssignStreamRequest) String() string            { return proto.CompactTextString(m) }
+func (*AssignStreamRequest) ProtoMessage()               {}
+func (*AssignStreamRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{39} }
+
+type AssignStreamResponse struct {
+	Node string `protobuf:"bytes,1,opt,name=node" json:"node,omitempty"`
+}
+
+func (m *AssignStreamResponse) Reset()                    { *m = AssignStreamResponse{} }
+func (m *AssignStreamResponse) String() string            { return proto.CompactTextString(m) }
+func (*AssignStreamResponse) ProtoMessage()               {}
+func (*AssignStreamResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{40} }
+
+type DefineTopicRequest struct {
+	Topic      string `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
+	Partitions uint32 `protobuf:"varint,2,opt,name=partitions" json:"partitions,omitempty"`
+}
+
+func (m *DefineTopicRequest) Reset()                    { *m = DefineTopicRequest{} }
+func (m *DefineTopicRequest) String() string            { return proto.CompactTextString(m) }
+func (*DefineTopicRequest) ProtoMessage()               {}
+func (*DefineTopicRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{41} }
+
+type DefineTopicResponse struct {
+	Index uint64 `protobuf:"varint,1,opt,name=index" json:"index,omitempty"`
+}
+
+func (m *DefineTopicResponse) Reset()                    { *m = DefineTopicResponse{} }
+func (m *DefineTopicResponse) String() string            { return proto.CompactTextString(m) }
+func (*DefineTopicResponse) ProtoMessage()               {}
+func (*DefineTopicResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{42} }
+
+type ListStreamsRequest struct {
+	Prefix    string `protobuf:"bytes,1,opt,name=prefix" json:"prefix,omitempty"`
+	PageSize  uint32 `protobuf:"varint,2,opt,name=page_size" json:"page_size,omitempty"`
+	PageToken string `protobuf:"bytes,3,opt,name=page_token" json:"page_token,omitempty"`
+}
+
+func (m *ListStreamsRequest) Reset()                    { *m = ListStreamsRequest{} }
+func (m *ListStreamsRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListStreamsRequest) ProtoMessage()               {}
+func (*ListStreamsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{43} }
+
+type ListStreamsResponse struct {
+	Streams       []string `protobuf:"bytes,1,rep,name=streams" json:"streams,omitempty"`
+	NextPageToken string   `protobuf:"bytes,2,opt,name=next_page_token" json:"next_page_token,omitempty"`
+}
+
+func (m *ListStreamsResponse) Reset()                    { *m = ListStreamsResponse{} }
+func (m *ListStreamsResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListStreamsResponse) ProtoMessage()               {}
+func (*ListStreamsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{44} }
+
+type StatStreamRequest struct {
+	Stream string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+}
+
+func (m *StatStreamRequest) Reset()                    { *m = StatStreamRequest{} }
+func (m *StatStreamRequest) String() string            { return proto.CompactTextString(m) }
+func (*StatStreamRequest) ProtoMessage()               {}
+func (*StatStreamRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{45} }
+
+type StatStreamResponse struct {
+	FirstOffset  uint64 `protobuf:"varint,1,opt,name=first_offset" json:"first_offset,omitempty"`
+	NextOffset   uint64 `protobuf:"varint,2,opt,name=next_offset" json:"next_offset,omitempty"`
+	Bytes        uint64 `protobuf:"varint,3,opt,name=bytes" json:"bytes,omitempty"`
+	SegmentCount uint32 `protobuf:"varint,4,opt,name=segment_count" json:"segment_count,omitempty"`
+	Created      int64  `protobuf:"varint,5,opt,name=created" json:"created,omitempty"`
+}
+
+func (m *StatStreamResponse) Reset()                    { *m = StatStreamResponse{} }
+func (m *StatStreamResponse) String() string            { return proto.CompactTextString(m) }
+func (*StatStreamResponse) ProtoMessage()               {}
+func (*StatStreamResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{46} }
+
+type DeleteStreamRequest struct {
+	Stream string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+}
+
+func (m *DeleteStreamRequest) Reset()                    { *m = DeleteStreamRequest{} }
+func (m *DeleteStreamRequest) String() string            { return proto.CompactTextString(m) }
+func (*DeleteStreamRequest) ProtoMessage()               {}
+func (*DeleteStreamRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{47} }
+
+type DeleteStreamResponse struct {
+}
+
+func (m *DeleteStreamResponse) Reset()                    { *m = DeleteStreamResponse{} }
+func (m *DeleteStreamResponse) String() string            { return proto.CompactTextString(m) }
+func (*DeleteStreamResponse) ProtoMessage()               {}
+func (*DeleteStreamResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{48} }
+
+type TruncateStreamRequest struct {
+	Stream string `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+	Offset uint64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+}
+
+func (m *TruncateStreamRequest) Reset()                    { *m = TruncateStreamRequest{} }
+func (m *TruncateStreamRequest) String() string            { return proto.CompactTextString(m) }
+func (*TruncateStreamRequest) ProtoMessage()               {}
+func (*TruncateStreamRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{49} }
+
+type TruncateStreamResponse struct {
+	FirstOffset uint64 `protobuf:"varint,1,opt,name=first_offset" json:"first_offset,omitempty"`
+}
+
+func (m *TruncateStreamResponse) Reset()                    { *m = TruncateStreamResponse{} }
+func (m *TruncateStreamResponse) String() string            { return proto.CompactTextString(m) }
+func (*TruncateStreamResponse) ProtoMessage()               {}
+func (*TruncateStreamResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{50} }
+
+type CreateStreamRequest struct {
+	Stream string        `protobuf:"bytes,1,opt,name=stream" json:"stream,omitempty"`
+	Config *StreamConfig `protobuf:"bytes,2,opt,name=config" json:"config,omitempty"`
+}
+
+func (m *CreateStreamRequest) Reset()                    { *m = CreateStreamRequest{} }
+func (m *CreateStreamRequest) String() string            { return proto.CompactTextString(m) }
+func (*CreateStreamRequest) ProtoMessage()               {}
+func (*CreateStreamRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{51} }
+
+func (m *CreateStreamRequest) GetConfig() *StreamConfig {
+	if m != nil {
+		return m.Config
+	}
+	return nil
+}
+
+type CreateStreamResponse struct {
+}
+
+func (m *CreateStreamResponse) Reset()                    { *m = CreateStreamResponse{} }
+func (m *CreateStreamResponse) String() string            { return proto.CompactTextString(m) }
+func (*CreateStreamResponse) ProtoMessage()               {}
+func (*CreateStreamResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{52} }
+
+type StreamConfig struct {
+	SegmentMaxBytes      uint64                  `protobuf:"varint,1,opt,name=segment_max_bytes" json:"segment_max_bytes,omitempty"`
+	SegmentMaxAge        int64                   `protobuf:"varint,2,opt,name=segment_max_age" json:"segment_max_age,omitempty"`
+	RetentionMaxAge      int64                   `protobuf:"varint,3,opt,name=retention_max_age" json:"retention_max_age,omitempty"`
+	RetentionMaxBytes    uint64                  `protobuf:"varint,4,opt,name=retention_max_bytes" json:"retention_max_bytes,omitempty"`
+	RetentionMaxMessages uint64                  `protobuf:"varint,5,opt,name=retention_max_messages" json:"retention_max_messages,omitempty"`
+	MaxMessageBytes      uint32                  `protobuf:"varint,6,opt,name=max_message_bytes" json:"max_message_bytes,omitempty"`
+	Compact              bool                    `protobuf:"varint,7,opt,name=compact" json:"compact,omitempty"`
+	TombstoneRetention   int64                   `protobuf:"varint,8,opt,name=tombstone_retention" json:"tombstone_retention,omitempty"`
+	Durability           StreamConfig_Durability `protobuf:"varint,9,opt,name=durability,enum=api.StreamConfig_Durability" json:"durability,omitempty"`
+	SyncInterval         int64                   `protobuf:"varint,10,opt,name=sync_interval" json:"sync_interval,omitempty"`
+	SyncBytes            uint64                  `protobuf:"varint,11,opt,name=sync_bytes" json:"sync_bytes,omitempty"`
+}
+
+func (m *StreamConfig) Reset()                    { *m = StreamConfig{} }
+func (m *StreamConfig) String() string            { return proto.CompactTextString(m) }
+func (*StreamConfig) ProtoMessage()               {}
+func (*StreamConfig) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{53} }
+
+type CreateTopicRequest struct {
+	Topic      string        `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
+	Partitions uint32        `protobuf:"varint,2,opt,name=partitions" json:"partitions,omitempty"`
+	Config     *StreamConfig `protobuf:"bytes,3,opt,name=config" json:"config,omitempty"`
+}
+
+func (m *CreateTopicRequest) Reset()                    { *m = CreateTopicRequest{} }
+func (m *CreateTopicRequest) String() string            { return proto.CompactTextString(m) }
+func (*CreateTopicRequest) ProtoMessage()               {}
+func (*CreateTopicRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{54} }
+
+func (m *CreateTopicRequest) GetConfig() *StreamConfig {
+	if m != nil {
+		return m.Config
+	}
+	return nil
+}
+
+type CreateTopicResponse struct {
+	Streams []string `protobuf:"bytes,1,rep,name=streams" json:"streams,omitempty"`
+}
+
+func (m *CreateTopicResponse) Reset()                    { *m = CreateTopicResponse{} }
+func (m *CreateTopicResponse) String() string            { return proto.CompactTextString(m) }
+func (*CreateTopicResponse) ProtoMessage()               {}
+func (*CreateTopicResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{55} }
+
+type DescribeTopicRequest struct {
+	Topic string `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
+}
+
+func (m *DescribeTopicRequest) Reset()                    { *m = DescribeTopicRequest{} }
+func (m *DescribeTopicRequest) String() string            { return proto.CompactTextString(m) }
+func (*DescribeTopicRequest) ProtoMessage()               {}
+func (*DescribeTopicRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{56} }
+
+type DescribeTopicResponse struct {
+	Partitions uint32   `protobuf:"varint,1,opt,name=partitions" json:"partitions,omitempty"`
+	Streams    []string `protobuf:"bytes,2,rep,name=streams" json:"streams,omitempty"`
+}
+
+func (m *DescribeTopicResponse) Reset()                    { *m = DescribeTopicResponse{} }
+func (m *DescribeTopicResponse) String() string            { return proto.CompactTextString(m) }
+func (*DescribeTopicResponse) ProtoMessage()               {}
+func (*DescribeTopicResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{57} }
+
+type DeleteTopicRequest struct {
+	Topic string `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
+}
+
+func (m *DeleteTopicRequest) Reset()                    { *m = DeleteTopicRequest{} }
+func (m *DeleteTopicRequest) String() string            { return proto.CompactTextString(m) }
+func (*DeleteTopicRequest) ProtoMessage()               {}
+func (*DeleteTopicRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{58} }
+
+type DeleteTopicResponse struct {
+}
+
+func (m *DeleteTopicResponse) Reset()                    { *m = DeleteTopicResponse{} }
+func (m *DeleteTopicResponse) String() string            { return proto.CompactTextString(m) }
+func (*DeleteTopicResponse) ProtoMessage()               {}
+func (*DeleteTopicResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{59} }
+
 func init() {
 	proto.RegisterType((*PingRequest)(nil), "api.PingRequest")
 	proto.RegisterType((*PingResponse)(nil), "api.PingResponse")
 	proto.RegisterType((*WriteRequest)(nil), "api.WriteRequest")
 	proto.RegisterType((*ReadRequest)(nil), "api.ReadRequest")
 	proto.RegisterType((*WriteResponse)(nil), "api.WriteResponse")
+	proto.RegisterType((*ReadResponse)(nil), "api.ReadResponse")
+	proto.RegisterType((*SubscribeRequest)(nil), "api.SubscribeRequest")
+	proto.RegisterType((*SubscribeResponse)(nil), "api.SubscribeResponse")
+	proto.RegisterType((*OffsetForTimeRequest)(nil), "api.OffsetForTimeRequest")
+	proto.RegisterType((*OffsetForTimeResponse)(nil), "api.OffsetForTimeResponse")
+	proto.RegisterType((*RegisterProducerRequest)(nil), "api.RegisterProducerRequest")
+	proto.RegisterType((*RegisterProducerResponse)(nil), "api.RegisterProducerResponse")
+	proto.RegisterType((*WriteTransactionRequest)(nil), "api.WriteTransactionRequest")
+	proto.RegisterType((*TransactionWrite)(nil), "api.TransactionWrite")
+	proto.RegisterType((*WriteTransactionResponse)(nil), "api.WriteTransactionResponse")
+	proto.RegisterType((*WriteTopicRequest)(nil), "api.WriteTopicRequest")
+	proto.RegisterType((*WriteTopicResponse)(nil), "api.WriteTopicResponse")
+	proto.RegisterType((*PartitionWrite)(nil), "api.PartitionWrite")
+	proto.RegisterType((*CommitOffsetRequest)(nil), "api.CommitOffsetRequest")
+	proto.RegisterType((*CommitOffsetResponse)(nil), "api.CommitOffsetResponse")
+	proto.RegisterType((*FetchCommittedOffsetRequest)(nil), "api.FetchCommittedOffsetRequest")
+	proto.RegisterType((*FetchCommittedOffsetResponse)(nil), "api.FetchCommittedOffsetResponse")
+	proto.RegisterType((*JoinGroupRequest)(nil), "api.JoinGroupRequest")
+	proto.RegisterType((*JoinGroupResponse)(nil), "api.JoinGroupResponse")
+	proto.RegisterType((*Assignment)(nil), "api.Assignment")
+	proto.RegisterType((*HeartbeatRequest)(nil), "api.HeartbeatRequest")
+	proto.RegisterType((*HeartbeatResponse)(nil), "api.HeartbeatResponse")
+	proto.RegisterType((*LeaveGroupRequest)(nil), "api.LeaveGroupRequest")
+	proto.RegisterType((*LeaveGroupResponse)(nil), "api.LeaveGroupResponse")
+	proto.RegisterType((*ReplicaFetchRequest)(nil), "api.ReplicaFetchRequest")
+	proto.RegisterType((*ReplicaFetchResponse)(nil), "api.ReplicaFetchResponse")
+	proto.RegisterType((*VoteRequest)(nil), "api.VoteRequest")
+	proto.RegisterType((*VoteResponse)(nil), "api.VoteResponse")
+	proto.RegisterType((*LogEntry)(nil), "api.LogEntry")
+	proto.RegisterType((*AppendEntriesRequest)(nil), "api.AppendEntriesRequest")
+	proto.RegisterType((*AppendEntriesResponse)(nil), "api.AppendEntriesResponse")
+	proto.RegisterType((*StreamProgress)(nil), "api.StreamProgress")
+	proto.RegisterType((*InstallSnapshotRequest)(nil), "api.InstallSnapshotRequest")
+	proto.RegisterType((*InstallSnapshotResponse)(nil), "api.InstallSnapshotResponse")
+	proto.RegisterType((*AssignStreamRequest)(nil), "api.AssignStreamRequest")
+	proto.RegisterType((*AssignStreamResponse)(nil), "api.AssignStreamResponse")
+	proto.RegisterType((*DefineTopicRequest)(nil), "api.DefineTopicRequest")
+	proto.RegisterType((*DefineTopicResponse)(nil), "api.DefineTopicResponse")
+	proto.RegisterType((*ListStreamsRequest)(nil), "api.ListStreamsRequest")
+	proto.RegisterType((*ListStreamsResponse)(nil), "api.ListStreamsResponse")
+	proto.RegisterType((*StatStreamRequest)(nil), "api.StatStreamRequest")
+	proto.RegisterType((*StatStreamResponse)(nil), "api.StatStreamResponse")
+	proto.RegisterType((*DeleteStreamRequest)(nil), "api.DeleteStreamRequest")
+	proto.RegisterType((*DeleteStreamResponse)(nil), "api.DeleteStreamResponse")
+	proto.RegisterType((*TruncateStreamRequest)(nil), "api.TruncateStreamRequest")
+	proto.RegisterType((*TruncateStreamResponse)(nil), "api.TruncateStreamResponse")
+	proto.RegisterType((*CreateStreamRequest)(nil), "api.CreateStreamRequest")
+	proto.RegisterType((*CreateStreamResponse)(nil), "api.CreateStreamResponse")
+	proto.RegisterType((*StreamConfig)(nil), "api.StreamConfig")
+	proto.RegisterType((*CreateTopicRequest)(nil), "api.CreateTopicRequest")
+	proto.RegisterType((*CreateTopicResponse)(nil), "api.CreateTopicResponse")
+	proto.RegisterType((*DescribeTopicRequest)(nil), "api.DescribeTopicRequest")
+	proto.RegisterType((*DescribeTopicResponse)(nil), "api.DescribeTopicResponse")
+	proto.RegisterType((*DeleteTopicRequest)(nil), "api.DeleteTopicRequest")
+	proto.RegisterType((*DeleteTopicResponse)(nil), "api.DeleteTopicResponse")
+	proto.RegisterEnum("api.WriteRequest_Expect", WriteRequest_Expect_name, WriteRequest_Expect_value)
+	proto.RegisterEnum("api.StreamConfig_Durability", StreamConfig_Durability_name, StreamConfig_Durability_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -102,6 +937,17 @@ const _ = grpc.SupportPackageIsVersion3
 
 type StrandClient interface {
 	Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteResponse, error)
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadResponse, error)
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Strand_SubscribeClient, error)
+	OffsetForTime(ctx context.Context, in *OffsetForTimeRequest, opts ...grpc.CallOption) (*OffsetForTimeResponse, error)
+	RegisterProducer(ctx context.Context, in *RegisterProducerRequest, opts ...grpc.CallOption) (*RegisterProducerResponse, error)
+	WriteTransaction(ctx context.Context, in *WriteTransactionRequest, opts ...grpc.CallOption) (*WriteTransactionResponse, error)
+	WriteTopic(ctx context.Context, in *WriteTopicRequest, opts ...grpc.CallOption) (*WriteTopicResponse, error)
+	CommitOffset(ctx context.Context, in *CommitOffsetRequest, opts ...grpc.CallOption) (*CommitOffsetResponse, error)
+	FetchCommittedOffset(ctx context.Context, in *FetchCommittedOffsetRequest, opts ...grpc.CallOption) (*FetchCommittedOffsetResponse, error)
+	JoinGroup(ctx context.Context, in *JoinGroupRequest, opts ...grpc.CallOption) (*JoinGroupResponse, error)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	LeaveGroup(ctx context.Context, in *LeaveGroupRequest, opts ...grpc.CallOption) (*LeaveGroupResponse, error)
 	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
 }
 
@@ -122,33 +968,166 @@ func (c *strandClient) Write(ctx context.Context, in *WriteRequest, opts ...grpc
 	return out, nil
 }
 
-func (c *strandClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error) {
-	out := new(PingResponse)
-	err := grpc.Invoke(ctx, "/api.Strand/Ping", in, out, c.cc, opts...)
+func (c *strandClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadResponse, error) {
+	out := new(ReadResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/Read", in, out, c.cc, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-// Server API for Strand service
+func (c *strandClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Strand_SubscribeClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Strand_serviceDesc.Streams[0], c.cc, "/api.Strand/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &strandSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
 
-type StrandServer interface {
-	Write(context.Context, *WriteRequest) (*WriteResponse, error)
-	Ping(context.Context, *PingRequest) (*PingResponse, error)
+type Strand_SubscribeClient interface {
+	Recv() (*SubscribeResponse, error)
+	grpc.ClientStream
 }
 
-func RegisterStrandServer(s *grpc.Server, srv StrandServer) {
-	s.RegisterService(&_Strand_serviceDesc, srv)
+type strandSubscribeClient struct {
+	grpc.ClientStream
 }
 
-func _Strand_Write_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(WriteRequest)
-	if err := dec(in); err != nil {
+func (x *strandSubscribeClient) Recv() (*SubscribeResponse, error) {
+	m := new(SubscribeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
-	if interceptor == nil {
-		return srv.(StrandServer).Write(ctx, in)
+	return m, nil
+}
+
+func (c *strandClient) OffsetForTime(ctx context.Context, in *OffsetForTimeRequest, opts ...grpc.CallOption) (*OffsetForTimeResponse, error) {
+	out := new(OffsetForTimeResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/OffsetForTime", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) RegisterProducer(ctx context.Context, in *RegisterProducerRequest, opts ...grpc.CallOption) (*RegisterProducerResponse, error) {
+	out := new(RegisterProducerResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/RegisterProducer", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) WriteTransaction(ctx context.Context, in *WriteTransactionRequest, opts ...grpc.CallOption) (*WriteTransactionResponse, error) {
+	out := new(WriteTransactionResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/WriteTransaction", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) WriteTopic(ctx context.Context, in *WriteTopicRequest, opts ...grpc.CallOption) (*WriteTopicResponse, error) {
+	out := new(WriteTopicResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/WriteTopic", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) CommitOffset(ctx context.Context, in *CommitOffsetRequest, opts ...grpc.CallOption) (*CommitOffsetResponse, error) {
+	out := new(CommitOffsetResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/CommitOffset", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) FetchCommittedOffset(ctx context.Context, in *FetchCommittedOffsetRequest, opts ...grpc.CallOption) (*FetchCommittedOffsetResponse, error) {
+	out := new(FetchCommittedOffsetResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/FetchCommittedOffset", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) JoinGroup(ctx context.Context, in *JoinGroupRequest, opts ...grpc.CallOption) (*JoinGroupResponse, error) {
+	out := new(JoinGroupResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/JoinGroup", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	out := new(HeartbeatResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/Heartbeat", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) LeaveGroup(ctx context.Context, in *LeaveGroupRequest, opts ...grpc.CallOption) (*LeaveGroupResponse, error) {
+	out := new(LeaveGroupResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/LeaveGroup", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *strandClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error) {
+	out := new(PingResponse)
+	err := grpc.Invoke(ctx, "/api.Strand/Ping", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Strand service
+
+type StrandServer interface {
+	Write(context.Context, *WriteRequest) (*WriteResponse, error)
+	Read(context.Context, *ReadRequest) (*ReadResponse, error)
+	Subscribe(*SubscribeRequest, Strand_SubscribeServer) error
+	OffsetForTime(context.Context, *OffsetForTimeRequest) (*OffsetForTimeResponse, error)
+	RegisterProducer(context.Context, *RegisterProducerRequest) (*RegisterProducerResponse, error)
+	WriteTransaction(context.Context, *WriteTransactionRequest) (*WriteTransactionResponse, error)
+	WriteTopic(context.Context, *WriteTopicRequest) (*WriteTopicResponse, error)
+	CommitOffset(context.Context, *CommitOffsetRequest) (*CommitOffsetResponse, error)
+	FetchCommittedOffset(context.Context, *FetchCommittedOffsetRequest) (*FetchCommittedOffsetResponse, error)
+	JoinGroup(context.Context, *JoinGroupRequest) (*JoinGroupResponse, error)
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	LeaveGroup(context.Context, *LeaveGroupRequest) (*LeaveGroupResponse, error)
+	Ping(context.Context, *PingRequest) (*PingResponse, error)
+}
+
+func RegisterStrandServer(s *grpc.Server, srv StrandServer) {
+	s.RegisterService(&_Strand_serviceDesc, srv)
+}
+
+func _Strand_Write_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).Write(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
@@ -160,6 +1139,207 @@ func _Strand_Write_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Strand_Read_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).Read(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/Read",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).Read(ctx, req.(*ReadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StrandServer).Subscribe(m, &strandSubscribeServer{stream})
+}
+
+type Strand_SubscribeServer interface {
+	Send(*SubscribeResponse) error
+	grpc.ServerStream
+}
+
+type strandSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *strandSubscribeServer) Send(m *SubscribeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Strand_OffsetForTime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OffsetForTimeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).OffsetForTime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/OffsetForTime",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).OffsetForTime(ctx, req.(*OffsetForTimeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_RegisterProducer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterProducerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).RegisterProducer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/RegisterProducer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).RegisterProducer(ctx, req.(*RegisterProducerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_WriteTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).WriteTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/WriteTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).WriteTransaction(ctx, req.(*WriteTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_WriteTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).WriteTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/WriteTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).WriteTopic(ctx, req.(*WriteTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_CommitOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).CommitOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/CommitOffset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).CommitOffset(ctx, req.(*CommitOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_FetchCommittedOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FetchCommittedOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).FetchCommittedOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/FetchCommittedOffset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).FetchCommittedOffset(ctx, req.(*FetchCommittedOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_JoinGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JoinGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).JoinGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/JoinGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).JoinGroup(ctx, req.(*JoinGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Strand_LeaveGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaveGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StrandServer).LeaveGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Strand/LeaveGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StrandServer).LeaveGroup(ctx, req.(*LeaveGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Strand_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(PingRequest)
 	if err := dec(in); err != nil {
@@ -186,11 +1366,612 @@ var _Strand_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Write",
 			Handler:    _Strand_Write_Handler,
 		},
+		{
+			MethodName: "Read",
+			Handler:    _Strand_Read_Handler,
+		},
+		{
+			MethodName: "OffsetForTime",
+			Handler:    _Strand_OffsetForTime_Handler,
+		},
+		{
+			MethodName: "RegisterProducer",
+			Handler:    _Strand_RegisterProducer_Handler,
+		},
+		{
+			MethodName: "WriteTransaction",
+			Handler:    _Strand_WriteTransaction_Handler,
+		},
+		{
+			MethodName: "WriteTopic",
+			Handler:    _Strand_WriteTopic_Handler,
+		},
+		{
+			MethodName: "CommitOffset",
+			Handler:    _Strand_CommitOffset_Handler,
+		},
+		{
+			MethodName: "FetchCommittedOffset",
+			Handler:    _Strand_FetchCommittedOffset_Handler,
+		},
+		{
+			MethodName: "JoinGroup",
+			Handler:    _Strand_JoinGroup_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _Strand_Heartbeat_Handler,
+		},
+		{
+			MethodName: "LeaveGroup",
+			Handler:    _Strand_LeaveGroup_Handler,
+		},
 		{
 			MethodName: "Ping",
 			Handler:    _Strand_Ping_Handler,
 		},
 	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Strand_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: fileDescriptor0,
+}
+
+// Client API for Replication service
+
+type ReplicationClient interface {
+	Fetch(ctx context.Context, in *ReplicaFetchRequest, opts ...grpc.CallOption) (*ReplicaFetchResponse, error)
+}
+
+type replicationClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewReplicationClient(cc *grpc.ClientConn) ReplicationClient {
+	return &replicationClient{cc}
+}
+
+func (c *replicationClient) Fetch(ctx context.Context, in *ReplicaFetchRequest, opts ...grpc.CallOption) (*ReplicaFetchResponse, error) {
+	out := new(ReplicaFetchResponse)
+	err := grpc.Invoke(ctx, "/api.Replication/Fetch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Replication service
+
+type ReplicationServer interface {
+	Fetch(context.Context, *ReplicaFetchRequest) (*ReplicaFetchResponse, error)
+}
+
+func RegisterReplicationServer(s *grpc.Server, srv ReplicationServer) {
+	s.RegisterService(&_Replication_serviceDesc, srv)
+}
+
+func _Replication_Fetch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplicaFetchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).Fetch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Replication/Fetch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).Fetch(ctx, req.(*ReplicaFetchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Replication_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "api.Replication",
+	HandlerType: (*ReplicationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Fetch",
+			Handler:    _Replication_Fetch_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: fileDescriptor0,
+}
+
+// Client API for Cluster service
+
+type ClusterClient interface {
+	RequestVote(ctx context.Context, in *VoteRequest, opts ...grpc.CallOption) (*VoteResponse, error)
+	AppendEntries(ctx context.Context, in *AppendEntriesRequest, opts ...grpc.CallOption) (*AppendEntriesResponse, error)
+	AssignStream(ctx context.Context, in *AssignStreamRequest, opts ...grpc.CallOption) (*AssignStreamResponse, error)
+	InstallSnapshot(ctx context.Context, in *InstallSnapshotRequest, opts ...grpc.CallOption) (*InstallSnapshotResponse, error)
+	DefineTopic(ctx context.Context, in *DefineTopicRequest, opts ...grpc.CallOption) (*DefineTopicResponse, error)
+}
+
+type clusterClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewClusterClient(cc *grpc.ClientConn) ClusterClient {
+	return &clusterClient{cc}
+}
+
+func (c *clusterClient) RequestVote(ctx context.Context, in *VoteRequest, opts ...grpc.CallOption) (*VoteResponse, error) {
+	out := new(VoteResponse)
+	err := grpc.Invoke(ctx, "/api.Cluster/RequestVote", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) AppendEntries(ctx context.Context, in *AppendEntriesRequest, opts ...grpc.CallOption) (*AppendEntriesResponse, error) {
+	out := new(AppendEntriesResponse)
+	err := grpc.Invoke(ctx, "/api.Cluster/AppendEntries", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) AssignStream(ctx context.Context, in *AssignStreamRequest, opts ...grpc.CallOption) (*AssignStreamResponse, error) {
+	out := new(AssignStreamResponse)
+	err := grpc.Invoke(ctx, "/api.Cluster/AssignStream", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) InstallSnapshot(ctx context.Context, in *InstallSnapshotRequest, opts ...grpc.CallOption) (*InstallSnapshotResponse, error) {
+	out := new(InstallSnapshotResponse)
+	err := grpc.Invoke(ctx, "/api.Cluster/InstallSnapshot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) DefineTopic(ctx context.Context, in *DefineTopicRequest, opts ...grpc.CallOption) (*DefineTopicResponse, error) {
+	out := new(DefineTopicResponse)
+	err := grpc.Invoke(ctx, "/api.Cluster/DefineTopic", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Cluster service
+
+type ClusterServer interface {
+	RequestVote(context.Context, *VoteRequest) (*VoteResponse, error)
+	AppendEntries(context.Context, *AppendEntriesRequest) (*AppendEntriesResponse, error)
+	AssignStream(context.Context, *AssignStreamRequest) (*AssignStreamResponse, error)
+	InstallSnapshot(context.Context, *InstallSnapshotRequest) (*InstallSnapshotResponse, error)
+	DefineTopic(context.Context, *DefineTopicRequest) (*DefineTopicResponse, error)
+}
+
+func RegisterClusterServer(s *grpc.Server, srv ClusterServer) {
+	s.RegisterService(&_Cluster_serviceDesc, srv)
+}
+
+func _Cluster_RequestVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).RequestVote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Cluster/RequestVote",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).RequestVote(ctx, req.(*VoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_AppendEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendEntriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).AppendEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Cluster/AppendEntries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).AppendEntries(ctx, req.(*AppendEntriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_AssignStream_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AssignStreamRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).AssignStream(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Cluster/AssignStream",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).AssignStream(ctx, req.(*AssignStreamRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_InstallSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstallSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).InstallSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Cluster/InstallSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).InstallSnapshot(ctx, req.(*InstallSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_DefineTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DefineTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).DefineTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Cluster/DefineTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).DefineTopic(ctx, req.(*DefineTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Cluster_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "api.Cluster",
+	HandlerType: (*ClusterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RequestVote",
+			Handler:    _Cluster_RequestVote_Handler,
+		},
+		{
+			MethodName: "AppendEntries",
+			Handler:    _Cluster_AppendEntries_Handler,
+		},
+		{
+			MethodName: "AssignStream",
+			Handler:    _Cluster_AssignStream_Handler,
+		},
+		{
+			MethodName: "InstallSnapshot",
+			Handler:    _Cluster_InstallSnapshot_Handler,
+		},
+		{
+			MethodName: "DefineTopic",
+			Handler:    _Cluster_DefineTopic_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: fileDescriptor0,
+}
+
+// Client API for Admin service
+
+type AdminClient interface {
+	CreateStream(ctx context.Context, in *CreateStreamRequest, opts ...grpc.CallOption) (*CreateStreamResponse, error)
+	ListStreams(ctx context.Context, in *ListStreamsRequest, opts ...grpc.CallOption) (*ListStreamsResponse, error)
+	StatStream(ctx context.Context, in *StatStreamRequest, opts ...grpc.CallOption) (*StatStreamResponse, error)
+	DeleteStream(ctx context.Context, in *DeleteStreamRequest, opts ...grpc.CallOption) (*DeleteStreamResponse, error)
+	TruncateStream(ctx context.Context, in *TruncateStreamRequest, opts ...grpc.CallOption) (*TruncateStreamResponse, error)
+	CreateTopic(ctx context.Context, in *CreateTopicRequest, opts ...grpc.CallOption) (*CreateTopicResponse, error)
+	DescribeTopic(ctx context.Context, in *DescribeTopicRequest, opts ...grpc.CallOption) (*DescribeTopicResponse, error)
+	DeleteTopic(ctx context.Context, in *DeleteTopicRequest, opts ...grpc.CallOption) (*DeleteTopicResponse, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) CreateStream(ctx context.Context, in *CreateStreamRequest, opts ...grpc.CallOption) (*CreateStreamResponse, error) {
+	out := new(CreateStreamResponse)
+	err := grpc.Invoke(ctx, "/api.Admin/CreateStream", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListStreams(ctx context.Context, in *ListStreamsRequest, opts ...grpc.CallOption) (*ListStreamsResponse, error) {
+	out := new(ListStreamsResponse)
+	err := grpc.Invoke(ctx, "/api.Admin/ListStreams", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) StatStream(ctx context.Context, in *StatStreamRequest, opts ...grpc.CallOption) (*StatStreamResponse, error) {
+	out := new(StatStreamResponse)
+	err := grpc.Invoke(ctx, "/api.Admin/StatStream", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeleteStream(ctx context.Context, in *DeleteStreamRequest, opts ...grpc.CallOption) (*DeleteStreamResponse, error) {
+	out := new(DeleteStreamResponse)
+	err := grpc.Invoke(ctx, "/api.Admin/DeleteStream", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TruncateStream(ctx context.Context, in *TruncateStreamRequest, opts ...grpc.CallOption) (*TruncateStreamResponse, error) {
+	out := new(TruncateStreamResponse)
+	err := grpc.Invoke(ctx, "/api.Admin/TruncateStream", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) CreateTopic(ctx context.Context, in *CreateTopicRequest, opts ...grpc.CallOption) (*CreateTopicResponse, error) {
+	out := new(CreateTopicResponse)
+	err := grpc.Invoke(ctx, "/api.Admin/CreateTopic", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DescribeTopic(ctx context.Context, in *DescribeTopicRequest, opts ...grpc.CallOption) (*DescribeTopicResponse, error) {
+	out := new(DescribeTopicResponse)
+	err := grpc.Invoke(ctx, "/api.Admin/DescribeTopic", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeleteTopic(ctx context.Context, in *DeleteTopicRequest, opts ...grpc.CallOption) (*DeleteTopicResponse, error) {
+	out := new(DeleteTopicResponse)
+	err := grpc.Invoke(ctx, "/api.Admin/DeleteTopic", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Admin service
+
+type AdminServer interface {
+	CreateStream(context.Context, *CreateStreamRequest) (*CreateStreamResponse, error)
+	ListStreams(context.Context, *ListStreamsRequest) (*ListStreamsResponse, error)
+	StatStream(context.Context, *StatStreamRequest) (*StatStreamResponse, error)
+	DeleteStream(context.Context, *DeleteStreamRequest) (*DeleteStreamResponse, error)
+	TruncateStream(context.Context, *TruncateStreamRequest) (*TruncateStreamResponse, error)
+	CreateTopic(context.Context, *CreateTopicRequest) (*CreateTopicResponse, error)
+	DescribeTopic(context.Context, *DescribeTopicRequest) (*DescribeTopicResponse, error)
+	DeleteTopic(context.Context, *DeleteTopicRequest) (*DeleteTopicResponse, error)
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_CreateStream_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateStreamRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).CreateStream(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Admin/CreateStream",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).CreateStream(ctx, req.(*CreateStreamRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListStreams_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListStreamsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListStreams(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Admin/ListStreams",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListStreams(ctx, req.(*ListStreamsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_StatStream_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatStreamRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).StatStream(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Admin/StatStream",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).StatStream(ctx, req.(*StatStreamRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DeleteStream_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteStreamRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteStream(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Admin/DeleteStream",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteStream(ctx, req.(*DeleteStreamRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_TruncateStream_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TruncateStreamRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).TruncateStream(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Admin/TruncateStream",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).TruncateStream(ctx, req.(*TruncateStreamRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_CreateTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).CreateTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Admin/CreateTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).CreateTopic(ctx, req.(*CreateTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DescribeTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DescribeTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Admin/DescribeTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DescribeTopic(ctx, req.(*DescribeTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DeleteTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.Admin/DeleteTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteTopic(ctx, req.(*DeleteTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "api.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateStream",
+			Handler:    _Admin_CreateStream_Handler,
+		},
+		{
+			MethodName: "ListStreams",
+			Handler:    _Admin_ListStreams_Handler,
+		},
+		{
+			MethodName: "StatStream",
+			Handler:    _Admin_StatStream_Handler,
+		},
+		{
+			MethodName: "DeleteStream",
+			Handler:    _Admin_DeleteStream_Handler,
+		},
+		{
+			MethodName: "TruncateStream",
+			Handler:    _Admin_TruncateStream_Handler,
+		},
+		{
+			MethodName: "CreateTopic",
+			Handler:    _Admin_CreateTopic_Handler,
+		},
+		{
+			MethodName: "DescribeTopic",
+			Handler:    _Admin_DescribeTopic_Handler,
+		},
+		{
+			MethodName: "DeleteTopic",
+			Handler:    _Admin_DeleteTopic_Handler,
+		},
+	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: fileDescriptor0,
 }
@@ -198,18 +1979,134 @@ var _Strand_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("strand.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 198 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x74, 0x90, 0x41, 0x6b, 0x84, 0x30,
-	0x10, 0x85, 0xd1, 0x5a, 0xb1, 0x63, 0x14, 0x9d, 0x93, 0xd8, 0x4b, 0xc9, 0xa9, 0x50, 0x1a, 0x4a,
-	0xfb, 0x47, 0x8a, 0x3d, 0xf4, 0x9c, 0xc5, 0x51, 0x64, 0xd1, 0xb8, 0x4e, 0xf6, 0xff, 0x6f, 0x36,
-	0x7a, 0xc8, 0x65, 0x8f, 0xf3, 0xe6, 0xcb, 0xbc, 0xf7, 0x02, 0x82, 0xed, 0xa6, 0x97, 0x5e, 0xad,
-	0x9b, 0xb1, 0x06, 0x9f, 0xf4, 0x3a, 0xc9, 0x02, 0xf2, 0xdf, 0x69, 0x19, 0x3b, 0xba, 0x5c, 0x89,
-	0xad, 0x2c, 0x41, 0xec, 0x23, 0xaf, 0x66, 0x61, 0x92, 0x5f, 0x20, 0xfe, 0xb7, 0xc9, 0xd2, 0xb1,
-	0xc7, 0x12, 0x52, 0x77, 0x83, 0xf4, 0xdc, 0x44, 0x6f, 0xd1, 0xfb, 0x0b, 0x56, 0x90, 0xcd, 0xc4,
-	0xac, 0x47, 0xe2, 0x26, 0x76, 0x8a, 0x90, 0x9f, 0x90, 0x77, 0xa4, 0xfb, 0x47, 0x0f, 0xdc, 0x6c,
-	0x86, 0x81, 0xc9, 0x7a, 0x3c, 0x91, 0xaf, 0x50, 0x1c, 0x06, 0xbb, 0x23, 0x02, 0xc4, 0xe6, 0xec,
-	0xe1, 0xec, 0x9b, 0x20, 0xfd, 0xf3, 0x89, 0x51, 0xc1, 0xb3, 0xc7, 0xb0, 0x56, 0x2e, 0xb5, 0x0a,
-	0x33, 0xb5, 0x18, 0x4a, 0xc7, 0x95, 0x0f, 0x48, 0xee, 0x3d, 0xb0, 0xf2, 0xbb, 0xa0, 0x61, 0x5b,
-	0x07, 0xca, 0x0e, 0x9f, 0x52, 0xff, 0x1f, 0x3f, 0xb7, 0x00, 0x00, 0x00, 0xff, 0xff, 0x12, 0x85,
-	0x21, 0x7d, 0x1f, 0x01, 0x00, 0x00,
+	// 2064 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x59, 0xdd, 0x72, 0x1b, 0x49,
+	0x15, 0xde, 0xf1, 0x48, 0xb2, 0x74, 0x24, 0xd9, 0x52, 0x4b, 0x96, 0xc7, 0xe3, 0x84, 0x72, 0x26,
+	0x1b, 0x62, 0x0a, 0x30, 0xc1, 0xb0, 0xb5, 0xb0, 0x95, 0x85, 0x75, 0x39, 0xf6, 0x6e, 0x88, 0xb1,
+	0x5d, 0xb6, 0x37, 0x5b, 0x81, 0x5a, 0x44, 0x7b, 0xa6, 0xad, 0x0c, 0xd1, 0xfc, 0x30, 0xdd, 0x4a,
+	0x6c, 0x5e, 0x80, 0x0b, 0x9e, 0x81, 0x07, 0xe0, 0x01, 0x78, 0x11, 0x2e, 0xb9, 0xe6, 0x41, 0xa8,
+	0xfe, 0xd1, 0x4c, 0xcf, 0x8f, 0x94, 0xe4, 0x52, 0xe7, 0x74, 0x9f, 0xf3, 0x9d, 0xd3, 0xe7, 0x77,
+	0x04, 0x1d, 0xca, 0x12, 0x1c, 0x7a, 0x7b, 0x71, 0x12, 0xb1, 0x08, 0x99, 0x38, 0xf6, 0x9d, 0x2e,
+	0xb4, 0xcf, 0xfd, 0x70, 0x72, 0x41, 0xfe, 0x3a, 0x23, 0x94, 0x39, 0x6b, 0xd0, 0x91, 0x3f, 0x69,
+	0x1c, 0x85, 0x94, 0x38, 0xff, 0x33, 0xa0, 0xf3, 0x5d, 0xe2, 0x33, 0xa2, 0x0e, 0xa0, 0x35, 0x68,
+	0x50, 0x96, 0x10, 0x1c, 0x58, 0xc6, 0x8e, 0xb1, 0xdb, 0x42, 0x3d, 0x68, 0x06, 0x84, 0x52, 0x3c,
+	0x21, 0xd4, 0x5a, 0xd9, 0x31, 0x76, 0x3b, 0xa8, 0x03, 0x35, 0x7a, 0x17, 0xba, 0x96, 0xb9, 0x63,
+	0xec, 0x36, 0xd1, 0x2e, 0x34, 0xc8, 0x6d, 0x4c, 0x5c, 0x66, 0xd5, 0x76, 0x8c, 0xdd, 0xb5, 0x7d,
+	0x6b, 0x0f, 0xc7, 0xfe, 0x9e, 0x2e, 0x72, 0xef, 0x48, 0xf0, 0xd1, 0x26, 0xac, 0xcb, 0x93, 0xc4,
+	0x1b, 0x47, 0x37, 0x37, 0x94, 0x30, 0xab, 0xbe, 0x63, 0xec, 0xd6, 0xd0, 0x00, 0xda, 0x71, 0x12,
+	0x79, 0x33, 0x97, 0x24, 0x63, 0xdf, 0xb3, 0x1a, 0x82, 0xd8, 0x83, 0x26, 0xe5, 0xf7, 0x43, 0x97,
+	0x58, 0xab, 0x82, 0xd2, 0x81, 0x1a, 0x76, 0xdf, 0x50, 0xab, 0xb9, 0x63, 0xec, 0x76, 0x9d, 0x9f,
+	0x40, 0x43, 0xc9, 0x5d, 0x05, 0xf3, 0xe0, 0xf4, 0x55, 0xef, 0x13, 0x04, 0xd0, 0x38, 0x3b, 0x3e,
+	0xbe, 0x3c, 0xba, 0xea, 0x19, 0xa8, 0x0b, 0xad, 0xd3, 0xb3, 0xf1, 0xe5, 0xd5, 0xc5, 0xd1, 0xc1,
+	0xef, 0x7b, 0x2b, 0xce, 0x5f, 0xa0, 0x7d, 0x41, 0xb0, 0xb7, 0xc8, 0xc8, 0x35, 0x68, 0x28, 0x44,
+	0x2b, 0x42, 0xd5, 0x10, 0x3a, 0x01, 0xbe, 0x1d, 0xa7, 0x86, 0x73, 0x53, 0xbb, 0xa8, 0x0f, 0x2d,
+	0x4e, 0xbd, 0xbe, 0x63, 0x84, 0x0a, 0x6b, 0xbb, 0x08, 0x01, 0xb8, 0x51, 0x10, 0x27, 0x84, 0x52,
+	0xe2, 0x09, 0x73, 0x9a, 0xce, 0xf7, 0xd0, 0x55, 0xe6, 0x4b, 0x1f, 0x23, 0x80, 0x95, 0xe8, 0x8d,
+	0xd0, 0xd4, 0xe4, 0x92, 0x6f, 0xfc, 0x84, 0xb2, 0x71, 0x4e, 0xdf, 0x00, 0xda, 0x53, 0x9c, 0x11,
+	0x4d, 0x41, 0xdc, 0x80, 0xae, 0x02, 0x30, 0x76, 0xa3, 0x59, 0x28, 0x1d, 0xdc, 0x75, 0x3e, 0x83,
+	0x8e, 0x34, 0x45, 0x49, 0xd7, 0x1f, 0xc8, 0x10, 0x0f, 0x34, 0x80, 0x76, 0x48, 0x6e, 0xf3, 0x2a,
+	0x9c, 0x3f, 0x41, 0xef, 0x72, 0x76, 0x4d, 0xdd, 0xc4, 0xbf, 0x5e, 0xf8, 0xd6, 0x03, 0x68, 0xdf,
+	0x24, 0x51, 0x90, 0xc7, 0x96, 0xb3, 0xda, 0xac, 0xb0, 0xba, 0x26, 0xac, 0xfe, 0x02, 0xfa, 0x9a,
+	0xfc, 0x8f, 0xc3, 0xf6, 0x6b, 0x18, 0x9e, 0x89, 0xdf, 0xc7, 0x51, 0x72, 0xe5, 0x07, 0x0b, 0xf1,
+	0xf5, 0xa1, 0xc5, 0xfc, 0x80, 0x50, 0x86, 0x83, 0x58, 0x5c, 0x35, 0x9d, 0xc7, 0xb0, 0x51, 0xb8,
+	0xaa, 0x54, 0x67, 0x4f, 0x6a, 0x08, 0x1d, 0x5b, 0xb0, 0x79, 0x41, 0x26, 0x3e, 0x65, 0x24, 0x39,
+	0x57, 0xc1, 0x36, 0xcf, 0x89, 0x9f, 0x81, 0x55, 0x66, 0x29, 0x31, 0x85, 0xd8, 0x94, 0xb2, 0xbe,
+	0x82, 0x4d, 0xf1, 0xc2, 0x57, 0x09, 0x0e, 0x29, 0x76, 0x99, 0x1f, 0x85, 0x73, 0xc8, 0x8f, 0xa0,
+	0xf1, 0x8e, 0xb3, 0xb8, 0xbd, 0xe6, 0x6e, 0x7b, 0x7f, 0x43, 0xa4, 0x83, 0x76, 0x50, 0x5c, 0x74,
+	0x7e, 0x09, 0xbd, 0x22, 0xed, 0xfd, 0x99, 0xe7, 0xfc, 0x06, 0xac, 0xb2, 0x5e, 0x05, 0xd4, 0x29,
+	0x28, 0x46, 0x7a, 0x1e, 0xaa, 0x64, 0x3f, 0x87, 0xbe, 0xbc, 0x1f, 0xc5, 0xbe, 0x3b, 0x47, 0xdc,
+	0x85, 0x3a, 0xe3, 0xbf, 0x3f, 0x30, 0xdf, 0xe7, 0x59, 0x28, 0x83, 0xf1, 0x4b, 0x40, 0xba, 0x44,
+	0x85, 0xe5, 0x31, 0x40, 0x8c, 0x13, 0xe6, 0x73, 0x80, 0x73, 0x3c, 0x03, 0x81, 0xe7, 0x7c, 0x4e,
+	0x96, 0x6e, 0x78, 0x09, 0x6b, 0x79, 0x0a, 0x7f, 0xe2, 0xf4, 0xaa, 0x40, 0xd4, 0xd5, 0xfc, 0xb2,
+	0x22, 0x10, 0x3e, 0x80, 0xba, 0xb0, 0x54, 0x00, 0xaa, 0x36, 0xf4, 0x25, 0x0c, 0x0e, 0xa3, 0x20,
+	0xf0, 0x99, 0x8c, 0x0d, 0xcd, 0xd4, 0x49, 0x12, 0xcd, 0xe2, 0x2c, 0xeb, 0x73, 0x82, 0xb3, 0x90,
+	0x31, 0xe7, 0x25, 0x28, 0x20, 0x0c, 0x7b, 0x98, 0x61, 0x61, 0x6e, 0xcb, 0xf9, 0x11, 0x0c, 0xf3,
+	0x72, 0x95, 0xc1, 0xb9, 0xc0, 0x34, 0x44, 0x60, 0x3e, 0x85, 0xed, 0x63, 0xc2, 0xdc, 0xd7, 0xf2,
+	0x3c, 0x23, 0xde, 0xc7, 0x40, 0x71, 0xae, 0xe1, 0x5e, 0xf5, 0x6d, 0xa5, 0xb0, 0x0b, 0xf5, 0x9b,
+	0x68, 0x16, 0x7a, 0xaa, 0xaa, 0x14, 0xeb, 0x97, 0x8e, 0xdc, 0x2c, 0xa7, 0x4e, 0x4d, 0x20, 0xfc,
+	0x1e, 0x7a, 0xbf, 0x8b, 0xfc, 0xf0, 0x6b, 0x0e, 0x63, 0x31, 0xac, 0x38, 0x21, 0x37, 0xfe, 0xad,
+	0xf2, 0x10, 0xaf, 0x05, 0x24, 0xb8, 0x96, 0xb9, 0x20, 0x05, 0x6f, 0xc2, 0x3a, 0x25, 0x94, 0xfa,
+	0x51, 0x38, 0xe6, 0x0a, 0xa2, 0x19, 0x53, 0xe2, 0x5f, 0x40, 0x5f, 0x13, 0x9f, 0x39, 0x2a, 0x13,
+	0x20, 0x75, 0x3c, 0x04, 0xc0, 0x94, 0xfa, 0x93, 0x30, 0x20, 0xa1, 0xc4, 0xdf, 0xde, 0x5f, 0x17,
+	0x6f, 0x7a, 0x90, 0x92, 0x9d, 0x9f, 0x03, 0x64, 0xbf, 0x78, 0xfd, 0x99, 0x90, 0x90, 0x24, 0x38,
+	0x8d, 0x92, 0x1a, 0x5a, 0x87, 0x55, 0xe9, 0x41, 0x1e, 0xb6, 0xe6, 0x6e, 0x8b, 0xa7, 0xd8, 0x37,
+	0x04, 0x27, 0xec, 0x9a, 0xe0, 0x45, 0x5e, 0xcf, 0xa1, 0x91, 0x8e, 0xff, 0x15, 0xf4, 0xb5, 0x5b,
+	0x0a, 0x75, 0x1e, 0xa2, 0x51, 0x0d, 0xf1, 0x33, 0xe8, 0x9f, 0x10, 0xfc, 0x96, 0x2c, 0xf3, 0x67,
+	0x85, 0xc2, 0x21, 0x20, 0xfd, 0x9a, 0x0a, 0xe0, 0xbf, 0x1b, 0x30, 0xb8, 0x20, 0xf1, 0xd4, 0x77,
+	0xb1, 0x88, 0x83, 0xb9, 0x3c, 0x5e, 0xa1, 0xa3, 0xe9, 0x34, 0x7a, 0xa7, 0x7b, 0xf0, 0x7d, 0x71,
+	0x5c, 0xd1, 0xb7, 0x78, 0x80, 0xe0, 0xdb, 0xf1, 0x3b, 0xec, 0xcb, 0x26, 0x6c, 0xa2, 0x11, 0xac,
+	0xf9, 0xa1, 0x3b, 0x9d, 0x79, 0xbc, 0xdb, 0x84, 0x37, 0xfe, 0x44, 0xf4, 0xe1, 0xa6, 0x33, 0x83,
+	0x61, 0x1e, 0xc8, 0x47, 0x95, 0x76, 0x4e, 0x7c, 0x4d, 0xb0, 0x97, 0xef, 0x6c, 0x0f, 0xa0, 0xa1,
+	0x74, 0xd4, 0x84, 0x2f, 0xfb, 0xc2, 0x97, 0x97, 0xc2, 0x86, 0x43, 0xc1, 0x70, 0xfe, 0x0c, 0xed,
+	0x97, 0x51, 0x36, 0x95, 0x74, 0xa0, 0xc6, 0x48, 0x12, 0xa8, 0xb7, 0x1e, 0x42, 0xc7, 0xc5, 0xa1,
+	0xe7, 0x7b, 0x98, 0x91, 0xd4, 0x93, 0xdc, 0x02, 0xd1, 0x44, 0xa7, 0xd1, 0x64, 0xec, 0x87, 0x1e,
+	0xb9, 0xcd, 0xfa, 0x68, 0x4a, 0x17, 0x42, 0x6a, 0xa2, 0x88, 0xff, 0x14, 0x3a, 0x52, 0x83, 0x32,
+	0x28, 0xaf, 0x62, 0x1d, 0x56, 0x27, 0x09, 0x0e, 0x19, 0x91, 0xd2, 0x9b, 0xce, 0x2b, 0x68, 0x9e,
+	0x44, 0x93, 0xa3, 0x90, 0x25, 0x77, 0x85, 0xa3, 0x45, 0xf7, 0x77, 0xa0, 0x16, 0x46, 0x1e, 0x51,
+	0xf9, 0x91, 0x96, 0x57, 0x51, 0x41, 0x78, 0xe8, 0x6a, 0xa5, 0xb1, 0x2e, 0x8a, 0xe8, 0x3f, 0x0d,
+	0x18, 0x1e, 0xc4, 0x31, 0x09, 0x3d, 0x2e, 0xde, 0x27, 0xb4, 0xda, 0xea, 0x3e, 0xb4, 0xa6, 0x04,
+	0x7b, 0x24, 0xc9, 0x99, 0x1c, 0x27, 0xe4, 0x6d, 0x95, 0xc9, 0x29, 0x3d, 0x33, 0x19, 0xfd, 0x00,
+	0x56, 0x89, 0xd4, 0x60, 0xd5, 0x45, 0x51, 0xee, 0x0a, 0xc7, 0xa7, 0x76, 0x71, 0x4f, 0x49, 0x0d,
+	0xae, 0xa8, 0x3b, 0x72, 0x14, 0x73, 0x12, 0xd8, 0x28, 0xc0, 0x5b, 0xe4, 0x32, 0x3a, 0x73, 0x5d,
+	0x42, 0x65, 0xe3, 0x68, 0xf2, 0xb7, 0x0f, 0x30, 0x73, 0x5f, 0xe7, 0xa0, 0x3d, 0x82, 0x66, 0x9c,
+	0x44, 0x93, 0x84, 0x1f, 0xab, 0x69, 0x9d, 0x41, 0xbe, 0xfe, 0xb9, 0x62, 0x39, 0x4f, 0x60, 0x2d,
+	0x4f, 0x79, 0xdf, 0xcc, 0xe6, 0xfc, 0xdb, 0x80, 0xd1, 0xf3, 0x90, 0x32, 0x3c, 0x9d, 0x5e, 0x86,
+	0x38, 0xa6, 0xaf, 0x23, 0xf6, 0xc1, 0x7e, 0xdc, 0x86, 0x81, 0x08, 0x11, 0x95, 0x01, 0x5e, 0x0e,
+	0xb1, 0x0d, 0x28, 0xcf, 0xd4, 0x3c, 0xea, 0x40, 0x3b, 0xab, 0x0c, 0x0b, 0xbc, 0x7a, 0x1f, 0x1a,
+	0x22, 0x02, 0xa8, 0xd5, 0xa8, 0x60, 0x3b, 0x8f, 0x61, 0xb3, 0x04, 0xbb, 0xca, 0xbf, 0xce, 0x23,
+	0x18, 0xc8, 0x72, 0x23, 0x1d, 0xb3, 0x60, 0x48, 0x72, 0x3e, 0x85, 0x61, 0xfe, 0x58, 0x26, 0x4c,
+	0x84, 0xa5, 0x3c, 0xf5, 0x39, 0xa0, 0x67, 0xe4, 0xc6, 0x0f, 0x97, 0xce, 0x02, 0xf9, 0x60, 0x5d,
+	0x11, 0xc1, 0xfa, 0x29, 0x0c, 0x72, 0x17, 0xb3, 0x86, 0x24, 0x7d, 0x26, 0xb1, 0xbe, 0x00, 0x74,
+	0xe2, 0x53, 0x26, 0x21, 0x50, 0x0d, 0xaa, 0x6a, 0x27, 0x69, 0x39, 0x8c, 0xf9, 0x78, 0x4b, 0xfd,
+	0xbf, 0x11, 0x29, 0x5e, 0xaa, 0x9c, 0x90, 0x31, 0x8b, 0xde, 0x90, 0x50, 0xa6, 0x90, 0xf3, 0x5b,
+	0x18, 0xe4, 0x84, 0x29, 0x95, 0x5a, 0xc5, 0xe7, 0x23, 0x86, 0x68, 0x45, 0xa2, 0x00, 0x69, 0x02,
+	0x64, 0x8d, 0x7d, 0x08, 0xfd, 0x4b, 0x86, 0xd9, 0x72, 0xbf, 0xbd, 0x05, 0xa4, 0x1f, 0x52, 0x4a,
+	0x8a, 0xf3, 0xba, 0x31, 0xaf, 0x6a, 0xe5, 0x52, 0xd7, 0x85, 0x7a, 0x36, 0x24, 0x8b, 0x1c, 0xa4,
+	0x64, 0xc2, 0xe3, 0x42, 0x1f, 0xdf, 0x39, 0x6a, 0x37, 0x21, 0x98, 0xa9, 0x75, 0xc1, 0xe4, 0xcf,
+	0xfa, 0x8c, 0x4c, 0x09, 0x23, 0xcb, 0xe1, 0x8d, 0x60, 0x98, 0x3f, 0xa6, 0x3a, 0xc5, 0xe7, 0xb0,
+	0x71, 0x95, 0xcc, 0x42, 0x17, 0xbf, 0x47, 0x40, 0x29, 0x5f, 0xf6, 0x60, 0x54, 0xbc, 0xb8, 0xcc,
+	0x66, 0xe7, 0x1b, 0x18, 0x1c, 0x26, 0x44, 0x3b, 0x5d, 0xad, 0x26, 0xab, 0xed, 0x2b, 0x8b, 0x6a,
+	0xfb, 0x08, 0x86, 0x79, 0x49, 0xca, 0x94, 0x7f, 0x98, 0xd0, 0xd1, 0x0f, 0xa2, 0x2d, 0xe8, 0xcf,
+	0x5d, 0x98, 0x35, 0x30, 0xf9, 0x02, 0x62, 0xec, 0xc8, 0x58, 0x78, 0x22, 0x03, 0xc8, 0xe4, 0x77,
+	0x12, 0xc2, 0x48, 0xc8, 0x63, 0x36, 0x65, 0x99, 0x82, 0xb5, 0x0d, 0x83, 0x3c, 0x2b, 0xeb, 0x88,
+	0xbc, 0x36, 0x8e, 0xf2, 0xcc, 0xb4, 0xbb, 0xc9, 0x25, 0x75, 0x0b, 0xfa, 0x1a, 0x55, 0x5d, 0x6d,
+	0xa4, 0x4f, 0x1a, 0x05, 0x31, 0x76, 0x99, 0xd8, 0x54, 0x9b, 0x5c, 0x11, 0x8b, 0x82, 0x6b, 0xca,
+	0xa2, 0x90, 0x8c, 0x53, 0xa9, 0x62, 0x71, 0x35, 0xd1, 0x13, 0x00, 0x6f, 0x96, 0xe0, 0x6b, 0x7f,
+	0xea, 0xb3, 0x3b, 0xab, 0x25, 0x96, 0xe6, 0x7b, 0x25, 0x27, 0xed, 0x3d, 0x4b, 0xcf, 0x88, 0x48,
+	0xba, 0x0b, 0xdd, 0xb1, 0x1f, 0x32, 0x92, 0xbc, 0xc5, 0x53, 0x0b, 0x84, 0x20, 0x04, 0x20, 0xc8,
+	0x12, 0x4a, 0x5b, 0x3c, 0xd2, 0x73, 0x00, 0xed, 0x62, 0x1b, 0x56, 0x9f, 0x1d, 0x1d, 0x1f, 0x7c,
+	0x7b, 0x72, 0xd5, 0xfb, 0x84, 0x6f, 0xc4, 0x97, 0xaf, 0x4e, 0x0f, 0xc7, 0xa7, 0x67, 0xa7, 0x47,
+	0x3d, 0x03, 0xad, 0x43, 0x5b, 0xfc, 0x3c, 0x38, 0xf9, 0xee, 0xe0, 0xd5, 0x65, 0x6f, 0x05, 0xad,
+	0x01, 0x08, 0xc2, 0xd7, 0x17, 0x67, 0xdf, 0x9e, 0xf7, 0x4c, 0xe7, 0x0f, 0x80, 0xe4, 0x2b, 0x7d,
+	0x64, 0x85, 0xd0, 0x22, 0xc0, 0x5c, 0x14, 0x01, 0x3f, 0x84, 0x41, 0x4e, 0xf6, 0x82, 0x8c, 0x76,
+	0x1e, 0xf1, 0xa0, 0x97, 0x3b, 0xe5, 0x12, 0x14, 0xce, 0x53, 0xd8, 0x28, 0x1c, 0x53, 0x02, 0x51,
+	0x61, 0x11, 0x51, 0xaf, 0x95, 0x1f, 0x14, 0x1f, 0x02, 0x92, 0x99, 0xb5, 0x4c, 0xc5, 0x06, 0x0c,
+	0x72, 0x87, 0xa4, 0x82, 0xfd, 0xff, 0x34, 0xa0, 0x71, 0x29, 0xbe, 0xb9, 0xa0, 0x3d, 0xa8, 0xab,
+	0x15, 0xa6, 0xf4, 0x05, 0xc4, 0xae, 0xd8, 0x51, 0xd0, 0x8f, 0xa1, 0xc6, 0xf7, 0x78, 0xd4, 0x13,
+	0x3c, 0xed, 0xeb, 0x84, 0xdd, 0xd7, 0x28, 0xea, 0xf0, 0x53, 0x68, 0xa5, 0xdb, 0x35, 0x92, 0x3b,
+	0x65, 0x71, 0x9b, 0xb7, 0x47, 0x45, 0xb2, 0xbc, 0xfb, 0xc4, 0x40, 0xc7, 0xd0, 0xcd, 0x2d, 0xc9,
+	0x68, 0x4b, 0x1c, 0xad, 0xda, 0xb9, 0x6d, 0xbb, 0x8a, 0xa5, 0x50, 0x9c, 0x41, 0xaf, 0xb8, 0x28,
+	0xa3, 0x7b, 0x0a, 0x6c, 0xe5, 0x6a, 0x6d, 0xdf, 0x5f, 0xc0, 0xcd, 0x04, 0x16, 0x17, 0x5a, 0x25,
+	0x70, 0xc1, 0x7e, 0x6d, 0xdf, 0x5f, 0xc0, 0x55, 0x02, 0xbf, 0x04, 0xc8, 0xf6, 0x51, 0x34, 0xd2,
+	0x0e, 0x6b, 0x6f, 0x6b, 0x6f, 0x96, 0xe8, 0xea, 0xfa, 0x21, 0x74, 0xf4, 0xfd, 0x0e, 0xc9, 0x8f,
+	0x59, 0x15, 0xab, 0xa4, 0xbd, 0x55, 0xc1, 0x51, 0x42, 0xfe, 0x08, 0xc3, 0xaa, 0xdd, 0x0d, 0xed,
+	0x88, 0x2b, 0x4b, 0x96, 0x42, 0xfb, 0xc1, 0x92, 0x13, 0x4a, 0xf8, 0x17, 0xd0, 0x4a, 0xb7, 0x2a,
+	0x15, 0x08, 0xc5, 0x25, 0xce, 0x1e, 0x15, 0xc9, 0xd9, 0xdd, 0x74, 0xb7, 0x51, 0x77, 0x8b, 0x1b,
+	0x92, 0x3d, 0x2a, 0x92, 0x33, 0xc7, 0x66, 0x6b, 0x8a, 0x72, 0x6c, 0x69, 0xdd, 0xb1, 0x37, 0x4b,
+	0xf4, 0x2c, 0xd8, 0xf9, 0x67, 0x47, 0x15, 0xec, 0xda, 0x07, 0x49, 0xbb, 0xaf, 0x51, 0x54, 0x52,
+	0xbd, 0x80, 0xb6, 0x5a, 0x39, 0x44, 0x40, 0x3c, 0x85, 0xba, 0x70, 0x89, 0x7a, 0x8d, 0x8a, 0xb5,
+	0xc8, 0xde, 0xaa, 0xe0, 0x28, 0x61, 0xff, 0x5d, 0x81, 0xd5, 0xc3, 0xe9, 0x8c, 0x87, 0x1f, 0xda,
+	0x87, 0xb6, 0xba, 0xc1, 0x27, 0x7f, 0x05, 0x46, 0x5b, 0x33, 0xec, 0xbe, 0x46, 0x51, 0xc8, 0x8f,
+	0xa1, 0x9b, 0x1b, 0x7e, 0x55, 0xee, 0x54, 0xcd, 0xeb, 0xb6, 0x5d, 0xc5, 0xca, 0x42, 0x4b, 0x1f,
+	0xcb, 0x94, 0x31, 0x15, 0x03, 0x9d, 0xbd, 0x55, 0xc1, 0x51, 0x42, 0x4e, 0x60, 0xbd, 0x30, 0x2b,
+	0xa2, 0x6d, 0x71, 0xba, 0x7a, 0xf0, 0xb5, 0xef, 0x55, 0x33, 0x95, 0xb4, 0xaf, 0xa0, 0xad, 0x8d,
+	0x72, 0x48, 0x3e, 0x5e, 0x79, 0x2a, 0xb4, 0xad, 0x32, 0x43, 0x39, 0xf7, 0x5f, 0x35, 0xa8, 0x1f,
+	0x78, 0x81, 0x1f, 0x8a, 0xcc, 0xd1, 0x7a, 0xfa, 0x3c, 0x73, 0xca, 0x03, 0x83, 0xbd, 0x55, 0xc1,
+	0xc9, 0x00, 0x69, 0x83, 0x9e, 0x02, 0x54, 0x9e, 0x23, 0x6d, 0xab, 0xcc, 0xc8, 0xc2, 0x34, 0x1b,
+	0xe2, 0x54, 0x98, 0x96, 0x46, 0x3f, 0x7b, 0xb3, 0x44, 0xcf, 0x1e, 0x49, 0x1f, 0xb2, 0xd0, 0xdc,
+	0xf2, 0x29, 0xa9, 0xb6, 0xa2, 0x6a, 0x22, 0x43, 0xcf, 0x61, 0x2d, 0x3f, 0x58, 0x21, 0x5b, 0x7d,
+	0x04, 0xac, 0x18, 0xd3, 0xec, 0xed, 0x4a, 0x5e, 0xe6, 0x10, 0xad, 0x4f, 0x2a, 0x87, 0x94, 0xbb,
+	0xb2, 0x6d, 0x95, 0x19, 0x59, 0xf8, 0xe6, 0x5a, 0x23, 0x9a, 0x03, 0x2f, 0x77, 0x55, 0xdb, 0xae,
+	0x62, 0xe9, 0xb1, 0x32, 0x25, 0x79, 0x24, 0xe5, 0xb6, 0x69, 0x5b, 0x65, 0x86, 0x94, 0x70, 0xdd,
+	0x10, 0x7f, 0x4a, 0xfc, 0xe2, 0xff, 0x03, 0x00, 0xad, 0x29, 0x30, 0x8f, 0xa4, 0x18, 0x00, 0x00,
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/pjvds/randombytes"
 	"github.com/pjvds/stopwatch"
 	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/message"
 	"github.com/urfave/cli"
 )
 
@@ -110,7 +111,9 @@ func main() {
 				done := make(chan struct{})
 
 				var bytesSend int64
-				messages := randombytes.Make(8096)
+				set := message.NewSet()
+				set.Append(randombytes.Make(8096))
+				messages := set.GetBuffer()
 
 				watch := stopwatch.Start()
 				for i := 0; i < 16; i++ {
@@ -135,7 +138,7 @@ func main() {
 									fmt.Printf("write failed: %v\n", err)
 								}
 
-								atomic.AddInt64(&bytesSend, 8096)
+								atomic.AddInt64(&bytesSend, int64(len(messages)))
 							}
 						}
 					}(streamId)
@@ -0,0 +1,1363 @@
+// Package cluster keeps the metadata of a cluster of strand servers. The
+// nodes of a cluster elect a leader with the raft protocol, and the
+// leader assigns every stream to the node that leads it. The assignments
+// are entries in a replicated log, an assignment is committed once a
+// majority of the nodes stored it. When a node stops answering the
+// leader, the leader assigns its streams to the nodes that are alive
+// and replicated them the furthest. The topics are entries in the same
+// log, so every node knows them, whichever node leads their partitions.
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/tidy"
+	"golang.org/x/net/context"
+)
+
+var log = tidy.Configure().
+	LogFromLevel(tidy.DEBUG).To(tidy.Console).
+	MustBuild()
+
+// SetLogLevel sets the level from which the nodes
+// log. It must be called before a node is started.
+func SetLogLevel(level tidy.Level) {
+	log = tidy.Configure().
+		LogFromLevel(level).To(tidy.Console).
+		MustBuild()
+}
+
+const (
+	// DEFAULT_HEARTBEAT_INTERVAL is the interval at which the leader
+	// sends its entries, or an empty heartbeat, to the other nodes.
+	DEFAULT_HEARTBEAT_INTERVAL = 100 * time.Millisecond
+
+	// DEFAULT_ELECTION_TIMEOUT is the shortest time a node waits for the
+	// leader before it starts an election. The actual timeout is picked at
+	// random between the election timeout and twice the election timeout.
+	DEFAULT_ELECTION_TIMEOUT = time.Second
+
+	// DEFAULT_NODE_TIMEOUT is the time after which the leader assigns
+	// the streams of a node that doesn't answer to other nodes.
+	DEFAULT_NODE_TIMEOUT = 5 * time.Second
+
+	// MAX_APPEND_ENTRIES is the maximum number of
+	// entries the leader sends to a node in one call.
+	MAX_APPEND_ENTRIES = 256
+
+	// DEFAULT_SNAPSHOT_ENTRIES is the number of applied entries after
+	// which a node replaces them by a snapshot of the assignments.
+	DEFAULT_SNAPSHOT_ENTRIES = 1024
+)
+
+// ErrStopped is returned by a node that is stopped.
+var ErrStopped = errors.New("node stopped")
+
+// NodeId identifies a node in the cluster.
+type NodeId string
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+// Config configures a node.
+type Config struct {
+	// Id is the id of the node.
+	Id NodeId
+
+	// Peers holds the address of every node in
+	// the cluster, including the node itself.
+	Peers map[NodeId]string
+
+	// Directory is the directory the node keeps its state in.
+	Directory string
+
+	HeartbeatInterval time.Duration
+	ElectionTimeout   time.Duration
+	NodeTimeout       time.Duration
+	SnapshotEntries   int
+}
+
+// Node is a member of a cluster. It takes part in the elections
+// and keeps the assignments of the streams to the nodes.
+type Node struct {
+	config    Config
+	transport Transport
+
+	lock     sync.Mutex
+	role     role
+	term     uint64
+	votedFor NodeId
+
+	// log holds the last entry of the snapshot at index 0, with only
+	// its term, and the entries after the snapshot. The entry at an
+	// index in raft is at the index minus the snapshot index.
+	log         []entry
+	snapshot    uint64
+	commitIndex uint64
+	lastApplied uint64
+	leader      NodeId
+	deadline    time.Time
+
+	// the progress of the other nodes, kept by the leader
+	nextIndex   map[NodeId]uint64
+	matchIndex  map[NodeId]uint64
+	contact     map[NodeId]time.Time
+	replicating map[NodeId]bool
+
+	// replicated holds the offsets up to which the node replicated
+	// the streams that other nodes lead. Every node reports them to
+	// the leader, which keeps the reports of all nodes in progress.
+	replicated map[string]uint64
+	progress   map[NodeId]map[string]uint64
+
+	// assignments holds the committed assignments and
+	// topics the committed topics with their partitions
+	assignments map[string]NodeId
+	topics      map[string]int
+
+	// changed is closed and replaced every time the committed
+	// assignments, the committed topics or the leader change
+	changed chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// Start loads the state of the node from its directory and starts
+// taking part in the cluster. The transport carries the calls to the
+// other nodes, the calls of the other nodes must be passed to the
+// RequestVote, AppendEntries, InstallSnapshot and AssignStream methods
+// of the node.
+func Start(config Config, transport Transport) (*Node, error) {
+	if _, ok := config.Peers[config.Id]; !ok {
+		return nil, errors.New("the peers don't include the node itself")
+	}
+	if config.HeartbeatInterval == 0 {
+		config.HeartbeatInterval = DEFAULT_HEARTBEAT_INTERVAL
+	}
+	if config.ElectionTimeout == 0 {
+		config.ElectionTimeout = DEFAULT_ELECTION_TIMEOUT
+	}
+	if config.NodeTimeout == 0 {
+		config.NodeTimeout = DEFAULT_NODE_TIMEOUT
+	}
+	if config.SnapshotEntries == 0 {
+		config.SnapshotEntries = DEFAULT_SNAPSHOT_ENTRIES
+	}
+
+	loaded, err := loadState(config.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := loadSnapshot(config.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := followSnapshot(loaded, saved)
+	if err != nil {
+		return nil, err
+	}
+
+	// the snapshot is committed, its assignments apply right away
+	assignments := make(map[string]NodeId, len(saved.Assignments))
+	for id, node := range saved.Assignments {
+		assignments[id] = node
+	}
+	topics := make(map[string]int, len(saved.Topics))
+	for name, partitions := range saved.Topics {
+		topics[name] = partitions
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	node := &Node{
+		config:      config,
+		transport:   transport,
+		term:        loaded.Term,
+		votedFor:    loaded.VotedFor,
+		log:         append([]entry{{Term: saved.Term}}, entries...),
+		snapshot:    saved.Index,
+		commitIndex: saved.Index,
+		lastApplied: saved.Index,
+		nextIndex:   make(map[NodeId]uint64),
+		matchIndex:  make(map[NodeId]uint64),
+		contact:     make(map[NodeId]time.Time),
+		replicating: make(map[NodeId]bool),
+		replicated:  make(map[string]uint64),
+		progress:    make(map[NodeId]map[string]uint64),
+		assignments: assignments,
+		topics:      topics,
+		changed:     make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	node.resetDeadline()
+
+	node.done.Add(1)
+	go node.run()
+	return node, nil
+}
+
+// followSnapshot returns the entries of the loaded log that follow the
+// snapshot. A node that crashed right after it saved a snapshot has a
+// log that starts before the snapshot, the entries the snapshot holds
+// are dropped from it. The log is dropped as a whole if it doesn't
+// hold the last entry of the snapshot.
+func followSnapshot(loaded state, saved snapshot) ([]entry, error) {
+	if loaded.Snapshot > saved.Index {
+		return nil, fmt.Errorf("the cluster log follows snapshot index %v, but the snapshot is at index %v", loaded.Snapshot, saved.Index)
+	}
+
+	dropped := saved.Index - loaded.Snapshot
+	if dropped == 0 {
+		return loaded.Log, nil
+	}
+	if dropped > uint64(len(loaded.Log)) || loaded.Log[dropped-1].Term != saved.Term {
+		return nil, nil
+	}
+	return loaded.Log[dropped:], nil
+}
+
+func (this *Node) run() {
+	defer this.done.Done()
+
+	ticker := time.NewTicker(this.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			this.tick()
+		case <-this.ctx.Done():
+			return
+		}
+	}
+}
+
+func (this *Node) tick() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.role == leader {
+		this.reassign()
+		this.broadcast()
+		return
+	}
+
+	if time.Now().After(this.deadline) {
+		this.campaign()
+	}
+}
+
+// resetDeadline picks a new random time to start
+// an election at. It must be called with the lock held.
+func (this *Node) resetDeadline() {
+	timeout := this.config.ElectionTimeout
+	this.deadline = time.Now().Add(timeout + time.Duration(rand.Int63n(int64(timeout))))
+}
+
+func (this *Node) lastIndex() uint64 {
+	return this.snapshot + uint64(len(this.log)-1)
+}
+
+// entry returns the entry at the index in raft, which must not
+// be before the snapshot. It must be called with the lock held.
+func (this *Node) entry(index uint64) entry {
+	return this.log[index-this.snapshot]
+}
+
+func (this *Node) lastTerm() uint64 {
+	return this.log[len(this.log)-1].Term
+}
+
+// save writes the term, the vote and the log to disk. A node that
+// can't save its state must not answer, so it exits when that fails.
+// It must be called with the lock held.
+func (this *Node) save() {
+	if err := saveState(this.config.Directory, state{
+		Term:     this.term,
+		VotedFor: this.votedFor,
+		Snapshot: this.snapshot,
+		Log:      this.log[1:],
+	}); err != nil {
+		log.With("node", this.config.Id).WithError(err).Fatal("failed to save cluster state")
+	}
+}
+
+// notify wakes up the routines that wait for
+// a change. It must be called with the lock held.
+func (this *Node) notify() {
+	close(this.changed)
+	this.changed = make(chan struct{})
+}
+
+// observe steps down when a node has a newer term and returns true if
+// it did. It must be called with the lock held.
+func (this *Node) observe(term uint64) bool {
+	if term <= this.term {
+		return false
+	}
+
+	this.term = term
+	this.votedFor = ""
+	this.role = follower
+	if this.leader != "" {
+		this.leader = ""
+		this.notify()
+	}
+	this.save()
+	return true
+}
+
+// campaign starts an election for the next term. It must
+// be called with the lock held.
+func (this *Node) campaign() {
+	this.role = candidate
+	this.term++
+	this.votedFor = this.config.Id
+	if this.leader != "" {
+		this.leader = ""
+		this.notify()
+	}
+	this.save()
+	this.resetDeadline()
+
+	if log.IsDebug() {
+		log.With("node", this.config.Id).With("term", this.term).Debug("starting election")
+	}
+
+	request := &api.VoteRequest{
+		Term:         this.term,
+		CandidateId:  string(this.config.Id),
+		LastLogIndex: this.lastIndex(),
+		LastLogTerm:  this.lastTerm(),
+	}
+
+	votes := 1
+	if votes > len(this.config.Peers)/2 {
+		this.lead()
+		return
+	}
+
+	for peer := range this.config.Peers {
+		if peer == this.config.Id {
+			continue
+		}
+
+		this.done.Add(1)
+		go func(peer NodeId) {
+			defer this.done.Done()
+
+			ctx, cancel := context.WithTimeout(this.ctx, this.config.ElectionTimeout)
+			defer cancel()
+
+			response, err := this.transport.RequestVote(ctx, peer, request)
+			if err != nil {
+				return
+			}
+
+			this.lock.Lock()
+			defer this.lock.Unlock()
+
+			if this.observe(response.Term) {
+				return
+			}
+			if this.role != candidate || this.term != request.Term || !response.Granted {
+				return
+			}
+
+			votes++
+			if votes > len(this.config.Peers)/2 {
+				this.lead()
+			}
+		}(peer)
+	}
+}
+
+// lead makes the node the leader of the current term. It commits an
+// empty entry first, to commit the entries of the previous terms. It
+// must be called with the lock held.
+func (this *Node) lead() {
+	if log.IsInfo() {
+		log.With("node", this.config.Id).With("term", this.term).Info("elected leader")
+	}
+
+	this.role = leader
+	this.leader = this.config.Id
+	this.notify()
+
+	now := time.Now()
+	for peer := range this.config.Peers {
+		this.nextIndex[peer] = this.lastIndex() + 1
+		this.matchIndex[peer] = 0
+		this.contact[peer] = now
+	}
+
+	this.log = append(this.log, entry{Term: this.term})
+	this.save()
+
+	this.advanceCommit()
+	this.broadcast()
+}
+
+// broadcast sends the entries the other nodes miss, or a heartbeat if
+// they are up to date. It must be called with the lock held.
+func (this *Node) broadcast() {
+	for peer := range this.config.Peers {
+		if peer == this.config.Id || this.replicating[peer] {
+			continue
+		}
+
+		this.replicating[peer] = true
+		this.done.Add(1)
+		go this.replicate(peer)
+	}
+}
+
+// replicate sends entries to the node until it has all entries, or until
+// a call fails. At most one routine replicates to a node at a time.
+func (this *Node) replicate(peer NodeId) {
+	defer this.done.Done()
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	defer func() {
+		this.replicating[peer] = false
+	}()
+
+	for this.role == leader && this.ctx.Err() == nil {
+		next := this.nextIndex[peer]
+		if next <= this.snapshot {
+			// the node misses entries that are compacted
+			if !this.installSnapshot(peer) {
+				return
+			}
+			continue
+		}
+
+		last := this.lastIndex()
+		if next+MAX_APPEND_ENTRIES <= last {
+			last = next + MAX_APPEND_ENTRIES - 1
+		}
+
+		request := &api.AppendEntriesRequest{
+			Term:         this.term,
+			LeaderId:     string(this.config.Id),
+			PrevLogIndex: next - 1,
+			PrevLogTerm:  this.entry(next - 1).Term,
+			LeaderCommit: this.commitIndex,
+		}
+		for _, e := range this.log[next-this.snapshot : last-this.snapshot+1] {
+			request.Entries = append(request.Entries, &api.LogEntry{
+				Term:       e.Term,
+				Stream:     e.Stream,
+				Node:       string(e.Node),
+				Topic:      e.Topic,
+				Partitions: uint32(e.Partitions),
+			})
+		}
+
+		this.lock.Unlock()
+		ctx, cancel := context.WithTimeout(this.ctx, this.config.ElectionTimeout)
+		response, err := this.transport.AppendEntries(ctx, peer, request)
+		cancel()
+		this.lock.Lock()
+
+		if err != nil {
+			if log.IsDebug() {
+				log.With("node", this.config.Id).With("peer", peer).WithError(err).Debug("failed to append entries")
+			}
+			return
+		}
+		if this.observe(response.Term) || this.term != request.Term {
+			return
+		}
+		this.contact[peer] = time.Now()
+
+		if !response.Success {
+			// the node doesn't have the previous entry, the
+			// match index tells where its log ends or differs
+			this.nextIndex[peer] = response.MatchIndex + 1
+			continue
+		}
+
+		this.matchIndex[peer] = response.MatchIndex
+		this.nextIndex[peer] = response.MatchIndex + 1
+		this.report(peer, response.Progress)
+		this.advanceCommit()
+
+		if this.nextIndex[peer] > this.lastIndex() {
+			return
+		}
+	}
+}
+
+// installSnapshot sends the committed assignments and topics to a node that misses
+// entries the leader compacted. It returns true if the node installed
+// them. It must be called with the lock held, it is released during the
+// call.
+func (this *Node) installSnapshot(peer NodeId) bool {
+	request := &api.InstallSnapshotRequest{
+		Term:              this.term,
+		LeaderId:          string(this.config.Id),
+		LastIncludedIndex: this.lastApplied,
+		LastIncludedTerm:  this.entry(this.lastApplied).Term,
+	}
+	for id, node := range this.assignments {
+		request.Assignments = append(request.Assignments, &api.LogEntry{
+			Stream: id,
+			Node:   string(node),
+		})
+	}
+	for name, partitions := range this.topics {
+		request.Topics = append(request.Topics, &api.LogEntry{
+			Topic:      name,
+			Partitions: uint32(partitions),
+		})
+	}
+
+	this.lock.Unlock()
+	ctx, cancel := context.WithTimeout(this.ctx, this.config.ElectionTimeout)
+	response, err := this.transport.InstallSnapshot(ctx, peer, request)
+	cancel()
+	this.lock.Lock()
+
+	if err != nil {
+		if log.IsDebug() {
+			log.With("node", this.config.Id).With("peer", peer).WithError(err).Debug("failed to install snapshot")
+		}
+		return false
+	}
+	if this.observe(response.Term) || this.term != request.Term || this.role != leader {
+		return false
+	}
+	this.contact[peer] = time.Now()
+
+	if request.LastIncludedIndex > this.matchIndex[peer] {
+		this.matchIndex[peer] = request.LastIncludedIndex
+	}
+	this.nextIndex[peer] = request.LastIncludedIndex + 1
+	this.advanceCommit()
+	return true
+}
+
+// advanceCommit commits the entries of the current term that a majority
+// of the nodes stored. It must be called with the lock held.
+func (this *Node) advanceCommit() {
+	for index := this.lastIndex(); index > this.commitIndex; index-- {
+		if this.entry(index).Term != this.term {
+			break
+		}
+
+		stored := 1
+		for peer, match := range this.matchIndex {
+			if peer != this.config.Id && match >= index {
+				stored++
+			}
+		}
+
+		if stored > len(this.config.Peers)/2 {
+			this.commitIndex = index
+			this.apply()
+			return
+		}
+	}
+}
+
+// apply applies the committed entries to the assignments
+// and the topics. It must be called with the lock held.
+func (this *Node) apply() {
+	if this.lastApplied >= this.commitIndex {
+		return
+	}
+
+	for this.lastApplied < this.commitIndex {
+		this.lastApplied++
+		e := this.entry(this.lastApplied)
+		if e.Stream != "" {
+			this.assignments[e.Stream] = e.Node
+		}
+		if e.Topic != "" {
+			if e.Partitions > 0 {
+				this.topics[e.Topic] = e.Partitions
+			} else {
+				delete(this.topics, e.Topic)
+			}
+		}
+	}
+	this.notify()
+
+	if this.lastApplied-this.snapshot >= uint64(this.config.SnapshotEntries) {
+		this.compact()
+	}
+}
+
+// compact replaces the applied entries by a snapshot of the assignments
+// and the topics,
+// so the log and the state file don't grow without bounds. A node that
+// fails to save the snapshot keeps its log. It must be called with the
+// lock held.
+func (this *Node) compact() {
+	saved := snapshot{
+		Index:       this.lastApplied,
+		Term:        this.entry(this.lastApplied).Term,
+		Assignments: this.assignments,
+		Topics:      this.topics,
+	}
+	if err := saveSnapshot(this.config.Directory, saved); err != nil {
+		log.With("node", this.config.Id).WithError(err).Error("failed to save cluster snapshot")
+		return
+	}
+
+	if log.IsDebug() {
+		log.With("node", this.config.Id).With("index", saved.Index).Debug("compacted cluster log")
+	}
+
+	this.log = append([]entry{{Term: saved.Term}}, this.log[saved.Index-this.snapshot+1:]...)
+	this.snapshot = saved.Index
+	this.save()
+}
+
+// effective returns the assignments including the entries that are not
+// committed yet. It must be called with the lock held.
+func (this *Node) effective() map[string]NodeId {
+	assignments := make(map[string]NodeId, len(this.assignments))
+	for id, node := range this.assignments {
+		assignments[id] = node
+	}
+	for _, e := range this.log[this.lastApplied-this.snapshot+1:] {
+		if e.Stream != "" {
+			assignments[e.Stream] = e.Node
+		}
+	}
+	return assignments
+}
+
+// alive returns true if the node answered the leader within the
+// node timeout. It must be called with the lock held.
+func (this *Node) alive(node NodeId, now time.Time) bool {
+	if node == this.config.Id {
+		return true
+	}
+	return now.Sub(this.contact[node]) <= this.config.NodeTimeout
+}
+
+// loads returns the number of streams assigned to every node
+// that is alive. It must be called with the lock held.
+func (this *Node) loads(assignments map[string]NodeId, now time.Time) map[NodeId]int {
+	loads := make(map[NodeId]int, len(this.config.Peers))
+	for peer := range this.config.Peers {
+		if this.alive(peer, now) {
+			loads[peer] = 0
+		}
+	}
+	for _, node := range assignments {
+		if _, ok := loads[node]; ok {
+			loads[node]++
+		}
+	}
+	return loads
+}
+
+// report keeps the offsets up to which a node replicated the streams,
+// as the node reported them. It must be called with the lock held.
+func (this *Node) report(peer NodeId, progress []*api.StreamProgress) {
+	offsets := make(map[string]uint64, len(progress))
+	for _, p := range progress {
+		offsets[p.Stream] = p.Offset
+	}
+	this.progress[peer] = offsets
+}
+
+// offset returns the offset up to which the node replicated the stream,
+// as far as the leader knows. It must be called with the lock held.
+func (this *Node) offset(node NodeId, id string) uint64 {
+	if node == this.config.Id {
+		return this.replicated[id]
+	}
+	return this.progress[node][id]
+}
+
+// caughtUp returns the loads of the nodes that replicated the stream the
+// furthest, of the nodes in the loads. It must be called with the lock
+// held.
+func (this *Node) caughtUp(id string, loads map[NodeId]int) map[NodeId]int {
+	furthest := uint64(0)
+	for node := range loads {
+		if offset := this.offset(node, id); offset > furthest {
+			furthest = offset
+		}
+	}
+
+	nodes := make(map[NodeId]int, len(loads))
+	for node, load := range loads {
+		if this.offset(node, id) == furthest {
+			nodes[node] = load
+		}
+	}
+	return nodes
+}
+
+// leastLoaded returns the node with the fewest streams,
+// or the lowest id of the nodes with the fewest streams.
+func leastLoaded(loads map[NodeId]int) NodeId {
+	nodes := make([]string, 0, len(loads))
+	for node := range loads {
+		nodes = append(nodes, string(node))
+	}
+	sort.Strings(nodes)
+
+	least := NodeId(nodes[0])
+	for _, node := range nodes[1:] {
+		if loads[NodeId(node)] < loads[least] {
+			least = NodeId(node)
+		}
+	}
+	return least
+}
+
+// propose appends an assignment to the log of the leader and sends it
+// to the other nodes. It must be called with the lock held.
+func (this *Node) propose(id string, node NodeId) {
+	this.log = append(this.log, entry{
+		Term:   this.term,
+		Stream: id,
+		Node:   node,
+	})
+	this.save()
+	this.advanceCommit()
+	this.broadcast()
+}
+
+// assignAsLeader assigns the stream to the node with the fewest streams,
+// unless it is assigned already. It must be called with the lock held.
+func (this *Node) assignAsLeader(id string) NodeId {
+	now := time.Now()
+	assignments := this.effective()
+	if node, ok := assignments[id]; ok {
+		return node
+	}
+
+	node := leastLoaded(this.loads(assignments, now))
+	this.propose(id, node)
+	return node
+}
+
+// reassign assigns the streams of the nodes that stopped answering to
+// the nodes that are alive. A stream goes to the node that replicated
+// it the furthest, so the messages that the node that stopped answering
+// acknowledged after they were replicated are kept, and the other nodes
+// don't drop them when they follow the new node. It must be called with
+// the lock held.
+func (this *Node) reassign() {
+	now := time.Now()
+	assignments := this.effective()
+	loads := this.loads(assignments, now)
+
+	ids := make([]string, 0, len(assignments))
+	for id, node := range assignments {
+		if !this.alive(node, now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		node := leastLoaded(this.caughtUp(id, loads))
+		loads[node]++
+
+		if log.IsInfo() {
+			log.With("stream_id", id).With("from", assignments[id]).With("to", node).Info("reassigning stream")
+		}
+		this.log = append(this.log, entry{
+			Term:   this.term,
+			Stream: id,
+			Node:   node,
+		})
+	}
+
+	if len(ids) > 0 {
+		this.save()
+		this.advanceCommit()
+	}
+}
+
+// RequestVote handles the vote request of a candidate. The node votes
+// for at most one candidate in a term, and only for a candidate that
+// has all entries the node has.
+func (this *Node) RequestVote(ctx context.Context, request *api.VoteRequest) (*api.VoteResponse, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.ctx.Err() != nil {
+		return nil, ErrStopped
+	}
+
+	if request.Term < this.term {
+		return &api.VoteResponse{Term: this.term}, nil
+	}
+	this.observe(request.Term)
+
+	candidate := NodeId(request.CandidateId)
+	upToDate := request.LastLogTerm > this.lastTerm() ||
+		(request.LastLogTerm == this.lastTerm() && request.LastLogIndex >= this.lastIndex())
+
+	granted := (this.votedFor == "" || this.votedFor == candidate) && upToDate
+	if granted {
+		this.votedFor = candidate
+		this.save()
+		this.resetDeadline()
+	}
+
+	return &api.VoteResponse{
+		Term:    this.term,
+		Granted: granted,
+	}, nil
+}
+
+// AppendEntries handles the entries and heartbeats of the leader. When the
+// call fails because the node misses the previous entry, the match index
+// of the response holds the index the leader should try before.
+func (this *Node) AppendEntries(ctx context.Context, request *api.AppendEntriesRequest) (*api.AppendEntriesResponse, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.ctx.Err() != nil {
+		return nil, ErrStopped
+	}
+
+	if request.Term < this.term {
+		return &api.AppendEntriesResponse{Term: this.term}, nil
+	}
+	this.observe(request.Term)
+
+	this.role = follower
+	this.resetDeadline()
+	if this.leader != NodeId(request.LeaderId) {
+		this.leader = NodeId(request.LeaderId)
+		this.notify()
+	}
+
+	previous := request.PrevLogIndex
+	previousTerm := request.PrevLogTerm
+	entries := request.Entries
+
+	// the entries up to the snapshot are committed, so they
+	// are the same as the entries of the leader
+	if previous < this.snapshot {
+		skipped := this.snapshot - previous
+		if skipped > uint64(len(entries)) {
+			return &api.AppendEntriesResponse{
+				Term:       this.term,
+				Success:    true,
+				MatchIndex: previous + uint64(len(entries)),
+				Progress:   this.reportable(),
+			}, nil
+		}
+
+		previous = this.snapshot
+		previousTerm = entries[skipped-1].Term
+		entries = entries[skipped:]
+	}
+
+	if previous > this.lastIndex() {
+		return &api.AppendEntriesResponse{
+			Term:       this.term,
+			MatchIndex: this.lastIndex(),
+		}, nil
+	}
+	if this.entry(previous).Term != previousTerm {
+		return &api.AppendEntriesResponse{
+			Term:       this.term,
+			MatchIndex: previous - 1,
+		}, nil
+	}
+
+	changed := false
+	for i, e := range entries {
+		index := previous + 1 + uint64(i)
+		if index <= this.lastIndex() {
+			if this.entry(index).Term == e.Term {
+				continue
+			}
+
+			// the entries from here on were never committed
+			this.log = this.log[:index-this.snapshot]
+		}
+
+		this.log = append(this.log, entry{
+			Term:       e.Term,
+			Stream:     e.Stream,
+			Node:       NodeId(e.Node),
+			Topic:      e.Topic,
+			Partitions: int(e.Partitions),
+		})
+		changed = true
+	}
+	if changed {
+		this.save()
+	}
+
+	match := previous + uint64(len(entries))
+	if request.LeaderCommit > this.commitIndex {
+		this.commitIndex = request.LeaderCommit
+		if this.commitIndex > match {
+			this.commitIndex = match
+		}
+		this.apply()
+	}
+
+	return &api.AppendEntriesResponse{
+		Term:       this.term,
+		Success:    true,
+		MatchIndex: match,
+		Progress:   this.reportable(),
+	}, nil
+}
+
+// reportable returns the offsets up to which the node replicated the
+// streams, to report them to the leader. It must be called with the
+// lock held.
+func (this *Node) reportable() []*api.StreamProgress {
+	progress := make([]*api.StreamProgress, 0, len(this.replicated))
+	for id, offset := range this.replicated {
+		progress = append(progress, &api.StreamProgress{
+			Stream: id,
+			Offset: offset,
+		})
+	}
+	return progress
+}
+
+// InstallSnapshot handles the snapshot of the leader for a node that
+// misses entries the leader compacted. The node keeps the entries after
+// the snapshot if its log holds the last entry of the snapshot, otherwise
+// the snapshot replaces its log.
+func (this *Node) InstallSnapshot(ctx context.Context, request *api.InstallSnapshotRequest) (*api.InstallSnapshotResponse, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.ctx.Err() != nil {
+		return nil, ErrStopped
+	}
+
+	if request.Term < this.term {
+		return &api.InstallSnapshotResponse{Term: this.term}, nil
+	}
+	this.observe(request.Term)
+
+	this.role = follower
+	this.resetDeadline()
+	if this.leader != NodeId(request.LeaderId) {
+		this.leader = NodeId(request.LeaderId)
+		this.notify()
+	}
+
+	index := request.LastIncludedIndex
+	if index <= this.snapshot {
+		return &api.InstallSnapshotResponse{Term: this.term}, nil
+	}
+
+	saved := snapshot{
+		Index:       index,
+		Term:        request.LastIncludedTerm,
+		Assignments: make(map[string]NodeId, len(request.Assignments)),
+		Topics:      make(map[string]int, len(request.Topics)),
+	}
+	for _, e := range request.Assignments {
+		saved.Assignments[e.Stream] = NodeId(e.Node)
+	}
+	for _, e := range request.Topics {
+		saved.Topics[e.Topic] = int(e.Partitions)
+	}
+	if err := saveSnapshot(this.config.Directory, saved); err != nil {
+		log.With("node", this.config.Id).WithError(err).Error("failed to save cluster snapshot")
+		return nil, grpc.Errorf(codes.Internal, "failed to save snapshot: %v", err)
+	}
+
+	if index <= this.lastIndex() && this.entry(index).Term == saved.Term {
+		this.log = append([]entry{{Term: saved.Term}}, this.log[index-this.snapshot+1:]...)
+	} else {
+		this.log = []entry{{Term: saved.Term}}
+	}
+	this.snapshot = index
+	this.save()
+
+	if this.commitIndex < index {
+		this.commitIndex = index
+	}
+	if this.lastApplied < index {
+		this.lastApplied = index
+		this.assignments = saved.Assignments
+		this.topics = saved.Topics
+		this.notify()
+	}
+
+	return &api.InstallSnapshotResponse{Term: this.term}, nil
+}
+
+// AssignStream handles the assignment of a stream that a node
+// forwarded to the leader. It fails on a node that is not the leader.
+func (this *Node) AssignStream(ctx context.Context, request *api.AssignStreamRequest) (*api.AssignStreamResponse, error) {
+	this.lock.Lock()
+	if this.ctx.Err() != nil {
+		this.lock.Unlock()
+		return nil, ErrStopped
+	}
+	if this.role != leader {
+		this.lock.Unlock()
+		return nil, grpc.Errorf(codes.Unavailable, "node %v is not the leader", this.config.Id)
+	}
+	this.lock.Unlock()
+
+	node, err := this.Assign(ctx, request.Stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.AssignStreamResponse{
+		Node: string(node),
+	}, nil
+}
+
+// Assign returns the node that leads the stream, assigning the stream
+// to a node first if it isn't assigned yet. A node that is not the
+// leader forwards the assignment to the leader. Assign waits until
+// the assignment is committed, or until the context is done.
+func (this *Node) Assign(ctx context.Context, id string) (NodeId, error) {
+	for {
+		this.lock.Lock()
+		if this.ctx.Err() != nil {
+			this.lock.Unlock()
+			return "", ErrStopped
+		}
+		if node, ok := this.assignments[id]; ok {
+			this.lock.Unlock()
+			return node, nil
+		}
+
+		changed := this.changed
+		current := this.leader
+
+		if this.role == leader {
+			this.assignAsLeader(id)
+			current = ""
+		}
+		this.lock.Unlock()
+
+		if current != "" {
+			response, err := this.transport.AssignStream(ctx, current, &api.AssignStreamRequest{
+				Stream: id,
+			})
+			if err == nil {
+				return NodeId(response.Node), nil
+			}
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			if log.IsDebug() {
+				log.With("node", this.config.Id).With("leader", current).WithError(err).Debug("failed to forward assignment to leader")
+			}
+		}
+
+		// wait for the assignment to be committed or for a new
+		// leader, and retry now and then in case the leader is gone
+		timer := time.NewTimer(this.config.ElectionTimeout)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-this.ctx.Done():
+			timer.Stop()
+			return "", ErrStopped
+		}
+		timer.Stop()
+	}
+}
+
+// Replicated records the offset up to which the node replicated a stream
+// that another node leads. The node reports it to the leader, which
+// assigns the stream to the node that replicated it the furthest when
+// the node that leads it stops answering.
+func (this *Node) Replicated(id string, offset uint64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.replicated[id] = offset
+}
+
+// DefineTopic handles the definition of a topic that a node
+// forwarded to the leader. It fails on a node that is not the leader.
+func (this *Node) DefineTopic(ctx context.Context, request *api.DefineTopicRequest) (*api.DefineTopicResponse, error) {
+	this.lock.Lock()
+	if this.ctx.Err() != nil {
+		this.lock.Unlock()
+		return nil, ErrStopped
+	}
+	if this.role != leader {
+		this.lock.Unlock()
+		return nil, grpc.Errorf(codes.Unavailable, "node %v is not the leader", this.config.Id)
+	}
+	this.lock.Unlock()
+
+	index, err := this.define(ctx, request.Topic, int(request.Partitions))
+	if err != nil {
+		return nil, err
+	}
+	return &api.DefineTopicResponse{
+		Index: index,
+	}, nil
+}
+
+// CreateTopic creates the topic with the number of partitions, the
+// streams of the partitions are assigned like any other stream. It
+// fails with a grpc AlreadyExists error if the topic exists. A node
+// that is not the leader forwards the topic to the leader. CreateTopic
+// waits until the topic is committed, or until the context is done.
+func (this *Node) CreateTopic(ctx context.Context, name string, partitions int) error {
+	if partitions < 1 {
+		return grpc.Errorf(codes.InvalidArgument, "a topic has at least one partition")
+	}
+	_, err := this.define(ctx, name, partitions)
+	return err
+}
+
+// DeleteTopic deletes the topic, but not the streams of its
+// partitions. It fails with a grpc NotFound error if the topic
+// doesn't exist, and waits like CreateTopic.
+func (this *Node) DeleteTopic(ctx context.Context, name string) error {
+	_, err := this.define(ctx, name, 0)
+	return err
+}
+
+// define creates the topic with the number of partitions, or deletes
+// it without partitions, at the leader. It returns the index of the
+// entry that defines the topic once the node applied it.
+func (this *Node) define(ctx context.Context, name string, partitions int) (uint64, error) {
+	for {
+		this.lock.Lock()
+		if this.ctx.Err() != nil {
+			this.lock.Unlock()
+			return 0, ErrStopped
+		}
+
+		changed := this.changed
+		current := this.leader
+
+		if this.role == leader {
+			index, err := this.defineAsLeader(name, partitions)
+			term := this.term
+			this.lock.Unlock()
+
+			if err != nil {
+				return 0, err
+			}
+			return index, this.waitForTopic(ctx, name, partitions, index, term)
+		}
+		this.lock.Unlock()
+
+		if current != "" {
+			response, err := this.transport.DefineTopic(ctx, current, &api.DefineTopicRequest{
+				Topic:      name,
+				Partitions: uint32(partitions),
+			})
+			if err == nil {
+				// the topic is committed, the node knows
+				// it once it applied the entry as well
+				return response.Index, this.waitForApplied(ctx, response.Index)
+			}
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			if code := grpc.Code(err); code == codes.AlreadyExists || code == codes.NotFound {
+				return 0, err
+			}
+			if log.IsDebug() {
+				log.With("node", this.config.Id).With("leader", current).WithError(err).Debug("failed to forward topic to leader")
+			}
+		}
+
+		// wait for a new leader, and retry now and
+		// then in case the leader is gone
+		timer := time.NewTimer(this.config.ElectionTimeout)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-this.ctx.Done():
+			timer.Stop()
+			return 0, ErrStopped
+		}
+		timer.Stop()
+	}
+}
+
+// defineAsLeader appends the definition of the topic to the log and
+// returns its index. It fails if the topic exists, or if it doesn't
+// exist when it is deleted, including the topics that are not committed
+// yet. It must be called with the lock held.
+func (this *Node) defineAsLeader(name string, partitions int) (uint64, error) {
+	_, exists := this.topics[name]
+	for _, e := range this.log[this.lastApplied-this.snapshot+1:] {
+		if e.Topic == name {
+			exists = e.Partitions > 0
+		}
+	}
+
+	if exists && partitions > 0 {
+		return 0, grpc.Errorf(codes.AlreadyExists, "topic %v already exists", name)
+	}
+	if !exists && partitions == 0 {
+		return 0, grpc.Errorf(codes.NotFound, "topic %v not found", name)
+	}
+
+	this.log = append(this.log, entry{
+		Term:       this.term,
+		Topic:      name,
+		Partitions: partitions,
+	})
+	this.save()
+	this.advanceCommit()
+	this.broadcast()
+	return this.lastIndex(), nil
+}
+
+// waitForTopic waits until the definition of the topic at the index is
+// applied. It fails if the node lost the leadership before, the topic
+// might not be defined then.
+func (this *Node) waitForTopic(ctx context.Context, name string, partitions int, index uint64, term uint64) error {
+	for {
+		this.lock.Lock()
+		if this.lastApplied >= index || this.term != term {
+			defined := this.topics[name] == partitions
+			this.lock.Unlock()
+
+			if !defined {
+				return grpc.Errorf(codes.Unavailable, "topic %v is not defined, the leader changed", name)
+			}
+			return nil
+		}
+		changed := this.changed
+		this.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-this.ctx.Done():
+			return ErrStopped
+		}
+	}
+}
+
+// waitForApplied waits until the node applied
+// the committed entries up to the index.
+func (this *Node) waitForApplied(ctx context.Context, index uint64) error {
+	for {
+		this.lock.Lock()
+		applied := this.lastApplied >= index
+		changed := this.changed
+		this.lock.Unlock()
+
+		if applied {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-this.ctx.Done():
+			return ErrStopped
+		}
+	}
+}
+
+// Topic returns the number of partitions of the
+// committed topic, or false if it doesn't exist.
+func (this *Node) Topic(name string) (int, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	partitions, ok := this.topics[name]
+	return partitions, ok
+}
+
+// StreamLeader returns the node the stream is assigned
+// to, or false if the stream is not assigned.
+func (this *Node) StreamLeader(id string) (NodeId, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	node, ok := this.assignments[id]
+	return node, ok
+}
+
+// Assignments returns the committed assignments
+// of all streams known to the node.
+func (this *Node) Assignments() map[string]NodeId {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	assignments := make(map[string]NodeId, len(this.assignments))
+	for id, node := range this.assignments {
+		assignments[id] = node
+	}
+	return assignments
+}
+
+// Changed returns a channel that is closed when the committed
+// assignments, the committed topics or the leader change.
+func (this *Node) Changed() <-chan struct{} {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.changed
+}
+
+// Id returns the id of the node.
+func (this *Node) Id() NodeId {
+	return this.config.Id
+}
+
+// Address returns the address of the node with the given id.
+func (this *Node) Address(node NodeId) (string, bool) {
+	address, ok := this.config.Peers[node]
+	return address, ok
+}
+
+// Leader returns the leader of the cluster
+// as far as the node knows, or an empty id.
+func (this *Node) Leader() NodeId {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.leader
+}
+
+// Stop stops the node and waits for its routines. The
+// transport is not closed, it is owned by the caller.
+func (this *Node) Stop() {
+	this.cancel()
+	this.done.Wait()
+}
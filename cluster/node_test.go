@@ -0,0 +1,471 @@
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// testNode runs a node with its own grpc server on loopback.
+type testNode struct {
+	node      *Node
+	server    *grpc.Server
+	listener  net.Listener
+	transport *GrpcTransport
+	config    Config
+}
+
+type testCluster struct {
+	t         *testing.T
+	directory string
+	nodes     map[NodeId]*testNode
+}
+
+func newTestCluster(t *testing.T, size int, configure ...func(*Config)) *testCluster {
+	directory, err := ioutil.TempDir("", "cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := &testCluster{
+		t:         t,
+		directory: directory,
+		nodes:     make(map[NodeId]*testNode),
+	}
+
+	peers := make(map[NodeId]string)
+	listeners := make(map[NodeId]net.Listener)
+	for i := 0; i < size; i++ {
+		id := NodeId(fmt.Sprintf("node-%v", i))
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listeners[id] = listener
+		peers[id] = listener.Addr().String()
+	}
+
+	for id, listener := range listeners {
+		config := Config{
+			Id:                id,
+			Peers:             peers,
+			Directory:         filepath.Join(directory, string(id)),
+			HeartbeatInterval: 10 * time.Millisecond,
+			ElectionTimeout:   100 * time.Millisecond,
+			NodeTimeout:       300 * time.Millisecond,
+		}
+		for _, configure := range configure {
+			configure(&config)
+		}
+		cluster.start(config, listener)
+	}
+
+	return cluster
+}
+
+func (this *testCluster) start(config Config, listener net.Listener) {
+	transport := NewGrpcTransport(config.Peers)
+	node, err := Start(config, transport)
+	if err != nil {
+		this.t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	api.RegisterClusterServer(server, node)
+	go server.Serve(listener)
+
+	this.nodes[config.Id] = &testNode{
+		node:      node,
+		server:    server,
+		listener:  listener,
+		transport: transport,
+		config:    config,
+	}
+}
+
+func (this *testCluster) stop(id NodeId) {
+	stopped := this.nodes[id]
+	stopped.server.Stop()
+	stopped.node.Stop()
+	stopped.transport.Close()
+	delete(this.nodes, id)
+}
+
+// restart starts a stopped node again on the same address.
+func (this *testCluster) restart(config Config) {
+	listener, err := net.Listen("tcp", config.Peers[config.Id])
+	if err != nil {
+		this.t.Fatal(err)
+	}
+	this.start(config, listener)
+}
+
+func (this *testCluster) close() {
+	for id := range this.nodes {
+		this.stop(id)
+	}
+	os.RemoveAll(this.directory)
+}
+
+// leader waits until all running nodes agree on a leader that runs.
+func (this *testCluster) leader() NodeId {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		leaders := make(map[NodeId]bool)
+		for _, running := range this.nodes {
+			leaders[running.node.Leader()] = true
+		}
+
+		if len(leaders) == 1 && !leaders[""] {
+			for leader := range leaders {
+				if _, ok := this.nodes[leader]; ok {
+					return leader
+				}
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	this.t.Fatal("no leader elected")
+	return ""
+}
+
+// eventually waits until the stream is assigned to
+// the same node on all running nodes and returns it.
+func (this *testCluster) eventually(id string) NodeId {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		nodes := make(map[NodeId]bool)
+		for _, running := range this.nodes {
+			node, _ := running.node.StreamLeader(id)
+			nodes[node] = true
+		}
+
+		if len(nodes) == 1 && !nodes[""] {
+			for node := range nodes {
+				return node
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	this.t.Fatalf("stream %v not assigned on all nodes", id)
+	return ""
+}
+
+func (this *testCluster) follower(leader NodeId) *Node {
+	for id, running := range this.nodes {
+		if id != leader {
+			return running.node
+		}
+	}
+	return nil
+}
+
+func TestElection(t *testing.T) {
+	cluster := newTestCluster(t, 3)
+	defer cluster.close()
+
+	leader := cluster.leader()
+	assert.Contains(t, cluster.nodes, leader)
+}
+
+func TestAssignFromFollower(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newTestCluster(t, 3)
+	defer cluster.close()
+
+	follower := cluster.follower(cluster.leader())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assigned := make(map[NodeId]int)
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("stream-%v", i)
+		node, err := follower.Assign(ctx, id)
+		assert.Nil(err)
+		assert.Equal(node, cluster.eventually(id))
+
+		assigned[node]++
+	}
+
+	// the streams are spread over the nodes
+	assert.Len(assigned, 3)
+
+	// assigning again returns the same node
+	node, err := follower.Assign(ctx, "stream-0")
+	assert.Nil(err)
+	assert.Equal(cluster.eventually("stream-0"), node)
+}
+
+func TestFailover(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newTestCluster(t, 3)
+	defer cluster.close()
+
+	leader := cluster.leader()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 6; i++ {
+		_, err := cluster.nodes[leader].node.Assign(ctx, fmt.Sprintf("stream-%v", i))
+		assert.Nil(err)
+	}
+
+	cluster.stop(leader)
+	elected := cluster.leader()
+	assert.NotEqual(leader, elected)
+
+	// the streams of the stopped node move to the nodes that are left
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("stream-%v", i)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if node := cluster.eventually(id); node != leader {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.NotEqual(leader, cluster.eventually(id), id)
+	}
+}
+
+func TestFailoverToMostReplicated(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newTestCluster(t, 3)
+	defer cluster.close()
+
+	leader := cluster.leader()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := cluster.nodes[leader].node.Assign(ctx, "replicated")
+	assert.Nil(err)
+	stopped := cluster.eventually("replicated")
+
+	// the node with the highest id replicated the stream the furthest,
+	// it wouldn't get the stream if the loads of the nodes decided
+	var others []NodeId
+	for id := range cluster.nodes {
+		if id != stopped {
+			others = append(others, id)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i] < others[j] })
+
+	cluster.nodes[others[0]].node.Replicated("replicated", 5)
+	cluster.nodes[others[1]].node.Replicated("replicated", 10)
+
+	cluster.stop(stopped)
+	cluster.leader()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if node := cluster.eventually("replicated"); node != stopped {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(others[1], cluster.eventually("replicated"))
+}
+
+func TestRestart(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newTestCluster(t, 3)
+	defer cluster.close()
+
+	leader := cluster.leader()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assigned, err := cluster.nodes[leader].node.Assign(ctx, "restarted")
+	assert.Nil(err)
+
+	// a node that restarts loads the assignments from its
+	// log, they are applied once the leader commits again
+	restarted := cluster.follower(leader).config
+	cluster.stop(restarted.Id)
+	cluster.restart(restarted)
+
+	assert.Equal(assigned, cluster.eventually("restarted"))
+}
+
+// topicEverywhere waits until all running nodes know the topic with the
+// number of partitions, or don't know it if partitions is 0.
+func (this *testCluster) topicEverywhere(name string, partitions int) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		known := 0
+		for _, running := range this.nodes {
+			if p, _ := running.node.Topic(name); p == partitions {
+				known++
+			}
+		}
+
+		if known == len(this.nodes) {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestTopics(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newTestCluster(t, 3)
+	defer cluster.close()
+
+	follower := cluster.follower(cluster.leader())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Nil(follower.CreateTopic(ctx, "orders", 4))
+	partitions, ok := follower.Topic("orders")
+	assert.True(ok, "topic committed when created")
+	assert.Equal(4, partitions)
+	assert.True(cluster.topicEverywhere("orders", 4), "topic on all nodes")
+
+	err := follower.CreateTopic(ctx, "orders", 2)
+	assert.Equal(codes.AlreadyExists, grpc.Code(err), "create existing topic")
+
+	assert.Nil(follower.DeleteTopic(ctx, "orders"))
+	assert.True(cluster.topicEverywhere("orders", 0), "topic deleted on all nodes")
+
+	err = follower.DeleteTopic(ctx, "orders")
+	assert.Equal(codes.NotFound, grpc.Code(err), "delete deleted topic")
+
+	// the topics survive the loss of the leader
+	leader := cluster.leader()
+	assert.Nil(cluster.nodes[leader].node.CreateTopic(ctx, "payments", 2))
+	cluster.stop(leader)
+	cluster.leader()
+
+	assert.True(cluster.topicEverywhere("payments", 2), "topic after failover")
+}
+
+func snapshotEvery(entries int) func(*Config) {
+	return func(config *Config) {
+		config.SnapshotEntries = entries
+	}
+}
+
+// snapshotIndex returns the index of the last
+// entry in the snapshot of the node.
+func snapshotIndex(node *Node) uint64 {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+
+	return node.snapshot
+}
+
+func TestSnapshotCompactsLog(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newTestCluster(t, 3, snapshotEvery(4))
+	defer cluster.close()
+
+	leader := cluster.leader()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		_, err := cluster.nodes[leader].node.Assign(ctx, fmt.Sprintf("stream-%v", i))
+		assert.Nil(err)
+	}
+	for i := 0; i < 10; i++ {
+		cluster.eventually(fmt.Sprintf("stream-%v", i))
+	}
+
+	for id, running := range cluster.nodes {
+		running.node.lock.Lock()
+		assert.True(running.node.snapshot > 0, "snapshot of %v", id)
+		assert.True(len(running.node.log) <= 5, "log of %v", id)
+		running.node.lock.Unlock()
+	}
+
+	// a node that restarts has the assignments of its snapshot right
+	// away, the first entry of the leader doesn't assign a stream
+	restarted := cluster.follower(leader).config
+	index := snapshotIndex(cluster.nodes[restarted.Id].node)
+	cluster.stop(restarted.Id)
+	cluster.restart(restarted)
+
+	assignments := cluster.nodes[restarted.Id].node.Assignments()
+	assert.Len(assignments, int(index)-1, "assignments in snapshot")
+}
+
+func TestInstallSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newTestCluster(t, 3, snapshotEvery(4))
+	defer cluster.close()
+
+	leader := cluster.leader()
+	stopped := cluster.follower(leader).config
+	cluster.stop(stopped.Id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		_, err := cluster.nodes[leader].node.Assign(ctx, fmt.Sprintf("stream-%v", i))
+		assert.Nil(err)
+	}
+	assert.True(snapshotIndex(cluster.nodes[leader].node) > 0, "snapshot of leader")
+
+	// the entries the node missed are compacted, it gets a snapshot
+	assert.Nil(cluster.nodes[leader].node.CreateTopic(ctx, "orders", 3))
+
+	cluster.restart(stopped)
+	for i := 0; i < 10; i++ {
+		cluster.eventually(fmt.Sprintf("stream-%v", i))
+	}
+	assert.True(snapshotIndex(cluster.nodes[stopped.Id].node) > 0, "snapshot of restarted node")
+	assert.True(cluster.topicEverywhere("orders", 3), "topics in snapshot")
+}
+
+func TestFollowSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	log := []entry{{Term: 1}, {Term: 1, Stream: "a"}, {Term: 2, Stream: "b"}, {Term: 2, Stream: "c"}}
+
+	tests := []struct {
+		name     string
+		loaded   state
+		saved    snapshot
+		expected []entry
+	}{
+		{"no snapshot", state{Log: log}, snapshot{}, log},
+		{"log follows snapshot", state{Snapshot: 2, Log: log[2:]}, snapshot{Index: 2, Term: 1}, log[2:]},
+		{"crash after snapshot", state{Log: log}, snapshot{Index: 2, Term: 1}, log[2:]},
+		{"log without snapshot entry", state{Log: log[:1]}, snapshot{Index: 2, Term: 1}, nil},
+		{"log differs from snapshot", state{Log: log}, snapshot{Index: 3, Term: 3}, nil},
+	}
+
+	for _, test := range tests {
+		entries, err := followSnapshot(test.loaded, test.saved)
+		assert.Nil(err, test.name)
+		assert.Equal(test.expected, entries, test.name)
+	}
+
+	_, err := followSnapshot(state{Snapshot: 3}, snapshot{Index: 2})
+	assert.NotNil(err, "log after missing snapshot")
+}
@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// STATE_FILENAME is the name of the file in the directory of a node
+	// that holds its term, its vote and its log.
+	STATE_FILENAME = "state"
+
+	// SNAPSHOT_FILENAME is the name of the file in the directory of a
+	// node that holds the assignments of the entries it compacted.
+	SNAPSHOT_FILENAME = "snapshot"
+)
+
+// entry is an entry in the log of a node, it assigns the stream to
+// the node that leads it, or defines the topic with the number of
+// partitions. A topic without partitions is deleted.
+type entry struct {
+	Term   uint64
+	Stream string
+	Node   NodeId
+
+	Topic      string
+	Partitions int
+}
+
+// state is the part of a node that must survive a restart, so the node
+// never votes twice in a term and never forgets the entries it accepted.
+type state struct {
+	Term     uint64
+	VotedFor NodeId
+
+	// Snapshot is the index of the last entry in the
+	// snapshot, the log holds the entries after it
+	Snapshot uint64
+	Log      []entry
+}
+
+// snapshot holds the committed assignments and topics up to and
+// including the entry at the index. The entries it holds are dropped
+// from the log, so the log doesn't grow without bounds.
+type snapshot struct {
+	Index       uint64
+	Term        uint64
+	Assignments map[string]NodeId
+	Topics      map[string]int
+}
+
+func loadState(directory string) (state, error) {
+	if err := os.MkdirAll(directory, 0777); err != nil {
+		return state{}, err
+	}
+
+	var loaded state
+	err := readFile(filepath.Join(directory, STATE_FILENAME), &loaded)
+	return loaded, err
+}
+
+// saveState replaces the state file. The log only holds the entries
+// after the snapshot, so it is small enough to write as a whole.
+func saveState(directory string, saved state) error {
+	return writeFile(filepath.Join(directory, STATE_FILENAME), saved)
+}
+
+func loadSnapshot(directory string) (snapshot, error) {
+	var loaded snapshot
+	err := readFile(filepath.Join(directory, SNAPSHOT_FILENAME), &loaded)
+	return loaded, err
+}
+
+// saveSnapshot replaces the snapshot file. It is saved before the
+// state without the entries it holds, a crash in between leaves a
+// log that starts before the snapshot.
+func saveSnapshot(directory string, saved snapshot) error {
+	return writeFile(filepath.Join(directory, SNAPSHOT_FILENAME), saved)
+}
+
+// readFile reads the value from the JSON file, a file
+// that doesn't exist leaves the value as it is.
+func readFile(filename string, value interface{}) error {
+	buffer, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(buffer, value); err != nil {
+		return fmt.Errorf("invalid cluster state in %v: %v", filename, err)
+	}
+	return nil
+}
+
+// writeFile replaces the file with the value as JSON. The value is
+// written to a new file that is synced before it is moved over the
+// old one.
+func writeFile(filename string, value interface{}) error {
+	buffer, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename+".new", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(buffer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".new", filename)
+}
@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/pjvds/strand/api"
+	"golang.org/x/net/context"
+)
+
+// Transport carries the calls between the nodes of a cluster.
+type Transport interface {
+	RequestVote(ctx context.Context, node NodeId, request *api.VoteRequest) (*api.VoteResponse, error)
+	AppendEntries(ctx context.Context, node NodeId, request *api.AppendEntriesRequest) (*api.AppendEntriesResponse, error)
+	AssignStream(ctx context.Context, node NodeId, request *api.AssignStreamRequest) (*api.AssignStreamResponse, error)
+	InstallSnapshot(ctx context.Context, node NodeId, request *api.InstallSnapshotRequest) (*api.InstallSnapshotResponse, error)
+	DefineTopic(ctx context.Context, node NodeId, request *api.DefineTopicRequest) (*api.DefineTopicResponse, error)
+}
+
+// GrpcTransport calls the Cluster service of the other nodes. The
+// connections are dialed the first time a node is called.
+type GrpcTransport struct {
+	peers map[NodeId]string
+
+	lock    sync.Mutex
+	conns   map[NodeId]*grpc.ClientConn
+	clients map[NodeId]api.ClusterClient
+}
+
+// NewGrpcTransport creates a transport to the
+// nodes at the addresses in peers.
+func NewGrpcTransport(peers map[NodeId]string) *GrpcTransport {
+	return &GrpcTransport{
+		peers:   peers,
+		conns:   make(map[NodeId]*grpc.ClientConn),
+		clients: make(map[NodeId]api.ClusterClient),
+	}
+}
+
+func (this *GrpcTransport) client(node NodeId) (api.ClusterClient, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if client, ok := this.clients[node]; ok {
+		return client, nil
+	}
+
+	address, ok := this.peers[node]
+	if !ok {
+		return nil, fmt.Errorf("unknown node %v", node)
+	}
+
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	client := api.NewClusterClient(conn)
+	this.conns[node] = conn
+	this.clients[node] = client
+	return client, nil
+}
+
+func (this *GrpcTransport) RequestVote(ctx context.Context, node NodeId, request *api.VoteRequest) (*api.VoteResponse, error) {
+	client, err := this.client(node)
+	if err != nil {
+		return nil, err
+	}
+	return client.RequestVote(ctx, request)
+}
+
+func (this *GrpcTransport) AppendEntries(ctx context.Context, node NodeId, request *api.AppendEntriesRequest) (*api.AppendEntriesResponse, error) {
+	client, err := this.client(node)
+	if err != nil {
+		return nil, err
+	}
+	return client.AppendEntries(ctx, request)
+}
+
+func (this *GrpcTransport) AssignStream(ctx context.Context, node NodeId, request *api.AssignStreamRequest) (*api.AssignStreamResponse, error) {
+	client, err := this.client(node)
+	if err != nil {
+		return nil, err
+	}
+	return client.AssignStream(ctx, request)
+}
+
+func (this *GrpcTransport) InstallSnapshot(ctx context.Context, node NodeId, request *api.InstallSnapshotRequest) (*api.InstallSnapshotResponse, error) {
+	client, err := this.client(node)
+	if err != nil {
+		return nil, err
+	}
+	return client.InstallSnapshot(ctx, request)
+}
+
+func (this *GrpcTransport) DefineTopic(ctx context.Context, node NodeId, request *api.DefineTopicRequest) (*api.DefineTopicResponse, error) {
+	client, err := this.client(node)
+	if err != nil {
+		return nil, err
+	}
+	return client.DefineTopic(ctx, request)
+}
+
+// Close closes the connections to the other nodes.
+func (this *GrpcTransport) Close() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for node, conn := range this.conns {
+		conn.Close()
+		delete(this.conns, node)
+		delete(this.clients, node)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pjvds/tidy"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+
+	"github.com/pjvds/strand/stream"
+)
+
+// Config holds the settings of the server. The settings are read from
+// the config file, the environment and the flags, in that order. A
+// setting from a later source overrides the same setting from an
+// earlier one, settings that are not set keep their default.
+type Config struct {
+	// Listen is the address the server listens on.
+	Listen string `yaml:"listen"`
+
+	// Data is the directory that holds the streams.
+	Data string `yaml:"data"`
+
+	// LogLevel is the level from which the server logs, one
+	// of debug, info, notice, warn, error or fatal.
+	LogLevel string `yaml:"log_level"`
+
+	// Strict only writes to streams that are created explicitly.
+	Strict bool `yaml:"strict"`
+
+	// ShutdownTimeout is the time the writes in progress get
+	// to finish when the server is asked to shut down.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Limits  LimitsConfig  `yaml:"limits"`
+	Streams StreamsConfig `yaml:"streams"`
+	Follow  FollowConfig  `yaml:"follow"`
+	Cluster ClusterConfig `yaml:"cluster"`
+}
+
+type LimitsConfig struct {
+	// MaxRequestBytes is the size of the largest request the server
+	// accepts, it limits the size of a write.
+	MaxRequestBytes int `yaml:"max_request_bytes"`
+
+	// MaxConcurrentStreams is the number of calls, subscriptions
+	// included, a connection can have at a time, 0 has no limit.
+	MaxConcurrentStreams uint32 `yaml:"max_concurrent_streams"`
+}
+
+// StreamsConfig holds the settings of the streams that
+// are not created with settings of their own.
+type StreamsConfig struct {
+	SegmentMaxBytes      int64         `yaml:"segment_max_bytes"`
+	SegmentMaxAge        time.Duration `yaml:"segment_max_age"`
+	RetentionMaxAge      time.Duration `yaml:"retention_max_age"`
+	RetentionMaxBytes    int64         `yaml:"retention_max_bytes"`
+	RetentionMaxMessages uint64        `yaml:"retention_max_messages"`
+	MaxMessageBytes      int           `yaml:"max_message_bytes"`
+
+	// Durability is one of none, always or group.
+	Durability   string        `yaml:"durability"`
+	SyncInterval time.Duration `yaml:"sync_interval"`
+	SyncBytes    int64         `yaml:"sync_bytes"`
+}
+
+// FollowConfig makes the server a follower of the leader at the
+// address, the id identifies the follower at the leader.
+type FollowConfig struct {
+	Leader string `yaml:"leader"`
+	Id     string `yaml:"id"`
+}
+
+// ClusterConfig makes the server a node of a cluster. The peers
+// hold the address of every node by its id, including the server
+// itself.
+type ClusterConfig struct {
+	Id                string            `yaml:"id"`
+	Peers             map[string]string `yaml:"peers"`
+	HeartbeatInterval time.Duration     `yaml:"heartbeat_interval"`
+	ElectionTimeout   time.Duration     `yaml:"election_timeout"`
+	NodeTimeout       time.Duration     `yaml:"node_timeout"`
+}
+
+var logLevels = map[string]tidy.Level{
+	"debug":  tidy.DEBUG,
+	"info":   tidy.INFO,
+	"notice": tidy.NOTICE,
+	"warn":   tidy.WARN,
+	"error":  tidy.ERROR,
+	"fatal":  tidy.FATAL,
+}
+
+var durabilities = map[string]stream.Durability{
+	"none":   stream.SyncNone,
+	"always": stream.SyncAlways,
+	"group":  stream.SyncGroup,
+}
+
+// DefaultConfig listens on port 6300, keeps the streams in ./data,
+// logs from info, gives writes 30 seconds to finish on shutdown and
+// uses the default stream options.
+func DefaultConfig() Config {
+	defaults := stream.DefaultOptions
+
+	return Config{
+		Listen:          ":6300",
+		Data:            "data",
+		LogLevel:        "info",
+		ShutdownTimeout: 30 * time.Second,
+		Limits: LimitsConfig{
+			MaxRequestBytes: 4 * 1024 * 1024,
+		},
+		Streams: StreamsConfig{
+			SegmentMaxBytes:      defaults.SegmentMaxBytes,
+			SegmentMaxAge:        defaults.SegmentMaxAge,
+			RetentionMaxAge:      defaults.RetentionMaxAge,
+			RetentionMaxBytes:    defaults.RetentionMaxBytes,
+			RetentionMaxMessages: defaults.RetentionMaxMessages,
+			MaxMessageBytes:      defaults.MaxMessageBytes,
+			Durability:           "none",
+			SyncInterval:         defaults.SyncInterval,
+			SyncBytes:            defaults.SyncBytes,
+		},
+	}
+}
+
+var flags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "config",
+		Usage:  "the YAML file to read the settings from",
+		EnvVar: "STRAND_CONFIG",
+	},
+	cli.StringFlag{
+		Name:   "listen",
+		Usage:  "the address to listen on",
+		EnvVar: "STRAND_LISTEN",
+	},
+	cli.StringFlag{
+		Name:   "data",
+		Usage:  "the directory that holds the streams",
+		EnvVar: "STRAND_DATA",
+	},
+	cli.StringFlag{
+		Name:   "log-level",
+		Usage:  "the level to log from: debug, info, notice, warn, error or fatal",
+		EnvVar: "STRAND_LOG_LEVEL",
+	},
+	cli.BoolFlag{
+		Name:   "strict",
+		Usage:  "only write to streams that are created explicitly",
+		EnvVar: "STRAND_STRICT",
+	},
+	cli.DurationFlag{
+		Name:   "shutdown-timeout",
+		Usage:  "the time the writes in progress get to finish on shutdown",
+		EnvVar: "STRAND_SHUTDOWN_TIMEOUT",
+	},
+	cli.IntFlag{
+		Name:   "max-request-bytes",
+		Usage:  "the size of the largest request",
+		EnvVar: "STRAND_MAX_REQUEST_BYTES",
+	},
+	cli.IntFlag{
+		Name:   "max-message-bytes",
+		Usage:  "the size of the largest message of a stream, 0 allows any size",
+		EnvVar: "STRAND_MAX_MESSAGE_BYTES",
+	},
+	cli.StringFlag{
+		Name:   "durability",
+		Usage:  "when writes are synced to disk: none, always or group",
+		EnvVar: "STRAND_DURABILITY",
+	},
+	cli.DurationFlag{
+		Name:   "retention-max-age",
+		Usage:  "the age after which segments are deleted, 0 retains them forever",
+		EnvVar: "STRAND_RETENTION_MAX_AGE",
+	},
+	cli.Int64Flag{
+		Name:   "retention-max-bytes",
+		Usage:  "the size of a stream after which its oldest segments are deleted, 0 has no limit",
+		EnvVar: "STRAND_RETENTION_MAX_BYTES",
+	},
+	cli.StringFlag{
+		Name:   "follow",
+		Usage:  "the address of the leader to follow",
+		EnvVar: "STRAND_FOLLOW",
+	},
+	cli.StringFlag{
+		Name:   "follower-id",
+		Usage:  "the id of the follower at the leader, the host name by default",
+		EnvVar: "STRAND_FOLLOWER_ID",
+	},
+	cli.StringFlag{
+		Name:   "cluster-id",
+		Usage:  "the id of the node in the cluster",
+		EnvVar: "STRAND_CLUSTER_ID",
+	},
+	cli.StringSliceFlag{
+		Name:   "cluster-peer",
+		Usage:  "a node of the cluster as id=address, once for every node including this one",
+		EnvVar: "STRAND_CLUSTER_PEERS",
+	},
+}
+
+// configure reads the config file, if any, applies the environment
+// and the flags to it and validates the result.
+func configure(c *cli.Context) (Config, error) {
+	config := DefaultConfig()
+
+	if filename := c.String("config"); filename != "" {
+		buffer, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read config file: %v", err)
+		}
+		if err := yaml.UnmarshalStrict(buffer, &config); err != nil {
+			return Config{}, fmt.Errorf("invalid config file %v: %v", filename, err)
+		}
+	}
+
+	if c.IsSet("listen") {
+		config.Listen = c.String("listen")
+	}
+	if c.IsSet("data") {
+		config.Data = c.String("data")
+	}
+	if c.IsSet("log-level") {
+		config.LogLevel = c.String("log-level")
+	}
+	if c.IsSet("strict") {
+		config.Strict = c.Bool("strict")
+	}
+	if c.IsSet("shutdown-timeout") {
+		config.ShutdownTimeout = c.Duration("shutdown-timeout")
+	}
+	if c.IsSet("max-request-bytes") {
+		config.Limits.MaxRequestBytes = c.Int("max-request-bytes")
+	}
+	if c.IsSet("max-message-bytes") {
+		config.Streams.MaxMessageBytes = c.Int("max-message-bytes")
+	}
+	if c.IsSet("durability") {
+		config.Streams.Durability = c.String("durability")
+	}
+	if c.IsSet("retention-max-age") {
+		config.Streams.RetentionMaxAge = c.Duration("retention-max-age")
+	}
+	if c.IsSet("retention-max-bytes") {
+		config.Streams.RetentionMaxBytes = c.Int64("retention-max-bytes")
+	}
+	if c.IsSet("follow") {
+		config.Follow.Leader = c.String("follow")
+	}
+	if c.IsSet("follower-id") {
+		config.Follow.Id = c.String("follower-id")
+	}
+	if c.IsSet("cluster-id") {
+		config.Cluster.Id = c.String("cluster-id")
+	}
+	if c.IsSet("cluster-peer") {
+		config.Cluster.Peers = make(map[string]string)
+		for _, peer := range c.StringSlice("cluster-peer") {
+			parts := strings.SplitN(peer, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return Config{}, fmt.Errorf("invalid cluster peer %q, expected id=address", peer)
+			}
+			config.Cluster.Peers[parts[0]] = parts[1]
+		}
+	}
+
+	if config.Follow.Leader != "" && config.Follow.Id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to get host name for the follower id: %v", err)
+		}
+		config.Follow.Id = hostname
+	}
+
+	if err := config.validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// validate returns an error that names the first invalid setting.
+func (this Config) validate() error {
+	if _, _, err := net.SplitHostPort(this.Listen); err != nil {
+		return fmt.Errorf("invalid listen address %q: %v", this.Listen, err)
+	}
+	if this.Data == "" {
+		return fmt.Errorf("data directory is empty")
+	}
+	if _, ok := logLevels[this.LogLevel]; !ok {
+		return fmt.Errorf("invalid log level %q, use debug, info, notice, warn, error or fatal", this.LogLevel)
+	}
+
+	if this.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid shutdown timeout %v, it must be more than 0", this.ShutdownTimeout)
+	}
+
+	if this.Limits.MaxRequestBytes <= 0 {
+		return fmt.Errorf("invalid max request bytes %v, it must be more than 0", this.Limits.MaxRequestBytes)
+	}
+
+	streams := this.Streams
+	if streams.SegmentMaxBytes <= 0 {
+		return fmt.Errorf("invalid segment max bytes %v, it must be more than 0", streams.SegmentMaxBytes)
+	}
+	if streams.SegmentMaxAge < 0 || streams.RetentionMaxAge < 0 || streams.RetentionMaxBytes < 0 ||
+		streams.SyncInterval < 0 || streams.SyncBytes < 0 {
+		return fmt.Errorf("segment, retention and sync settings can't be negative")
+	}
+	if streams.MaxMessageBytes < 0 {
+		return fmt.Errorf("invalid max message bytes %v, it can't be negative", streams.MaxMessageBytes)
+	}
+	if streams.MaxMessageBytes > this.Limits.MaxRequestBytes {
+		return fmt.Errorf("max message bytes %v is more than the max request bytes %v, messages that size can't be written",
+			streams.MaxMessageBytes, this.Limits.MaxRequestBytes)
+	}
+	if _, ok := durabilities[streams.Durability]; !ok {
+		return fmt.Errorf("invalid durability %q, use none, always or group", streams.Durability)
+	}
+
+	if this.Follow.Leader != "" && len(this.Cluster.Peers) > 0 {
+		return fmt.Errorf("a server either follows a leader or is a node of a cluster, not both")
+	}
+
+	if this.Cluster.Id != "" || len(this.Cluster.Peers) > 0 {
+		if _, ok := this.Cluster.Peers[this.Cluster.Id]; !ok {
+			return fmt.Errorf("cluster id %q is not one of the cluster peers", this.Cluster.Id)
+		}
+		if this.Cluster.HeartbeatInterval < 0 || this.Cluster.ElectionTimeout < 0 || this.Cluster.NodeTimeout < 0 {
+			return fmt.Errorf("cluster timeouts can't be negative")
+		}
+		if this.Cluster.ElectionTimeout > 0 && this.Cluster.HeartbeatInterval >= this.Cluster.ElectionTimeout {
+			return fmt.Errorf("cluster heartbeat interval %v must be shorter than the election timeout %v",
+				this.Cluster.HeartbeatInterval, this.Cluster.ElectionTimeout)
+		}
+	}
+
+	return nil
+}
+
+// options returns the stream options of the settings.
+func (this StreamsConfig) options() stream.Options {
+	options := stream.DefaultOptions
+	options.SegmentMaxBytes = this.SegmentMaxBytes
+	options.SegmentMaxAge = this.SegmentMaxAge
+	options.RetentionMaxAge = this.RetentionMaxAge
+	options.RetentionMaxBytes = this.RetentionMaxBytes
+	options.RetentionMaxMessages = this.RetentionMaxMessages
+	options.MaxMessageBytes = this.MaxMessageBytes
+	options.Durability = durabilities[this.Durability]
+	options.SyncInterval = this.SyncInterval
+	options.SyncBytes = this.SyncBytes
+	return options
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// run configures strandd with the config file, if not empty,
+// the environment variables and the command line arguments.
+func run(t *testing.T, file string, env map[string]string, args ...string) (Config, error) {
+	if file != "" {
+		f, err := ioutil.TempFile("", "strandd-config")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+
+		f.WriteString(file)
+		f.Close()
+		args = append([]string{"--config", f.Name()}, args...)
+	}
+
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	var config Config
+	var configured error
+
+	app := cli.NewApp()
+	app.Flags = flags
+	app.Writer = ioutil.Discard
+	app.ErrWriter = ioutil.Discard
+	app.Action = func(c *cli.Context) error {
+		config, configured = configure(c)
+		return nil
+	}
+
+	if err := app.Run(append([]string{"strandd"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return config, configured
+}
+
+func TestConfigureDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := run(t, "", nil)
+	assert.Nil(err)
+	assert.Equal(DefaultConfig(), config)
+}
+
+func TestConfigurePrecedence(t *testing.T) {
+	file := "listen: \":7000\"\nstreams:\n  durability: always\n"
+
+	tests := []struct {
+		name       string
+		file       string
+		env        map[string]string
+		args       []string
+		listen     string
+		durability string
+	}{
+		{"defaults", "", nil, nil, ":6300", "none"},
+		{"file", file, nil, nil, ":7000", "always"},
+		{"environment", "", map[string]string{"STRAND_LISTEN": ":8000"}, nil, ":8000", "none"},
+		{"environment over file", file, map[string]string{"STRAND_LISTEN": ":8000"}, nil, ":8000", "always"},
+		{"flag over file", file, nil, []string{"--durability", "group"}, ":7000", "group"},
+		{"flag over environment", file, map[string]string{"STRAND_LISTEN": ":8000"}, []string{"--listen", ":9000"}, ":9000", "always"},
+	}
+
+	for _, test := range tests {
+		config, err := run(t, test.file, test.env, test.args...)
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.listen, config.Listen, test.name)
+		assert.Equal(t, test.durability, config.Streams.Durability, test.name)
+	}
+}
+
+func TestConfigureFile(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := run(t, `
+data: /var/lib/strand
+shutdown_timeout: 5s
+streams:
+  retention_max_age: 24h
+cluster:
+  id: a
+  peers:
+    a: "localhost:6300"
+    b: "localhost:6301"
+`, nil)
+	assert.Nil(err)
+	assert.Equal("/var/lib/strand", config.Data)
+	assert.Equal(5*time.Second, config.ShutdownTimeout)
+	assert.Equal(24*time.Hour, config.Streams.RetentionMaxAge)
+	assert.Equal(DefaultConfig().Streams.SegmentMaxBytes, config.Streams.SegmentMaxBytes, "default of unset setting")
+	assert.Equal(map[string]string{"a": "localhost:6300", "b": "localhost:6301"}, config.Cluster.Peers)
+}
+
+func TestConfigureClusterPeers(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := run(t, "", nil, "--cluster-id", "a", "--cluster-peer", "a=localhost:6300", "--cluster-peer", "b=localhost:6301")
+	assert.Nil(err)
+	assert.Equal(map[string]string{"a": "localhost:6300", "b": "localhost:6301"}, config.Cluster.Peers)
+
+	_, err = run(t, "", nil, "--cluster-id", "a", "--cluster-peer", "a")
+	assert.Error(err, "peer without address")
+}
+
+func TestConfigureFollowerIdDefaultsToHostName(t *testing.T) {
+	assert := assert.New(t)
+	hostname, _ := os.Hostname()
+
+	config, err := run(t, "", nil, "--follow", "leader:6300")
+	assert.Nil(err)
+	assert.Equal(hostname, config.Follow.Id)
+}
+
+func TestConfigureRejectsInvalidFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := run(t, "listen: [", nil)
+	assert.Error(err, "malformed file")
+
+	_, err = run(t, "lissen: \":7000\"\n", nil)
+	assert.Error(err, "unknown setting")
+
+	_, err = run(t, "", nil, "--config", "/nonexistent/strandd.yaml")
+	assert.Error(err, "missing file")
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		valid  bool
+	}{
+		{"defaults", func(c *Config) {}, true},
+		{"listen address", func(c *Config) { c.Listen = "6300" }, false},
+		{"data directory", func(c *Config) { c.Data = "" }, false},
+		{"log level", func(c *Config) { c.LogLevel = "verbose" }, false},
+		{"shutdown timeout", func(c *Config) { c.ShutdownTimeout = 0 }, false},
+		{"max request bytes", func(c *Config) { c.Limits.MaxRequestBytes = 0 }, false},
+		{"segment max bytes", func(c *Config) { c.Streams.SegmentMaxBytes = 0 }, false},
+		{"negative retention", func(c *Config) { c.Streams.RetentionMaxAge = -time.Second }, false},
+		{"negative max message bytes", func(c *Config) { c.Streams.MaxMessageBytes = -1 }, false},
+		{"max message bytes over request", func(c *Config) { c.Streams.MaxMessageBytes = c.Limits.MaxRequestBytes + 1 }, false},
+		{"durability", func(c *Config) { c.Streams.Durability = "sometimes" }, false},
+		{"follower in cluster", func(c *Config) {
+			c.Follow.Leader = "leader:6300"
+			c.Cluster.Id = "a"
+			c.Cluster.Peers = map[string]string{"a": "localhost:6300"}
+		}, false},
+		{"cluster", func(c *Config) {
+			c.Cluster.Id = "a"
+			c.Cluster.Peers = map[string]string{"a": "localhost:6300"}
+		}, true},
+		{"cluster id not a peer", func(c *Config) {
+			c.Cluster.Id = "c"
+			c.Cluster.Peers = map[string]string{"a": "localhost:6300"}
+		}, false},
+		{"negative cluster timeout", func(c *Config) {
+			c.Cluster.Id = "a"
+			c.Cluster.Peers = map[string]string{"a": "localhost:6300"}
+			c.Cluster.NodeTimeout = -time.Second
+		}, false},
+		{"heartbeat after election timeout", func(c *Config) {
+			c.Cluster.Id = "a"
+			c.Cluster.Peers = map[string]string{"a": "localhost:6300"}
+			c.Cluster.HeartbeatInterval = time.Second
+			c.Cluster.ElectionTimeout = time.Second
+		}, false},
+	}
+
+	for _, test := range tests {
+		config := DefaultConfig()
+		test.change(&config)
+
+		err := config.validate()
+		if test.valid {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.Error(t, err, test.name)
+		}
+	}
+}
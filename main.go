@@ -1,41 +1,184 @@
 package main
 
 import (
+	"fmt"
 	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
 
 	"github.com/pjvds/tidy"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
 
 	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/cluster"
 	"github.com/pjvds/strand/server"
+	"github.com/pjvds/strand/stream"
 )
 
 var log = tidy.Configure().
 	LogFromLevel(tidy.DEBUG).To(tidy.Console).
 	MustBuild()
 
+// CLUSTER_DIRECTORY is the directory in the data directory
+// that holds the state of the node of a cluster.
+const CLUSTER_DIRECTORY = ".cluster"
+
 func main() {
-	network := "tcp"
-	address := ":6300"
-	listener, err := net.Listen(network, address)
+	app := cli.NewApp()
+	app.Name = "strandd"
+	app.Usage = "serve strand streams"
+	app.Flags = flags
+	app.Action = func(c *cli.Context) error {
+		config, err := configure(c)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("strandd: %v", err), 2)
+		}
+
+		if err := serve(config); err != nil {
+			return cli.NewExitError(fmt.Sprintf("strandd: %v", err), 1)
+		}
+		return nil
+	}
+
+	app.Run(os.Args)
+}
+
+func serve(config Config) error {
+	level := logLevels[config.LogLevel]
+	log = tidy.Configure().
+		LogFromLevel(level).To(tidy.Console).
+		MustBuild()
+	server.SetLogLevel(level)
+	stream.SetLogLevel(level)
+	cluster.SetLogLevel(level)
+
+	if err := os.MkdirAll(config.Data, 0777); err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+
+	options := []server.Option{
+		server.Defaults(config.Streams.options()),
+	}
+	if config.Strict {
+		options = append(options, server.StrictStreams())
+	}
+	if config.Follow.Leader != "" {
+		options = append(options, server.Follow(config.Follow.Leader, config.Follow.Id))
+	}
+
+	var node *cluster.Node
+	if len(config.Cluster.Peers) > 0 {
+		peers := make(map[cluster.NodeId]string, len(config.Cluster.Peers))
+		for id, address := range config.Cluster.Peers {
+			peers[cluster.NodeId(id)] = address
+		}
+
+		transport := cluster.NewGrpcTransport(peers)
+		defer transport.Close()
+
+		var err error
+		node, err = cluster.Start(cluster.Config{
+			Id:                cluster.NodeId(config.Cluster.Id),
+			Peers:             peers,
+			Directory:         filepath.Join(config.Data, CLUSTER_DIRECTORY),
+			HeartbeatInterval: config.Cluster.HeartbeatInterval,
+			ElectionTimeout:   config.Cluster.ElectionTimeout,
+			NodeTimeout:       config.Cluster.NodeTimeout,
+		}, transport)
+		if err != nil {
+			return fmt.Errorf("failed to start cluster node: %v", err)
+		}
+		defer node.Stop()
+
+		options = append(options, server.Clustered(node))
+	}
+
+	listener, err := net.Listen("tcp", config.Listen)
 	if err != nil {
-		log.WithError(err).With("listen_address", address).Error("listen failure")
-		return
+		return fmt.Errorf("failed to listen on %v: %v", config.Listen, err)
 	}
 
-	grpcServer := grpc.NewServer()
-	strandServer, _ := server.NewServer("/tmp")
+	serverOptions := []grpc.ServerOption{
+		grpc.MaxMsgSize(config.Limits.MaxRequestBytes),
+	}
+	if config.Limits.MaxConcurrentStreams > 0 {
+		serverOptions = append(serverOptions, grpc.MaxConcurrentStreams(config.Limits.MaxConcurrentStreams))
+	}
+
+	grpcServer := grpc.NewServer(serverOptions...)
+	strandServer, err := server.NewServer(config.Data, options...)
+	if err != nil {
+		return fmt.Errorf("failed to open data directory %v: %v", config.Data, err)
+	}
 	api.RegisterStrandServer(grpcServer, strandServer)
+	api.RegisterAdminServer(grpcServer, strandServer)
+	api.RegisterReplicationServer(grpcServer, strandServer)
+	if node != nil {
+		api.RegisterClusterServer(grpcServer, node)
+	}
+
+	serving := make(chan error, 1)
+	go func() {
+		serving <- grpcServer.Serve(listener)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
 	log.Withs(tidy.Fields{
-		"network": network,
-		"address": address}).Info("listening")
+		"address": config.Listen,
+		"data":    config.Data}).Info("listening")
+
+	select {
+	case err := <-serving:
+		strandServer.Close()
+		return fmt.Errorf("failed to serve: %v", err)
+	case received := <-signals:
+		log.With("signal", received).Info("shutting down")
+	}
 
-	if err := grpcServer.Serve(listener); err != nil {
-		log.WithError(err).Fatal("grpc server failed")
+	return shutdown(grpcServer, strandServer, config.ShutdownTimeout)
+}
+
+// shutdown stops accepting calls and gives the writes in progress the
+// timeout to finish. The calls that are left after the timeout are cut
+// off. The streams are synced and closed either way.
+func shutdown(grpcServer *grpc.Server, strandServer *server.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	// the subscriptions end once the server shuts
+	// down, so the graceful stop doesn't wait for them
+	drained := strandServer.Shutdown(ctx)
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+		<-stopped
 	}
+
+	if err := strandServer.Close(); err != nil {
+		return fmt.Errorf("failed to close streams: %v", err)
+	}
+	if drained != nil {
+		return fmt.Errorf("writes in progress did not finish within %v", timeout)
+	}
+
+	log.Info("shut down")
+	return nil
 }
 
 func Stopwatch(do func()) time.Duration {
@@ -1,15 +1,263 @@
 package message
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
 
 var byteOrder = binary.LittleEndian
 
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
 const (
 	MESSAGE_SIZE_SIZE = 4
 	OFFSET_SIZE       = 8
+	VERSION_SIZE      = 1
+	CRC_SIZE          = 4
+	ATTRIBUTES_SIZE   = 1
+	TIMESTAMP_SIZE    = 8
+
+	KEY_SIZE_SIZE          = 4
+	HEADER_COUNT_SIZE      = 2
+	HEADER_NAME_SIZE_SIZE  = 2
+	HEADER_VALUE_SIZE_SIZE = 2
+	MESSAGE_COUNT_SIZE     = 4
+
+	// V1_HEADER_SIZE is the size of the header of a version 1
+	// message, holding the checksum and the attributes.
+	V1_HEADER_SIZE = MESSAGE_SIZE_SIZE + OFFSET_SIZE + VERSION_SIZE + CRC_SIZE + ATTRIBUTES_SIZE
+
+	// V2_HEADER_SIZE is the size of the header of a version 2 message,
+	// that adds the append timestamp and the producer timestamp.
+	V2_HEADER_SIZE = V1_HEADER_SIZE + TIMESTAMP_SIZE + TIMESTAMP_SIZE
+
+	// V3_HEADER_SIZE is the size of the fixed part of the header of a
+	// version 3 message, that adds the key size and the header count.
+	// The key and the headers follow the fixed part of the header.
+	V3_HEADER_SIZE = V2_HEADER_SIZE + KEY_SIZE_SIZE + HEADER_COUNT_SIZE
+
+	// HEADER_SIZE is the size of the fixed part of the header that is written.
+	HEADER_SIZE = V3_HEADER_SIZE
+
+	// MIN_HEADER_SIZE is the size of the smallest header of all
+	// versions, it always holds the size, offset and version.
+	MIN_HEADER_SIZE = V1_HEADER_SIZE
+
+	// VERSION is the version of the message frame that is written.
+	VERSION = 3
+
+	// NO_KEY is the key size of a message without a key.
+	NO_KEY = -1
+
+	// TOMBSTONE_ATTRIBUTE marks a message that deletes its key
+	// from a compacted stream.
+	TOMBSTONE_ATTRIBUTE = 1 << 0
+
+	// CODEC_MASK masks the attribute bits that hold the codec of a
+	// compressed message. The body of a compressed message holds the
+	// number of messages in it, followed by the compressed message set.
+	CODEC_MASK  = 3 << CODEC_SHIFT
+	CODEC_SHIFT = 1
+
+	offsetLocation            = MESSAGE_SIZE_SIZE
+	versionLocation           = offsetLocation + OFFSET_SIZE
+	crcLocation               = versionLocation + VERSION_SIZE
+	attributesLocation        = crcLocation + CRC_SIZE
+	timestampLocation         = attributesLocation + ATTRIBUTES_SIZE
+	producerTimestampLocation = timestampLocation + TIMESTAMP_SIZE
+	keySizeLocation           = producerTimestampLocation + TIMESTAMP_SIZE
+	keyLocation               = keySizeLocation + KEY_SIZE_SIZE
 )
 
+// headerSize returns the size of the header of the given
+// version, or false if the version is not supported.
+func headerSize(version byte) (int, bool) {
+	switch version {
+	case 1:
+		return V1_HEADER_SIZE, true
+	case 2:
+		return V2_HEADER_SIZE, true
+	case 3:
+		return V3_HEADER_SIZE, true
+	}
+	return 0, false
+}
+
+// ChecksumError is returned for a message
+// that doesn't match its checksum.
+type ChecksumError struct {
+	// Position of the message in the set buffer
+	Position int
+	Offset   Offset
+}
+
+func (this ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for message at %v", this.Position)
+}
+
+// VersionError is returned for a message
+// with a frame version that is not supported.
+type VersionError struct {
+	// Position of the message in the set buffer
+	Position int
+	Offset   Offset
+	Version  byte
+}
+
+func (this VersionError) Error() string {
+	return fmt.Sprintf("unsupported message version %v at %v", this.Version, this.Position)
+}
+
+// ReadHeader reads the message size and offset from the
+// message header at the start of the buffer. The buffer
+// must hold at least MIN_HEADER_SIZE bytes.
+func ReadHeader(buffer []byte) (size int, offset Offset) {
+	size = int(byteOrder.Uint32(buffer))
+	offset = Offset(byteOrder.Uint64(buffer[offsetLocation:]))
+	return
+}
+
+// ReadTimestamp reads the append timestamp, in unix nanoseconds, of
+// the message at the start of the buffer. Messages from before
+// version 2 don't have a timestamp, for those it returns 0.
+func ReadTimestamp(buffer []byte) int64 {
+	if buffer[versionLocation] < 2 {
+		return 0
+	}
+	return int64(byteOrder.Uint64(buffer[timestampLocation:]))
+}
+
+// ReadProducerTimestamp reads the timestamp, in unix nanoseconds, that
+// the producer gave to the message at the start of the buffer. It
+// returns 0 if the producer didn't give the message a timestamp.
+func ReadProducerTimestamp(buffer []byte) int64 {
+	if buffer[versionLocation] < 2 {
+		return 0
+	}
+	return int64(byteOrder.Uint64(buffer[producerTimestampLocation:]))
+}
+
+// Verify verifies the version and checksum of the message at
+// the start of the buffer. The buffer must hold the complete
+// message. The position is only used to report errors.
+func Verify(buffer []byte, position int) error {
+	size, offset := ReadHeader(buffer)
+
+	version := buffer[versionLocation]
+	headerSize, ok := headerSize(version)
+	if !ok {
+		return VersionError{
+			Position: position,
+			Offset:   offset,
+			Version:  version,
+		}
+	}
+
+	if size < headerSize {
+		return fmt.Errorf("invalid message size at %v", position)
+	}
+
+	if version >= 3 {
+		if _, ok := bodyLocation(buffer[:size]); !ok {
+			return fmt.Errorf("invalid key or headers in message at %v", position)
+		}
+	}
+
+	if _, ok := messageCount(buffer[:size]); !ok {
+		return fmt.Errorf("invalid compressed message at %v", position)
+	}
+
+	if byteOrder.Uint32(buffer[crcLocation:]) != checksum(buffer[:size]) {
+		return ChecksumError{
+			Position: position,
+			Offset:   offset,
+		}
+	}
+
+	return nil
+}
+
+// checksum calculates the CRC32C of the message. It covers everything
+// after the checksum itself, but not the offset so the offset can be
+// aligned without calculating the checksum again.
+func checksum(message []byte) uint32 {
+	return crc32.Checksum(message[attributesLocation:], crcTable)
+}
+
+// bodyLocation returns the location of the body in a version 3 message,
+// right after the key and the headers. It returns false if the key or
+// headers don't fit in the message.
+func bodyLocation(message []byte) (int, bool) {
+	location := keyLocation
+	keySize := int(int32(byteOrder.Uint32(message[keySizeLocation:])))
+	if keySize < NO_KEY {
+		return 0, false
+	}
+	if keySize > 0 {
+		location += keySize
+	}
+
+	if location+HEADER_COUNT_SIZE > len(message) {
+		return 0, false
+	}
+	count := int(byteOrder.Uint16(message[location:]))
+	location += HEADER_COUNT_SIZE
+
+	for i := 0; i < count; i++ {
+		if location+HEADER_NAME_SIZE_SIZE > len(message) {
+			return 0, false
+		}
+		location += HEADER_NAME_SIZE_SIZE + int(byteOrder.Uint16(message[location:]))
+
+		if location+HEADER_VALUE_SIZE_SIZE > len(message) {
+			return 0, false
+		}
+		location += HEADER_VALUE_SIZE_SIZE + int(byteOrder.Uint16(message[location:]))
+	}
+
+	if location > len(message) {
+		return 0, false
+	}
+	return location, true
+}
+
+// messageCount returns the number of messages that a message holds,
+// which is more than one for a compressed message. It returns false
+// for a compressed message with an unknown codec or without a count.
+func messageCount(message []byte) (int, bool) {
+	codec := Codec((message[attributesLocation] & CODEC_MASK) >> CODEC_SHIFT)
+	if codec == NoCompression {
+		return 1, true
+	}
+
+	if message[versionLocation] < 3 || !codec.supported() {
+		return 0, false
+	}
+
+	location, ok := bodyLocation(message)
+	if !ok || location+MESSAGE_COUNT_SIZE > len(message) {
+		return 0, false
+	}
+
+	count := int(byteOrder.Uint32(message[location:]))
+	return count, count > 0
+}
+
 func alterOffsetInSetBuffer(mesageSetBuffer []byte, index setIndex) {
-	location := index.position + MESSAGE_SIZE_SIZE
+	location := index.position + offsetLocation
 	byteOrder.PutUint64(mesageSetBuffer[location:], uint64(index.offset))
 }
+
+// alterTimestampInSetBuffer sets the append timestamp of a message
+// and updates its checksum, which covers the timestamp. Messages
+// from before version 2 are left untouched.
+func alterTimestampInSetBuffer(mesageSetBuffer []byte, index setIndex, timestamp int64) {
+	message := mesageSetBuffer[index.position : index.position+index.size]
+	if message[versionLocation] < 2 {
+		return
+	}
+
+	byteOrder.PutUint64(message[timestampLocation:], uint64(timestamp))
+	byteOrder.PutUint32(message[crcLocation:], checksum(message))
+}
@@ -0,0 +1,260 @@
+package message
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression codec of a compressed message.
+type Codec byte
+
+const (
+	NoCompression Codec = iota
+	Gzip
+	Snappy
+	Zstd
+)
+
+// MAX_DECOMPRESSED_SIZE is the size of the largest set of messages a
+// compressed message can hold, so a small compressed message can't
+// expand to more memory than there is.
+const MAX_DECOMPRESSED_SIZE = 64 * 1024 * 1024
+
+var (
+	ErrNestedCompression    = errors.New("compressed message holds a compressed message")
+	ErrDecompressedTooLarge = fmt.Errorf("compressed message holds more than %v bytes", MAX_DECOMPRESSED_SIZE)
+)
+
+// the zstd encoder and decoder are safe for concurrent use
+// and expensive to create, so they are shared
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MAX_DECOMPRESSED_SIZE))
+)
+
+func (this Codec) String() string {
+	switch this {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Snappy:
+		return "snappy"
+	case Zstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("codec(%d)", byte(this))
+}
+
+func (this Codec) supported() bool {
+	return this <= Zstd
+}
+
+func (this Codec) compress(buffer []byte) ([]byte, error) {
+	switch this {
+	case Gzip:
+		compressed := new(bytes.Buffer)
+		writer := gzip.NewWriter(compressed)
+		if _, err := writer.Write(buffer); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return compressed.Bytes(), nil
+	case Snappy:
+		return snappy.Encode(nil, buffer), nil
+	case Zstd:
+		return zstdEncoder.EncodeAll(buffer, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported codec %v", this)
+}
+
+// decompress returns the decompressed buffer, or ErrDecompressedTooLarge
+// if it would be larger than MAX_DECOMPRESSED_SIZE. The size is checked
+// before the memory for it is allocated.
+func (this Codec) decompress(buffer []byte) ([]byte, error) {
+	switch this {
+	case Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(buffer))
+		if err != nil {
+			return nil, err
+		}
+		decompressed, err := ioutil.ReadAll(io.LimitReader(reader, MAX_DECOMPRESSED_SIZE+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(decompressed) > MAX_DECOMPRESSED_SIZE {
+			return nil, ErrDecompressedTooLarge
+		}
+		return decompressed, nil
+	case Snappy:
+		size, err := snappy.DecodedLen(buffer)
+		if err != nil {
+			return nil, err
+		}
+		if size > MAX_DECOMPRESSED_SIZE {
+			return nil, ErrDecompressedTooLarge
+		}
+		return snappy.Decode(nil, buffer)
+	case Zstd:
+		decompressed, err := zstdDecoder.DecodeAll(buffer, nil)
+		if err == zstd.ErrDecoderSizeExceeded {
+			return nil, ErrDecompressedTooLarge
+		}
+		return decompressed, err
+	}
+	return nil, fmt.Errorf("unsupported codec %v", this)
+}
+
+// Compress returns a set with a single compressed message that holds all
+// messages of this set. The compressed set is written like any other set,
+// it is aligned as a whole and the messages in it get their offsets when
+// it is decompressed.
+func (this *Set) Compress(codec Codec) (*Set, error) {
+	if codec == NoCompression || !codec.supported() {
+		return nil, fmt.Errorf("unsupported codec %v", codec)
+	}
+
+	if len(this.index) == 0 {
+		return nil, errors.New("cannot compress an empty set")
+	}
+
+	for i := range this.index {
+		if this.Message(i).Codec() != NoCompression {
+			return nil, ErrNestedCompression
+		}
+	}
+
+	compressed, err := codec.compress(this.buffer.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, MESSAGE_COUNT_SIZE+len(compressed))
+	byteOrder.PutUint32(body, uint32(len(this.index)))
+	copy(body[MESSAGE_COUNT_SIZE:], compressed)
+
+	set := NewSet()
+	if err := set.append(body, appendOptions{
+		attributes: byte(codec) << CODEC_SHIFT,
+	}, len(this.index)); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Decompress returns the set with every compressed message replaced by
+// the messages in it. They get their offset and the append timestamp of
+// the compressed message, and their checksums are verified. A set
+// without compressed messages is returned as it is.
+func (this AlignedSet) Decompress() (AlignedSet, error) {
+	return this.DecompressMax(0)
+}
+
+// DecompressMax decompresses the set like Decompress, but stops at the
+// first frame that doesn't fit in max bytes anymore, so a set of many
+// compressed messages can't expand to more than max bytes in total. The
+// messages of that frame and the frames after it are left out, except
+// for the first frame, which is always decompressed. A max of 0 means
+// there is no limit.
+func (this AlignedSet) DecompressMax(maxBytes int) (AlignedSet, error) {
+	compressed := false
+	for i := range this.index {
+		if this.Message(i).Codec() != NoCompression {
+			compressed = true
+			break
+		}
+	}
+
+	if !compressed {
+		return this, nil
+	}
+
+	buffer := new(bytes.Buffer)
+	index := make([]setIndex, 0, this.MessageCount())
+
+	for i, frame := range this.index {
+		message := this.Message(i)
+		if message.Codec() == NoCompression {
+			if i > 0 && maxBytes > 0 && buffer.Len()+frame.size > maxBytes {
+				break
+			}
+
+			index = append(index, setIndex{
+				position: buffer.Len(),
+				size:     frame.size,
+				offset:   frame.offset,
+				count:    1,
+			})
+			buffer.Write(message)
+			continue
+		}
+
+		messages, inner, err := inflate(message, frame.position, frame.count)
+		if err != nil {
+			return AlignedSet{}, err
+		}
+		if i > 0 && maxBytes > 0 && buffer.Len()+len(messages) > maxBytes {
+			break
+		}
+
+		first := frame.offset.Sub(Offset(frame.count - 1))
+		for j, entry := range inner {
+			aligned := setIndex{
+				position: buffer.Len(),
+				size:     entry.size,
+				offset:   first.AddInt(j),
+				count:    1,
+			}
+			buffer.Write(messages[entry.position : entry.position+entry.size])
+
+			alterOffsetInSetBuffer(buffer.Bytes(), aligned)
+			alterTimestampInSetBuffer(buffer.Bytes(), aligned, message.Timestamp())
+			index = append(index, aligned)
+		}
+	}
+
+	set := Set{
+		index:  index,
+		buffer: buffer,
+	}
+	set.lastOffset = set.LastOffset()
+
+	return AlignedSet{
+		Set: set,
+	}, nil
+}
+
+// inflate decompresses the compressed message at the position in a set
+// and indexes the messages in it, verifying their checksums. It fails
+// if they are compressed themselves, or if the compressed message
+// doesn't hold the number of messages that its body starts with.
+func inflate(message Message, position int, count int) ([]byte, []setIndex, error) {
+	messages, err := message.Codec().decompress(message.Body()[MESSAGE_COUNT_SIZE:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decompress message at %v: %v", position, err)
+	}
+
+	inner, err := indexSetBuffer(messages)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid compressed message at %v: %v", position, err)
+	}
+	if len(inner) != count {
+		return nil, nil, fmt.Errorf("compressed message at %v holds %v messages instead of %v", position, len(inner), count)
+	}
+
+	for _, entry := range inner {
+		if Message(messages[entry.position:]).Codec() != NoCompression {
+			return nil, nil, ErrNestedCompression
+		}
+	}
+	return messages, inner, nil
+}
@@ -0,0 +1,179 @@
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet_CompressAndDecompress(t *testing.T) {
+	for _, codec := range []Codec{Gzip, Snappy, Zstd} {
+		assert := assert.New(t)
+
+		plain := NewSet()
+		for i := 0; i < 10; i++ {
+			plain.Append([]byte(fmt.Sprintf(`{"id": %v, "name": "message"}`, i)), WithKey([]byte(fmt.Sprint(i))))
+		}
+
+		compressed, err := plain.Compress(codec)
+		assert.Nil(err, "compress %v", codec)
+		assert.Equal(1, compressed.FrameCount(), "frames %v", codec)
+		assert.Equal(10, compressed.MessageCount(), "messages %v", codec)
+
+		// a compressed message followed by a regular message
+		compressed.Append([]byte("regular"))
+
+		unaligned, err := NewUnalignedSet(compressed.GetBuffer())
+		assert.Nil(err, "unaligned %v", codec)
+
+		aligned := unaligned.Align(Offset(100), 42)
+		assert.Equal(Offset(100), aligned.FirstOffset(), "first offset %v", codec)
+		assert.Equal(Offset(110), aligned.LastOffset(), "last offset %v", codec)
+		assert.Equal(Offset(109), aligned.Message(0).Offset(), "compressed message offset %v", codec)
+
+		decompressed, err := aligned.Decompress()
+		assert.Nil(err, "decompress %v", codec)
+		assert.Equal(11, decompressed.FrameCount(), "decompressed frames %v", codec)
+
+		for i := 0; i < decompressed.FrameCount(); i++ {
+			message := decompressed.Message(i)
+			assert.Equal(Offset(100).AddInt(i), message.Offset(), "offset %v", codec)
+			assert.Equal(int64(42), message.Timestamp(), "timestamp %v", codec)
+			if i < 10 {
+				assert.Equal([]byte(fmt.Sprint(i)), message.Key(), "key %v", codec)
+			}
+		}
+
+		_, err = NewAlignedSet(decompressed.GetBuffer())
+		assert.Nil(err, "verify decompressed %v", codec)
+
+		from := decompressed.From(Offset(105))
+		assert.Equal(6, from.MessageCount(), "messages from %v", codec)
+		assert.Equal(Offset(105), from.FirstOffset(), "first offset from %v", codec)
+		assert.Equal([]byte("5"), from.Message(0).Key(), "key from %v", codec)
+	}
+}
+
+func TestSet_CompressJson(t *testing.T) {
+	assert := assert.New(t)
+
+	plain := NewSet()
+	for i := 0; i < 100; i++ {
+		plain.Append([]byte(fmt.Sprintf(`{"id": %v, "type": "order", "status": "shipped", "items": [1, 2, 3]}`, i)))
+	}
+
+	compressed, _ := plain.Compress(Gzip)
+	assert.True(len(compressed.GetBuffer()) < len(plain.GetBuffer())/3, "compressed size")
+}
+
+func TestSet_CompressNested(t *testing.T) {
+	assert := assert.New(t)
+
+	plain := NewSet()
+	plain.Append([]byte("message"))
+	compressed, _ := plain.Compress(Snappy)
+
+	_, err := compressed.Compress(Snappy)
+	assert.Equal(ErrNestedCompression, err)
+}
+
+func TestNewAlignedSet_CorruptCompressedMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	plain := NewSet()
+	plain.Append(bytes.Repeat([]byte("message"), 10))
+	compressed, _ := plain.Compress(Gzip)
+
+	// corrupt the compressed data, but keep the outer checksum valid
+	buffer := compressed.GetBuffer()
+	buffer[len(buffer)-10] ^= 0xff
+	byteOrder.PutUint32(buffer[crcLocation:], checksum(buffer))
+
+	aligned, err := NewAlignedSet(buffer)
+	assert.Nil(err)
+
+	_, err = aligned.Decompress()
+	assert.NotNil(err)
+}
+
+func TestDecompressRefusesTooLargeMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	tooLarge := make([]byte, MAX_DECOMPRESSED_SIZE+1)
+	for _, codec := range []Codec{Gzip, Snappy, Zstd} {
+		compressed, err := codec.compress(tooLarge)
+		assert.Nil(err)
+
+		_, err = codec.decompress(compressed)
+		assert.Equal(ErrDecompressedTooLarge, err, "decompress with %v", codec)
+	}
+}
+
+func TestNewUnalignedSet_VerifiesCompressedMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	plain := NewSet()
+	plain.Append(bytes.Repeat([]byte("message"), 10))
+	plain.Append([]byte("other"))
+
+	// corrupt the compressed data, but keep the outer checksum valid
+	compressed, _ := plain.Compress(Gzip)
+	buffer := compressed.GetBuffer()
+	buffer[len(buffer)-10] ^= 0xff
+	byteOrder.PutUint32(buffer[crcLocation:], checksum(buffer))
+
+	_, err := NewUnalignedSet(buffer)
+	assert.NotNil(err, "corrupt compressed data")
+
+	// a count that doesn't match the messages in it
+	compressed, _ = plain.Compress(Gzip)
+	buffer = compressed.GetBuffer()
+	location, _ := bodyLocation(buffer)
+	byteOrder.PutUint32(buffer[location:], 1<<31)
+	byteOrder.PutUint32(buffer[crcLocation:], checksum(buffer))
+
+	_, err = NewUnalignedSet(buffer)
+	assert.NotNil(err, "wrong message count")
+
+	compressed, _ = plain.Compress(Gzip)
+	unaligned, err := NewUnalignedSet(compressed.GetBuffer())
+	assert.Nil(err)
+	assert.Equal(2, unaligned.MessageCount())
+}
+
+func TestAlignedSet_DecompressMax(t *testing.T) {
+	assert := assert.New(t)
+
+	// three compressed messages of two messages each and a regular message
+	var buffer []byte
+	for i := 0; i < 3; i++ {
+		plain := NewSet()
+		plain.Append(bytes.Repeat([]byte("message"), 100))
+		plain.Append(bytes.Repeat([]byte("message"), 100))
+
+		compressed, _ := plain.Compress(Snappy)
+		buffer = append(buffer, compressed.GetBuffer()...)
+	}
+	regular := NewSet()
+	regular.Append([]byte("regular"))
+	buffer = append(buffer, regular.GetBuffer()...)
+
+	unaligned, _ := NewUnalignedSet(buffer)
+	aligned := unaligned.Align(Offset(0), 42)
+
+	full, err := aligned.DecompressMax(0)
+	assert.Nil(err)
+	assert.Equal(7, full.MessageCount(), "no limit")
+
+	decompressed, err := aligned.DecompressMax(len(full.GetBuffer()) - 1)
+	assert.Nil(err)
+	assert.Equal(6, decompressed.MessageCount(), "messages that fit")
+	assert.Equal(Offset(0), decompressed.FirstOffset())
+	assert.Equal(Offset(5), decompressed.LastOffset())
+
+	decompressed, err = aligned.DecompressMax(1)
+	assert.Nil(err)
+	assert.Equal(2, decompressed.MessageCount(), "first frame always decompressed")
+}
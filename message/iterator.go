@@ -0,0 +1,78 @@
+package message
+
+import "fmt"
+
+// Iterator walks the messages in a buffer of messages, like the buffer
+// of a set or the messages of a read response. The messages it returns
+// are views that slice directly into the buffer, so walking a buffer
+// doesn't allocate. Compressed messages are returned as they are, use
+// Decompress on the set to walk the messages in them.
+type Iterator struct {
+	buffer   []byte
+	position int
+	err      error
+}
+
+// NewIterator returns an iterator over the messages in the buffer.
+// The messages are not verified, NewAlignedSet verifies a buffer
+// that comes from an untrusted source.
+func NewIterator(buffer []byte) *Iterator {
+	return &Iterator{
+		buffer: buffer,
+	}
+}
+
+// Messages returns an iterator over the messages in the set.
+func (this *Set) Messages() *Iterator {
+	return NewIterator(this.buffer.Bytes())
+}
+
+// Next returns the next message, or false if there are no more
+// messages or the next message is incomplete or its key or headers
+// don't fit in it. Err tells the two apart.
+func (this *Iterator) Next() (Message, bool) {
+	if this.err != nil || this.position == len(this.buffer) {
+		return nil, false
+	}
+
+	if this.position+MIN_HEADER_SIZE > len(this.buffer) {
+		this.err = fmt.Errorf("invalid message size at %v", this.position)
+		return nil, false
+	}
+
+	size, _ := ReadHeader(this.buffer[this.position:])
+	if size < MIN_HEADER_SIZE {
+		this.err = fmt.Errorf("invalid message size at %v", this.position)
+		return nil, false
+	}
+
+	if this.position+size > len(this.buffer) {
+		this.err = fmt.Errorf("message too short at %v", this.position)
+		return nil, false
+	}
+
+	message := Message(this.buffer[this.position : this.position+size])
+
+	// the key and headers must fit in the message, so
+	// the accessors of the message never read past it
+	version := message.Version()
+	if headerSize, ok := headerSize(version); !ok || size < headerSize {
+		this.err = fmt.Errorf("invalid message header at %v", this.position)
+		return nil, false
+	}
+	if version >= 3 {
+		if _, ok := bodyLocation(message); !ok {
+			this.err = fmt.Errorf("invalid key or headers in message at %v", this.position)
+			return nil, false
+		}
+	}
+
+	this.position += size
+	return message, true
+}
+
+// Err returns the error that stopped the iterator
+// before the end of the buffer, if any.
+func (this *Iterator) Err() error {
+	return this.err
+}
@@ -0,0 +1,90 @@
+package message
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIterator_Next(t *testing.T) {
+	assert := assert.New(t)
+
+	set := NewSet()
+	for i := 0; i < 5; i++ {
+		set.Append([]byte(fmt.Sprint("body-", i)), WithKey([]byte(fmt.Sprint("key-", i))), WithHeader("index", fmt.Sprint(i)))
+	}
+
+	unaligned, _ := NewUnalignedSet(set.GetBuffer())
+	aligned := unaligned.Align(Offset(10), 42)
+
+	messages := aligned.Messages()
+	count := 0
+	for message, ok := messages.Next(); ok; message, ok = messages.Next() {
+		assert.Equal(Offset(10).AddInt(count), message.Offset())
+		assert.Equal(fmt.Sprint("body-", count), string(message.Body()))
+		assert.Equal(fmt.Sprint("key-", count), string(message.Key()))
+
+		index, _ := message.Header("index")
+		assert.Equal(fmt.Sprint(count), index)
+		count++
+	}
+
+	assert.Nil(messages.Err())
+	assert.Equal(5, count)
+}
+
+func TestIterator_NextDoesNotAllocate(t *testing.T) {
+	buffer := bufferWith5RandomMessages
+
+	allocations := testing.AllocsPerRun(100, func() {
+		messages := Iterator{buffer: buffer}
+		for message, ok := messages.Next(); ok; message, ok = messages.Next() {
+			message.Body()
+			message.Key()
+		}
+	})
+
+	assert.Equal(t, float64(0), allocations)
+}
+
+func TestIterator_IncompleteMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := bufferWith5RandomMessages[:len(bufferWith5RandomMessages)-1]
+	messages := NewIterator(buffer)
+
+	count := 0
+	for _, ok := messages.Next(); ok; _, ok = messages.Next() {
+		count++
+	}
+
+	assert.Equal(4, count)
+	assert.NotNil(messages.Err())
+}
+
+func TestIterator_TruncatedHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	set := NewSet()
+	set.Append([]byte("body"), WithKey([]byte("key")), WithHeader("name", "value"))
+	buffer := set.GetBuffer()
+
+	// the message is cut in its headers, but its size matches
+	truncated := append([]byte(nil), buffer[:keyLocation+len("key")+HEADER_COUNT_SIZE+1]...)
+	byteOrder.PutUint32(truncated, uint32(len(truncated)))
+
+	messages := NewIterator(truncated)
+	_, ok := messages.Next()
+	assert.False(ok)
+	assert.NotNil(messages.Err())
+
+	// a message shorter than its header
+	truncated = append([]byte(nil), buffer[:keyLocation-1]...)
+	byteOrder.PutUint32(truncated, uint32(len(truncated)))
+
+	messages = NewIterator(truncated)
+	_, ok = messages.Next()
+	assert.False(ok)
+	assert.NotNil(messages.Err())
+}
@@ -0,0 +1,39 @@
+package message
+
+import "fmt"
+
+// LEGACY_HEADER_SIZE is the size of the header of a message from before
+// messages were versioned. It only holds the size and the offset, the
+// body follows right after it.
+const LEGACY_HEADER_SIZE = MESSAGE_SIZE_SIZE + OFFSET_SIZE
+
+// UpgradeLegacy converts messages from before messages were versioned to
+// version 1 messages, with a checksum, keeping their offsets. A torn
+// message at the end of the buffer is dropped, like recovery drops it,
+// but an invalid message before that fails the upgrade.
+func UpgradeLegacy(buffer []byte) ([]byte, error) {
+	var upgraded []byte
+
+	for position := 0; position+LEGACY_HEADER_SIZE <= len(buffer); {
+		size, offset := ReadHeader(buffer[position:])
+		if position+size > len(buffer) {
+			break
+		}
+		if size < LEGACY_HEADER_SIZE {
+			return nil, fmt.Errorf("invalid legacy message size %v at %v", size, position)
+		}
+		body := buffer[position+LEGACY_HEADER_SIZE : position+size]
+
+		frame := make([]byte, V1_HEADER_SIZE+len(body))
+		byteOrder.PutUint32(frame, uint32(len(frame)))
+		byteOrder.PutUint64(frame[offsetLocation:], uint64(offset))
+		frame[versionLocation] = 1
+		copy(frame[V1_HEADER_SIZE:], body)
+		byteOrder.PutUint32(frame[crcLocation:], checksum(frame))
+
+		upgraded = append(upgraded, frame...)
+		position += size
+	}
+
+	return upgraded, nil
+}
@@ -0,0 +1,47 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyFrame returns a message from before messages were versioned.
+func legacyFrame(offset Offset, body string) []byte {
+	frame := make([]byte, LEGACY_HEADER_SIZE+len(body))
+	byteOrder.PutUint32(frame, uint32(len(frame)))
+	byteOrder.PutUint64(frame[offsetLocation:], uint64(offset))
+	copy(frame[LEGACY_HEADER_SIZE:], body)
+	return frame
+}
+
+func TestUpgradeLegacy(t *testing.T) {
+	assert := assert.New(t)
+
+	var buffer []byte
+	buffer = append(buffer, legacyFrame(0, "hello world")...)
+	buffer = append(buffer, legacyFrame(1, "")...)
+	buffer = append(buffer, legacyFrame(2, "abc")...)
+	torn := legacyFrame(3, "torn")
+	buffer = append(buffer, torn[:len(torn)-1]...)
+
+	upgraded, err := UpgradeLegacy(buffer)
+	assert.Nil(err)
+
+	set, err := NewAlignedSet(upgraded)
+	assert.Nil(err)
+	assert.Equal(3, set.MessageCount(), "torn message is dropped")
+
+	for i, body := range []string{"hello world", "", "abc"} {
+		message := set.Message(i)
+		assert.Equal(byte(1), message.Version())
+		assert.Equal(Offset(i), message.Offset())
+		assert.Equal(body, string(message.Body()))
+		assert.Nil(Verify(message, 0))
+	}
+
+	invalid := legacyFrame(0, "x")
+	byteOrder.PutUint32(invalid, 4)
+	_, err = UpgradeLegacy(append(invalid, legacyFrame(1, "y")...))
+	assert.NotNil(err)
+}
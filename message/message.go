@@ -0,0 +1,147 @@
+package message
+
+// Message is a view on a single message in a set buffer.
+// Its accessors slice directly into the buffer, the slices
+// they return are only valid as long as the buffer is.
+type Message []byte
+
+// Header is a string header of a message.
+type Header struct {
+	Name  string
+	Value string
+}
+
+func (this Message) Size() int {
+	size, _ := ReadHeader(this)
+	return size
+}
+
+func (this Message) Offset() Offset {
+	_, offset := ReadHeader(this)
+	return offset
+}
+
+// FirstOffset returns the offset of the first message in
+// a compressed message, which has the offset of the last.
+// For a regular message it is the offset of the message.
+func (this Message) FirstOffset() Offset {
+	return this.Offset().Sub(Offset(this.MessageCount() - 1))
+}
+
+func (this Message) Version() byte {
+	return this[versionLocation]
+}
+
+func (this Message) Attributes() byte {
+	return this[attributesLocation]
+}
+
+// Tombstone returns true if the message deletes
+// its key from a compacted stream.
+func (this Message) Tombstone() bool {
+	return this.Attributes()&TOMBSTONE_ATTRIBUTE != 0
+}
+
+// Codec returns the codec of a compressed message,
+// or NoCompression for a regular message.
+func (this Message) Codec() Codec {
+	return Codec((this.Attributes() & CODEC_MASK) >> CODEC_SHIFT)
+}
+
+// MessageCount returns the number of messages in
+// a compressed message, or 1 for a regular message.
+func (this Message) MessageCount() int {
+	count, _ := messageCount(this[:this.Size()])
+	return count
+}
+
+// Timestamp returns the append timestamp in unix nanoseconds.
+func (this Message) Timestamp() int64 {
+	return ReadTimestamp(this)
+}
+
+// ProducerTimestamp returns the timestamp the producer
+// gave to the message in unix nanoseconds, or 0.
+func (this Message) ProducerTimestamp() int64 {
+	return ReadProducerTimestamp(this)
+}
+
+// Key returns the key of the message,
+// or nil if the message has no key.
+func (this Message) Key() []byte {
+	if this.Version() < 3 {
+		return nil
+	}
+
+	size := int(int32(byteOrder.Uint32(this[keySizeLocation:])))
+	if size == NO_KEY {
+		return nil
+	}
+	return this[keyLocation : keyLocation+size]
+}
+
+// HeaderCount returns the number of headers of the message.
+func (this Message) HeaderCount() int {
+	if this.Version() < 3 {
+		return 0
+	}
+	return int(byteOrder.Uint16(this[this.headersLocation():]))
+}
+
+// HeaderAt returns the name and value of the header at the given index.
+func (this Message) HeaderAt(i int) (name []byte, value []byte) {
+	location := this.headersLocation() + HEADER_COUNT_SIZE
+
+	for ; ; i-- {
+		nameSize := int(byteOrder.Uint16(this[location:]))
+		location += HEADER_NAME_SIZE_SIZE
+		name = this[location : location+nameSize]
+		location += nameSize
+
+		valueSize := int(byteOrder.Uint16(this[location:]))
+		location += HEADER_VALUE_SIZE_SIZE
+		value = this[location : location+valueSize]
+		location += valueSize
+
+		if i == 0 {
+			return name, value
+		}
+	}
+}
+
+// Header returns the value of the first header with the
+// given name, or false if the message has no such header.
+func (this Message) Header(name string) (string, bool) {
+	for i := 0; i < this.HeaderCount(); i++ {
+		headerName, value := this.HeaderAt(i)
+		if string(headerName) == name {
+			return string(value), true
+		}
+	}
+	return "", false
+}
+
+// Body returns the actual content of the message.
+func (this Message) Body() []byte {
+	size := this.Size()
+
+	switch this.Version() {
+	case 1:
+		return this[V1_HEADER_SIZE:size]
+	case 2:
+		return this[V2_HEADER_SIZE:size]
+	}
+
+	location, _ := bodyLocation(this[:size])
+	return this[location:size]
+}
+
+// headersLocation returns the location of the
+// header count in a version 3 message.
+func (this Message) headersLocation() int {
+	location := keyLocation
+	if size := int(int32(byteOrder.Uint32(this[keySizeLocation:]))); size > 0 {
+		location += size
+	}
+	return location
+}
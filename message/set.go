@@ -4,50 +4,228 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
+	"time"
 )
 
+const (
+	// MAX_KEY_SIZE is the size of the largest key a message can have.
+	MAX_KEY_SIZE = math.MaxInt32
+
+	// MAX_HEADERS is the number of headers a message can have at most.
+	MAX_HEADERS = math.MaxUint16
+
+	// MAX_HEADER_FIELD_SIZE is the size of the largest
+	// name or value a header can have.
+	MAX_HEADER_FIELD_SIZE = math.MaxUint16
+
+	// MAX_MESSAGE_SIZE is the size of the largest message
+	// frame, including its header, key and headers.
+	MAX_MESSAGE_SIZE = math.MaxInt32
+)
+
+// FieldTooLargeError is returned for a message with a key, headers
+// or a size that don't fit the size fields of the message frame.
+type FieldTooLargeError struct {
+	Field   string
+	Size    int
+	MaxSize int
+}
+
+func (this FieldTooLargeError) Error() string {
+	return fmt.Sprintf("%v of %v is larger than the maximum of %v", this.Field, this.Size, this.MaxSize)
+}
+
 type Set struct {
 	index      []setIndex
 	buffer     *bytes.Buffer
 	lastOffset Offset
 }
 
-func (this *Set) Append(message []byte) {
-	position := this.buffer.Len()
+// NewSet returns an empty set to append messages to.
+func NewSet() *Set {
+	return &Set{
+		buffer: new(bytes.Buffer),
+	}
+}
+
+// AppendOption sets an optional
+// field of an appended message.
+type AppendOption func(options *appendOptions)
+
+type appendOptions struct {
+	timestamp  int64
+	key        []byte
+	headers    []Header
+	attributes byte
+}
+
+// WithTimestamp gives the message a producer timestamp.
+func WithTimestamp(timestamp time.Time) AppendOption {
+	return func(options *appendOptions) {
+		options.timestamp = timestamp.UnixNano()
+	}
+}
+
+// WithKey gives the message a key.
+func WithKey(key []byte) AppendOption {
+	return func(options *appendOptions) {
+		options.key = key
+	}
+}
+
+// WithHeader adds a header to the message.
+func WithHeader(name string, value string) AppendOption {
+	return func(options *appendOptions) {
+		options.headers = append(options.headers, Header{
+			Name:  name,
+			Value: value,
+		})
+	}
+}
+
+// AsTombstone marks the message as a tombstone that deletes
+// its key once the stream is compacted. A tombstone must
+// have a key.
+func AsTombstone() AppendOption {
+	return func(options *appendOptions) {
+		options.attributes |= TOMBSTONE_ATTRIBUTE
+	}
+}
+
+// Append appends a message with the given body to the set. The options
+// set the optional fields of the message, like the key and headers:
+//
+//	set.Append(body, WithKey(id), WithHeader("content-type", "application/json"))
+//
+// It returns a FieldTooLargeError for a key or headers that don't fit
+// the message frame, the set is left as it was.
+func (this *Set) Append(message []byte, options ...AppendOption) error {
+	appendOptions := appendOptions{}
+	for _, option := range options {
+		option(&appendOptions)
+	}
+
+	return this.append(message, appendOptions, 1)
+}
+
+// frameSize returns the size of the frame for the message, or a
+// FieldTooLargeError if a field doesn't fit its size field.
+func frameSize(message []byte, appendOptions appendOptions) (int, error) {
+	if len(appendOptions.key) > MAX_KEY_SIZE {
+		return 0, FieldTooLargeError{"key", len(appendOptions.key), MAX_KEY_SIZE}
+	}
+	if len(appendOptions.headers) > MAX_HEADERS {
+		return 0, FieldTooLargeError{"header count", len(appendOptions.headers), MAX_HEADERS}
+	}
+
+	size := int64(HEADER_SIZE + len(appendOptions.key) + len(message))
+	for _, header := range appendOptions.headers {
+		if len(header.Name) > MAX_HEADER_FIELD_SIZE {
+			return 0, FieldTooLargeError{"header name", len(header.Name), MAX_HEADER_FIELD_SIZE}
+		}
+		if len(header.Value) > MAX_HEADER_FIELD_SIZE {
+			return 0, FieldTooLargeError{"value of header " + header.Name, len(header.Value), MAX_HEADER_FIELD_SIZE}
+		}
+		size += int64(HEADER_NAME_SIZE_SIZE + len(header.Name) + HEADER_VALUE_SIZE_SIZE + len(header.Value))
+	}
 
-	size := MESSAGE_SIZE_SIZE + OFFSET_SIZE + len(message)
-	offset := this.lastOffset.Next()
+	if size > MAX_MESSAGE_SIZE {
+		return 0, FieldTooLargeError{"message size", int(size), MAX_MESSAGE_SIZE}
+	}
+	return int(size), nil
+}
+
+// append appends a frame that holds the given number of messages,
+// which is more than one for a compressed message.
+func (this *Set) append(message []byte, appendOptions appendOptions, count int) error {
+	size, err := frameSize(message, appendOptions)
+	if err != nil {
+		return err
+	}
+
+	position := this.buffer.Len()
+	offset := this.lastOffset.AddInt(count)
 
 	// Write appends the given content to the buffer, growing the buffer as needed.
 	// Err is always nil. If the buffer becomes too large, it will panic with ErrTooLarge.
 	// Therefor we don't need to check written bytes or err.
-	binary.Write(this.buffer, byteOrder, size)
+	binary.Write(this.buffer, byteOrder, int32(size))
 	binary.Write(this.buffer, byteOrder, offset)
+	this.buffer.WriteByte(VERSION)
+	binary.Write(this.buffer, byteOrder, uint32(0))
+	this.buffer.WriteByte(appendOptions.attributes)
+	binary.Write(this.buffer, byteOrder, int64(0))
+	binary.Write(this.buffer, byteOrder, appendOptions.timestamp)
+
+	if appendOptions.key == nil {
+		binary.Write(this.buffer, byteOrder, int32(NO_KEY))
+	} else {
+		binary.Write(this.buffer, byteOrder, int32(len(appendOptions.key)))
+		this.buffer.Write(appendOptions.key)
+	}
+
+	binary.Write(this.buffer, byteOrder, uint16(len(appendOptions.headers)))
+	for _, header := range appendOptions.headers {
+		binary.Write(this.buffer, byteOrder, uint16(len(header.Name)))
+		this.buffer.WriteString(header.Name)
+		binary.Write(this.buffer, byteOrder, uint16(len(header.Value)))
+		this.buffer.WriteString(header.Value)
+	}
+
 	this.buffer.Write(message)
 
+	frame := this.buffer.Bytes()[position:]
+	byteOrder.PutUint32(frame[crcLocation:], checksum(frame))
+
 	this.index = append(this.index, setIndex{
 		position: position,
 		size:     size,
 		offset:   offset,
+		count:    count,
 	})
 
 	this.lastOffset = offset
+	return nil
 }
 
 func (this *Set) GetBuffer() []byte {
 	return this.buffer.Bytes()
 }
 
+// Message returns a view on the frame at the given index, which
+// is a compressed message for a compressed set.
+func (this *Set) Message(i int) Message {
+	index := this.index[i]
+	return Message(this.buffer.Bytes()[index.position : index.position+index.size])
+}
+
+// MessageCount returns the number of messages in the set,
+// including the messages in compressed messages.
 func (this *Set) MessageCount() int {
+	count := 0
+	for _, index := range this.index {
+		count += index.count
+	}
+	return count
+}
+
+// FrameCount returns the number of frames in the set. It only differs
+// from the message count if the set holds compressed messages.
+func (this *Set) FrameCount() int {
 	return len(this.index)
 }
 
+// FirstOffset returns the offset of the first message. A compressed
+// message has the offset of the last message in it, so the first
+// offset is derived from its message count.
 func (this *Set) FirstOffset() Offset {
 	if len(this.index) == 0 {
 		return EmptyOffset
 	}
 
-	return this.index[0].offset
+	first := this.index[0]
+	return first.offset.Sub(Offset(first.count - 1))
 }
 
 func (this *Set) DeltaOffset() Offset {
@@ -70,40 +248,106 @@ type setIndex struct {
 	position int
 	size     int
 	offset   Offset
+
+	// count is the number of messages in the frame,
+	// more than one for a compressed message
+	count int
 }
 
+// NewUnalignedSet creates a set from a buffer of messages that a
+// producer wrote. Unlike the messages read from a stream, compressed
+// messages are decompressed to verify them before they are written,
+// so a compressed message that is corrupt, or that holds another
+// number of messages than it says, never gets offsets assigned.
 func NewUnalignedSet(buffer []byte) (UnalignedSet, error) {
+	index, err := indexSetBuffer(buffer)
+	if err != nil {
+		return UnalignedSet{}, err
+	}
+
+	for _, frame := range index {
+		message := Message(buffer[frame.position : frame.position+frame.size])
+		if message.Codec() == NoCompression {
+			continue
+		}
+		if _, _, err := inflate(message, frame.position, frame.count); err != nil {
+			return UnalignedSet{}, err
+		}
+	}
+
+	return UnalignedSet{
+		Set: Set{
+			index:  index,
+			buffer: bytes.NewBuffer(buffer),
+		},
+	}, nil
+}
+
+// NewAlignedSet creates a set from a buffer of messages
+// that already have their offsets assigned, like the
+// messages read from a stream.
+func NewAlignedSet(buffer []byte) (AlignedSet, error) {
+	index, err := indexSetBuffer(buffer)
+	if err != nil {
+		return AlignedSet{}, err
+	}
+
+	set := Set{
+		index:  index,
+		buffer: bytes.NewBuffer(buffer),
+	}
+	set.lastOffset = set.LastOffset()
+
+	return AlignedSet{
+		Set: set,
+	}, nil
+}
+
+// indexSetBuffer indexes the messages in the
+// buffer and verifies their checksums.
+func indexSetBuffer(buffer []byte) ([]setIndex, error) {
 	position := 0
 	index := make([]setIndex, 0, 8)
 
 	for position < len(buffer) {
-		// make sure there are enough bytes left for an int32
-		if position+4 > len(buffer) {
-			return UnalignedSet{}, fmt.Errorf("invalid message size at %v", position)
+		// make sure there are enough bytes left for the header
+		if position+MIN_HEADER_SIZE > len(buffer) {
+			return nil, fmt.Errorf("invalid message size at %v", position)
+		}
+		size, offset := ReadHeader(buffer[position:])
+
+		// the message size includes the header
+		if size < MIN_HEADER_SIZE {
+			return nil, fmt.Errorf("invalid message size at %v", position)
 		}
-		size := int(byteOrder.Uint32(buffer[position:]))
 
-		if position+MESSAGE_SIZE_SIZE+size > len(buffer) {
-			return UnalignedSet{}, fmt.Errorf("message too short at %v", position)
+		if position+size > len(buffer) {
+			return nil, fmt.Errorf("message too short at %v", position)
 		}
 
+		if err := Verify(buffer[position:], position); err != nil {
+			return nil, err
+		}
+		count, _ := messageCount(buffer[position : position+size])
+
 		index = append(index, setIndex{
 			position: position,
 			size:     size,
+			offset:   offset,
+			count:    count,
 		})
 
-		position += MESSAGE_SIZE_SIZE + size
+		position += size
 	}
 
-	return UnalignedSet{
-		Set: Set{
-			index:  index,
-			buffer: bytes.NewBuffer(buffer),
-		},
-	}, nil
+	return index, nil
 }
 
-func (this UnalignedSet) Align(startOffset Offset) AlignedSet {
+// Align assigns the offsets to the messages, starting at the given
+// offset, and stamps them with the given append timestamp. A compressed
+// message gets the offset of the last message in it, the messages in it
+// get their offsets when the message is decompressed.
+func (this UnalignedSet) Align(startOffset Offset, timestamp int64) AlignedSet {
 	index := this.index
 	buffer := this.buffer
 
@@ -114,11 +358,13 @@ func (this UnalignedSet) Align(startOffset Offset) AlignedSet {
 	// immediate changes to the slice will affect the result of future reads.
 	bytes := buffer.Bytes()
 
+	offset := startOffset
 	for i := 0; i < len(index); i++ {
-		offset := startOffset.AddInt(i)
+		offset = offset.AddInt(index[i].count)
 
-		index[i].offset = offset
+		index[i].offset = offset.Sub(1)
 		alterOffsetInSetBuffer(bytes, index[i])
+		alterTimestampInSetBuffer(bytes, index[i], timestamp)
 	}
 
 	// TODO: align messages
@@ -131,3 +377,39 @@ func (this UnalignedSet) Align(startOffset Offset) AlignedSet {
 }
 
 type AlignedSet struct{ Set }
+
+// From returns the set without the messages before the given offset,
+// which a decompressed set can hold when it is read from an offset in
+// the middle of a compressed message.
+func (this AlignedSet) From(offset Offset) AlignedSet {
+	i := 0
+	for i < len(this.index) && this.index[i].offset < offset {
+		i++
+	}
+
+	if i == 0 {
+		return this
+	}
+
+	buffer := this.buffer.Bytes()
+	start := len(buffer)
+	if i < len(this.index) {
+		start = this.index[i].position
+	}
+
+	index := make([]setIndex, 0, len(this.index)-i)
+	for _, entry := range this.index[i:] {
+		entry.position -= start
+		index = append(index, entry)
+	}
+
+	set := Set{
+		index:  index,
+		buffer: bytes.NewBuffer(buffer[start:]),
+	}
+	set.lastOffset = set.LastOffset()
+
+	return AlignedSet{
+		Set: set,
+	}
+}
@@ -1,9 +1,9 @@
 package message
 
 import (
-	"bytes"
-	"encoding/binary"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pjvds/randombytes"
 	"github.com/stretchr/testify/assert"
@@ -22,27 +22,147 @@ func TestUnalignedMessages_Align(t *testing.T) {
 	assert := assert.New(t)
 	unalignedSet, _ := NewUnalignedSet(bufferWith5RandomMessages)
 
-	set := unalignedSet.Align(Offset(12))
+	set := unalignedSet.Align(Offset(12), 42)
 
-	assert.Equal(Offset(12), set.FirstOffset, "first offset")
-	assert.Equal(Offset(5), set.DeltaOffset, "delta offset")
-	assert.Equal(Offset(17), set.LastOffset, "last offset")
+	assert.Equal(Offset(12), set.FirstOffset(), "first offset")
+	assert.Equal(Offset(4), set.DeltaOffset(), "delta offset")
+	assert.Equal(Offset(16), set.LastOffset(), "last offset")
 
 	for i := 0; i < len(set.index); i++ {
 		assert.Equal(Offset(12+i), set.index[i].offset, "index offset at %v", i)
+
+		message := set.GetBuffer()[set.index[i].position:]
+		assert.Equal(int64(42), ReadTimestamp(message), "timestamp at %v", i)
+	}
+
+	_, err := NewAlignedSet(set.GetBuffer())
+	assert.Nil(err, "checksums after align")
+}
+
+func TestSet_AppendWithTimestamp(t *testing.T) {
+	assert := assert.New(t)
+	timestamp := time.Date(2016, 9, 1, 9, 0, 0, 0, time.UTC)
+
+	set := NewSet()
+	set.Append([]byte("hello"), WithTimestamp(timestamp))
+	set.Append([]byte("world"))
+
+	buffer := set.GetBuffer()
+	assert.Equal(timestamp.UnixNano(), ReadProducerTimestamp(buffer))
+	assert.Equal(int64(0), ReadProducerTimestamp(buffer[set.index[1].position:]))
+}
+
+func TestSet_AppendWithKeyAndHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	set := NewSet()
+	set.Append([]byte("body"), WithKey([]byte("key")), WithHeader("a", "1"), WithHeader("b", ""))
+	set.Append([]byte("no key"))
+	set.Append(nil, WithKey([]byte{}))
+
+	unaligned, err := NewUnalignedSet(set.GetBuffer())
+	assert.Nil(err)
+	assert.Equal(3, unaligned.MessageCount())
+
+	message := unaligned.Message(0)
+	assert.Equal([]byte("key"), message.Key())
+	assert.Equal([]byte("body"), message.Body())
+	assert.Equal(2, message.HeaderCount())
+
+	name, value := message.HeaderAt(1)
+	assert.Equal("b", string(name))
+	assert.Equal("", string(value))
+
+	value1, ok := message.Header("a")
+	assert.True(ok)
+	assert.Equal("1", value1)
+
+	_, ok = message.Header("c")
+	assert.False(ok)
+
+	message = unaligned.Message(1)
+	assert.Nil(message.Key(), "no key")
+	assert.Equal(0, message.HeaderCount())
+	assert.Equal([]byte("no key"), message.Body())
+
+	message = unaligned.Message(2)
+	assert.NotNil(message.Key(), "empty key")
+	assert.Empty(message.Key())
+	assert.Empty(message.Body())
+}
+
+func TestNewUnalignedMessageSet_InvalidHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	set := NewSet()
+	set.Append([]byte("body"), WithHeader("name", "value"))
+
+	// claim a header count that doesn't fit the message
+	buffer := set.GetBuffer()
+	byteOrder.PutUint16(buffer[keyLocation:], 100)
+	byteOrder.PutUint32(buffer[crcLocation:], checksum(buffer))
+
+	_, err := NewUnalignedSet(buffer)
+	assert.NotNil(err)
+}
+
+func TestAppendRejectsOversizedHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	set := NewSet()
+	assert.Nil(set.Append([]byte("body")))
+
+	tooLarge := strings.Repeat("x", MAX_HEADER_FIELD_SIZE+1)
+	err := set.Append([]byte("name"), WithHeader(tooLarge, "value"))
+	if assert.IsType(FieldTooLargeError{}, err) {
+		assert.Equal(MAX_HEADER_FIELD_SIZE+1, err.(FieldTooLargeError).Size)
+	}
+	assert.IsType(FieldTooLargeError{}, set.Append([]byte("value"), WithHeader("name", tooLarge)))
+
+	headers := make([]AppendOption, MAX_HEADERS+1)
+	for i := range headers {
+		headers[i] = WithHeader("name", "value")
+	}
+	assert.IsType(FieldTooLargeError{}, set.Append([]byte("count"), headers...))
+
+	assert.Equal(1, set.MessageCount(), "rejected messages not appended")
+	_, err = NewUnalignedSet(set.GetBuffer())
+	assert.Nil(err)
+}
+
+func TestNewUnalignedMessageSet_ChecksumMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := make([]byte, len(bufferWith5RandomMessages))
+	copy(buffer, bufferWith5RandomMessages)
+
+	// flip a bit in the body of the last message
+	buffer[len(buffer)-1] ^= 1
+
+	_, err := NewUnalignedSet(buffer)
+	assert.IsType(ChecksumError{}, err)
+}
+
+func TestNewUnalignedMessageSet_UnsupportedVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := make([]byte, len(bufferWith5RandomMessages))
+	copy(buffer, bufferWith5RandomMessages)
+	buffer[versionLocation] = VERSION + 1
+
+	_, err := NewUnalignedSet(buffer)
+	if assert.IsType(VersionError{}, err) {
+		assert.Equal(byte(VERSION+1), err.(VersionError).Version)
 	}
 }
 
 var bufferWith5RandomMessages = func() []byte {
-	buffer := new(bytes.Buffer)
+	set := NewSet()
 
 	for i := 0; i < 5; i++ {
 		size := i * 50
-		message := randombytes.Make(size)
-
-		binary.Write(buffer, byteOrder, int32(size))
-		buffer.Write(message)
+		set.Append(randombytes.Make(size))
 	}
 
-	return buffer.Bytes()
+	return set.GetBuffer()
 }()
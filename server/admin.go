@@ -0,0 +1,341 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/message"
+	"github.com/pjvds/strand/stream"
+	"golang.org/x/net/context"
+)
+
+// DEFAULT_LIST_PAGE_SIZE is the maximum number of streams
+// listed by a request that doesn't specify its own limit.
+const DEFAULT_LIST_PAGE_SIZE = 100
+
+// ListStreams lists the streams in the data directory in order
+// of their names, including the streams that are not opened yet.
+func (this *Server) ListStreams(ctx context.Context, request *api.ListStreamsRequest) (*api.ListStreamsResponse, error) {
+	if log.IsDebug() {
+		log.With("prefix", request.Prefix).With("page_token", request.PageToken).Debug("handling list streams request")
+	}
+
+	ids, err := this.directory.List()
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int(request.PageSize)
+	if pageSize == 0 {
+		pageSize = DEFAULT_LIST_PAGE_SIZE
+	}
+
+	response := &api.ListStreamsResponse{}
+	for _, id := range ids {
+		name := string(id)
+		if name <= request.PageToken || !strings.HasPrefix(name, request.Prefix) {
+			continue
+		}
+
+		if len(response.Streams) == pageSize {
+			response.NextPageToken = response.Streams[pageSize-1]
+			break
+		}
+		response.Streams = append(response.Streams, name)
+	}
+
+	return response, nil
+}
+
+// CreateStream creates a stream with its own settings, which are stored
+// with the stream. A server with strict streams only writes to streams
+// that are created this way.
+func (this *Server) CreateStream(ctx context.Context, request *api.CreateStreamRequest) (*api.CreateStreamResponse, error) {
+	id := stream.Id(request.Stream)
+	if log.IsDebug() {
+		log.With("stream_id", id).Debug("handling create stream request")
+	}
+
+	if !validName(string(id)) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	if err := this.begin(); err != nil {
+		return nil, err
+	}
+	defer this.end()
+
+	conn, err := this.forward(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewAdminClient(conn).CreateStream(this.forwardContext(ctx), request)
+	}
+
+	options := this.streamOptions(request.Config)
+
+	_, err = this.streams.Create(id, func(id stream.Id) (stream.Stream, error) {
+		return this.directory.CreateStream(id, options)
+	})
+	if err != nil {
+		if err == stream.ErrStreamExists {
+			return nil, grpc.Errorf(codes.AlreadyExists, "stream %v already exists", id)
+		}
+		if log.IsInfo() {
+			log.With("stream_id", id).WithError(err).Info("failed to create stream")
+		}
+		return nil, getError(id, err)
+	}
+
+	return &api.CreateStreamResponse{}, nil
+}
+
+// validName returns true for a valid stream or topic name, the
+// name of a stream is the name of its directory.
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, "/\\")
+}
+
+// validStream returns true for the name of a stream or for the stream
+// of the committed offsets, the only internal stream that clients may
+// use. It is checked by every call that takes a stream, before the
+// stream is used, so no other dot entry of the data directory, like
+// the topics directory, is ever opened as a stream.
+func validStream(id stream.Id) bool {
+	return validName(string(id)) || id == OFFSETS_STREAM
+}
+
+// validTopic returns true for a valid topic name.
+func validTopic(name string) bool {
+	return validName(name) && !strings.Contains(name, stream.PARTITION_SEPARATOR)
+}
+
+// streamOptions returns the default options of the
+// server, with the settings of the config applied.
+func (this *Server) streamOptions(config *api.StreamConfig) stream.Options {
+	return applyConfig(this.defaults, config)
+}
+
+// applyConfig returns the options with the
+// settings of the config that are not 0 applied.
+func applyConfig(options stream.Options, config *api.StreamConfig) stream.Options {
+	if config == nil {
+		return options
+	}
+
+	if config.SegmentMaxBytes > 0 {
+		options.SegmentMaxBytes = int64(config.SegmentMaxBytes)
+	}
+	if config.SegmentMaxAge > 0 {
+		options.SegmentMaxAge = time.Duration(config.SegmentMaxAge)
+	}
+	if config.RetentionMaxAge > 0 {
+		options.RetentionMaxAge = time.Duration(config.RetentionMaxAge)
+	}
+	if config.RetentionMaxBytes > 0 {
+		options.RetentionMaxBytes = int64(config.RetentionMaxBytes)
+	}
+	if config.RetentionMaxMessages > 0 {
+		options.RetentionMaxMessages = config.RetentionMaxMessages
+	}
+	if config.MaxMessageBytes > 0 {
+		options.MaxMessageBytes = int(config.MaxMessageBytes)
+	}
+	if config.Compact {
+		options.Compact = true
+	}
+	if config.TombstoneRetention > 0 {
+		options.TombstoneRetention = time.Duration(config.TombstoneRetention)
+	}
+	if config.SyncInterval > 0 {
+		options.SyncInterval = time.Duration(config.SyncInterval)
+	}
+	if config.SyncBytes > 0 {
+		options.SyncBytes = int64(config.SyncBytes)
+	}
+
+	switch config.Durability {
+	case api.StreamConfig_SYNC_NONE:
+		options.Durability = stream.SyncNone
+	case api.StreamConfig_SYNC_ALWAYS:
+		options.Durability = stream.SyncAlways
+	case api.StreamConfig_SYNC_GROUP:
+		options.Durability = stream.SyncGroup
+	}
+
+	return options
+}
+
+// streamConfig returns the config that holds every setting of the
+// options, so the options are the same whatever they are applied to.
+func streamConfig(options stream.Options) *api.StreamConfig {
+	config := &api.StreamConfig{
+		SegmentMaxBytes:      uint64(options.SegmentMaxBytes),
+		SegmentMaxAge:        int64(options.SegmentMaxAge),
+		RetentionMaxAge:      int64(options.RetentionMaxAge),
+		RetentionMaxBytes:    uint64(options.RetentionMaxBytes),
+		RetentionMaxMessages: options.RetentionMaxMessages,
+		MaxMessageBytes:      uint32(options.MaxMessageBytes),
+		Compact:              options.Compact,
+		TombstoneRetention:   int64(options.TombstoneRetention),
+		SyncInterval:         int64(options.SyncInterval),
+		SyncBytes:            uint64(options.SyncBytes),
+	}
+
+	switch options.Durability {
+	case stream.SyncNone:
+		config.Durability = api.StreamConfig_SYNC_NONE
+	case stream.SyncAlways:
+		config.Durability = api.StreamConfig_SYNC_ALWAYS
+	case stream.SyncGroup:
+		config.Durability = api.StreamConfig_SYNC_GROUP
+	}
+
+	return config
+}
+
+func (this *Server) StatStream(ctx context.Context, request *api.StatStreamRequest) (*api.StatStreamResponse, error) {
+	id := stream.Id(request.Stream)
+	if log.IsDebug() {
+		log.With("stream_id", id).Debug("handling stat stream request")
+	}
+
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	conn, err := this.forward(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewAdminClient(conn).StatStream(this.forwardContext(ctx), request)
+	}
+
+	s, err := this.existingStream(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := s.Stat()
+	return &api.StatStreamResponse{
+		FirstOffset:  uint64(stats.StartOffset),
+		NextOffset:   uint64(stats.HeadOffset),
+		Bytes:        uint64(stats.Bytes),
+		SegmentCount: uint32(stats.Segments),
+		Created:      stats.Created.UnixNano(),
+	}, nil
+}
+
+// DeleteStream closes the stream and removes its files. Subscriptions
+// on the stream fail, a later write creates the stream from scratch.
+func (this *Server) DeleteStream(ctx context.Context, request *api.DeleteStreamRequest) (*api.DeleteStreamResponse, error) {
+	id := stream.Id(request.Stream)
+	if log.IsDebug() {
+		log.With("stream_id", id).Debug("handling delete stream request")
+	}
+
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	if internal(id) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "stream %v is internal", id)
+	}
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	if err := this.begin(); err != nil {
+		return nil, err
+	}
+	defer this.end()
+
+	conn, err := this.forward(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewAdminClient(conn).DeleteStream(this.forwardContext(ctx), request)
+	}
+
+	if _, err := this.existingStream(id); err != nil {
+		return nil, err
+	}
+
+	if err := this.streams.Delete(id); err != nil {
+		if log.IsInfo() {
+			log.With("stream_id", id).WithError(err).Info("failed to delete stream")
+		}
+		return nil, getError(id, err)
+	}
+
+	return &api.DeleteStreamResponse{}, nil
+}
+
+func (this *Server) TruncateStream(ctx context.Context, request *api.TruncateStreamRequest) (*api.TruncateStreamResponse, error) {
+	id := stream.Id(request.Stream)
+	offset := message.Offset(request.Offset)
+	if log.IsDebug() {
+		log.With("stream_id", id).With("offset", offset).Debug("handling truncate stream request")
+	}
+
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	if internal(id) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "stream %v is internal", id)
+	}
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	if err := this.begin(); err != nil {
+		return nil, err
+	}
+	defer this.end()
+
+	conn, err := this.forward(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewAdminClient(conn).TruncateStream(this.forwardContext(ctx), request)
+	}
+
+	s, err := this.existingStream(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Truncate(offset); err != nil {
+		return nil, readError(s, offset, err)
+	}
+
+	return &api.TruncateStreamResponse{
+		FirstOffset: uint64(s.StartOffset()),
+	}, nil
+}
+
+// existingStream gets the stream, but doesn't create it
+// like a write does when it doesn't exist.
+func (this *Server) existingStream(id stream.Id) (stream.Stream, error) {
+	s, err := this.streams.Open(id, this.directory.Opener(this.defaults))
+	if err != nil {
+		if log.IsInfo() {
+			log.With("stream_id", id).WithError(err).Info("failed to get stream")
+		}
+		return nil, getError(id, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/stream"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestListStreams(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	for _, id := range []string{"orders-b", "payments", "orders-a", "orders-c"} {
+		server.write(t, id, "a")
+	}
+	ctx := context.Background()
+
+	listed, err := server.admin.ListStreams(ctx, &api.ListStreamsRequest{})
+	assert.Nil(err)
+	assert.Equal([]string{"orders-a", "orders-b", "orders-c", "payments"}, listed.Streams, "internal streams are not listed")
+	assert.Empty(listed.NextPageToken)
+
+	listed, err = server.admin.ListStreams(ctx, &api.ListStreamsRequest{Prefix: "orders-", PageSize: 2})
+	assert.Nil(err)
+	assert.Equal([]string{"orders-a", "orders-b"}, listed.Streams, "first page")
+	assert.Equal("orders-b", listed.NextPageToken)
+
+	listed, err = server.admin.ListStreams(ctx, &api.ListStreamsRequest{Prefix: "orders-", PageSize: 2, PageToken: listed.NextPageToken})
+	assert.Nil(err)
+	assert.Equal([]string{"orders-c"}, listed.Streams, "last page")
+	assert.Empty(listed.NextPageToken)
+}
+
+func TestStatStream(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "stat", "a", "b", "c")
+	ctx := context.Background()
+
+	stat, err := server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: "stat"})
+	assert.Nil(err)
+	assert.Equal(uint64(0), stat.FirstOffset)
+	assert.Equal(uint64(3), stat.NextOffset)
+	assert.Equal(uint32(1), stat.SegmentCount)
+	assert.True(stat.Bytes > 0, "bytes")
+	assert.True(stat.Created > 0, "created")
+
+	_, err = server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: "unknown"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "stat doesn't create streams")
+
+	_, err = server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: ".."})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "invalid stream name")
+}
+
+func TestDeleteStream(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "deleted", "a", "b")
+	ctx := context.Background()
+
+	_, err := server.admin.DeleteStream(ctx, &api.DeleteStreamRequest{Stream: "deleted"})
+	assert.Nil(err)
+
+	_, err = server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: "deleted"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "stat deleted stream")
+
+	_, err = server.admin.DeleteStream(ctx, &api.DeleteStreamRequest{Stream: "deleted"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "delete deleted stream")
+
+	_, err = server.admin.DeleteStream(ctx, &api.DeleteStreamRequest{Stream: string(OFFSETS_STREAM)})
+	assert.Equal(codes.PermissionDenied, grpc.Code(err), "delete internal stream")
+
+	// a write creates the stream from scratch
+	written := server.write(t, "deleted", "c")
+	assert.Equal(uint64(0), written.FirstOffset)
+}
+
+func TestDeleteStreamEndsSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "deleted", "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscription, err := server.strand.Subscribe(ctx, &api.SubscribeRequest{Stream: "deleted"})
+	assert.Nil(err)
+	_, err = subscription.Recv()
+	assert.Nil(err)
+
+	_, err = server.admin.DeleteStream(ctx, &api.DeleteStreamRequest{Stream: "deleted"})
+	assert.Nil(err)
+
+	_, err = subscription.Recv()
+	assert.Equal(codes.Aborted, grpc.Code(err), "subscription of deleted stream")
+}
+
+func TestTruncateStream(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "truncated", "a", "b", "c", "d")
+	ctx := context.Background()
+
+	truncated, err := server.admin.TruncateStream(ctx, &api.TruncateStreamRequest{Stream: "truncated", Offset: 2})
+	assert.Nil(err)
+	assert.Equal(uint64(2), truncated.FirstOffset)
+
+	_, err = server.strand.Read(ctx, &api.ReadRequest{Stream: "truncated", Offset: 1})
+	assert.Equal(codes.OutOfRange, grpc.Code(err), "read truncated offset")
+
+	read, err := server.strand.Read(ctx, &api.ReadRequest{Stream: "truncated", Offset: 2})
+	assert.Nil(err)
+	_, bodies := bodiesOf(t, read.Messages)
+	assert.Equal([]string{"c", "d"}, bodies)
+
+	_, err = server.admin.TruncateStream(ctx, &api.TruncateStreamRequest{Stream: "truncated", Offset: 5})
+	assert.Equal(codes.OutOfRange, grpc.Code(err), "truncate after head")
+
+	_, err = server.admin.TruncateStream(ctx, &api.TruncateStreamRequest{Stream: "unknown", Offset: 1})
+	assert.Equal(codes.NotFound, grpc.Code(err), "truncate unknown stream")
+
+	_, err = server.admin.TruncateStream(ctx, &api.TruncateStreamRequest{Stream: string(OFFSETS_STREAM), Offset: 1})
+	assert.Equal(codes.PermissionDenied, grpc.Code(err), "truncate internal stream")
+}
+
+func TestStrictStreams(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t, StrictStreams())
+	defer server.stop()
+
+	ctx := context.Background()
+
+	_, err := server.strand.Write(ctx, &api.WriteRequest{Stream: "created", Messages: setOf("a")})
+	assert.Equal(codes.NotFound, grpc.Code(err), "write to stream that isn't created")
+
+	_, err = server.strand.Read(ctx, &api.ReadRequest{Stream: "created"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "read from stream that isn't created")
+
+	_, err = server.admin.CreateStream(ctx, &api.CreateStreamRequest{Stream: "created"})
+	assert.Nil(err)
+
+	written := server.write(t, "created", "a")
+	assert.Equal(uint64(0), written.FirstOffset)
+
+	_, err = server.admin.CreateStream(ctx, &api.CreateStreamRequest{Stream: "created"})
+	assert.Equal(codes.AlreadyExists, grpc.Code(err), "create existing stream")
+
+	for _, name := range []string{"", ".offsets", "a/b", ".."} {
+		_, err = server.admin.CreateStream(ctx, &api.CreateStreamRequest{Stream: name})
+		assert.Equal(codes.InvalidArgument, grpc.Code(err), "create %q", name)
+	}
+}
+
+func TestCreateStreamWithConfig(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer os.RemoveAll(server.directory)
+
+	ctx := context.Background()
+	_, err := server.admin.CreateStream(ctx, &api.CreateStreamRequest{
+		Stream: "configured",
+		Config: &api.StreamConfig{
+			MaxMessageBytes: 64,
+			Compact:         true,
+			Durability:      api.StreamConfig_SYNC_ALWAYS,
+		},
+	})
+	assert.Nil(err)
+
+	_, err = server.strand.Write(ctx, &api.WriteRequest{Stream: "configured", Messages: setOf(string(make([]byte, 128)))})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "message larger than max message bytes")
+
+	// the config is stored with the stream
+	server.close()
+	server = startServerIn(t, server.directory, StrictStreams())
+	defer server.close()
+
+	fetched, err := server.Fetch(ctx, &api.ReplicaFetchRequest{FollowerId: "test", Stream: "configured", IncludeConfig: true})
+	assert.Nil(err)
+	assert.Equal(uint32(64), fetched.Config.MaxMessageBytes, "max message bytes after restart")
+	assert.True(fetched.Config.Compact, "compact after restart")
+	assert.Equal(api.StreamConfig_SYNC_ALWAYS, fetched.Config.Durability, "durability after restart")
+	assert.Equal(uint64(stream.DefaultOptions.SegmentMaxBytes), fetched.Config.SegmentMaxBytes, "default settings")
+
+	_, err = server.strand.Write(ctx, &api.WriteRequest{Stream: "configured", Messages: setOf(string(make([]byte, 128)))})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "max message bytes after restart")
+}
+
+func TestInternalStreams(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer os.RemoveAll(server.directory)
+
+	ctx := context.Background()
+
+	_, err := server.strand.Read(ctx, &api.ReadRequest{Stream: TOPICS_DIRECTORY})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "read topics directory")
+
+	_, err = server.strand.OffsetForTime(ctx, &api.OffsetForTimeRequest{Stream: TOPICS_DIRECTORY})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "offset for time of topics directory")
+
+	subscription, err := server.strand.Subscribe(ctx, &api.SubscribeRequest{Stream: TOPICS_DIRECTORY})
+	assert.Nil(err)
+	_, err = subscription.Recv()
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "subscribe to topics directory")
+
+	_, err = server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: TOPICS_DIRECTORY})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "stat topics directory")
+
+	// the topics directory is left as it is, so the server still opens it
+	server.close()
+	server = startServerIn(t, server.directory)
+	defer server.close()
+
+	_, err = server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: string(OFFSETS_STREAM)})
+	assert.Nil(err, "stat committed offsets")
+}
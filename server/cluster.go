@@ -0,0 +1,307 @@
+package server
+
+import (
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/cluster"
+	"github.com/pjvds/strand/message"
+	"github.com/pjvds/strand/stream"
+	"golang.org/x/net/context"
+)
+
+// FORWARDED_HEADER is the header of the requests that a server forwarded
+// to the node that leads the stream. A forwarded request is never
+// forwarded again, so nodes that disagree about the leader of a stream
+// don't forward a request back and forth.
+const FORWARDED_HEADER = "strand-forwarded"
+
+// Clustered makes the server a node of a cluster. Every stream is led by
+// the node the cluster assigns it to, the other nodes replicate it from
+// that node. Requests for a stream that another node leads are forwarded
+// to that node. The committed offsets are assigned like any stream, the
+// node that leads them also coordinates the consumer groups. The topics
+// are kept in the cluster metadata, so every node knows them. The other
+// internal streams are kept by every node on its own.
+func Clustered(node *cluster.Node) Option {
+	return func(config *config) {
+		config.node = node
+	}
+}
+
+// connections keeps a connection to every server that is called, so
+// the calls to a server share the same connection.
+type connections struct {
+	lock  sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func newConnections() *connections {
+	return &connections{
+		conns: make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (this *connections) get(address string) (*grpc.ClientConn, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if conn, ok := this.conns[address]; ok {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	this.conns[address] = conn
+	return conn, nil
+}
+
+func (this *connections) close() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for address, conn := range this.conns {
+		conn.Close()
+		delete(this.conns, address)
+	}
+}
+
+// route returns the node that leads the stream, or an empty id if the
+// server handles the stream itself. Streams that are not assigned yet
+// are assigned first if assign is true, otherwise they are handled by
+// the server itself.
+func (this *Server) route(ctx context.Context, id stream.Id, assign bool) (cluster.NodeId, error) {
+	if this.node == nil || (internal(id) && id != OFFSETS_STREAM) {
+		return "", nil
+	}
+
+	node, ok := this.node.StreamLeader(string(id))
+	if !ok {
+		if !assign {
+			return "", nil
+		}
+
+		var err error
+		if node, err = this.node.Assign(ctx, string(id)); err != nil {
+			if log.IsInfo() {
+				log.With("stream_id", id).WithError(err).Info("failed to assign stream")
+			}
+			return "", grpc.Errorf(codes.Unavailable, "failed to assign stream %v: %v", id, err)
+		}
+	}
+
+	if node == this.node.Id() {
+		return "", nil
+	}
+
+	if forwarded(ctx) {
+		return "", grpc.Errorf(codes.Unavailable, "stream %v is led by node %v", id, node)
+	}
+	return node, nil
+}
+
+// leads returns true if the server is the cluster
+// node that the stream is assigned to.
+func (this *Server) leads(id stream.Id) bool {
+	if this.node == nil {
+		return false
+	}
+	node, ok := this.node.StreamLeader(string(id))
+	return ok && node == this.node.Id()
+}
+
+// forward returns a connection to the node that leads the stream,
+// or nil if the server handles the stream itself.
+func (this *Server) forward(ctx context.Context, id stream.Id, assign bool) (*grpc.ClientConn, error) {
+	node, err := this.route(ctx, id, assign)
+	if err != nil || node == "" {
+		return nil, err
+	}
+	return this.connect(node)
+}
+
+func (this *Server) connect(node cluster.NodeId) (*grpc.ClientConn, error) {
+	address, ok := this.node.Address(node)
+	if !ok {
+		return nil, grpc.Errorf(codes.Internal, "unknown node %v", node)
+	}
+
+	conn, err := this.connections.get(address)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "failed to connect to node %v: %v", node, err)
+	}
+	return conn, nil
+}
+
+// forwardContext returns the context for a forwarded request.
+func (this *Server) forwardContext(ctx context.Context) context.Context {
+	return metadata.NewOutgoingContext(ctx, metadata.Pairs(FORWARDED_HEADER, string(this.node.Id())))
+}
+
+// forwarded returns true for a request that
+// another node forwarded to the server.
+func forwarded(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md[FORWARDED_HEADER]) > 0
+}
+
+// forwardSubscription passes the messages of a subscription
+// at the node that leads the stream to the subscriber.
+func (this *Server) forwardSubscription(conn *grpc.ClientConn, request *api.SubscribeRequest, subscription api.Strand_SubscribeServer) error {
+	ctx, cancel := context.WithCancel(this.forwardContext(subscription.Context()))
+	defer cancel()
+
+	// the forwarded subscription ends when the server shuts down
+	go func() {
+		select {
+		case <-this.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	forwarded, err := api.NewStrandClient(conn).Subscribe(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	for {
+		response, err := forwarded.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			select {
+			case <-this.closing:
+				return grpc.Errorf(codes.Unavailable, "server is shutting down")
+			default:
+			}
+			return err
+		}
+
+		if err := subscription.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+// transactionLeader returns the node that leads all streams of the
+// transaction, or an empty id if the server leads them itself. The
+// streams of a transaction must be led by the same node.
+func (this *Server) transactionLeader(ctx context.Context, request *api.WriteTransactionRequest) (cluster.NodeId, error) {
+	if this.node == nil {
+		return "", nil
+	}
+
+	var leader cluster.NodeId
+	for i, write := range request.Writes {
+		node, err := this.route(ctx, stream.Id(write.Stream), true)
+		if err != nil {
+			return "", err
+		}
+
+		if i > 0 && node != leader {
+			return "", grpc.Errorf(codes.FailedPrecondition, "transaction writes to streams that are led by different nodes")
+		}
+		leader = node
+	}
+	return leader, nil
+}
+
+// clusterTopics keeps the topics in the cluster metadata. The topics
+// are cached, so the messages without a key are spread round robin
+// over the partitions, like they are on a single server.
+type clusterTopics struct {
+	node *cluster.Node
+
+	lock   sync.Mutex
+	topics map[string]*stream.Topic
+}
+
+func newClusterTopics(node *cluster.Node) *clusterTopics {
+	return &clusterTopics{
+		node:   node,
+		topics: make(map[string]*stream.Topic),
+	}
+}
+
+func (this *clusterTopics) Get(name string) (*stream.Topic, error) {
+	partitions, ok := this.node.Topic(name)
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if !ok {
+		delete(this.topics, name)
+		return nil, stream.ErrTopicNotFound
+	}
+
+	// a topic that is deleted and created again
+	// might have another number of partitions
+	topic, ok := this.topics[name]
+	if !ok || topic.Partitions != partitions {
+		topic = &stream.Topic{
+			Name:       name,
+			Partitions: partitions,
+		}
+		this.topics[name] = topic
+	}
+	return topic, nil
+}
+
+func (this *clusterTopics) Create(ctx context.Context, name string, partitions int) error {
+	return topicError(this.node.CreateTopic(ctx, name, partitions))
+}
+
+func (this *clusterTopics) Delete(ctx context.Context, name string) error {
+	return topicError(this.node.DeleteTopic(ctx, name))
+}
+
+// topicError returns the topic error of the stream package for
+// the grpc error of the cluster node, if there is one.
+func topicError(err error) error {
+	switch grpc.Code(err) {
+	case codes.AlreadyExists:
+		return stream.ErrTopicExists
+	case codes.NotFound:
+		return stream.ErrTopicNotFound
+	}
+	return err
+}
+
+// startClusterFollower starts replicating the streams that
+// the cluster assigned to the other nodes from those nodes.
+func startClusterFollower(node *cluster.Node, directory stream.Directory, streams *stream.Map, defaults stream.Options) *Follower {
+	source := func(id stream.Id) (string, bool) {
+		leader, ok := node.StreamLeader(string(id))
+		if !ok || leader == node.Id() {
+			return "", false
+		}
+		return node.Address(leader)
+	}
+
+	list := func(ctx context.Context) ([]stream.Id, error) {
+		var ids []stream.Id
+		for id, leader := range node.Assignments() {
+			if leader != node.Id() {
+				ids = append(ids, stream.Id(id))
+			}
+		}
+		return ids, nil
+	}
+
+	// the leader of the cluster assigns the streams of a node that
+	// stops answering to the node that replicated them the furthest
+	replicated := func(id stream.Id, offset message.Offset) {
+		node.Replicated(string(id), uint64(offset))
+	}
+
+	return startFollower(string(node.Id()), source, list, node.Changed, replicated, newConnections(), directory, streams, defaults)
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/stream"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DEFAULT_SESSION_TIMEOUT is the time a member stays in its group
+	// without a heartbeat, for members that don't specify their own.
+	DEFAULT_SESSION_TIMEOUT = 30 * time.Second
+
+	// ASSIGNMENT_REFRESH_INTERVAL is the interval at which the streams
+	// of a group are listed again to pick up new and deleted streams.
+	ASSIGNMENT_REFRESH_INTERVAL = 10 * time.Second
+)
+
+// Assignment is the set of streams a member of a group reads. The
+// generation increases every time the streams of a group are assigned
+// again. Members that see a new generation stop reading the streams
+// that are no longer assigned to them and commit their offsets, the
+// member that takes a stream over continues from the committed offset.
+type Assignment struct {
+	Generation uint64
+	Streams    []stream.Id
+}
+
+type member struct {
+	id       string
+	timeout  time.Duration
+	seen     time.Time
+	assigned []stream.Id
+}
+
+type group struct {
+	prefix     string
+	generation uint64
+	members    map[string]*member
+
+	streams   []stream.Id
+	refreshed time.Time
+}
+
+// Coordinator keeps track of the members of the consumer groups and
+// assigns the streams of every group across its live members. A member
+// that misses its heartbeats for longer than its session timeout is
+// removed from the group when the group is visited next.
+type Coordinator struct {
+	list func() ([]stream.Id, error)
+
+	lock   sync.Mutex
+	groups map[string]*group
+}
+
+// NewCoordinator creates a coordinator that
+// assigns the streams returned by list.
+func NewCoordinator(list func() ([]stream.Id, error)) *Coordinator {
+	return &Coordinator{
+		list:   list,
+		groups: make(map[string]*group),
+	}
+}
+
+// Join adds a member to the group and assigns the streams of the group
+// again. All members of a group must read the streams with the same
+// prefix. A member that is still in the group keeps its id.
+func (this *Coordinator) Join(name string, prefix string, memberId string, timeout time.Duration) (string, Assignment, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	now := time.Now()
+
+	g, ok := this.groups[name]
+	if ok {
+		this.expire(g, now)
+	}
+
+	// a group without live members starts over
+	if !ok || len(g.members) == 0 {
+		g = &group{
+			prefix:  prefix,
+			members: make(map[string]*member),
+		}
+		this.groups[name] = g
+	}
+
+	if g.prefix != prefix {
+		return "", Assignment{}, grpc.Errorf(codes.FailedPrecondition, "group %v reads the streams with prefix %q", name, g.prefix)
+	}
+
+	m, known := g.members[memberId]
+	if !known {
+		id, err := newMemberId()
+		if err != nil {
+			return "", Assignment{}, err
+		}
+
+		m = &member{id: id}
+		g.members[id] = m
+	}
+	m.timeout = timeout
+	m.seen = now
+
+	if _, err := this.refresh(g, now, true); err != nil {
+		if !known {
+			delete(g.members, m.id)
+		}
+		return "", Assignment{}, err
+	}
+	this.assign(g)
+
+	return m.id, Assignment{g.generation, m.assigned}, nil
+}
+
+// Heartbeat keeps the member in the group and returns its current
+// assignment. The streams are assigned again when members expired
+// or when streams are created or deleted.
+func (this *Coordinator) Heartbeat(name string, memberId string) (Assignment, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	now := time.Now()
+
+	m, g, err := this.member(name, memberId)
+	if err != nil {
+		return Assignment{}, err
+	}
+	m.seen = now
+
+	expired := this.expire(g, now)
+
+	changed, err := this.refresh(g, now, false)
+	if err != nil {
+		return Assignment{}, err
+	}
+
+	if expired || changed {
+		this.assign(g)
+	}
+
+	return Assignment{g.generation, m.assigned}, nil
+}
+
+// Leave removes the member from the group and assigns its
+// streams to the other members right away.
+func (this *Coordinator) Leave(name string, memberId string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	_, g, err := this.member(name, memberId)
+	if err != nil {
+		return err
+	}
+
+	delete(g.members, memberId)
+	if len(g.members) == 0 {
+		delete(this.groups, name)
+		return nil
+	}
+
+	this.assign(g)
+	return nil
+}
+
+// member returns the member and its group, or a grpc NotFound
+// error that tells the member to join the group again.
+func (this *Coordinator) member(name string, memberId string) (*member, *group, error) {
+	if g, ok := this.groups[name]; ok {
+		if m, ok := g.members[memberId]; ok {
+			return m, g, nil
+		}
+	}
+	return nil, nil, grpc.Errorf(codes.NotFound, "member %v is not in group %v", memberId, name)
+}
+
+// expire removes the members that missed their heartbeats and returns
+// true if it removed any. It must be called with the lock held.
+func (this *Coordinator) expire(g *group, now time.Time) bool {
+	expired := false
+	for id, m := range g.members {
+		if now.Sub(m.seen) > m.timeout {
+			delete(g.members, id)
+			expired = true
+		}
+	}
+	return expired
+}
+
+// refresh lists the streams of the group, if the last list is older than
+// the refresh interval or if forced. It returns true if the streams
+// changed. It must be called with the lock held.
+func (this *Coordinator) refresh(g *group, now time.Time, force bool) (bool, error) {
+	if !force && now.Sub(g.refreshed) < ASSIGNMENT_REFRESH_INTERVAL {
+		return false, nil
+	}
+
+	ids, err := this.list()
+	if err != nil {
+		return false, err
+	}
+
+	streams := make([]stream.Id, 0, len(ids))
+	for _, id := range ids {
+		if strings.HasPrefix(string(id), g.prefix) {
+			streams = append(streams, id)
+		}
+	}
+	g.refreshed = now
+
+	changed := len(streams) != len(g.streams)
+	for i := 0; !changed && i < len(streams); i++ {
+		changed = streams[i] != g.streams[i]
+	}
+
+	g.streams = streams
+	return changed, nil
+}
+
+// assign spreads the streams of the group round robin over its members,
+// in order of their ids, and starts a new generation. It must be called
+// with the lock held.
+func (this *Coordinator) assign(g *group) {
+	ids := make([]string, 0, len(g.members))
+	for id, m := range g.members {
+		ids = append(ids, id)
+		m.assigned = nil
+	}
+	sort.Strings(ids)
+
+	for i, id := range g.streams {
+		m := g.members[ids[i%len(ids)]]
+		m.assigned = append(m.assigned, id)
+	}
+
+	g.generation++
+}
+
+func newMemberId() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// JoinGroup adds a consumer to a group and returns the
+// streams it reads until its assignment changes.
+func (this *Server) JoinGroup(ctx context.Context, request *api.JoinGroupRequest) (*api.JoinGroupResponse, error) {
+	if log.IsDebug() {
+		log.With("group", request.Group).With("member_id", request.MemberId).Debug("handling join group request")
+	}
+
+	if request.Group == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "group name is empty")
+	}
+
+	// the groups are coordinated by the node that leads the committed
+	// offsets, the members of a group must all join the same node
+	conn, err := this.forward(ctx, OFFSETS_STREAM, true)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewStrandClient(conn).JoinGroup(this.forwardContext(ctx), request)
+	}
+
+	timeout := time.Duration(request.SessionTimeout)
+	if timeout <= 0 {
+		timeout = DEFAULT_SESSION_TIMEOUT
+	}
+
+	memberId, assignment, err := this.coordinator.Join(request.Group, request.Prefix, request.MemberId, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.JoinGroupResponse{
+		MemberId:   memberId,
+		Assignment: assignmentResponse(assignment),
+	}, nil
+}
+
+func (this *Server) Heartbeat(ctx context.Context, request *api.HeartbeatRequest) (*api.HeartbeatResponse, error) {
+	conn, err := this.forward(ctx, OFFSETS_STREAM, false)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewStrandClient(conn).Heartbeat(this.forwardContext(ctx), request)
+	}
+
+	assignment, err := this.coordinator.Heartbeat(request.Group, request.MemberId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.HeartbeatResponse{
+		Assignment: assignmentResponse(assignment),
+	}, nil
+}
+
+func (this *Server) LeaveGroup(ctx context.Context, request *api.LeaveGroupRequest) (*api.LeaveGroupResponse, error) {
+	if log.IsDebug() {
+		log.With("group", request.Group).With("member_id", request.MemberId).Debug("handling leave group request")
+	}
+
+	conn, err := this.forward(ctx, OFFSETS_STREAM, false)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewStrandClient(conn).LeaveGroup(this.forwardContext(ctx), request)
+	}
+
+	if err := this.coordinator.Leave(request.Group, request.MemberId); err != nil {
+		return nil, err
+	}
+	return &api.LeaveGroupResponse{}, nil
+}
+
+func assignmentResponse(assignment Assignment) *api.Assignment {
+	streams := make([]string, len(assignment.Streams))
+	for i, id := range assignment.Streams {
+		streams[i] = string(id)
+	}
+
+	return &api.Assignment{
+		Generation: assignment.Generation,
+		Streams:    streams,
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/stream"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// listing returns a list function for a coordinator
+// that returns the streams the pointer points to.
+func listing(streams *[]stream.Id) func() ([]stream.Id, error) {
+	return func() ([]stream.Id, error) {
+		return *streams, nil
+	}
+}
+
+// assigned returns the streams of the assignments, in order.
+func assigned(assignments ...Assignment) []stream.Id {
+	var ids []stream.Id
+	for _, assignment := range assignments {
+		ids = append(ids, assignment.Streams...)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestCoordinatorAssignsOnJoinAndLeave(t *testing.T) {
+	assert := assert.New(t)
+	streams := []stream.Id{"orders-a", "orders-b", "orders-c", "orders-d", "payments"}
+	coordinator := NewCoordinator(listing(&streams))
+
+	first, assignment, err := coordinator.Join("group", "orders-", "", time.Minute)
+	assert.Nil(err)
+	assert.NotEmpty(first)
+	assert.Equal(uint64(1), assignment.Generation)
+	assert.Equal(streams[:4], assignment.Streams, "all streams with the prefix")
+
+	second, joined, err := coordinator.Join("group", "orders-", "", time.Minute)
+	assert.Nil(err)
+	assert.NotEqual(first, second)
+	assert.Equal(uint64(2), joined.Generation)
+
+	current, err := coordinator.Heartbeat("group", first)
+	assert.Nil(err)
+	assert.Equal(uint64(2), current.Generation)
+	assert.Len(current.Streams, 2, "streams of first member")
+	assert.Len(joined.Streams, 2, "streams of second member")
+	assert.Equal(streams[:4], assigned(current, joined), "streams split over the members")
+
+	assert.Nil(coordinator.Leave("group", second))
+
+	current, err = coordinator.Heartbeat("group", first)
+	assert.Nil(err)
+	assert.Equal(uint64(3), current.Generation)
+	assert.Equal(streams[:4], current.Streams, "streams of the member that left")
+
+	// the last member that leaves removes the group
+	assert.Nil(coordinator.Leave("group", first))
+	_, err = coordinator.Heartbeat("group", first)
+	assert.Equal(codes.NotFound, grpc.Code(err))
+}
+
+func TestCoordinatorRejoinKeepsMemberId(t *testing.T) {
+	assert := assert.New(t)
+	streams := []stream.Id{"orders-a", "orders-b"}
+	coordinator := NewCoordinator(listing(&streams))
+
+	id, _, _ := coordinator.Join("group", "orders-", "", time.Minute)
+
+	rejoined, assignment, err := coordinator.Join("group", "orders-", id, time.Minute)
+	assert.Nil(err)
+	assert.Equal(id, rejoined)
+	assert.Equal(uint64(2), assignment.Generation)
+	assert.Equal(streams, assignment.Streams)
+}
+
+func TestCoordinatorRejectsOtherPrefix(t *testing.T) {
+	assert := assert.New(t)
+	streams := []stream.Id{"orders-a", "payments-a"}
+	coordinator := NewCoordinator(listing(&streams))
+
+	coordinator.Join("group", "orders-", "", time.Minute)
+
+	_, _, err := coordinator.Join("group", "payments-", "", time.Minute)
+	assert.Equal(codes.FailedPrecondition, grpc.Code(err))
+}
+
+func TestCoordinatorExpiresMembers(t *testing.T) {
+	assert := assert.New(t)
+	streams := []stream.Id{"orders-a", "orders-b", "orders-c"}
+	coordinator := NewCoordinator(listing(&streams))
+
+	expiring, _, _ := coordinator.Join("group", "orders-", "", 10*time.Millisecond)
+	live, _, _ := coordinator.Join("group", "orders-", "", time.Minute)
+
+	time.Sleep(20 * time.Millisecond)
+
+	assignment, err := coordinator.Heartbeat("group", live)
+	assert.Nil(err)
+	assert.Equal(uint64(3), assignment.Generation, "generation after expiry")
+	assert.Equal(streams, assignment.Streams, "streams of the expired member")
+
+	_, err = coordinator.Heartbeat("group", expiring)
+	assert.Equal(codes.NotFound, grpc.Code(err), "heartbeat of expired member")
+
+	// a group of which all members expired starts over
+	time.Sleep(20 * time.Millisecond)
+	coordinator.groups["group"].members[live].seen = time.Time{}
+
+	_, assignment, err = coordinator.Join("group", "other-", "", time.Minute)
+	assert.Nil(err)
+	assert.Equal(uint64(1), assignment.Generation, "generation of group that starts over")
+}
+
+func TestCoordinatorAssignsNewStreams(t *testing.T) {
+	assert := assert.New(t)
+	streams := []stream.Id{"orders-a"}
+	coordinator := NewCoordinator(listing(&streams))
+
+	id, _, _ := coordinator.Join("group", "orders-", "", time.Minute)
+	streams = append(streams, "orders-b")
+
+	// the streams are listed again after the refresh interval
+	assignment, err := coordinator.Heartbeat("group", id)
+	assert.Nil(err)
+	assert.Equal(uint64(1), assignment.Generation, "generation before refresh")
+
+	coordinator.groups["group"].refreshed = time.Now().Add(-ASSIGNMENT_REFRESH_INTERVAL)
+
+	assignment, err = coordinator.Heartbeat("group", id)
+	assert.Nil(err)
+	assert.Equal(uint64(2), assignment.Generation, "generation after refresh")
+	assert.Equal(streams, assignment.Streams)
+}
+
+func TestCoordinatorJoinFailsWhenStreamsCantBeListed(t *testing.T) {
+	assert := assert.New(t)
+	failure := errors.New("listing failed")
+	coordinator := NewCoordinator(func() ([]stream.Id, error) {
+		return nil, failure
+	})
+
+	_, _, err := coordinator.Join("group", "orders-", "", time.Minute)
+	assert.Equal(failure, err)
+	assert.Empty(coordinator.groups["group"].members, "member that failed to join")
+}
+
+func TestJoinGroup(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "orders-a", "a")
+	server.write(t, "orders-b", "b")
+	server.write(t, "payments", "c")
+	ctx := context.Background()
+
+	first, err := server.strand.JoinGroup(ctx, &api.JoinGroupRequest{Group: "billing", Prefix: "orders-"})
+	assert.Nil(err)
+	assert.Equal(uint64(1), first.Assignment.Generation)
+	assert.Equal([]string{"orders-a", "orders-b"}, first.Assignment.Streams)
+
+	second, err := server.strand.JoinGroup(ctx, &api.JoinGroupRequest{Group: "billing", Prefix: "orders-"})
+	assert.Nil(err)
+	assert.Equal(uint64(2), second.Assignment.Generation)
+	assert.Len(second.Assignment.Streams, 1, "streams of second member")
+
+	beat, err := server.strand.Heartbeat(ctx, &api.HeartbeatRequest{Group: "billing", MemberId: first.MemberId})
+	assert.Nil(err)
+	assert.Equal(uint64(2), beat.Assignment.Generation)
+	assert.Len(beat.Assignment.Streams, 1, "streams of first member")
+	assert.NotEqual(second.Assignment.Streams, beat.Assignment.Streams)
+
+	_, err = server.strand.LeaveGroup(ctx, &api.LeaveGroupRequest{Group: "billing", MemberId: second.MemberId})
+	assert.Nil(err)
+
+	beat, err = server.strand.Heartbeat(ctx, &api.HeartbeatRequest{Group: "billing", MemberId: first.MemberId})
+	assert.Nil(err)
+	assert.Equal(uint64(3), beat.Assignment.Generation)
+	assert.Equal([]string{"orders-a", "orders-b"}, beat.Assignment.Streams, "streams after leave")
+}
+
+func TestJoinGroupErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+
+	_, err := server.strand.JoinGroup(ctx, &api.JoinGroupRequest{Prefix: "orders-"})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "empty group")
+
+	joined, err := server.strand.JoinGroup(ctx, &api.JoinGroupRequest{Group: "billing", Prefix: "orders-"})
+	assert.Nil(err)
+
+	_, err = server.strand.JoinGroup(ctx, &api.JoinGroupRequest{Group: "billing", Prefix: "payments"})
+	assert.Equal(codes.FailedPrecondition, grpc.Code(err), "other prefix")
+
+	_, err = server.strand.Heartbeat(ctx, &api.HeartbeatRequest{Group: "billing", MemberId: "unknown"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "heartbeat of unknown member")
+
+	_, err = server.strand.LeaveGroup(ctx, &api.LeaveGroupRequest{Group: "shipping", MemberId: joined.MemberId})
+	assert.Equal(codes.NotFound, grpc.Code(err), "leave unknown group")
+}
+
+func TestJoinGroupSessionTimeout(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+
+	joined, err := server.strand.JoinGroup(ctx, &api.JoinGroupRequest{
+		Group:          "billing",
+		Prefix:         "orders-",
+		SessionTimeout: int64(10 * time.Millisecond),
+	})
+	assert.Nil(err)
+
+	live, err := server.strand.JoinGroup(ctx, &api.JoinGroupRequest{Group: "billing", Prefix: "orders-"})
+	assert.Nil(err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	// the heartbeat of the live member removes the expired member
+	beat, err := server.strand.Heartbeat(ctx, &api.HeartbeatRequest{Group: "billing", MemberId: live.MemberId})
+	assert.Nil(err)
+	assert.Equal(uint64(3), beat.Assignment.Generation, "generation after expiry")
+
+	_, err = server.strand.Heartbeat(ctx, &api.HeartbeatRequest{Group: "billing", MemberId: joined.MemberId})
+	assert.Equal(codes.NotFound, grpc.Code(err), "heartbeat after session timeout")
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/message"
+	"github.com/pjvds/strand/stream"
+	"golang.org/x/net/context"
+)
+
+// OFFSETS_STREAM is the internal stream that holds the offsets
+// committed by consumer groups. Like every stream that starts with
+// a dot it is not listed and clients can't write to it. In a cluster
+// it is led by a single node, like the streams of the clients.
+const OFFSETS_STREAM = stream.Id(".offsets")
+
+// openOffsetStore opens the offset store, creating its stream the first
+// time. The stream is compacted, so it only retains the latest commits,
+// and commits are synced before they are acknowledged.
+func openOffsetStore(directory stream.Directory, streams *stream.Map, defaults stream.Options) (*stream.OffsetStore, error) {
+	exists, err := directory.Exists(OFFSETS_STREAM)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		options := defaults
+		options.Compact = true
+		options.Durability = stream.SyncGroup
+
+		if _, err := streams.Create(OFFSETS_STREAM, func(id stream.Id) (stream.Stream, error) {
+			return directory.CreateStream(id, options)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := streams.Get(OFFSETS_STREAM)
+	if err != nil {
+		return nil, err
+	}
+	return stream.OpenOffsetStore(s)
+}
+
+// internal returns true for the streams
+// that the server keeps for itself.
+func internal(id stream.Id) bool {
+	return strings.HasPrefix(string(id), ".")
+}
+
+// CommitOffset records the offset of a consumer group for a stream, so a
+// consumer of the group can continue from it after a restart.
+func (this *Server) CommitOffset(ctx context.Context, request *api.CommitOffsetRequest) (*api.CommitOffsetResponse, error) {
+	id := stream.Id(request.Stream)
+	if log.IsDebug() {
+		log.With("group", request.Group).With("stream_id", id).With("offset", request.Offset).Debug("handling commit offset request")
+	}
+
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	if request.Group == "" || len(request.Group) > stream.MAX_GROUP_SIZE {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid group name %q", request.Group)
+	}
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	// the commits of all nodes go to the node that leads the
+	// committed offsets, so they are in a single stream
+	conn, err := this.forward(ctx, OFFSETS_STREAM, true)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewStrandClient(conn).CommitOffset(this.forwardContext(ctx), request)
+	}
+
+	if err := this.begin(); err != nil {
+		return nil, err
+	}
+	defer this.end()
+
+	committed, err := this.offsets.Commit(request.Group, id, message.Offset(request.Offset), request.Metadata)
+	if err != nil {
+		if log.IsInfo() {
+			log.With("group", request.Group).With("stream_id", id).WithError(err).Info("failed to commit offset")
+		}
+		return nil, err
+	}
+
+	return &api.CommitOffsetResponse{
+		Timestamp: committed.Timestamp,
+	}, nil
+}
+
+func (this *Server) FetchCommittedOffset(ctx context.Context, request *api.FetchCommittedOffsetRequest) (*api.FetchCommittedOffsetResponse, error) {
+	id := stream.Id(request.Stream)
+	if log.IsDebug() {
+		log.With("group", request.Group).With("stream_id", id).Debug("handling fetch committed offset request")
+	}
+
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	conn, err := this.forward(ctx, OFFSETS_STREAM, false)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewStrandClient(conn).FetchCommittedOffset(this.forwardContext(ctx), request)
+	}
+
+	// a follower replicates the commits of the leader
+	if err := this.offsets.Refresh(); err != nil {
+		return nil, getError(OFFSETS_STREAM, err)
+	}
+
+	committed, ok := this.offsets.Fetch(request.Group, id)
+	if !ok {
+		return &api.FetchCommittedOffsetResponse{}, nil
+	}
+
+	return &api.FetchCommittedOffsetResponse{
+		Found:     true,
+		Offset:    uint64(committed.Offset),
+		Metadata:  committed.Metadata,
+		Timestamp: committed.Timestamp,
+	}, nil
+}
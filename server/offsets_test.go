@@ -0,0 +1,74 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/stream"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestCommitOffset(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer os.RemoveAll(server.directory)
+
+	ctx := context.Background()
+
+	fetched, err := server.strand.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "billing", Stream: "orders"})
+	assert.Nil(err)
+	assert.False(fetched.Found, "found before commit")
+
+	committed, err := server.strand.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing", Stream: "orders", Offset: 5, Metadata: "host-1"})
+	assert.Nil(err)
+	assert.True(committed.Timestamp > 0, "timestamp")
+
+	server.strand.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "shipping", Stream: "orders", Offset: 2})
+
+	fetched, err = server.strand.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "billing", Stream: "orders"})
+	assert.Nil(err)
+	assert.True(fetched.Found)
+	assert.Equal(uint64(5), fetched.Offset)
+	assert.Equal("host-1", fetched.Metadata)
+	assert.Equal(committed.Timestamp, fetched.Timestamp)
+
+	// the offsets are kept after a restart
+	server.close()
+	server = startServerIn(t, server.directory)
+	defer server.close()
+
+	fetched, err = server.strand.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "billing", Stream: "orders"})
+	assert.Nil(err)
+	assert.True(fetched.Found, "found after restart")
+	assert.Equal(uint64(5), fetched.Offset, "offset after restart")
+
+	fetched, err = server.strand.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "shipping", Stream: "orders"})
+	assert.Nil(err)
+	assert.Equal(uint64(2), fetched.Offset, "offset of other group")
+}
+
+func TestCommitOffsetErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+
+	_, err := server.strand.CommitOffset(ctx, &api.CommitOffsetRequest{Stream: "orders", Offset: 1})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "empty group")
+
+	_, err = server.strand.CommitOffset(ctx, &api.CommitOffsetRequest{Group: strings.Repeat("g", stream.MAX_GROUP_SIZE+1), Stream: "orders", Offset: 1})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "group too long")
+
+	_, err = server.strand.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing", Stream: "a/b", Offset: 1})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "invalid stream name")
+
+	_, err = server.strand.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "billing", Stream: ""})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "fetch empty stream name")
+}
@@ -0,0 +1,634 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/message"
+	"github.com/pjvds/strand/stream"
+	"golang.org/x/net/context"
+)
+
+const (
+	// REPLICA_LAG_TIMEOUT is the time after its last fetch that
+	// a follower is no longer in sync for a stream.
+	REPLICA_LAG_TIMEOUT = 10 * time.Second
+
+	// REPLICA_MAX_WAIT is the longest time a fetch of a follower that
+	// is at the head waits for new messages. It is shorter than the lag
+	// timeout, so a follower that keeps up stays in sync.
+	REPLICA_MAX_WAIT = 5 * time.Second
+
+	// ACK_TIMEOUT is the longest time a write
+	// waits for followers to replicate it.
+	ACK_TIMEOUT = 10 * time.Second
+
+	// FOLLOWER_REFRESH_INTERVAL is the interval at which a
+	// follower lists the streams of the leader to follow.
+	FOLLOWER_REFRESH_INTERVAL = 10 * time.Second
+
+	// FOLLOWER_RETRY_INTERVAL is the time a follower
+	// waits after a failure before it fetches again.
+	FOLLOWER_RETRY_INTERVAL = time.Second
+)
+
+type replicaProgress struct {
+	offset message.Offset
+	seen   time.Time
+}
+
+// replicaTracker keeps the offsets the followers replicated every
+// stream up to. A follower reports its offset with every fetch, the
+// offset it fetches from is the offset it replicated up to.
+type replicaTracker struct {
+	lock      sync.Mutex
+	followers map[stream.Id]map[string]replicaProgress
+
+	// progressed is closed and replaced every
+	// time a follower reports its offset
+	progressed chan struct{}
+}
+
+func newReplicaTracker() *replicaTracker {
+	return &replicaTracker{
+		followers:  make(map[stream.Id]map[string]replicaProgress),
+		progressed: make(chan struct{}),
+	}
+}
+
+func (this *replicaTracker) update(follower string, id stream.Id, offset message.Offset) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	followers, ok := this.followers[id]
+	if !ok {
+		followers = make(map[string]replicaProgress)
+		this.followers[id] = followers
+	}
+	followers[follower] = replicaProgress{offset, time.Now()}
+
+	close(this.progressed)
+	this.progressed = make(chan struct{})
+}
+
+// wait blocks until the given number of followers replicated the stream
+// up to the offset. It fails right away if fewer followers are in sync.
+func (this *replicaTracker) wait(ctx context.Context, id stream.Id, offset message.Offset, acks int) error {
+	timer := time.NewTimer(ACK_TIMEOUT)
+	defer timer.Stop()
+
+	for {
+		this.lock.Lock()
+		inSync, replicated := 0, 0
+		now := time.Now()
+		for _, progress := range this.followers[id] {
+			if now.Sub(progress.seen) > REPLICA_LAG_TIMEOUT {
+				continue
+			}
+			inSync++
+			if progress.offset >= offset {
+				replicated++
+			}
+		}
+		progressed := this.progressed
+		this.lock.Unlock()
+
+		if replicated >= acks {
+			return nil
+		}
+		if inSync < acks {
+			return grpc.Errorf(codes.Unavailable, "%v followers of stream %v are in sync, %v are required", inSync, id, acks)
+		}
+
+		select {
+		case <-progressed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return grpc.Errorf(codes.DeadlineExceeded, "%v of %v followers replicated stream %v up to offset %v", replicated, acks, id, offset)
+		}
+	}
+}
+
+// Fetch reads messages for a follower. The messages are returned as
+// they are stored, so the follower stores the same frames. A fetch at
+// the head waits for new messages for at most the max wait.
+func (this *Server) Fetch(ctx context.Context, request *api.ReplicaFetchRequest) (*api.ReplicaFetchResponse, error) {
+	id := stream.Id(request.Stream)
+	offset := message.Offset(request.Offset)
+
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	if request.FollowerId == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "follower id is empty")
+	}
+
+	maxWait := time.Duration(request.MaxWait)
+	if maxWait > REPLICA_MAX_WAIT {
+		maxWait = REPLICA_MAX_WAIT
+	}
+
+	s, err := this.existingStream(id)
+	if err != nil {
+		// a stream is assigned to a cluster node before its first
+		// write, its followers wait for the stream to be created
+		if grpc.Code(err) == codes.NotFound && this.leads(id) {
+			this.replicas.update(request.FollowerId, id, offset)
+			return this.fetchNothing(ctx, request, maxWait)
+		}
+		return nil, err
+	}
+
+	this.replicas.update(request.FollowerId, id, offset)
+
+	maxBytes := int(request.MaxBytes)
+	if maxBytes == 0 {
+		maxBytes = DEFAULT_READ_MAX_BYTES
+	}
+
+	set, err := s.Read(offset, 0, maxBytes)
+	if err != nil {
+		return nil, readError(s, offset, err)
+	}
+
+	// a follower that asks for the settings creates the stream
+	// with them, it doesn't wait for the first message to do so
+	if set.MessageCount() == 0 && maxWait > 0 && !request.IncludeConfig {
+		timer := time.NewTimer(maxWait)
+		select {
+		case <-s.Notify(offset):
+			timer.Stop()
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+
+		if set, err = s.Read(offset, 0, maxBytes); err != nil {
+			return nil, readError(s, offset, err)
+		}
+	}
+
+	nextOffset := offset
+	if set.MessageCount() > 0 {
+		nextOffset = set.LastOffset().Next()
+	}
+
+	response := &api.ReplicaFetchResponse{
+		Messages:   set.GetBuffer(),
+		NextOffset: uint64(nextOffset),
+		HeadOffset: uint64(s.HeadOffset()),
+	}
+	if request.IncludeConfig {
+		response.Config = streamConfig(s.Stat().Options)
+	}
+	return response, nil
+}
+
+// fetchNothing answers a fetch of a stream that doesn't exist yet
+// after the max wait, so the follower doesn't fetch again right away.
+func (this *Server) fetchNothing(ctx context.Context, request *api.ReplicaFetchRequest, maxWait time.Duration) (*api.ReplicaFetchResponse, error) {
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return &api.ReplicaFetchResponse{
+		NextOffset: request.Offset,
+		HeadOffset: request.Offset,
+	}, nil
+}
+
+// Follower pulls streams from the servers that lead them into the local
+// streams. Every stream is followed by its own routine, which fetches
+// from the offset the local stream is at.
+type Follower struct {
+	id string
+
+	// source returns the address of the server the stream
+	// is replicated from, or false to stop following it
+	source func(id stream.Id) (string, bool)
+
+	// list returns the streams to follow
+	list func(ctx context.Context) ([]stream.Id, error)
+
+	// changed returns a channel that is closed when the streams
+	// to follow change, it is nil if they are only listed
+	changed func() <-chan struct{}
+
+	// replicated is called with the offset up to which a stream
+	// is replicated every time it changes, it is nil if nobody
+	// needs to know
+	replicated func(id stream.Id, offset message.Offset)
+
+	connections *connections
+	directory   stream.Directory
+	streams     *stream.Map
+	defaults    stream.Options
+
+	lock      sync.Mutex
+	following map[stream.Id]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// StartFollower connects to the leader and starts following its
+// streams. The id identifies the follower at the leader.
+func StartFollower(leader string, id string, directory stream.Directory, streams *stream.Map, defaults stream.Options) (*Follower, error) {
+	connections := newConnections()
+	conn, err := connections.get(leader)
+	if err != nil {
+		return nil, err
+	}
+	admin := api.NewAdminClient(conn)
+
+	source := func(stream.Id) (string, bool) {
+		return leader, true
+	}
+
+	list := func(ctx context.Context) ([]stream.Id, error) {
+		// the committed offsets are replicated with the streams, so
+		// the consumer groups continue where they were when the
+		// follower takes over. The other internal state, like the
+		// topics and the transaction log, is not a stream and is
+		// not replicated.
+		ids := []stream.Id{OFFSETS_STREAM}
+		request := &api.ListStreamsRequest{}
+		for {
+			response, err := admin.ListStreams(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range response.Streams {
+				ids = append(ids, stream.Id(name))
+			}
+
+			if response.NextPageToken == "" {
+				return ids, nil
+			}
+			request.PageToken = response.NextPageToken
+		}
+	}
+
+	return startFollower(id, source, list, nil, nil, connections, directory, streams, defaults), nil
+}
+
+func startFollower(id string, source func(stream.Id) (string, bool), list func(context.Context) ([]stream.Id, error), changed func() <-chan struct{}, replicated func(stream.Id, message.Offset), connections *connections, directory stream.Directory, streams *stream.Map, defaults stream.Options) *Follower {
+	ctx, cancel := context.WithCancel(context.Background())
+	follower := &Follower{
+		id:          id,
+		source:      source,
+		list:        list,
+		changed:     changed,
+		replicated:  replicated,
+		connections: connections,
+		directory:   directory,
+		streams:     streams,
+		defaults:    defaults,
+		following:   make(map[stream.Id]bool),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	follower.done.Add(1)
+	go follower.run()
+	return follower
+}
+
+func (this *Follower) run() {
+	defer this.done.Done()
+
+	ticker := time.NewTicker(FOLLOWER_REFRESH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		var changed <-chan struct{}
+		if this.changed != nil {
+			changed = this.changed()
+		}
+
+		if err := this.discover(); err != nil && this.ctx.Err() == nil {
+			log.WithError(err).Error("failed to list the streams to follow")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-changed:
+		case <-this.ctx.Done():
+			return
+		}
+	}
+}
+
+// discover starts following the streams
+// that are not followed yet.
+func (this *Follower) discover() error {
+	ids, err := this.list(this.ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		this.lock.Lock()
+		following := this.following[id]
+		this.following[id] = true
+		this.lock.Unlock()
+
+		if !following {
+			this.done.Add(1)
+			go this.follow(id)
+		}
+	}
+	return nil
+}
+
+// follow replicates the stream until the follower is stopped, the
+// stream is deleted from the leader or the stream is no longer followed.
+func (this *Follower) follow(id stream.Id) {
+	defer this.done.Done()
+	defer func() {
+		this.lock.Lock()
+		delete(this.following, id)
+		this.lock.Unlock()
+	}()
+
+	// a stream that doesn't exist yet is created once
+	// the leader tells the settings it has
+	local, err := this.local(id)
+	if err != nil {
+		log.With("stream_id", id).WithError(err).Error("failed to open stream to replicate")
+		return
+	}
+
+	offset := message.EmptyOffset
+	if local != nil {
+		offset = local.HeadOffset()
+		this.report(id, local)
+	}
+
+	// skipped is the offset the follower continues from
+	// after the leader dropped the messages it needed
+	skipped := message.EmptyOffset
+
+	// reconciled is the leader the local stream is reconciled
+	// with, the stream is reconciled again when the leader changes
+	reconciled := ""
+
+	for this.ctx.Err() == nil {
+		leader, ok := this.source(id)
+		if !ok {
+			if log.IsInfo() {
+				log.With("stream_id", id).Info("stopped following stream")
+			}
+			return
+		}
+
+		conn, err := this.connections.get(leader)
+		if err != nil {
+			log.With("stream_id", id).With("leader", leader).WithError(err).Error("failed to connect to leader")
+			this.pause()
+			continue
+		}
+
+		if local != nil && leader != reconciled {
+			ok, err := this.reconcile(conn, id, local)
+			if err != nil {
+				log.With("stream_id", id).With("leader", leader).WithError(err).Error("failed to reconcile stream with leader")
+				this.pause()
+				continue
+			}
+			if ok {
+				reconciled = leader
+				offset = local.HeadOffset()
+				this.report(id, local)
+			}
+		}
+
+		response, err := api.NewReplicationClient(conn).Fetch(this.ctx, &api.ReplicaFetchRequest{
+			FollowerId:    this.id,
+			Stream:        string(id),
+			Offset:        uint64(offset),
+			MaxWait:       int64(REPLICA_MAX_WAIT),
+			IncludeConfig: local == nil,
+		})
+		if err != nil {
+			if this.ctx.Err() != nil {
+				return
+			}
+
+			switch grpc.Code(err) {
+			case codes.NotFound:
+				if log.IsInfo() {
+					log.With("stream_id", id).Info("stream deleted from leader, stopped following it")
+				}
+				return
+			case codes.OutOfRange:
+				// the leader dropped the messages the follower
+				// needs, it continues from the oldest message
+				if start, ok := this.leaderStart(conn, id); ok && start > offset {
+					offset = start
+					skipped = start
+					continue
+				}
+
+				// the follower is ahead of the leader, it holds
+				// messages the leader doesn't have
+				reconciled = ""
+			}
+
+			log.With("stream_id", id).With("offset", offset).WithError(err).Error("failed to fetch from leader")
+			this.pause()
+			continue
+		}
+
+		if local == nil {
+			// the stream isn't created at the leader yet
+			if response.Config == nil {
+				continue
+			}
+
+			if local, err = this.create(id, response.Config); err != nil {
+				log.With("stream_id", id).WithError(err).Error("failed to create stream to replicate")
+				this.pause()
+				continue
+			}
+		}
+
+		set, err := message.NewAlignedSet(response.Messages)
+		if err == nil {
+			err = local.Replicate(set)
+		}
+		if err != nil {
+			log.With("stream_id", id).With("offset", offset).WithError(err).Error("failed to replicate messages")
+			this.pause()
+			continue
+		}
+
+		// drop the messages the leader dropped before
+		// the follower could replicate them
+		if skipped > message.EmptyOffset && local.HeadOffset() > skipped {
+			if err := local.Truncate(skipped); err != nil {
+				log.With("stream_id", id).WithError(err).Error("failed to truncate stream")
+			}
+			skipped = message.EmptyOffset
+		}
+
+		if set.MessageCount() > 0 {
+			this.report(id, local)
+		}
+		offset = message.Offset(response.NextOffset)
+	}
+}
+
+// report tells the offset up to which the
+// local stream is replicated, if asked to.
+func (this *Follower) report(id stream.Id, local stream.Stream) {
+	if this.replicated != nil {
+		this.replicated(id, local.HeadOffset())
+	}
+}
+
+// reconcile rewinds the local stream to the last message it shares with
+// the leader. After a leader change the follower might hold messages the
+// new leader never had, they would be mixed with the messages of the
+// leader otherwise. It returns false if the leader doesn't have the
+// stream yet.
+func (this *Follower) reconcile(conn *grpc.ClientConn, id stream.Id, local stream.Stream) (bool, error) {
+	stats, err := api.NewAdminClient(conn).StatStream(this.ctx, &api.StatStreamRequest{
+		Stream: string(id),
+	})
+	if err != nil {
+		if grpc.Code(err) == codes.NotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// the messages before either start offset can't be
+	// compared, the messages after either head are not shared
+	low := local.StartOffset()
+	if start := message.Offset(stats.FirstOffset); start > low {
+		low = start
+	}
+	high := local.HeadOffset()
+	if head := message.Offset(stats.NextOffset); head < high {
+		high = head
+	}
+
+	// both streams hold the same messages up to the first
+	// message that differs, it is found with a binary search
+	for low < high {
+		middle := low + (high-low)/2
+
+		same, err := this.same(conn, id, local, middle)
+		if err != nil {
+			return false, err
+		}
+
+		if same {
+			low = middle.Next()
+		} else {
+			high = middle
+		}
+	}
+
+	if head := local.HeadOffset(); low < head {
+		if log.IsInfo() {
+			log.With("stream_id", id).With("from", head).With("to", low).Info("rewinding stream to the last message shared with the leader")
+		}
+		if err := local.Rewind(low); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// same returns true if the local stream holds the same
+// message at the offset as the stream at the leader.
+func (this *Follower) same(conn *grpc.ClientConn, id stream.Id, local stream.Stream, offset message.Offset) (bool, error) {
+	set, err := local.Read(offset, 1, 1)
+	if err != nil {
+		return false, err
+	}
+
+	response, err := api.NewStrandClient(conn).Read(this.ctx, &api.ReadRequest{
+		Stream:      string(id),
+		Offset:      uint64(offset),
+		MaxMessages: 1,
+		MaxBytes:    1,
+		Compressed:  true,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(set.GetBuffer(), response.Messages), nil
+}
+
+// leaderStart returns the offset of the oldest message of the stream
+// at the leader, or false if the leader can't tell.
+func (this *Follower) leaderStart(conn *grpc.ClientConn, id stream.Id) (message.Offset, bool) {
+	response, err := api.NewAdminClient(conn).StatStream(this.ctx, &api.StatStreamRequest{
+		Stream: string(id),
+	})
+	if err != nil {
+		return message.EmptyOffset, false
+	}
+	return message.Offset(response.FirstOffset), true
+}
+
+// local returns the local stream, or nil if it doesn't exist yet.
+func (this *Follower) local(id stream.Id) (stream.Stream, error) {
+	exists, err := this.directory.Exists(id)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return this.streams.Get(id)
+}
+
+// create creates the local stream with the settings the stream has at
+// the leader. They are stored with the stream, so the follower keeps
+// them when it restarts.
+func (this *Follower) create(id stream.Id, config *api.StreamConfig) (stream.Stream, error) {
+	options := applyConfig(this.defaults, config)
+
+	created, err := this.streams.Create(id, func(id stream.Id) (stream.Stream, error) {
+		return this.directory.CreateStream(id, options)
+	})
+	if err == stream.ErrStreamExists {
+		return this.streams.Get(id)
+	}
+	return created, err
+}
+
+func (this *Follower) pause() {
+	timer := time.NewTimer(FOLLOWER_RETRY_INTERVAL)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-this.ctx.Done():
+	}
+}
+
+// Stop stops following the leader and waits for
+// the routines that replicate the streams.
+func (this *Follower) Stop() {
+	this.cancel()
+	this.done.Wait()
+	this.connections.close()
+}
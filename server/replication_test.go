@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// waitFor polls the condition until it is true,
+// it fails the test after five seconds.
+func waitFor(t *testing.T, condition func() bool, format string, args ...interface{}) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// replicated returns true if the follower has the
+// same frames of the stream as the leader.
+func replicated(leader *testServer, follower *testServer, id string) bool {
+	ctx := context.Background()
+	request := &api.ReadRequest{Stream: id, Compressed: true}
+
+	expected, err := leader.strand.Read(ctx, request)
+	if err != nil {
+		return false
+	}
+	actual, err := follower.strand.Read(ctx, request)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(expected.Messages, actual.Messages) && expected.NextOffset == actual.NextOffset
+}
+
+func TestFollowerReplicatesStreams(t *testing.T) {
+	assert := assert.New(t)
+	leader := startServer(t)
+	defer leader.stop()
+
+	leader.write(t, "orders", "a", "b")
+	ctx := context.Background()
+	_, err := leader.admin.CreateStream(ctx, &api.CreateStreamRequest{
+		Stream: "configured",
+		Config: &api.StreamConfig{MaxMessageBytes: 64},
+	})
+	assert.Nil(err)
+	leader.strand.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing", Stream: "orders", Offset: 1})
+
+	follower := startServer(t, Follow(leader.address, "follower"))
+	defer follower.stop()
+
+	waitFor(t, func() bool { return replicated(leader, follower, "orders") }, "stream not replicated")
+
+	// new messages are replicated as they are written
+	leader.write(t, "orders", "c")
+	waitFor(t, func() bool { return replicated(leader, follower, "orders") }, "new messages not replicated")
+
+	// the stream is created with the settings of the leader
+	waitFor(t, func() bool {
+		_, err := follower.admin.StatStream(ctx, &api.StatStreamRequest{Stream: "configured"})
+		return err == nil
+	}, "stream without messages not replicated")
+	fetched, err := follower.Fetch(ctx, &api.ReplicaFetchRequest{FollowerId: "test", Stream: "configured", IncludeConfig: true})
+	assert.Nil(err)
+	assert.Equal(uint32(64), fetched.Config.MaxMessageBytes, "settings of replicated stream")
+
+	// the committed offsets are replicated with the streams
+	waitFor(t, func() bool {
+		fetched, err := follower.strand.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "billing", Stream: "orders"})
+		return err == nil && fetched.Found && fetched.Offset == 1
+	}, "committed offset not replicated")
+}
+
+func TestFollowerRefusesWrites(t *testing.T) {
+	assert := assert.New(t)
+	leader := startServer(t)
+	defer leader.stop()
+
+	follower := startServer(t, Follow(leader.address, "follower"))
+	defer follower.stop()
+
+	ctx := context.Background()
+
+	_, err := follower.strand.Write(ctx, &api.WriteRequest{Stream: "orders", Messages: setOf("a")})
+	assert.Equal(codes.FailedPrecondition, grpc.Code(err), "write")
+
+	_, err = follower.admin.CreateStream(ctx, &api.CreateStreamRequest{Stream: "orders"})
+	assert.Equal(codes.FailedPrecondition, grpc.Code(err), "create stream")
+
+	_, err = follower.admin.TruncateStream(ctx, &api.TruncateStreamRequest{Stream: "orders", Offset: 1})
+	assert.Equal(codes.FailedPrecondition, grpc.Code(err), "truncate stream")
+
+	_, err = follower.strand.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing", Stream: "orders", Offset: 1})
+	assert.Equal(codes.FailedPrecondition, grpc.Code(err), "commit offset")
+}
+
+func TestWriteWaitsForAcks(t *testing.T) {
+	assert := assert.New(t)
+	leader := startServer(t)
+	defer leader.stop()
+
+	ctx := context.Background()
+
+	_, err := leader.strand.Write(ctx, &api.WriteRequest{Stream: "orders", Messages: setOf("a"), Acks: 1})
+	assert.Equal(codes.Unavailable, grpc.Code(err), "write without followers")
+
+	follower := startServer(t, Follow(leader.address, "follower"))
+	defer follower.stop()
+
+	waitFor(t, func() bool { return replicated(leader, follower, "orders") }, "stream not replicated")
+
+	written, err := leader.strand.Write(ctx, &api.WriteRequest{Stream: "orders", Messages: setOf("b"), Acks: 1})
+	assert.Nil(err)
+
+	// the write is replicated once it is acknowledged
+	read, err := follower.strand.Read(ctx, &api.ReadRequest{Stream: "orders", Offset: written.FirstOffset})
+	assert.Nil(err)
+	_, bodies := bodiesOf(t, read.Messages)
+	assert.Equal([]string{"b"}, bodies, "acknowledged messages")
+
+	_, err = leader.strand.Write(ctx, &api.WriteRequest{Stream: "orders", Messages: setOf("c"), Acks: 2})
+	assert.Equal(codes.Unavailable, grpc.Code(err), "write with more acks than followers")
+}
+
+func TestFetchErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "orders", "a")
+	replication := api.NewReplicationClient(server.conn)
+	ctx := context.Background()
+
+	_, err := replication.Fetch(ctx, &api.ReplicaFetchRequest{Stream: "orders"})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "empty follower id")
+
+	_, err = replication.Fetch(ctx, &api.ReplicaFetchRequest{FollowerId: "follower", Stream: "unknown"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "unknown stream")
+
+	_, err = replication.Fetch(ctx, &api.ReplicaFetchRequest{FollowerId: "follower", Stream: "orders", Offset: 2})
+	assert.Equal(codes.OutOfRange, grpc.Code(err), "offset after head")
+
+	fetched, err := replication.Fetch(ctx, &api.ReplicaFetchRequest{FollowerId: "follower", Stream: "orders", Offset: 1, MaxWait: int64(10 * time.Millisecond)})
+	assert.Nil(err)
+	assert.Empty(fetched.Messages, "fetch at head")
+	assert.Equal(uint64(1), fetched.HeadOffset)
+}
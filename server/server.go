@@ -1,7 +1,19 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
 	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/cluster"
 	"github.com/pjvds/strand/message"
 	"github.com/pjvds/strand/stream"
 	"github.com/pjvds/tidy"
@@ -12,16 +24,206 @@ var log = tidy.Configure().
 	LogFromLevel(tidy.DEBUG).To(tidy.Console).
 	MustBuild()
 
+// SetLogLevel sets the level from which the server logs. It
+// must be called before the first server is created.
+func SetLogLevel(level tidy.Level) {
+	log = tidy.Configure().
+		LogFromLevel(level).To(tidy.Console).
+		MustBuild()
+}
+
+// DEFAULT_READ_MAX_BYTES is the maximum number of bytes
+// returned by a read that doesn't specify its own limit.
+const DEFAULT_READ_MAX_BYTES = 1024 * 1024
+
+// MAX_DECOMPRESSED_READ_BYTES is the maximum number of bytes that the
+// compressed messages of a single read are decompressed to, for clients
+// that don't decompress them themselves. A read that holds more returns
+// the messages that fit, the client reads the rest with its next read.
+const MAX_DECOMPRESSED_READ_BYTES = message.MAX_DECOMPRESSED_SIZE
+
+// RETENTION_INTERVAL is the interval at which the
+// retention policy of the streams is enforced.
+const RETENTION_INTERVAL = time.Minute
+
+// HEAD_OFFSET_TRAILER is the trailer that holds the actual head offset
+// of the stream when a conditional write fails its precondition.
+const HEAD_OFFSET_TRAILER = "head-offset"
+
+// TRANSACTION_LOG_FILENAME is the name of the file in the data
+// directory that logs the transactions in progress.
+const TRANSACTION_LOG_FILENAME = ".transactions"
+
+// COMPACTION_INTERVAL is the interval at
+// which the compacted streams are compacted.
+const COMPACTION_INTERVAL = time.Minute
+
 type Server struct {
-	streams *stream.Map
+	directory stream.Directory
+	defaults  stream.Options
+	streams   *stream.Map
+	offsets   *stream.OffsetStore
+	topics    topicStore
+
+	coordinator *Coordinator
+	replicas    *replicaTracker
+
+	// leader is the address of the leader the server follows,
+	// it is empty unless the server is a follower
+	leader string
+
+	// follower is nil unless the server follows a leader
+	// or replicates the streams of the other cluster nodes
+	follower *Follower
+
+	// node is nil unless the server is a node of a cluster
+	node        *cluster.Node
+	connections *connections
+
+	janitor   *stream.Janitor
+	compactor *stream.Compactor
+
+	// lock claims the data directory
+	lock *stream.DirectoryLock
+
+	// closing is closed once the server shuts down, writes
+	// counts the writes in progress so they can finish
+	closing      chan struct{}
+	writes       sync.WaitGroup
+	shutdownLock sync.RWMutex
+}
+
+// Option configures a server.
+type Option func(config *config)
+
+type config struct {
+	strict   bool
+	defaults *stream.Options
+
+	leader     string
+	followerId string
+
+	node *cluster.Node
 }
 
-func NewServer(directory string) (*Server, error) {
+// StrictStreams makes the server refuse to write to or read from
+// streams that are not created with the CreateStream call, instead
+// of creating every stream that is written to.
+func StrictStreams() Option {
+	return func(config *config) {
+		config.strict = true
+	}
+}
+
+// Defaults sets the options of the streams that are not created with
+// their own settings, instead of the default options of the stream
+// package.
+func Defaults(options stream.Options) Option {
+	return func(config *config) {
+		config.defaults = &options
+	}
+}
+
+// Follow makes the server a follower that replicates every stream of
+// the leader at the given address. The id identifies the follower at
+// the leader. A follower doesn't accept writes of its own.
+func Follow(leader string, id string) Option {
+	return func(config *config) {
+		config.leader = leader
+		config.followerId = id
+	}
+}
+
+func NewServer(directory string, options ...Option) (*Server, error) {
+	config := config{}
+	for _, option := range options {
+		option(&config)
+	}
+
 	streamDir := stream.Directory(directory)
+	defaults := stream.DefaultOptions
+	if config.defaults != nil {
+		defaults = *config.defaults
+	}
 
-	return &Server{
-		streams: stream.NewMap(streamDir.OpenOrCreateStream),
-	}, nil
+	// the directory is claimed before anything in it is
+	// opened, another process might be writing to it
+	lock, err := streamDir.Lock()
+	if err != nil {
+		return nil, err
+	}
+
+	creator := streamDir.Creator(defaults)
+	if config.strict {
+		creator = streamDir.Opener(defaults)
+	}
+	streams := stream.NewMap(creator)
+
+	if err := streams.OpenTransactionLog(filepath.Join(directory, TRANSACTION_LOG_FILENAME)); err != nil {
+		lock.Release()
+		return nil, err
+	}
+
+	offsets, err := openOffsetStore(streamDir, streams, defaults)
+	if err != nil {
+		streams.Close()
+		lock.Release()
+		return nil, err
+	}
+
+	var topics topicStore
+	if config.node != nil {
+		topics = newClusterTopics(config.node)
+	} else {
+		opened, err := stream.OpenTopics(filepath.Join(directory, TOPICS_DIRECTORY))
+		if err != nil {
+			streams.Close()
+			lock.Release()
+			return nil, err
+		}
+		topics = localTopics{opened}
+	}
+
+	server := &Server{
+		directory: streamDir,
+		defaults:  defaults,
+		streams:   streams,
+		offsets:   offsets,
+		topics:    topics,
+		coordinator: NewCoordinator(func() ([]stream.Id, error) {
+			ids, err := streamDir.List()
+			if err != nil {
+				return nil, err
+			}
+
+			streams := make([]stream.Id, 0, len(ids))
+			for _, id := range ids {
+				if !internal(id) {
+					streams = append(streams, id)
+				}
+			}
+			return streams, nil
+		}),
+		janitor:     stream.StartJanitor(streams, streamDir, defaults, RETENTION_INTERVAL),
+		compactor:   stream.StartCompactor(streams, streamDir, defaults, COMPACTION_INTERVAL),
+		replicas:    newReplicaTracker(),
+		leader:      config.leader,
+		node:        config.node,
+		connections: newConnections(),
+		lock:        lock,
+		closing:     make(chan struct{}),
+	}
+
+	if config.node != nil {
+		server.follower = startClusterFollower(config.node, streamDir, streams, defaults)
+	} else if config.leader != "" {
+		if server.follower, err = StartFollower(config.leader, config.followerId, streamDir, streams, defaults); err != nil {
+			server.Close()
+			return nil, err
+		}
+	}
+
+	return server, nil
 }
 
 func (this *Server) Write(ctx context.Context, request *api.WriteRequest) (*api.WriteResponse, error) {
@@ -30,12 +232,41 @@ func (this *Server) Write(ctx context.Context, request *api.WriteRequest) (*api.
 		log.With("stream_id", id).Debug("handling append request")
 	}
 
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	if internal(id) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "stream %v is internal", id)
+	}
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	if err := this.begin(); err != nil {
+		return nil, err
+	}
+	defer this.end()
+
+	conn, err := this.forward(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		var trailer metadata.MD
+		response, err := api.NewStrandClient(conn).Write(this.forwardContext(ctx), request, grpc.Trailer(&trailer))
+		if len(trailer) > 0 {
+			grpc.SetTrailer(ctx, trailer)
+		}
+		return response, err
+	}
+
 	s, err := this.streams.Get(id)
 	if err != nil {
 		if log.IsInfo() {
 			log.With("stream_id", id).WithError(err).Info("failed to get stream")
 		}
-		return nil, err
+		return nil, getError(id, err)
 	}
 
 	set, err := message.NewUnalignedSet(request.Messages)
@@ -43,19 +274,377 @@ func (this *Server) Write(ctx context.Context, request *api.WriteRequest) (*api.
 		if log.IsDebug() {
 			log.WithError(err).Debug("failed to parse message set")
 		}
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid message set: %v", err)
+	}
+
+	if set.MessageCount() == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "message set is empty")
+	}
+
+	var options []stream.WriteOption
+	switch request.Expect {
+	case api.WriteRequest_OFFSET:
+		options = append(options, stream.ExpectHead(message.Offset(request.ExpectedOffset)))
+	case api.WriteRequest_NO_STREAM:
+		options = append(options, stream.ExpectHead(message.EmptyOffset))
+	}
+
+	if request.ProducerId != 0 {
+		options = append(options, stream.WithSequence(stream.ProducerId(request.ProducerId), request.Sequence))
+	}
+
+	written, err := s.Write(set, options...)
+	if err != nil {
+		if mismatch, ok := err.(stream.HeadMismatchError); ok {
+			grpc.SetTrailer(ctx, metadata.Pairs(HEAD_OFFSET_TRAILER, strconv.FormatUint(uint64(mismatch.Head), 10)))
+			return nil, grpc.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+		if _, ok := err.(stream.SequenceError); ok {
+			return nil, grpc.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+		if _, ok := err.(stream.MessageTooLargeError); ok {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		return nil, getError(id, err)
+	}
+
+	if request.Sync {
+		if err := s.Sync(written.LastOffset().Next()); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.Acks > 0 {
+		if err := this.replicas.wait(ctx, id, written.LastOffset().Next(), int(request.Acks)); err != nil {
+			if log.IsInfo() {
+				log.With("stream_id", id).WithError(err).Info("write not acknowledged by followers")
+			}
+			return nil, err
+		}
+	}
+
+	return &api.WriteResponse{
+		Ok:           true,
+		FirstOffset:  uint64(written.FirstOffset()),
+		LastOffset:   uint64(written.LastOffset()),
+		MessageCount: uint32(written.MessageCount()),
+	}, nil
+}
+
+func (this *Server) Read(ctx context.Context, request *api.ReadRequest) (*api.ReadResponse, error) {
+	id := stream.Id(request.Stream)
+	offset := message.Offset(request.Offset)
+	if log.IsDebug() {
+		log.With("stream_id", id).With("offset", offset).Debug("handling read request")
+	}
+
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	conn, err := this.forward(ctx, id, false)
+	if err != nil {
 		return nil, err
 	}
+	if conn != nil {
+		return api.NewStrandClient(conn).Read(this.forwardContext(ctx), request)
+	}
 
-	_, err = s.Write(set)
+	s, err := this.existingStream(id)
 	if err != nil {
 		return nil, err
 	}
 
-	return &api.WriteResponse{
-		Ok: true,
+	maxBytes := int(request.MaxBytes)
+	if maxBytes == 0 {
+		maxBytes = DEFAULT_READ_MAX_BYTES
+	}
+
+	set, err := s.Read(offset, int(request.MaxMessages), maxBytes)
+	if err != nil {
+		return nil, readError(s, offset, err)
+	}
+
+	if !request.Compressed {
+		if set, err = decompress(set, offset, MAX_DECOMPRESSED_READ_BYTES); err != nil {
+			return nil, err
+		}
+	}
+
+	nextOffset := offset
+	if set.MessageCount() > 0 {
+		nextOffset = set.LastOffset().Next()
+	}
+
+	return &api.ReadResponse{
+		Messages:   set.GetBuffer(),
+		NextOffset: uint64(nextOffset),
 	}, nil
 }
 
+// Subscribe sends all messages from the requested offset and keeps
+// following the stream, sending new messages as they are written.
+// Every subscriber reads from the stream at its own pace, a slow
+// subscriber falls behind instead of holding back the writers.
+func (this *Server) Subscribe(request *api.SubscribeRequest, subscription api.Strand_SubscribeServer) error {
+	id := stream.Id(request.Stream)
+	offset := message.Offset(request.FromOffset)
+	if log.IsDebug() {
+		log.With("stream_id", id).With("offset", offset).Debug("handling subscribe request")
+	}
+
+	if !validStream(id) {
+		return grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	conn, err := this.forward(subscription.Context(), id, false)
+	if err != nil {
+		return err
+	}
+	if conn != nil {
+		return this.forwardSubscription(conn, request, subscription)
+	}
+
+	s, err := this.existingStream(id)
+	if err != nil {
+		return err
+	}
+
+	maxBytes := int(request.MaxBytes)
+	if maxBytes == 0 {
+		maxBytes = DEFAULT_READ_MAX_BYTES
+	}
+
+	done := subscription.Context().Done()
+	for {
+		set, err := s.Read(offset, 0, maxBytes)
+		if err != nil {
+			return readError(s, offset, err)
+		}
+
+		if set.MessageCount() == 0 {
+			select {
+			case <-s.Notify(offset):
+				continue
+			case <-done:
+				return nil
+			case <-this.closing:
+				return grpc.Errorf(codes.Unavailable, "server is shutting down")
+			}
+		}
+
+		if !request.Compressed {
+			if set, err = decompress(set, offset, MAX_DECOMPRESSED_READ_BYTES); err != nil {
+				return err
+			}
+		}
+		offset = set.LastOffset().Next()
+
+		// Send blocks while the flow control window of
+		// the subscriber is full.
+		if err := subscription.Send(&api.SubscribeResponse{
+			Messages:   set.GetBuffer(),
+			NextOffset: uint64(offset),
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func (this *Server) OffsetForTime(ctx context.Context, request *api.OffsetForTimeRequest) (*api.OffsetForTimeResponse, error) {
+	id := stream.Id(request.Stream)
+	if log.IsDebug() {
+		log.With("stream_id", id).With("timestamp", request.Timestamp).Debug("handling offset for time request")
+	}
+
+	if !validStream(id) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+
+	conn, err := this.forward(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return api.NewStrandClient(conn).OffsetForTime(this.forwardContext(ctx), request)
+	}
+
+	s, err := this.existingStream(id)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := s.OffsetForTime(request.Timestamp)
+	if err != nil {
+		return nil, readError(s, offset, err)
+	}
+
+	return &api.OffsetForTimeResponse{
+		Offset: uint64(offset),
+	}, nil
+}
+
+// WriteTransaction writes messages to several streams at once. Readers
+// see the messages of all streams, or none of them if the write fails.
+func (this *Server) WriteTransaction(ctx context.Context, request *api.WriteTransactionRequest) (*api.WriteTransactionResponse, error) {
+	if log.IsDebug() {
+		log.With("streams", len(request.Writes)).Debug("handling transaction request")
+	}
+
+	if len(request.Writes) == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "transaction has no writes")
+	}
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	sets := make(map[stream.Id]message.UnalignedSet, len(request.Writes))
+	for _, write := range request.Writes {
+		id := stream.Id(write.Stream)
+		if !validStream(id) {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+		}
+		if internal(id) {
+			return nil, grpc.Errorf(codes.PermissionDenied, "stream %v is internal", id)
+		}
+		if _, ok := sets[id]; ok {
+			return nil, grpc.Errorf(codes.InvalidArgument, "stream %v is written more than once", id)
+		}
+
+		set, err := message.NewUnalignedSet(write.Messages)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid message set for stream %v: %v", id, err)
+		}
+		if set.MessageCount() == 0 {
+			return nil, grpc.Errorf(codes.InvalidArgument, "message set for stream %v is empty", id)
+		}
+
+		sets[id] = set
+	}
+
+	if err := this.begin(); err != nil {
+		return nil, err
+	}
+	defer this.end()
+
+	leader, err := this.transactionLeader(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if leader != "" {
+		conn, err := this.connect(leader)
+		if err != nil {
+			return nil, err
+		}
+		return api.NewStrandClient(conn).WriteTransaction(this.forwardContext(ctx), request)
+	}
+
+	written, err := this.streams.WriteTransaction(sets)
+	if err != nil {
+		if log.IsInfo() {
+			log.WithError(err).Info("transaction failed")
+		}
+		if err == stream.ErrStreamNotFound {
+			return nil, grpc.Errorf(codes.NotFound, "transaction writes to a stream that doesn't exist")
+		}
+		if _, ok := err.(stream.MessageTooLargeError); ok {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if err == stream.ErrClosed {
+			return nil, grpc.Errorf(codes.Unavailable, "server is shutting down")
+		}
+		return nil, err
+	}
+
+	response := &api.WriteTransactionResponse{
+		Writes: make([]*api.WriteResponse, 0, len(request.Writes)),
+	}
+	for _, write := range request.Writes {
+		set := written[stream.Id(write.Stream)]
+		response.Writes = append(response.Writes, &api.WriteResponse{
+			Ok:           true,
+			FirstOffset:  uint64(set.FirstOffset()),
+			LastOffset:   uint64(set.LastOffset()),
+			MessageCount: uint32(set.MessageCount()),
+		})
+	}
+
+	return response, nil
+}
+
+// RegisterProducer hands out a new producer id for idempotent writes.
+// The ids are random, so they don't have to be tracked by the server.
+func (this *Server) RegisterProducer(context.Context, *api.RegisterProducerRequest) (*api.RegisterProducerResponse, error) {
+	buffer := make([]byte, 8)
+	for {
+		if _, err := rand.Read(buffer); err != nil {
+			return nil, err
+		}
+
+		// producer id 0 means no producer
+		if id := binary.LittleEndian.Uint64(buffer); id != 0 {
+			return &api.RegisterProducerResponse{
+				ProducerId: id,
+			}, nil
+		}
+	}
+}
+
+// decompress decompresses the compressed messages in the set for clients
+// that don't do that themselves, without the messages before the offset
+// that was read. The messages are decompressed to at most max bytes, the
+// set ends before the first compressed message that doesn't fit anymore.
+func decompress(set message.AlignedSet, offset message.Offset, maxBytes int) (message.AlignedSet, error) {
+	decompressed, err := set.DecompressMax(maxBytes)
+	if err != nil {
+		log.WithError(err).With("offset", offset).Error("corrupt compressed message")
+		return message.AlignedSet{}, grpc.Errorf(codes.DataLoss, "%v", err)
+	}
+	return decompressed.From(offset), nil
+}
+
+// leaderOnly returns a grpc error for the calls
+// that change streams on a follower.
+func (this *Server) leaderOnly() error {
+	if this.leader != "" {
+		return grpc.Errorf(codes.FailedPrecondition, "server is a follower of %v", this.leader)
+	}
+	return nil
+}
+
+// getError translates an error from getting a stream to a grpc error.
+func getError(id stream.Id, err error) error {
+	if err == stream.ErrStreamNotFound {
+		return grpc.Errorf(codes.NotFound, "stream %v not found", id)
+	}
+	if err == stream.ErrClosed {
+		return grpc.Errorf(codes.Unavailable, "server is shutting down")
+	}
+	if err == stream.ErrInvalidId {
+		return grpc.Errorf(codes.InvalidArgument, "invalid stream name %q", id)
+	}
+	return err
+}
+
+// readError translates an error from reading
+// the stream at the given offset to a grpc error.
+func readError(s stream.Stream, offset message.Offset, err error) error {
+	if corruption, ok := err.(stream.CorruptionError); ok {
+		log.WithError(err).With("stream_id", corruption.Stream).With("offset", corruption.Offset).Error("corrupt message")
+		return grpc.Errorf(codes.DataLoss, "%v", err)
+	}
+
+	if err == stream.ErrOffsetOutOfRange {
+		return grpc.Errorf(codes.OutOfRange, "offset %v out of range [%v, %v]", offset, s.StartOffset(), s.HeadOffset())
+	}
+
+	// the stream is deleted, or closed because the server shuts down
+	if err == stream.ErrClosed {
+		return grpc.Errorf(codes.Aborted, "stream is closed")
+	}
+	return err
+}
+
 func (this *Server) Ping(context.Context, *api.PingRequest) (*api.PingResponse, error) {
 	return &api.PingResponse{}, nil
 }
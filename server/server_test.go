@@ -0,0 +1,463 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// testServer is a server in a temporary directory that serves
+// on a local port, with clients that are connected to it.
+type testServer struct {
+	*Server
+	directory string
+	address   string
+
+	grpc   *grpc.Server
+	conn   *grpc.ClientConn
+	strand api.StrandClient
+	admin  api.AdminClient
+}
+
+// startServer starts a server in a new temporary directory.
+func startServer(t *testing.T, options ...Option) *testServer {
+	directory, err := ioutil.TempDir("", "strand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startServerIn(t, directory, options...)
+}
+
+// startServerIn starts a server in the directory, which
+// is kept when the server stops so it can be started again.
+func startServerIn(t *testing.T, directory string, options ...Option) *testServer {
+	server, err := NewServer(directory, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+
+	g := grpc.NewServer()
+	api.RegisterStrandServer(g, server)
+	api.RegisterAdminServer(g, server)
+	api.RegisterReplicationServer(g, server)
+	go g.Serve(listener)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		g.Stop()
+		server.Close()
+		t.Fatal(err)
+	}
+
+	return &testServer{
+		Server:    server,
+		directory: directory,
+		address:   listener.Addr().String(),
+		grpc:      g,
+		conn:      conn,
+		strand:    api.NewStrandClient(conn),
+		admin:     api.NewAdminClient(conn),
+	}
+}
+
+// close stops the server and keeps its directory.
+func (this *testServer) close() {
+	this.conn.Close()
+	this.grpc.Stop()
+	this.Server.Close()
+}
+
+// stop stops the server and removes its directory.
+func (this *testServer) stop() {
+	this.close()
+	os.RemoveAll(this.directory)
+}
+
+// write writes a message for every body to the stream.
+func (this *testServer) write(t *testing.T, id string, bodies ...string) *api.WriteResponse {
+	response, err := this.strand.Write(context.Background(), &api.WriteRequest{
+		Stream:   id,
+		Messages: setOf(bodies...),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// setOf returns the buffer of a set with a message for every body.
+func setOf(bodies ...string) []byte {
+	set := message.NewSet()
+	for _, body := range bodies {
+		set.Append([]byte(body))
+	}
+	return set.GetBuffer()
+}
+
+// bodiesOf returns the offsets and bodies of the messages in the buffer.
+func bodiesOf(t *testing.T, buffer []byte) ([]message.Offset, []string) {
+	var offsets []message.Offset
+	var bodies []string
+
+	messages := message.NewIterator(buffer)
+	for m, ok := messages.Next(); ok; m, ok = messages.Next() {
+		offsets = append(offsets, m.Offset())
+		bodies = append(bodies, string(m.Body()))
+	}
+	if err := messages.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return offsets, bodies
+}
+
+func TestRead(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "read", "a", "b", "c", "d", "e")
+	ctx := context.Background()
+
+	read, err := server.strand.Read(ctx, &api.ReadRequest{Stream: "read", Offset: 1, MaxMessages: 3})
+	assert.Nil(err)
+	offsets, bodies := bodiesOf(t, read.Messages)
+	assert.Equal([]message.Offset{1, 2, 3}, offsets)
+	assert.Equal([]string{"b", "c", "d"}, bodies)
+	assert.Equal(uint64(4), read.NextOffset)
+
+	read, err = server.strand.Read(ctx, &api.ReadRequest{Stream: "read", Offset: read.NextOffset})
+	assert.Nil(err)
+	_, bodies = bodiesOf(t, read.Messages)
+	assert.Equal([]string{"e"}, bodies, "read until the head")
+	assert.Equal(uint64(5), read.NextOffset)
+
+	// a read at the head returns nothing and the same offset
+	read, err = server.strand.Read(ctx, &api.ReadRequest{Stream: "read", Offset: 5})
+	assert.Nil(err)
+	assert.Empty(read.Messages)
+	assert.Equal(uint64(5), read.NextOffset)
+}
+
+func TestReadMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "read", "a", "b", "c")
+	ctx := context.Background()
+
+	all, _ := server.strand.Read(ctx, &api.ReadRequest{Stream: "read"})
+	first, _ := server.strand.Read(ctx, &api.ReadRequest{Stream: "read", MaxMessages: 1})
+
+	// the first message is returned even if it doesn't fit
+	read, err := server.strand.Read(ctx, &api.ReadRequest{Stream: "read", MaxBytes: 1})
+	assert.Nil(err)
+	assert.Equal(first.Messages, read.Messages)
+
+	read, err = server.strand.Read(ctx, &api.ReadRequest{Stream: "read", MaxBytes: uint32(len(all.Messages) - 1)})
+	assert.Nil(err)
+	_, bodies := bodiesOf(t, read.Messages)
+	assert.Equal([]string{"a", "b"}, bodies)
+	assert.Equal(uint64(2), read.NextOffset)
+}
+
+func TestReadCompressed(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	set := message.NewSet()
+	set.Append([]byte("a"))
+	set.Append([]byte("b"))
+	set.Append([]byte("c"))
+	compressed, err := set.Compress(message.Gzip)
+	assert.Nil(err)
+
+	_, err = server.strand.Write(context.Background(), &api.WriteRequest{Stream: "read", Messages: compressed.GetBuffer()})
+	assert.Nil(err)
+
+	// the messages are decompressed from the offset that is read
+	read, err := server.strand.Read(context.Background(), &api.ReadRequest{Stream: "read", Offset: 1})
+	assert.Nil(err)
+	offsets, bodies := bodiesOf(t, read.Messages)
+	assert.Equal([]message.Offset{1, 2}, offsets)
+	assert.Equal([]string{"b", "c"}, bodies)
+	assert.Equal(uint64(3), read.NextOffset)
+
+	read, err = server.strand.Read(context.Background(), &api.ReadRequest{Stream: "read", Offset: 1, Compressed: true})
+	assert.Nil(err)
+	m, _ := message.NewIterator(read.Messages).Next()
+	assert.Equal(message.Gzip, m.Codec(), "message as stored")
+	assert.Equal(uint64(3), read.NextOffset)
+}
+
+func TestDecompressMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	for _, body := range []string{"a", "b"} {
+		set := message.NewSet()
+		set.Append([]byte(body))
+		set.Append([]byte(body))
+		compressed, _ := set.Compress(message.Snappy)
+
+		_, err := server.strand.Write(context.Background(), &api.WriteRequest{Stream: "read", Messages: compressed.GetBuffer()})
+		assert.Nil(err)
+	}
+
+	read, err := server.strand.Read(context.Background(), &api.ReadRequest{Stream: "read", Offset: 1, Compressed: true})
+	assert.Nil(err)
+	set, _ := message.NewAlignedSet(read.Messages)
+
+	// the first compressed message is always decompressed
+	decompressed, err := decompress(set, 1, 1)
+	assert.Nil(err)
+	offsets, bodies := bodiesOf(t, decompressed.GetBuffer())
+	assert.Equal([]message.Offset{1}, offsets)
+	assert.Equal([]string{"a"}, bodies)
+
+	decompressed, err = decompress(set, 1, MAX_DECOMPRESSED_READ_BYTES)
+	assert.Nil(err)
+	offsets, _ = bodiesOf(t, decompressed.GetBuffer())
+	assert.Equal([]message.Offset{1, 2, 3}, offsets)
+}
+
+func TestReadErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "read", "a", "b")
+	ctx := context.Background()
+
+	_, err := server.strand.Read(ctx, &api.ReadRequest{Stream: "read", Offset: 3})
+	assert.Equal(codes.OutOfRange, grpc.Code(err), "offset after head")
+
+	_, err = server.strand.Read(ctx, &api.ReadRequest{Stream: "../read"})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "invalid stream name")
+
+	_, err = server.strand.Read(ctx, &api.ReadRequest{Stream: ""})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "empty stream name")
+}
+
+func TestSubscribe(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "subscribed", "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	subscription, err := server.strand.Subscribe(ctx, &api.SubscribeRequest{Stream: "subscribed", FromOffset: 1})
+	assert.Nil(err)
+
+	received, err := subscription.Recv()
+	assert.Nil(err)
+	offsets, bodies := bodiesOf(t, received.Messages)
+	assert.Equal([]message.Offset{1}, offsets, "replayed offsets")
+	assert.Equal([]string{"b"}, bodies, "replayed messages")
+	assert.Equal(uint64(2), received.NextOffset)
+
+	// new messages are sent as they are written
+	server.write(t, "subscribed", "c", "d")
+
+	received, err = subscription.Recv()
+	assert.Nil(err)
+	offsets, bodies = bodiesOf(t, received.Messages)
+	assert.Equal([]message.Offset{2, 3}, offsets, "new offsets")
+	assert.Equal([]string{"c", "d"}, bodies, "new messages")
+	assert.Equal(uint64(4), received.NextOffset)
+
+	cancel()
+	_, err = subscription.Recv()
+	assert.Equal(codes.Canceled, grpc.Code(err))
+}
+
+func TestSubscribeMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "subscribed", "a", "b", "c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscription, err := server.strand.Subscribe(ctx, &api.SubscribeRequest{Stream: "subscribed", MaxBytes: 1})
+	assert.Nil(err)
+
+	// every response holds a single message that exceeds the max bytes
+	for i, body := range []string{"a", "b", "c"} {
+		received, err := subscription.Recv()
+		assert.Nil(err)
+		_, bodies := bodiesOf(t, received.Messages)
+		assert.Equal([]string{body}, bodies)
+		assert.Equal(uint64(i+1), received.NextOffset)
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	server.write(t, "subscribed", "a")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscription, _ := server.strand.Subscribe(ctx, &api.SubscribeRequest{Stream: "subscribed", FromOffset: 2})
+	_, err := subscription.Recv()
+	assert.Equal(codes.OutOfRange, grpc.Code(err), "offset after head")
+
+	subscription, _ = server.strand.Subscribe(ctx, &api.SubscribeRequest{Stream: "a/b"})
+	_, err = subscription.Recv()
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "invalid stream name")
+}
+
+func TestSubscribeEndsOnShutdown(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server.write(t, "subscribed", "a")
+
+	subscription, err := server.strand.Subscribe(ctx, &api.SubscribeRequest{Stream: "subscribed", FromOffset: 1})
+	assert.Nil(err)
+
+	assert.Nil(server.Shutdown(ctx))
+
+	_, err = subscription.Recv()
+	assert.Equal(codes.Unavailable, grpc.Code(err))
+}
+
+func TestReadsDontCreateStreams(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := server.strand.Read(ctx, &api.ReadRequest{Stream: "unknown"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "read unknown stream")
+
+	subscription, err := server.strand.Subscribe(ctx, &api.SubscribeRequest{Stream: "unknown"})
+	assert.Nil(err)
+	_, err = subscription.Recv()
+	assert.Equal(codes.NotFound, grpc.Code(err), "subscribe to unknown stream")
+
+	_, err = server.strand.OffsetForTime(ctx, &api.OffsetForTimeRequest{Stream: "unknown"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "offset for time of unknown stream")
+
+	_, err = server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: "unknown"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "stat unknown stream")
+
+	listed, err := server.admin.ListStreams(ctx, &api.ListStreamsRequest{})
+	assert.Nil(err)
+	assert.Empty(listed.Streams)
+}
+
+func TestWriteReturnsOffsets(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	written := server.write(t, "written", "a", "b", "c")
+	assert.True(written.Ok)
+	assert.Equal(uint64(0), written.FirstOffset)
+	assert.Equal(uint64(2), written.LastOffset)
+	assert.Equal(uint32(3), written.MessageCount)
+
+	written = server.write(t, "written", "d", "e")
+	assert.Equal(uint64(3), written.FirstOffset)
+	assert.Equal(uint64(4), written.LastOffset)
+	assert.Equal(uint32(2), written.MessageCount)
+
+	// the offsets are where the messages are read
+	read, err := server.strand.Read(context.Background(), &api.ReadRequest{Stream: "written", Offset: written.FirstOffset})
+	assert.Nil(err)
+	_, bodies := bodiesOf(t, read.Messages)
+	assert.Equal([]string{"d", "e"}, bodies)
+}
+
+func TestWriteErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+
+	_, err := server.strand.Write(ctx, &api.WriteRequest{Stream: "written", Messages: []byte{1, 2, 3}})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "invalid message set")
+
+	_, err = server.strand.Write(ctx, &api.WriteRequest{Stream: "written"})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "empty message set")
+
+	_, err = server.strand.Write(ctx, &api.WriteRequest{Stream: "a/b", Messages: setOf("a")})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "invalid stream name")
+
+	_, err = server.strand.Write(ctx, &api.WriteRequest{Stream: string(OFFSETS_STREAM), Messages: setOf("a")})
+	assert.Equal(codes.PermissionDenied, grpc.Code(err), "internal stream")
+}
+
+func TestConditionalWrite(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+	write := func(expect api.WriteRequest_Expect, offset uint64) (string, error) {
+		var trailer metadata.MD
+		_, err := server.strand.Write(ctx, &api.WriteRequest{
+			Stream:         "aggregate",
+			Messages:       setOf("event"),
+			Expect:         expect,
+			ExpectedOffset: offset,
+		}, grpc.Trailer(&trailer))
+
+		head := trailer[HEAD_OFFSET_TRAILER]
+		if len(head) == 0 {
+			return "", err
+		}
+		return head[0], err
+	}
+
+	_, err := write(api.WriteRequest_NO_STREAM, 0)
+	assert.Nil(err, "write to new stream")
+
+	head, err := write(api.WriteRequest_NO_STREAM, 0)
+	assert.Equal(codes.FailedPrecondition, grpc.Code(err), "write to existing stream")
+	assert.Equal("1", head)
+
+	_, err = write(api.WriteRequest_OFFSET, 1)
+	assert.Nil(err, "write at expected offset")
+
+	head, err = write(api.WriteRequest_OFFSET, 1)
+	assert.Equal(codes.FailedPrecondition, grpc.Code(err), "write at earlier offset")
+	assert.Equal("2", head)
+
+	_, err = write(api.WriteRequest_ANY, 7)
+	assert.Nil(err, "write at any offset")
+
+	stat, _ := server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: "aggregate"})
+	assert.Equal(uint64(3), stat.NextOffset, "messages written")
+}
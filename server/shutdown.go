@@ -0,0 +1,92 @@
+package server
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"golang.org/x/net/context"
+)
+
+// begin registers a write that is in progress, so the server waits for
+// it when it shuts down. It fails with Unavailable once the server is
+// shutting down. Every write that begins must call end.
+func (this *Server) begin() error {
+	this.shutdownLock.RLock()
+	defer this.shutdownLock.RUnlock()
+
+	select {
+	case <-this.closing:
+		return grpc.Errorf(codes.Unavailable, "server is shutting down")
+	default:
+	}
+
+	this.writes.Add(1)
+	return nil
+}
+
+// end marks a write that began as finished.
+func (this *Server) end() {
+	this.writes.Done()
+}
+
+// Shutdown refuses new writes, ends the subscriptions and waits for the
+// writes in progress to finish. It returns the error of the context if
+// it is done before the writes finish. The calls that are not writes
+// are not waited for, they are left to the grpc server.
+func (this *Server) Shutdown(ctx context.Context) error {
+	this.refuseWrites()
+
+	finished := make(chan struct{})
+	go func() {
+		this.writes.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops replicating, the retention and the compaction, syncs and
+// closes every stream and releases the data directory. It shuts the
+// server down first if that didn't happen yet, but doesn't wait for the
+// writes in progress. Writes that are still in progress finish before
+// their stream is closed.
+func (this *Server) Close() error {
+	this.refuseWrites()
+
+	if this.follower != nil {
+		this.follower.Stop()
+	}
+	this.janitor.Stop()
+	this.compactor.Stop()
+	this.connections.close()
+
+	closeErr := this.streams.Close()
+	if closeErr != nil {
+		if log.IsInfo() {
+			log.WithError(closeErr).Info("failed to close streams")
+		}
+	}
+
+	if err := this.lock.Release(); err != nil && closeErr == nil {
+		closeErr = err
+	}
+	return closeErr
+}
+
+// refuseWrites makes the writes that didn't begin
+// yet fail and ends the subscriptions.
+func (this *Server) refuseWrites() {
+	this.shutdownLock.Lock()
+	defer this.shutdownLock.Unlock()
+
+	select {
+	case <-this.closing:
+	default:
+		close(this.closing)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/message"
+	"github.com/pjvds/strand/stream"
+	"golang.org/x/net/context"
+)
+
+// TOPICS_DIRECTORY is the directory in the data directory that
+// holds the settings of the topics of a server that is not a node
+// of a cluster.
+const TOPICS_DIRECTORY = ".topics"
+
+// topicStore keeps the topics. A single server keeps them in the
+// topics directory, the nodes of a cluster keep them in the cluster
+// metadata.
+type topicStore interface {
+	Get(name string) (*stream.Topic, error)
+	Create(ctx context.Context, name string, partitions int) error
+	Delete(ctx context.Context, name string) error
+}
+
+// localTopics keeps the topics in the topics directory.
+type localTopics struct {
+	topics *stream.Topics
+}
+
+func (this localTopics) Get(name string) (*stream.Topic, error) {
+	return this.topics.Get(name)
+}
+
+func (this localTopics) Create(ctx context.Context, name string, partitions int) error {
+	_, err := this.topics.Create(name, partitions)
+	return err
+}
+
+func (this localTopics) Delete(ctx context.Context, name string) error {
+	return this.topics.Delete(name)
+}
+
+// CreateTopic creates a topic and the streams of its partitions. The
+// streams are created before the topic, so a topic that fails to be
+// created half way is created by calling CreateTopic again. A consumer
+// group reads the partitions of a topic with the prefix "<topic>#".
+//
+// In a cluster the topics are kept in the cluster metadata, so every
+// node knows them and the calls for a topic are handled by any node.
+// Only the calls for the partitions are forwarded to the nodes that
+// lead them.
+func (this *Server) CreateTopic(ctx context.Context, request *api.CreateTopicRequest) (*api.CreateTopicResponse, error) {
+	name := request.Topic
+	if log.IsDebug() {
+		log.With("topic", name).With("partitions", request.Partitions).Debug("handling create topic request")
+	}
+
+	if !validTopic(name) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid topic name %q", name)
+	}
+	if request.Partitions < 1 || request.Partitions > stream.MAX_PARTITIONS {
+		return nil, grpc.Errorf(codes.InvalidArgument, "a topic has 1 to %v partitions", stream.MAX_PARTITIONS)
+	}
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	if _, err := this.topics.Get(name); err == nil {
+		return nil, grpc.Errorf(codes.AlreadyExists, "topic %v already exists", name)
+	}
+
+	response := &api.CreateTopicResponse{}
+	for i := 0; i < int(request.Partitions); i++ {
+		id := stream.PartitionId(name, i)
+
+		if _, err := this.CreateStream(handlerContext(ctx), &api.CreateStreamRequest{
+			Stream: string(id),
+			Config: request.Config,
+		}); err != nil && grpc.Code(err) != codes.AlreadyExists {
+			return nil, err
+		}
+		response.Streams = append(response.Streams, string(id))
+	}
+
+	if err := this.topics.Create(ctx, name, int(request.Partitions)); err != nil {
+		if err == stream.ErrTopicExists {
+			return nil, grpc.Errorf(codes.AlreadyExists, "topic %v already exists", name)
+		}
+		if log.IsInfo() {
+			log.With("topic", name).WithError(err).Info("failed to create topic")
+		}
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (this *Server) DescribeTopic(ctx context.Context, request *api.DescribeTopicRequest) (*api.DescribeTopicResponse, error) {
+	if log.IsDebug() {
+		log.With("topic", request.Topic).Debug("handling describe topic request")
+	}
+
+	if !validTopic(request.Topic) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid topic name %q", request.Topic)
+	}
+
+	topic, err := this.topic(request.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &api.DescribeTopicResponse{
+		Partitions: uint32(topic.Partitions),
+	}
+	for _, id := range topic.Streams() {
+		response.Streams = append(response.Streams, string(id))
+	}
+	return response, nil
+}
+
+// DeleteTopic deletes the topic and the streams of its partitions.
+func (this *Server) DeleteTopic(ctx context.Context, request *api.DeleteTopicRequest) (*api.DeleteTopicResponse, error) {
+	if log.IsDebug() {
+		log.With("topic", request.Topic).Debug("handling delete topic request")
+	}
+
+	if !validTopic(request.Topic) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid topic name %q", request.Topic)
+	}
+
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	topic, err := this.topic(request.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	// the topic is deleted first, so it is not
+	// written to while its partitions are deleted
+	if err := this.topics.Delete(ctx, topic.Name); err != nil {
+		if err == stream.ErrTopicNotFound {
+			return nil, grpc.Errorf(codes.NotFound, "topic %v not found", topic.Name)
+		}
+		return nil, err
+	}
+
+	for _, id := range topic.Streams() {
+		if _, err := this.DeleteStream(handlerContext(ctx), &api.DeleteStreamRequest{
+			Stream: string(id),
+		}); err != nil && grpc.Code(err) != codes.NotFound {
+			return nil, err
+		}
+	}
+
+	return &api.DeleteTopicResponse{}, nil
+}
+
+// WriteTopic writes messages to the partitions of a topic. The messages
+// with the same key are written to the same partition. Every partition
+// is written on its own, a write that fails for a partition leaves the
+// messages that were written to the other partitions.
+func (this *Server) WriteTopic(ctx context.Context, request *api.WriteTopicRequest) (*api.WriteTopicResponse, error) {
+	if log.IsDebug() {
+		log.With("topic", request.Topic).Debug("handling write topic request")
+	}
+
+	if !validTopic(request.Topic) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid topic name %q", request.Topic)
+	}
+
+	if err := this.leaderOnly(); err != nil {
+		return nil, err
+	}
+
+	topic, err := this.topic(request.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := message.NewUnalignedSet(request.Messages)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid message set: %v", err)
+	}
+	if set.MessageCount() == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "message set is empty")
+	}
+
+	sets, err := topic.Split(set)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid message set: %v", err)
+	}
+
+	partitions := make([]int, 0, len(sets))
+	for partition := range sets {
+		partitions = append(partitions, partition)
+	}
+	sort.Ints(partitions)
+
+	response := &api.WriteTopicResponse{}
+	for _, partition := range partitions {
+		id := stream.PartitionId(topic.Name, partition)
+		messages := sets[partition]
+
+		written, err := this.Write(handlerContext(ctx), &api.WriteRequest{
+			Stream:   string(id),
+			Messages: messages.GetBuffer(),
+			Sync:     request.Sync,
+			Acks:     request.Acks,
+		})
+		if err != nil {
+			if log.IsInfo() {
+				log.With("topic", topic.Name).With("partition", partition).WithError(err).Info("failed to write partition")
+			}
+			return nil, err
+		}
+
+		response.Partitions = append(response.Partitions, &api.PartitionWrite{
+			Partition: uint32(partition),
+			Stream:    string(id),
+			Write:     written,
+		})
+	}
+
+	return response, nil
+}
+
+// topic returns the topic, or a grpc NotFound error.
+func (this *Server) topic(name string) (*stream.Topic, error) {
+	topic, err := this.topics.Get(name)
+	if err == stream.ErrTopicNotFound {
+		return nil, grpc.Errorf(codes.NotFound, "topic %v not found", name)
+	}
+	return topic, err
+}
+
+// handlerContext returns the context for a call the server makes to its
+// own handlers. The call is routed like a call of a client, even when
+// the request of the client was forwarded by another node.
+func handlerContext(ctx context.Context) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.MD{})
+}
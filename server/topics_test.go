@@ -0,0 +1,150 @@
+package server
+
+import (
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pjvds/strand/api"
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// keyedSetOf returns the buffer of a set with a message
+// for every key, the body of a message is its key.
+func keyedSetOf(keys ...string) []byte {
+	set := message.NewSet()
+	for _, key := range keys {
+		set.Append([]byte(key), message.WithKey([]byte(key)))
+	}
+	return set.GetBuffer()
+}
+
+func TestCreateTopic(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+
+	created, err := server.admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders", Partitions: 3})
+	assert.Nil(err)
+	assert.Equal([]string{"orders#0", "orders#1", "orders#2"}, created.Streams)
+
+	described, err := server.admin.DescribeTopic(ctx, &api.DescribeTopicRequest{Topic: "orders"})
+	assert.Nil(err)
+	assert.Equal(uint32(3), described.Partitions)
+	assert.Equal(created.Streams, described.Streams)
+
+	// the partitions are streams of their own
+	for _, id := range created.Streams {
+		_, err := server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: id})
+		assert.Nil(err, "stat partition %v", id)
+	}
+
+	_, err = server.admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders", Partitions: 3})
+	assert.Equal(codes.AlreadyExists, grpc.Code(err), "create existing topic")
+}
+
+func TestWriteTopic(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+	server.admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders", Partitions: 4})
+
+	written, err := server.strand.WriteTopic(ctx, &api.WriteTopicRequest{Topic: "orders", Messages: keyedSetOf("a", "b", "a", "c", "a")})
+	assert.Nil(err)
+
+	// every message is in the partition of its key
+	partitions := make(map[string]string)
+	count := 0
+	for _, partition := range written.Partitions {
+		read, err := server.strand.Read(ctx, &api.ReadRequest{Stream: partition.Stream})
+		assert.Nil(err)
+
+		_, keys := bodiesOf(t, read.Messages)
+		assert.Equal(int(partition.Write.MessageCount), len(keys), "messages of partition %v", partition.Stream)
+		for _, key := range keys {
+			if previous, ok := partitions[key]; ok {
+				assert.Equal(previous, partition.Stream, "partition of key %v", key)
+			}
+			partitions[key] = partition.Stream
+		}
+		count += len(keys)
+	}
+	assert.Equal(5, count, "messages written")
+
+	// a later write of a key goes to the same partition
+	again, err := server.strand.WriteTopic(ctx, &api.WriteTopicRequest{Topic: "orders", Messages: keyedSetOf("a")})
+	assert.Nil(err)
+	assert.Len(again.Partitions, 1)
+	assert.Equal(partitions["a"], again.Partitions[0].Stream)
+}
+
+func TestWriteTopicSpreadsMessagesWithoutKey(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+	server.admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders", Partitions: 3})
+
+	written, err := server.strand.WriteTopic(ctx, &api.WriteTopicRequest{Topic: "orders", Messages: setOf("a", "b", "c", "d", "e", "f")})
+	assert.Nil(err)
+	assert.Len(written.Partitions, 3, "partitions written")
+	for _, partition := range written.Partitions {
+		assert.Equal(uint32(2), partition.Write.MessageCount, "messages of partition %v", partition.Stream)
+	}
+}
+
+func TestDeleteTopic(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+	created, _ := server.admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders", Partitions: 2})
+
+	_, err := server.admin.DeleteTopic(ctx, &api.DeleteTopicRequest{Topic: "orders"})
+	assert.Nil(err)
+
+	_, err = server.admin.DescribeTopic(ctx, &api.DescribeTopicRequest{Topic: "orders"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "describe deleted topic")
+
+	for _, id := range created.Streams {
+		_, err := server.admin.StatStream(ctx, &api.StatStreamRequest{Stream: id})
+		assert.Equal(codes.NotFound, grpc.Code(err), "stat partition %v of deleted topic", id)
+	}
+
+	_, err = server.admin.DeleteTopic(ctx, &api.DeleteTopicRequest{Topic: "orders"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "delete deleted topic")
+}
+
+func TestTopicErrors(t *testing.T) {
+	assert := assert.New(t)
+	server := startServer(t)
+	defer server.stop()
+
+	ctx := context.Background()
+
+	_, err := server.admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders"})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "no partitions")
+
+	_, err = server.admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders#1", Partitions: 2})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "name with partition separator")
+
+	_, err = server.admin.DescribeTopic(ctx, &api.DescribeTopicRequest{Topic: "unknown"})
+	assert.Equal(codes.NotFound, grpc.Code(err), "describe unknown topic")
+
+	_, err = server.strand.WriteTopic(ctx, &api.WriteTopicRequest{Topic: "unknown", Messages: setOf("a")})
+	assert.Equal(codes.NotFound, grpc.Code(err), "write unknown topic")
+
+	server.admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders", Partitions: 2})
+
+	_, err = server.strand.WriteTopic(ctx, &api.WriteTopicRequest{Topic: "orders"})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err), "empty message set")
+}
@@ -0,0 +1,351 @@
+package stream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pjvds/strand/message"
+)
+
+// START_FILENAME is the name of the file in the stream directory
+// that holds the start offset the stream is truncated to.
+const START_FILENAME = "start"
+
+// Stats describes the retained messages and the files of a stream.
+type Stats struct {
+	StartOffset message.Offset
+	HeadOffset  message.Offset
+	Bytes       int64
+	Segments    int
+
+	// Created is the time the oldest retained segment was created,
+	// or its last modification for a segment that is opened from disk.
+	Created time.Time
+
+	// Options are the options the stream is opened with.
+	Options Options
+}
+
+// deletable is implemented by streams
+// that can be deleted from disk.
+type deletable interface {
+	delete() error
+}
+
+// closable is implemented by streams
+// that hold files that need closing.
+type closable interface {
+	close() error
+}
+
+func (this *stream) Stat() Stats {
+	this.headLock.RLock()
+	defer this.headLock.RUnlock()
+
+	stats := Stats{
+		StartOffset: this.startOffset(),
+		HeadOffset:  this.offset,
+		Segments:    len(this.segments),
+		Created:     this.segments[0].created,
+		Options:     this.options,
+	}
+	for _, segment := range this.segments {
+		stats.Bytes += segment.position
+	}
+	return stats
+}
+
+// Truncate drops the messages before the given offset. The segments that
+// only hold messages before the offset are deleted, the messages before
+// the offset in the segment that holds it are no longer readable. The
+// start offset is recorded on disk, so it survives a restart.
+func (this *stream) Truncate(offset message.Offset) error {
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+
+	if this.closed {
+		return ErrClosed
+	}
+
+	this.headLock.RLock()
+	head := this.offset
+	start := this.startOffset()
+	this.headLock.RUnlock()
+
+	if offset > head {
+		return ErrOffsetOutOfRange
+	}
+	if offset <= start {
+		return nil
+	}
+
+	if err := writeStartOffset(this.directory, offset); err != nil {
+		return err
+	}
+
+	this.headLock.Lock()
+	this.start = offset
+
+	var truncated []*segment
+	for len(this.segments) > 1 && this.segments[1].baseOffset <= offset {
+		truncated = append(truncated, this.segments[0])
+		this.segments = this.segments[1:]
+	}
+	this.headLock.Unlock()
+
+	// reads in progress finish before their segment is deleted
+	for _, segment := range truncated {
+		if err := segment.retire(segment.delete); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewind drops the messages at and after the given offset. The segments
+// after the offset are deleted and the segment that holds it is cut off
+// right before it. The writes of producers that are dropped are
+// forgotten and the aborted ranges are clipped to the new head. Rewind
+// waits for a compaction and for the reads of the segments it changes.
+func (this *stream) Rewind(offset message.Offset) error {
+	this.compactLock.Lock()
+	defer this.compactLock.Unlock()
+
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+
+	if this.closed {
+		return ErrClosed
+	}
+
+	this.headLock.RLock()
+	head := this.offset
+	start := this.startOffset()
+	this.headLock.RUnlock()
+
+	if offset >= head {
+		return nil
+	}
+	if offset < start {
+		return ErrOffsetOutOfRange
+	}
+
+	if err := this.syncer.rewind(offset, func() error {
+		return this.rewind(offset)
+	}); err != nil {
+		return err
+	}
+
+	this.headLock.Lock()
+	aborted, clipped := clipAborted(this.aborted, offset)
+	this.headLock.Unlock()
+
+	if clipped {
+		if err := writeAborted(this.directory, aborted); err != nil {
+			return err
+		}
+
+		this.headLock.Lock()
+		this.aborted = aborted
+		this.headLock.Unlock()
+	}
+
+	return this.producers.rewind(offset)
+}
+
+// rewind drops the segments after the offset and cuts off the segment
+// that holds it. It must be called with the writeLock held.
+func (this *stream) rewind(offset message.Offset) error {
+	this.headLock.Lock()
+	defer this.headLock.Unlock()
+
+	i := sort.Search(len(this.segments), func(i int) bool {
+		return this.segments[i].baseOffset > offset
+	}) - 1
+
+	// the segments are deleted from the last one on, so the
+	// segments that are left after a crash continue each other
+	for len(this.segments) > i+1 {
+		last := this.segments[len(this.segments)-1]
+		this.segments = this.segments[:len(this.segments)-1]
+		this.offset = last.baseOffset
+
+		last.drain()
+		if err := last.delete(); err != nil {
+			return err
+		}
+	}
+
+	kept := this.segments[i]
+	kept.drain()
+	if err := kept.rewind(offset); err != nil {
+		return err
+	}
+
+	this.offset = offset
+	return nil
+}
+
+// startOffset returns the offset of the oldest message that is retained,
+// the start offset the stream is truncated to or the base offset of the
+// oldest segment. It must be called with the headLock held.
+func (this *stream) startOffset() message.Offset {
+	if baseOffset := this.segments[0].baseOffset; baseOffset > this.start {
+		return baseOffset
+	}
+	return this.start
+}
+
+// delete closes the stream and removes its directory. Writes and
+// reads that are in progress finish first, later ones fail.
+func (this *stream) delete() error {
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+
+	this.headLock.Lock()
+	defer this.headLock.Unlock()
+
+	if !this.closed {
+		this.markClosed()
+		this.closeSegments()
+		this.producers.close()
+	}
+
+	return os.RemoveAll(this.directory)
+}
+
+// readStartOffset reads the start offset the stream in the directory is
+// truncated to. A stream that is never truncated starts at offset 0.
+func readStartOffset(directory string) (message.Offset, error) {
+	filename := filepath.Join(directory, START_FILENAME)
+
+	buffer, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return message.EmptyOffset, nil
+		}
+		return message.EmptyOffset, err
+	}
+
+	if len(buffer) != 8 {
+		return message.EmptyOffset, fmt.Errorf("invalid start offset in %v", filename)
+	}
+	return message.Offset(byteOrder.Uint64(buffer)), nil
+}
+
+// writeStartOffset replaces the start offset file of the stream in
+// the directory. The offset is written to a new file that is synced
+// before it is moved over the old one.
+func writeStartOffset(directory string, offset message.Offset) error {
+	filename := filepath.Join(directory, START_FILENAME)
+
+	file, err := os.OpenFile(filename+COMPACTION_EXTENSION, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 8)
+	byteOrder.PutUint64(buffer, uint64(offset))
+
+	if _, err := file.Write(buffer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(filename+COMPACTION_EXTENSION, filename)
+}
+
+// Delete closes the stream and removes it from the map and from disk. A
+// stream that is not in memory is opened by the creator to delete it.
+func (this *Map) Delete(id Id) error {
+	this.Lock()
+	defer this.Unlock()
+
+	stream, ok := this.streams[id]
+	if !ok {
+		if this.closed {
+			return ErrClosed
+		}
+
+		created, err := this.creator(id)
+		if err != nil {
+			return err
+		}
+		stream = created
+	}
+
+	// the stream is closed, even when it fails
+	// to delete, so it can't stay in the map
+	delete(this.streams, id)
+
+	deletable, ok := stream.(deletable)
+	if !ok {
+		return fmt.Errorf("stream %v can't be deleted", id)
+	}
+	return deletable.delete()
+}
+
+// List returns the ids of the streams in the directory, in order.
+func (this Directory) List() ([]Id, error) {
+	files, err := ioutil.ReadDir(string(this))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+
+		// the files of the server itself, like the lock
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if file.IsDir() {
+			names = append(names, name)
+			continue
+		}
+
+		// a stream from before streams were segmented
+		if strings.HasSuffix(name, SEGMENT_EXTENSION) {
+			names = append(names, strings.TrimSuffix(name, SEGMENT_EXTENSION))
+		}
+	}
+
+	sort.Strings(names)
+
+	streams := make([]Id, len(names))
+	for i, name := range names {
+		streams[i] = Id(name)
+	}
+	return streams, nil
+}
+
+// Exists returns true if the directory holds the stream.
+func (this Directory) Exists(id Id) (bool, error) {
+	path, err := this.path(id)
+	if err != nil {
+		return false, err
+	}
+
+	for _, filename := range []string{path, path + SEGMENT_EXTENSION} {
+		if _, err := os.Stat(filename); err == nil {
+			return true, nil
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
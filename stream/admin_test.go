@@ -0,0 +1,314 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncate(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		SegmentMaxBytes: 64 * 1024,
+	})
+
+	created, _ := creator("truncated")
+	for i := 0; i < 1000; i++ {
+		created.Write(newUnalignedSet(t, 10))
+	}
+
+	segments := created.Stat().Segments
+	offset := created.(*stream).segments[2].baseOffset + 5
+
+	assert.Nil(created.Truncate(offset))
+	assert.Equal(ErrOffsetOutOfRange, created.Truncate(message.Offset(10001)))
+
+	stats := created.Stat()
+	assert.Equal(offset, stats.StartOffset, "start offset")
+	assert.Equal(message.Offset(10000), stats.HeadOffset, "head offset")
+	assert.Equal(segments-2, stats.Segments, "segments")
+
+	_, err := created.Read(offset-1, 0, 1024)
+	assert.Equal(ErrOffsetOutOfRange, err)
+
+	set, err := created.Read(offset, 1, 1024)
+	assert.Nil(err)
+	assert.Equal(offset, set.FirstOffset())
+
+	// truncating to an earlier offset changes nothing
+	assert.Nil(created.Truncate(offset - 10))
+	assert.Equal(offset, created.StartOffset())
+
+	created.(*stream).closeSegments()
+
+	opened, err := creator("truncated")
+	assert.Nil(err)
+	assert.Equal(offset, opened.StartOffset(), "start offset after reopen")
+}
+
+func TestTruncateWaitsForReadsInProgress(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	created, _ := directory.Creator(Options{
+		SegmentMaxBytes: 4 * 1024,
+	})("truncated")
+	for i := 0; i < 500; i++ {
+		created.Write(newUnalignedSet(t, 10))
+	}
+	truncated := created.(*stream)
+
+	oldest, start, end, err := truncated.locate(message.EmptyOffset)
+	assert.Nil(err)
+
+	assert.Nil(created.Truncate(truncated.segments[1].baseOffset))
+
+	set, err := oldest.read(message.EmptyOffset, start, end, 1, 1024)
+	assert.Nil(err, "read segment truncated during read")
+	assert.Equal(message.EmptyOffset, set.FirstOffset())
+
+	oldest.release()
+	_, err = os.Stat(oldest.data.Name())
+	assert.True(os.IsNotExist(err), "segment file deleted after read")
+
+	_, err = created.Read(message.EmptyOffset, 1, 1024)
+	assert.Equal(ErrOffsetOutOfRange, err, "read truncated offset")
+}
+
+func TestRewind(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		SegmentMaxBytes: 16 * 1024,
+	})
+
+	created, _ := creator("rewound")
+	for i := 0; i < 1000; i++ {
+		created.Write(newUnalignedSet(t, 10))
+	}
+
+	segments := created.Stat().Segments
+	offset := created.(*stream).segments[2].baseOffset + 5
+
+	assert.Nil(created.Rewind(offset))
+
+	stats := created.Stat()
+	assert.Equal(offset, stats.HeadOffset, "head offset")
+	assert.Equal(3, stats.Segments, "segments")
+	assert.True(segments > 3, "segments before rewind")
+
+	_, err := created.Read(offset+1, 1, 1024)
+	assert.Equal(ErrOffsetOutOfRange, err)
+
+	set, err := created.Read(offset-1, 0, 1024)
+	assert.Nil(err)
+	assert.Equal(offset-1, set.LastOffset())
+
+	// writes continue at the new head
+	written, err := created.Write(newUnalignedSet(t, 10))
+	assert.Nil(err)
+	assert.Equal(offset, written.FirstOffset())
+
+	// rewinding to the head or after it changes nothing
+	assert.Nil(created.Rewind(offset + 11))
+	assert.Equal(offset+10, created.HeadOffset())
+
+	// rewinding within a segment drops the index entries after the head
+	assert.Nil(created.Rewind(offset + 3))
+	created.(*stream).closeSegments()
+
+	opened, err := creator("rewound")
+	assert.Nil(err)
+	assert.Equal(offset+3, opened.HeadOffset(), "head offset after reopen")
+	assert.Equal(3, opened.Stat().Segments, "segments after reopen")
+
+	found, err := opened.OffsetForTime(time.Now().UnixNano())
+	assert.Nil(err)
+	assert.Equal(offset+3, found, "time index after reopen")
+
+	// the truncated messages can't be rewound
+	assert.Nil(opened.Truncate(offset))
+	assert.Equal(ErrOffsetOutOfRange, opened.Rewind(offset-1))
+}
+
+func TestRewindForgetsDroppedWrites(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("rewound")
+	producer := ProducerId(42)
+
+	s.Write(newUnalignedSet(t, 3), WithSequence(producer, 1))
+	s.Write(newUnalignedSet(t, 3), WithSequence(producer, 2))
+
+	rewound := s.(*stream)
+	rewound.writeLock.Lock()
+	assert.Nil(rewound.markAborted(message.Offset(1), message.Offset(4)))
+	rewound.writeLock.Unlock()
+
+	assert.Nil(s.Rewind(message.Offset(3)))
+	assert.Equal([]offsetRange{{first: 1, last: 2}}, rewound.aborted, "aborted ranges")
+
+	// the dropped write is forgotten, the producer can write any sequence
+	written, err := s.Write(newUnalignedSet(t, 1), WithSequence(producer, 7))
+	assert.Nil(err)
+	assert.Equal(message.Offset(3), written.FirstOffset())
+
+	rewound.closeSegments()
+	reopened, err := directory.OpenOrCreateStream("rewound")
+	assert.Nil(err)
+	assert.Equal([]offsetRange{{first: 1, last: 2}}, reopened.(*stream).aborted, "aborted ranges after reopen")
+
+	set, err := reopened.Read(message.EmptyOffset, 0, 1024)
+	assert.Nil(err)
+	assert.Equal(2, set.MessageCount(), "messages after skipping aborted")
+}
+
+func TestRewindWaitsForReadsInProgress(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("rewound")
+	for i := 0; i < 10; i++ {
+		s.Write(newUnalignedSet(t, 10))
+	}
+	rewound := s.(*stream)
+
+	segment, start, end, err := rewound.locate(message.Offset(50))
+	assert.Nil(err)
+
+	done := make(chan error)
+	go func() {
+		done <- s.Rewind(message.Offset(20))
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("rewind didn't wait for read in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	set, err := segment.read(message.Offset(50), start, end, 1, 1024)
+	assert.Nil(err, "read segment rewound during read")
+	assert.Equal(message.Offset(50), set.FirstOffset())
+
+	segment.release()
+	assert.Nil(<-done)
+	assert.Equal(message.Offset(20), s.HeadOffset())
+}
+
+func TestMapDelete(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	streams := NewMap(directory.OpenOrCreateStream)
+
+	s, _ := streams.Get("deleted")
+	s.Write(newUnalignedSet(t, 3))
+	notified := s.Notify(message.Offset(3))
+
+	assert.Nil(streams.Delete("deleted"))
+
+	_, err := s.Write(newUnalignedSet(t, 1))
+	assert.Equal(ErrClosed, err, "write to deleted stream")
+	_, err = s.Read(message.EmptyOffset, 0, 1024)
+	assert.Equal(ErrClosed, err, "read from deleted stream")
+
+	select {
+	case <-notified:
+	default:
+		t.Fatal("not notified after delete")
+	}
+
+	exists, err := directory.Exists("deleted")
+	assert.Nil(err)
+	assert.False(exists)
+
+	_, err = os.Stat(filepath.Join(string(directory), "deleted"))
+	assert.True(os.IsNotExist(err))
+
+	// getting it again creates a new stream
+	s, _ = streams.Get("deleted")
+	assert.Equal(message.EmptyOffset, s.HeadOffset())
+}
+
+func TestMapOpen(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	streams := NewMap(directory.OpenOrCreateStream)
+	opener := directory.Opener(DefaultOptions)
+
+	_, err := streams.Open("opened", opener)
+	assert.Equal(ErrStreamNotFound, err, "open unknown stream")
+
+	exists, _ := directory.Exists("opened")
+	assert.False(exists, "exists after open")
+
+	created, _ := streams.Get("opened")
+	opened, err := streams.Open("opened", opener)
+	assert.Nil(err)
+	assert.Equal(created, opened)
+
+	assert.Nil(streams.Delete("opened"))
+
+	_, err = streams.Open("opened", opener)
+	assert.Equal(ErrStreamNotFound, err, "open deleted stream")
+}
+
+func TestDirectoryList(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	for _, id := range []Id{"b", "c", "a"} {
+		directory.OpenOrCreateStream(id)
+	}
+	os.Create(filepath.Join(string(directory), ".lock"))
+	os.Create(filepath.Join(string(directory), "legacy"+SEGMENT_EXTENSION))
+
+	streams, err := directory.List()
+	assert.Nil(err)
+	assert.Equal([]Id{"a", "b", "c", "legacy"}, streams)
+}
+
+func TestDirectoryRejectsInvalidIds(t *testing.T) {
+	assert := assert.New(t)
+	parent := tempDirectory(t)
+	defer os.RemoveAll(string(parent))
+
+	directory := Directory(filepath.Join(string(parent), "data"))
+	os.Mkdir(string(directory), 0777)
+	streams := NewMap(directory.OpenOrCreateStream)
+
+	for _, id := range []Id{"", ".", "..", "x/../..", "x/..", "a/b", "../data", `a\b`} {
+		_, err := streams.Get(id)
+		assert.Equal(ErrInvalidId, err, "get %q", id)
+		assert.Equal(ErrInvalidId, streams.Delete(id), "delete %q", id)
+
+		_, err = directory.Exists(id)
+		assert.Equal(ErrInvalidId, err, "exists %q", id)
+		_, err = directory.CreateStream(id, DefaultOptions)
+		assert.Equal(ErrInvalidId, err, "create %q", id)
+	}
+
+	_, err := os.Stat(string(directory))
+	assert.Nil(err, "data directory survives")
+
+	_, err = streams.Get(".offsets")
+	assert.Nil(err, "internal streams are in the directory")
+}
@@ -0,0 +1,221 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pjvds/strand/message"
+)
+
+// COMMITTED_OFFSET_SIZE is the size of the offset at the start of the
+// body of a committed offset message, the metadata follows it.
+const COMMITTED_OFFSET_SIZE = 8
+
+// MAX_GROUP_SIZE is the size of the longest consumer group name.
+const MAX_GROUP_SIZE = 1<<16 - 1
+
+// CommittedOffset is the position a consumer group
+// committed for a stream.
+type CommittedOffset struct {
+	Offset   message.Offset
+	Metadata string
+
+	// Timestamp is the time the offset was
+	// committed, in unix nanoseconds
+	Timestamp int64
+}
+
+type groupStream struct {
+	group  string
+	stream Id
+}
+
+// OffsetStore keeps the offsets committed by consumer groups in a
+// compacted stream. Every commit is a message keyed by the group and the
+// stream, so compaction only retains the latest commit of every pair.
+// The latest commits are kept in memory.
+type OffsetStore struct {
+	stream Stream
+
+	lock      sync.RWMutex
+	committed map[groupStream]CommittedOffset
+
+	// next is the offset of the first message in the
+	// stream that is not in memory yet, guarded by the lock
+	next message.Offset
+}
+
+// OpenOffsetStore reads the latest commits from the stream.
+func OpenOffsetStore(stream Stream) (*OffsetStore, error) {
+	store := &OffsetStore{
+		stream:    stream,
+		committed: make(map[groupStream]CommittedOffset),
+		next:      stream.StartOffset(),
+	}
+
+	if err := store.catchUp(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Refresh reads the commits that are appended to the stream other than
+// by the store itself, like the commits a follower replicates.
+func (this *OffsetStore) Refresh() error {
+	this.lock.RLock()
+	current := this.next == this.stream.HeadOffset()
+	this.lock.RUnlock()
+
+	if current {
+		return nil
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.catchUp()
+}
+
+// catchUp reads the commits from the next offset up to the head of the
+// stream into memory. A stream that is rewound before the next offset
+// is read again from the start. It must be called with the lock held.
+func (this *OffsetStore) catchUp() error {
+	if this.next > this.stream.HeadOffset() {
+		this.committed = make(map[groupStream]CommittedOffset)
+		this.next = message.EmptyOffset
+	}
+	if start := this.stream.StartOffset(); this.next < start {
+		this.next = start
+	}
+
+	for {
+		set, err := this.stream.Read(this.next, 0, COMPACTION_READ_BYTES)
+		if err != nil {
+			return err
+		}
+		if set.MessageCount() == 0 {
+			return nil
+		}
+		next := set.LastOffset().Next()
+
+		if set, err = set.Decompress(); err != nil {
+			return err
+		}
+
+		messages := set.Messages()
+		for frame, ok := messages.Next(); ok; frame, ok = messages.Next() {
+			key, ok := decodeCommitKey(frame.Key())
+			if !ok {
+				return fmt.Errorf("invalid committed offset key at offset %v", frame.Offset())
+			}
+
+			if frame.Tombstone() {
+				delete(this.committed, key)
+				continue
+			}
+
+			body := frame.Body()
+			if len(body) < COMMITTED_OFFSET_SIZE {
+				return fmt.Errorf("invalid committed offset at offset %v", frame.Offset())
+			}
+
+			this.committed[key] = CommittedOffset{
+				Offset:    message.Offset(byteOrder.Uint64(body)),
+				Metadata:  string(body[COMMITTED_OFFSET_SIZE:]),
+				Timestamp: frame.Timestamp(),
+			}
+		}
+
+		this.next = next
+	}
+}
+
+// Commit records the offset for the group and stream. It replaces the
+// offset committed before, even if the new offset is lower so a group
+// can rewind.
+func (this *OffsetStore) Commit(group string, stream Id, offset message.Offset, metadata string) (CommittedOffset, error) {
+	if len(group) > MAX_GROUP_SIZE {
+		return CommittedOffset{}, fmt.Errorf("group name of %v bytes is longer than %v bytes", len(group), MAX_GROUP_SIZE)
+	}
+	key := groupStream{group, stream}
+
+	body := make([]byte, COMMITTED_OFFSET_SIZE+len(metadata))
+	byteOrder.PutUint64(body, uint64(offset))
+	copy(body[COMMITTED_OFFSET_SIZE:], metadata)
+
+	set := message.NewSet()
+	if err := set.Append(body, message.WithKey(encodeCommitKey(key))); err != nil {
+		return CommittedOffset{}, err
+	}
+
+	unaligned, err := message.NewUnalignedSet(set.GetBuffer())
+	if err != nil {
+		return CommittedOffset{}, err
+	}
+
+	// the lock keeps the order of the commits in
+	// memory the same as the order in the stream
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	// a follower that takes over the stream reads the
+	// replicated commits before it commits on its own
+	if err := this.catchUp(); err != nil {
+		return CommittedOffset{}, err
+	}
+
+	written, err := this.stream.Write(unaligned)
+	if err != nil {
+		return CommittedOffset{}, err
+	}
+
+	committed := CommittedOffset{
+		Offset:    offset,
+		Metadata:  metadata,
+		Timestamp: written.Message(0).Timestamp(),
+	}
+	this.committed[key] = committed
+
+	// the commits before it are read on the next refresh
+	if written.FirstOffset() == this.next {
+		this.next = written.LastOffset().Next()
+	}
+	return committed, nil
+}
+
+// Fetch returns the offset the group committed for the stream,
+// or false if the group didn't commit an offset for it.
+func (this *OffsetStore) Fetch(group string, stream Id) (CommittedOffset, bool) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	committed, ok := this.committed[groupStream{group, stream}]
+	return committed, ok
+}
+
+// encodeCommitKey encodes the group and the stream in the key of
+// a commit message. The group is prefixed by its size, so neither
+// the group or the stream name need a separator that they can't hold.
+func encodeCommitKey(key groupStream) []byte {
+	encoded := make([]byte, 2+len(key.group)+len(key.stream))
+	byteOrder.PutUint16(encoded, uint16(len(key.group)))
+	copy(encoded[2:], key.group)
+	copy(encoded[2+len(key.group):], key.stream)
+	return encoded
+}
+
+func decodeCommitKey(encoded []byte) (groupStream, bool) {
+	if len(encoded) < 2 {
+		return groupStream{}, false
+	}
+
+	size := int(byteOrder.Uint16(encoded))
+	if 2+size > len(encoded) {
+		return groupStream{}, false
+	}
+
+	return groupStream{
+		group:  string(encoded[2 : 2+size]),
+		stream: Id(encoded[2+size:]),
+	}, true
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetStore(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream(".offsets")
+	store, err := OpenOffsetStore(s)
+	assert.Nil(err)
+
+	_, ok := store.Fetch("group", "orders")
+	assert.False(ok)
+
+	store.Commit("group", "orders", message.Offset(10), "first")
+	store.Commit("group", "invoices", message.Offset(3), "")
+	committed, err := store.Commit("group", "orders", message.Offset(20), "second")
+	assert.Nil(err)
+
+	fetched, ok := store.Fetch("group", "orders")
+	assert.True(ok)
+	assert.Equal(committed, fetched)
+
+	// the commits are read back from the stream
+	reopened, err := OpenOffsetStore(s)
+	assert.Nil(err)
+
+	fetched, ok = reopened.Fetch("group", "orders")
+	assert.True(ok)
+	assert.Equal(message.Offset(20), fetched.Offset)
+	assert.Equal("second", fetched.Metadata)
+	assert.Equal(committed.Timestamp, fetched.Timestamp)
+
+	fetched, ok = reopened.Fetch("group", "invoices")
+	assert.True(ok)
+	assert.Equal(message.Offset(3), fetched.Offset)
+
+	_, ok = reopened.Fetch("other", "orders")
+	assert.False(ok)
+}
+
+func TestOffsetStoreRefresh(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	leader, _ := directory.OpenOrCreateStream(".offsets")
+	follower, _ := directory.OpenOrCreateStream("follower")
+
+	store, _ := OpenOffsetStore(leader)
+	replica, err := OpenOffsetStore(follower)
+	assert.Nil(err)
+
+	store.Commit("group", "orders", message.Offset(10), "replicated")
+	set, _ := leader.Read(message.EmptyOffset, 0, 1024)
+	assert.Nil(follower.Replicate(set))
+
+	_, ok := replica.Fetch("group", "orders")
+	assert.False(ok, "commit before refresh")
+
+	assert.Nil(replica.Refresh())
+	fetched, ok := replica.Fetch("group", "orders")
+	assert.True(ok, "commit after refresh")
+	assert.Equal(message.Offset(10), fetched.Offset)
+	assert.Equal("replicated", fetched.Metadata)
+}
+
+func TestOffsetStoreRefreshAfterRewind(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream(".offsets")
+	store, _ := OpenOffsetStore(s)
+
+	store.Commit("group", "orders", message.Offset(10), "kept")
+	store.Commit("group", "orders", message.Offset(20), "dropped")
+
+	assert.Nil(s.Rewind(message.Offset(1)))
+	assert.Nil(store.Refresh())
+
+	fetched, ok := store.Fetch("group", "orders")
+	assert.True(ok, "commit before rewind")
+	assert.Equal(message.Offset(10), fetched.Offset)
+	assert.Equal("kept", fetched.Metadata)
+}
+
+func TestCommitReadsReplicatedCommitsFirst(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	leader, _ := directory.OpenOrCreateStream(".offsets")
+	follower, _ := directory.OpenOrCreateStream("follower")
+
+	store, _ := OpenOffsetStore(leader)
+	replica, _ := OpenOffsetStore(follower)
+
+	store.Commit("group", "orders", message.Offset(10), "replicated")
+	set, _ := leader.Read(message.EmptyOffset, 0, 1024)
+	assert.Nil(follower.Replicate(set))
+
+	// the follower takes over and commits without a refresh
+	_, err := replica.Commit("group", "payments", message.Offset(20), "")
+	assert.Nil(err)
+
+	fetched, ok := replica.Fetch("group", "orders")
+	assert.True(ok, "replicated commit")
+	assert.Equal(message.Offset(10), fetched.Offset)
+	assert.Nil(replica.Refresh())
+}
@@ -0,0 +1,392 @@
+package stream
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pjvds/strand/message"
+)
+
+const (
+	// COMPACTION_EXTENSION is added to the file names of
+	// a segment while it is rewritten by compaction.
+	COMPACTION_EXTENSION = ".compacting"
+
+	// COMPACTION_READ_BYTES is the number of bytes read at once
+	// while looking up the latest message of every key.
+	COMPACTION_READ_BYTES = 1024 * 1024
+)
+
+// compactable is implemented by streams
+// that can be compacted.
+type compactable interface {
+	compact(now time.Time) (int, error)
+}
+
+// compact rewrites the segments that are no longer active to retain
+// only the latest message of every key, and removes the tombstones
+// that are older than the tombstone retention. The messages keep their
+// offsets, so a compacted stream has gaps. It returns the number of
+// messages it removed.
+func (this *stream) compact(now time.Time) (int, error) {
+	if !this.options.Compact {
+		return 0, nil
+	}
+
+	this.compactLock.Lock()
+	defer this.compactLock.Unlock()
+
+	// the segments are acquired, so retention and truncation
+	// don't delete them while they are compacted
+	this.headLock.RLock()
+	segments := append([]*segment(nil), this.segments...)
+	for _, segment := range segments {
+		segment.acquire()
+	}
+	start := this.startOffset()
+	head := this.offset
+	this.headLock.RUnlock()
+
+	defer func() {
+		for _, segment := range segments {
+			segment.release()
+		}
+	}()
+
+	if len(segments) < 2 {
+		return 0, nil
+	}
+
+	latest, err := this.latestOffsets(start, head)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := now.Add(-this.options.TombstoneRetention).UnixNano()
+	retained := func(frame message.Message) bool {
+		key := frame.Key()
+		if key == nil {
+			return true
+		}
+		if latest[string(key)] != frame.Offset() {
+			return false
+		}
+		return !frame.Tombstone() || frame.Timestamp() > deadline
+	}
+
+	removed := 0
+	for _, segment := range segments[:len(segments)-1] {
+		count, err := this.compactSegment(segment, retained)
+		if err != nil {
+			return removed, this.identify(err)
+		}
+		removed += count
+	}
+
+	return removed, nil
+}
+
+// latestOffsets returns the offset of the latest message of
+// every key in the stream, from the start up to the head.
+func (this *stream) latestOffsets(start message.Offset, head message.Offset) (map[string]message.Offset, error) {
+	latest := make(map[string]message.Offset)
+
+	for offset := start; offset < head; {
+		set, err := this.Read(offset, 0, COMPACTION_READ_BYTES)
+		if err != nil {
+			return nil, err
+		}
+		if set.MessageCount() == 0 {
+			break
+		}
+
+		messages := set.Messages()
+		for frame, ok := messages.Next(); ok; frame, ok = messages.Next() {
+			if key := frame.Key(); key != nil {
+				latest[string(key)] = frame.Offset()
+			}
+		}
+
+		offset = set.LastOffset().Next()
+	}
+
+	return latest, nil
+}
+
+// compactSegment replaces the segment by a copy that only holds the
+// retained messages. The segment is left untouched if all its messages
+// are retained. It returns the number of messages it removed.
+func (this *stream) compactSegment(old *segment, retained func(message.Message) bool) (int, error) {
+	removed := 0
+	if err := old.frames(func(frame message.Message) error {
+		if !retained(frame) {
+			removed++
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	compacted, err := old.rewrite(retained)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := this.replaceSegment(old, compacted); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// replaceSegment moves the files of the compacted segment over the files
+// of the old segment and opens it in its place. The indexes of the old
+// segment are removed first, a crash halfway leaves a segment of which
+// the indexes are rebuilt when it is opened.
+func (this *stream) replaceSegment(old *segment, compacted *segment) error {
+	this.headLock.Lock()
+	defer this.headLock.Unlock()
+
+	i := 0
+	for i < len(this.segments) && this.segments[i] != old {
+		i++
+	}
+
+	// the segment is deleted by retention in the meantime
+	if i == len(this.segments) {
+		return compacted.delete()
+	}
+
+	if err := compacted.close(); err != nil {
+		return err
+	}
+
+	for _, file := range []*os.File{old.indexFile, old.timeIndexFile} {
+		if err := os.Remove(file.Name()); err != nil {
+			return err
+		}
+	}
+
+	renames := []struct{ from, to string }{
+		{compacted.data.Name(), old.data.Name()},
+		{compacted.indexFile.Name(), old.indexFile.Name()},
+		{compacted.timeIndexFile.Name(), old.timeIndexFile.Name()},
+	}
+	for _, rename := range renames {
+		if err := os.Rename(rename.from, rename.to); err != nil {
+			return err
+		}
+	}
+
+	opened, err := openSegment(filepath.Dir(old.data.Name()), old.baseOffset)
+	if err != nil {
+		return err
+	}
+
+	// the removed messages don't change the age and the
+	// offsets the segment covers
+	opened.created = old.created
+	opened.modified = old.modified
+	opened.nextOffset = old.nextOffset
+	opened.timestamp = old.timestamp
+
+	// reads in progress finish on the files of the
+	// old segment, they stay readable after the rename
+	this.segments[i] = opened
+	return old.retire(old.close)
+}
+
+// frames calls frame for every message in the segment. The
+// message is only valid until frame returns.
+func (this *segment) frames(frame func(message.Message) error) error {
+	end := this.position
+	reader := bufio.NewReader(io.NewSectionReader(this.data, 0, end))
+	buffer := make([]byte, 0, INDEX_INTERVAL)
+
+	for position := int64(0); position < end; {
+		header, err := reader.Peek(message.MIN_HEADER_SIZE)
+		if err != nil {
+			return err
+		}
+
+		size, _ := message.ReadHeader(header)
+		if size < message.MIN_HEADER_SIZE {
+			return fmt.Errorf("invalid message size %v in %v at position %v", size, this.data.Name(), position)
+		}
+
+		if cap(buffer) < size {
+			buffer = make([]byte, size)
+		}
+		buffer = buffer[:size]
+
+		if _, err := io.ReadFull(reader, buffer); err != nil {
+			return err
+		}
+
+		if err := message.Verify(buffer, 0); err != nil {
+			return this.corruption(err, position)
+		}
+
+		if err := frame(message.Message(buffer)); err != nil {
+			return err
+		}
+		position += int64(size)
+	}
+
+	return nil
+}
+
+// rewrite writes the retained messages of the segment to a new segment
+// with the same base offset. The files of the new segment are named
+// with the compaction extension and are synced to disk.
+func (this *segment) rewrite(retained func(message.Message) bool) (*segment, error) {
+	compacted, err := createCompactedSegment(filepath.Dir(this.data.Name()), this.baseOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(compacted.data)
+	err = this.frames(func(frame message.Message) error {
+		if !retained(frame) {
+			return nil
+		}
+
+		if _, err := writer.Write(frame); err != nil {
+			return err
+		}
+
+		var added bool
+		if compacted.index, added = compacted.index.add(frame.Offset(), compacted.position); added {
+			compacted.times = append(compacted.times, timeEntry{
+				timestamp: frame.Timestamp(),
+				offset:    frame.Offset(),
+			})
+		}
+
+		compacted.position += int64(len(frame))
+		return nil
+	})
+
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = writeIndex(compacted.indexFile, compacted.index, compacted.timeIndexFile, compacted.times)
+	}
+	for _, file := range []*os.File{compacted.data, compacted.indexFile, compacted.timeIndexFile} {
+		if err == nil {
+			err = file.Sync()
+		}
+	}
+
+	if err != nil {
+		compacted.delete()
+		return nil, err
+	}
+	return compacted, nil
+}
+
+// createCompactedSegment creates the files for a compacted segment,
+// truncating the files left behind by a compaction that didn't finish.
+func createCompactedSegment(directory string, baseOffset message.Offset) (*segment, error) {
+	extensions := []string{SEGMENT_EXTENSION, INDEX_EXTENSION, TIME_INDEX_EXTENSION}
+	files := make([]*os.File, 0, len(extensions))
+
+	for _, extension := range extensions {
+		file, err := os.OpenFile(segmentFilename(directory, baseOffset, extension)+COMPACTION_EXTENSION, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			for _, file := range files {
+				file.Close()
+			}
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return &segment{
+		baseOffset:    baseOffset,
+		data:          files[0],
+		indexFile:     files[1],
+		timeIndexFile: files[2],
+	}, nil
+}
+
+// Compactor compacts the streams in a directory at a regular
+// interval. Streams that aren't opened yet are opened into the map.
+type Compactor struct {
+	streams   *Map
+	directory Directory
+	options   Options
+	interval  time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartCompactor starts a compactor for the streams in the directory, the
+// streams that aren't in the map are opened with the given options.
+func StartCompactor(streams *Map, directory Directory, options Options, interval time.Duration) *Compactor {
+	compactor := &Compactor{
+		streams:   streams,
+		directory: directory,
+		options:   options,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go compactor.run()
+	return compactor
+}
+
+func (this *Compactor) run() {
+	defer close(this.done)
+
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			this.sweep(now)
+		case <-this.stop:
+			return
+		}
+	}
+}
+
+func (this *Compactor) sweep(now time.Time) {
+	opener := this.directory.Opener(this.options)
+	err := this.streams.EachIn(this.directory, opener, func(id Id, stream Stream) {
+		compactable, ok := stream.(compactable)
+		if !ok {
+			return
+		}
+
+		removed, err := compactable.compact(now)
+		if err != nil {
+			log.With("stream_id", id).WithError(err).Error("failed to compact stream")
+			return
+		}
+
+		if removed > 0 && log.IsDebug() {
+			log.With("stream_id", id).With("messages", removed).Debug("compacted stream")
+		}
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to compact streams")
+	}
+}
+
+// Stop stops the compactor and waits for a running sweep to finish.
+func (this *Compactor) Stop() {
+	close(this.stop)
+	<-this.done
+}
@@ -0,0 +1,212 @@
+package stream
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactRetainsLatestMessageOfEveryKey(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		SegmentMaxBytes:    4 * 1024,
+		Compact:            true,
+		TombstoneRetention: time.Hour,
+	})
+
+	s, _ := creator("compact")
+	for i := 0; i < 100; i++ {
+		s.Write(newKeyedSet(t, fmt.Sprintf("key-%v", i%10), fmt.Sprintf("value-%v", i)))
+	}
+	s.Write(newKeyedSet(t, "", "without key"))
+	deleted, _ := s.Write(newTombstoneSet(t, "key-3"))
+
+	// roll a new active segment
+	compacted := s.(*stream)
+	compacted.segments[len(compacted.segments)-1].created = time.Now().Add(-time.Hour)
+	compacted.options.SegmentMaxAge = time.Minute
+	s.Write(newKeyedSet(t, "key-0", "head"))
+
+	head := s.HeadOffset()
+	removed, err := compacted.compact(time.Now())
+	assert.Nil(err)
+	assert.True(removed > 0, "removed messages")
+
+	values := readValues(t, s)
+	assert.Equal(head, s.HeadOffset(), "head offset")
+	assert.Equal("head", values["key-0"])
+	assert.Equal("value-99", values["key-9"])
+	assert.Equal("without key", values[""])
+	assert.Equal("", values["key-3"], "tombstone")
+
+	set, err := s.Read(message.Offset(5), 1, 1024)
+	assert.Nil(err)
+	assert.True(set.FirstOffset() > message.Offset(5), "read at removed offset starts at next message")
+
+	// the tombstone is removed after the retention
+	_, err = compacted.compact(time.Now().Add(2 * time.Hour))
+	assert.Nil(err)
+	set, _ = s.Read(deleted.FirstOffset(), 1, 1024)
+	assert.NotEqual(deleted.FirstOffset(), set.FirstOffset(), "tombstone removed")
+
+	values = readValues(t, s)
+	_, ok := values["key-3"]
+	assert.False(ok, "key deleted")
+
+	compacted.closeSegments()
+	reopened, err := creator("compact")
+	assert.Nil(err)
+	assert.Equal(head, reopened.HeadOffset(), "head offset after reopen")
+	assert.Equal(values, readValues(t, reopened), "values after reopen")
+}
+
+func TestReadDuringCompaction(t *testing.T) {
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.Creator(Options{
+		SegmentMaxBytes:    1024,
+		Compact:            true,
+		TombstoneRetention: time.Hour,
+	})("compact")
+	compacted := s.(*stream)
+
+	done := make(chan struct{})
+	failed := make(chan error, 1)
+	go func() {
+		defer close(failed)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			previous := message.EmptyOffset
+			for offset := message.EmptyOffset; ; {
+				set, err := s.Read(offset, 0, 1024)
+				if err != nil {
+					failed <- err
+					return
+				}
+				if set.MessageCount() == 0 {
+					break
+				}
+				if set.FirstOffset() < previous {
+					failed <- fmt.Errorf("read offset %v after %v", set.FirstOffset(), previous)
+					return
+				}
+				previous = set.LastOffset()
+				offset = set.LastOffset().Next()
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		s.Write(newKeyedSet(t, fmt.Sprintf("key-%v", i%10), fmt.Sprintf("value-%v", i)))
+		if i%10 == 0 {
+			if _, err := compacted.compact(time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	close(done)
+
+	if err := <-failed; err != nil {
+		t.Fatalf("read during compaction: %v", err)
+	}
+}
+
+// readValues reads the stream and returns the body of the
+// last message of every key, or of the messages without a key
+// under the empty key. Tombstones have an empty value.
+func readValues(t *testing.T, s Stream) map[string]string {
+	values := make(map[string]string)
+
+	for offset := s.StartOffset(); offset < s.HeadOffset(); {
+		set, err := s.Read(offset, 0, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		messages := set.Messages()
+		for frame, ok := messages.Next(); ok; frame, ok = messages.Next() {
+			if frame.Tombstone() {
+				values[string(frame.Key())] = ""
+				continue
+			}
+			values[string(frame.Key())] = string(frame.Body())
+		}
+		offset = set.LastOffset().Next()
+	}
+
+	return values
+}
+
+func newKeyedSet(t *testing.T, key string, value string) message.UnalignedSet {
+	buffer := message.NewSet()
+	if key == "" {
+		buffer.Append([]byte(value))
+	} else {
+		buffer.Append([]byte(value), message.WithKey([]byte(key)))
+	}
+
+	set, err := message.NewUnalignedSet(buffer.GetBuffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func newTombstoneSet(t *testing.T, key string) message.UnalignedSet {
+	buffer := message.NewSet()
+	buffer.Append(nil, message.WithKey([]byte(key)), message.AsTombstone())
+
+	set, err := message.NewUnalignedSet(buffer.GetBuffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestCompactorSweepsStreamsInDirectory(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, err := directory.CreateStream("compact", Options{
+		SegmentMaxBytes:    1024,
+		Compact:            true,
+		TombstoneRetention: time.Hour,
+	})
+	assert.Nil(err)
+	for i := 0; i < 100; i++ {
+		s.Write(newKeyedSet(t, fmt.Sprintf("key-%v", i%10), fmt.Sprintf("value-%v", i)))
+	}
+	values := readValues(t, s)
+	s.(*stream).close()
+
+	// the stream is not opened in the map
+	streams := NewMap(directory.Creator(DefaultOptions))
+	defer streams.Close()
+	compactor := &Compactor{
+		streams:   streams,
+		directory: directory,
+		options:   DefaultOptions,
+	}
+	compactor.sweep(time.Now())
+
+	swept, err := streams.Get("compact")
+	assert.Nil(err)
+	set, err := swept.Read(message.Offset(5), 1, 1024)
+	assert.Nil(err)
+	assert.True(set.FirstOffset() > message.Offset(5), "compacted stream")
+	assert.Equal(values, readValues(t, swept), "values after compaction")
+}
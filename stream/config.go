@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pjvds/strand/message"
+)
+
+// CONFIG_FILENAME is the name of the file in the stream directory that
+// holds the options of a stream that is created explicitly.
+const CONFIG_FILENAME = "config"
+
+var (
+	ErrStreamNotFound = errors.New("stream not found")
+	ErrStreamExists   = errors.New("stream already exists")
+	ErrInvalidId      = errors.New("invalid stream id")
+)
+
+// MessageTooLargeError is returned for a write with a message
+// that is larger than the stream allows.
+type MessageTooLargeError struct {
+	Stream  Id
+	Size    int
+	MaxSize int
+}
+
+func (this MessageTooLargeError) Error() string {
+	return fmt.Sprintf("message of %v bytes is larger than the %v bytes stream %v allows",
+		this.Size, this.MaxSize, this.Stream)
+}
+
+// checkSize returns a MessageTooLargeError if a message in the set is
+// larger than the stream allows. A compressed message counts as a whole.
+func (this *stream) checkSize(messages message.UnalignedSet) error {
+	maxSize := this.options.MaxMessageBytes
+	if maxSize <= 0 {
+		return nil
+	}
+
+	frames := messages.Messages()
+	for frame, ok := frames.Next(); ok; frame, ok = frames.Next() {
+		if frame.Size() > maxSize {
+			return MessageTooLargeError{
+				Stream:  this.id,
+				Size:    frame.Size(),
+				MaxSize: maxSize,
+			}
+		}
+	}
+	return nil
+}
+
+// Opener returns a creator that opens the streams in the directory with
+// the given options, but fails with ErrStreamNotFound for a stream that
+// doesn't exist instead of creating it.
+func (this Directory) Opener(options Options) Creator {
+	return func(id Id) (Stream, error) {
+		exists, err := this.Exists(id)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrStreamNotFound
+		}
+		return this.openOrCreateStream(id, options)
+	}
+}
+
+// CreateStream creates a new stream in the directory. The options are
+// stored with the stream, they are used every time it is opened instead
+// of the options of the creator.
+func (this Directory) CreateStream(id Id, options Options) (Stream, error) {
+	exists, err := this.Exists(id)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrStreamExists
+	}
+
+	path, err := this.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := NewStream(path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// a crash before the options are written leaves
+	// a stream that is opened with the options of
+	// the creator
+	if err := writeConfig(path, options); err != nil {
+		if deletable, ok := created.(deletable); ok {
+			deletable.delete()
+		}
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// readConfig reads the options stored with the stream in the directory.
+// It returns false if the stream is not created explicitly.
+func readConfig(directory string) (Options, bool, error) {
+	filename := filepath.Join(directory, CONFIG_FILENAME)
+
+	buffer, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Options{}, false, nil
+		}
+		return Options{}, false, err
+	}
+
+	var options Options
+	if err := json.Unmarshal(buffer, &options); err != nil {
+		return Options{}, false, fmt.Errorf("invalid stream config in %v: %v", filename, err)
+	}
+	return options, true, nil
+}
+
+// writeConfig stores the options with the stream in the directory. They
+// are written to a new file that is synced before it is moved in place.
+func writeConfig(directory string, options Options) error {
+	filename := filepath.Join(directory, CONFIG_FILENAME)
+
+	buffer, err := json.MarshalIndent(options, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename+COMPACTION_EXTENSION, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(buffer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(filename+COMPACTION_EXTENSION, filename)
+}
+
+// Create creates a stream with the given creator and adds it to the
+// map. It fails with ErrStreamExists if the map already holds it.
+func (this *Map) Create(id Id, create Creator) (Stream, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.closed {
+		return nil, ErrClosed
+	}
+	if _, ok := this.streams[id]; ok {
+		return nil, ErrStreamExists
+	}
+
+	created, err := create(id)
+	if err != nil {
+		return nil, err
+	}
+
+	this.streams[id] = created
+	return created, nil
+}
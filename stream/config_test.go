@@ -0,0 +1,80 @@
+package stream
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateStreamStoresOptions(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	options := DefaultOptions
+	options.RetentionMaxAge = time.Hour
+	options.MaxMessageBytes = 1024
+	options.Compact = true
+	options.Durability = SyncAlways
+
+	created, err := directory.CreateStream("configured", options)
+	assert.Nil(err)
+	created.(*stream).closeSegments()
+
+	_, err = directory.CreateStream("configured", options)
+	assert.Equal(ErrStreamExists, err)
+
+	opened, err := directory.OpenOrCreateStream("configured")
+	assert.Nil(err)
+	assert.Equal(options, opened.(*stream).options)
+}
+
+func TestOpenerDoesNotCreate(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	streams := NewMap(directory.Opener(DefaultOptions))
+
+	_, err := streams.Get("missing")
+	assert.Equal(ErrStreamNotFound, err)
+
+	exists, _ := directory.Exists("missing")
+	assert.False(exists)
+
+	created, err := streams.Create("missing", func(id Id) (Stream, error) {
+		return directory.CreateStream(id, DefaultOptions)
+	})
+	assert.Nil(err)
+
+	got, err := streams.Get("missing")
+	assert.Nil(err)
+	assert.Equal(created, got)
+}
+
+func TestWriteMessageTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	options := DefaultOptions
+	options.MaxMessageBytes = message.HEADER_SIZE + 10
+
+	s, _ := directory.CreateStream("limited", options)
+
+	set := message.NewSet()
+	set.Append([]byte("0123456789"))
+	set.Append([]byte("0123456789a"))
+	unaligned, _ := message.NewUnalignedSet(set.GetBuffer())
+
+	_, err := s.Write(unaligned)
+	assert.Equal(MessageTooLargeError{
+		Stream:  "limited",
+		Size:    message.HEADER_SIZE + 11,
+		MaxSize: message.HEADER_SIZE + 10,
+	}, err)
+	assert.Equal(message.EmptyOffset, s.HeadOffset())
+}
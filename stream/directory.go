@@ -0,0 +1,198 @@
+package stream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pjvds/strand/message"
+)
+
+type Options struct {
+	// SegmentMaxBytes is the size at which the active
+	// segment is rolled over to a new segment.
+	SegmentMaxBytes int64
+
+	// SegmentMaxAge is the age at which the active
+	// segment is rolled over to a new segment.
+	SegmentMaxAge time.Duration
+
+	// RetentionMaxAge is the age after which a segment is deleted,
+	// counted from the last message written to it.
+	RetentionMaxAge time.Duration
+
+	// RetentionMaxBytes is the size the segments of a stream are
+	// allowed to take before the oldest segment is deleted.
+	RetentionMaxBytes int64
+
+	// RetentionMaxMessages is the number of messages that a stream
+	// retains before the oldest segment is deleted.
+	RetentionMaxMessages uint64
+
+	// MaxMessageBytes is the size of the largest message that
+	// can be written to the stream, 0 allows any size.
+	MaxMessageBytes int
+
+	// Compact retains only the latest message of every key in the
+	// segments that are no longer active. Messages without a key and
+	// compressed messages are always retained.
+	Compact bool
+
+	// TombstoneRetention is the time a tombstone is retained by
+	// compaction, counted from the moment it was appended. It gives
+	// consumers the chance to see the delete before it is removed.
+	TombstoneRetention time.Duration
+
+	// ProducerExpiry is the time after its last write that the
+	// sequence of an idempotent producer is forgotten.
+	ProducerExpiry time.Duration
+
+	// Durability determines when writes are synced to disk.
+	Durability Durability
+
+	// SyncInterval is the time a group of writes
+	// is gathered before it is synced to disk.
+	SyncInterval time.Duration
+
+	// SyncBytes is the number of bytes after which a
+	// group of writes is synced to disk right away.
+	SyncBytes int64
+}
+
+// DefaultOptions rolls segments at 512MB or after a week,
+// retains all messages forever and leaves syncing to the
+// operating system. Compacted streams retain tombstones
+// for a day and producers are forgotten after a week.
+var DefaultOptions = Options{
+	SegmentMaxBytes:    512 * 1024 * 1024,
+	SegmentMaxAge:      7 * 24 * time.Hour,
+	TombstoneRetention: 24 * time.Hour,
+	ProducerExpiry:     7 * 24 * time.Hour,
+	Durability:         SyncNone,
+	SyncInterval:       10 * time.Millisecond,
+	SyncBytes:          1024 * 1024,
+}
+
+// MIGRATION_EXTENSION is the extension of the hidden directory that
+// a stream file is migrated to before it is moved in place.
+const MIGRATION_EXTENSION = ".migrating"
+
+// Directory holds a sub directory with
+// the segments of every stream.
+type Directory string
+
+func (this Directory) OpenOrCreateStream(id Id) (Stream, error) {
+	return this.openOrCreateStream(id, DefaultOptions)
+}
+
+// Creator returns a creator that opens or creates
+// the streams in the directory with the given options.
+func (this Directory) Creator(options Options) Creator {
+	return func(id Id) (Stream, error) {
+		return this.openOrCreateStream(id, options)
+	}
+}
+
+// path returns the path of the stream in the directory. It fails with
+// ErrInvalidId for an id that is not the name of an entry directly in
+// the directory, like an empty id or one that holds a separator or
+// "..", so a stream never resolves to the directory or outside of it.
+func (this Directory) path(id Id) (string, error) {
+	path := filepath.Join(string(this), string(id))
+
+	relative, err := filepath.Rel(string(this), path)
+	if err != nil || relative != string(id) || relative == "." || relative == ".." ||
+		strings.ContainsAny(relative, "/\\") {
+		return "", ErrInvalidId
+	}
+	return path, nil
+}
+
+func (this Directory) openOrCreateStream(id Id, options Options) (Stream, error) {
+	path, err := this.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		migrated, err := migrateSingleFileStream(path)
+		if err != nil {
+			return nil, err
+		}
+		if !migrated {
+			return NewStream(path, options)
+		}
+	}
+
+	// a stream that is created explicitly
+	// has its own options
+	config, ok, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		options = config
+	}
+
+	return OpenStream(path, options)
+}
+
+// migrateSingleFileStream moves a stream file from before streams were
+// segmented into the stream directory, as the segment with base offset 0.
+// The messages of such a file are from before messages were versioned,
+// they are upgraded to version 1 messages on the way. The segment is
+// written to a hidden directory that is moved in place once it is
+// synced, so a crash never leaves a half migrated stream. It returns
+// false if there is no such file.
+func migrateSingleFileStream(path string) (bool, error) {
+	filename := path + SEGMENT_EXTENSION
+
+	buffer, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	upgraded, err := message.UpgradeLegacy(buffer)
+	if err != nil {
+		return false, fmt.Errorf("failed to migrate stream file %v: %v", filename, err)
+	}
+
+	migrating := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+MIGRATION_EXTENSION)
+	if err := os.RemoveAll(migrating); err != nil {
+		return false, err
+	}
+	if err := os.Mkdir(migrating, 0777); err != nil {
+		return false, err
+	}
+
+	segment, err := os.Create(segmentFilename(migrating, message.EmptyOffset, SEGMENT_EXTENSION))
+	if err != nil {
+		return false, err
+	}
+	if _, err := segment.Write(upgraded); err != nil {
+		segment.Close()
+		return false, err
+	}
+	if err := segment.Sync(); err != nil {
+		segment.Close()
+		return false, err
+	}
+	if err := segment.Close(); err != nil {
+		return false, err
+	}
+
+	if err := os.Rename(migrating, path); err != nil {
+		return false, err
+	}
+	return true, os.Remove(filename)
+}
@@ -0,0 +1,167 @@
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pjvds/strand/message"
+)
+
+// Durability determines when the messages
+// written to a stream are synced to disk.
+type Durability int
+
+const (
+	// SyncNone leaves syncing to the operating system,
+	// writes are acknowledged before they are synced.
+	SyncNone Durability = iota
+
+	// SyncAlways acknowledges a write once it is synced. Writes
+	// that arrive while a sync is running share the next sync.
+	SyncAlways
+
+	// SyncGroup acknowledges a write once it is synced. Writes are
+	// synced together every SyncInterval, or as soon as SyncBytes
+	// are written.
+	SyncGroup
+)
+
+// syncer syncs the active segment of a stream and lets writers wait
+// for their messages to be synced. Writers that wait at the same time
+// are batched together in a single sync.
+type syncer struct {
+	stream *stream
+
+	lock    sync.Mutex
+	synced  *sync.Cond
+	offset  message.Offset
+	syncing bool
+
+	// unsynced counts the bytes written since the last
+	// sync, full is signalled once it reaches SyncBytes
+	unsynced int64
+	full     chan struct{}
+}
+
+func newSyncer(stream *stream, offset message.Offset) *syncer {
+	syncer := &syncer{
+		stream: stream,
+		offset: offset,
+		full:   make(chan struct{}, 1),
+	}
+	syncer.synced = sync.NewCond(&syncer.lock)
+	return syncer
+}
+
+// written registers the number of bytes written
+// to the stream since the last sync.
+func (this *syncer) written(bytes int) {
+	options := this.stream.options
+	if options.Durability != SyncGroup || options.SyncBytes <= 0 {
+		return
+	}
+
+	if atomic.AddInt64(&this.unsynced, int64(bytes)) >= options.SyncBytes {
+		select {
+		case this.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait blocks until all messages before the given offset
+// are synced. The first writer that finds no sync running
+// becomes the leader and syncs for everyone waiting.
+func (this *syncer) wait(offset message.Offset) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for this.offset < offset {
+		if this.syncing {
+			this.synced.Wait()
+			continue
+		}
+
+		this.syncing = true
+		this.lock.Unlock()
+
+		synced, err := this.sync()
+
+		this.lock.Lock()
+		this.syncing = false
+		if err == nil && synced > this.offset {
+			this.offset = synced
+		}
+		this.synced.Broadcast()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rewind runs the rewind of the stream once no sync is running and
+// lowers the synced offset to the new head, so the messages that are
+// written at the dropped offsets are synced again.
+func (this *syncer) rewind(offset message.Offset, rewind func() error) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for this.syncing {
+		this.synced.Wait()
+	}
+
+	if this.offset > offset {
+		this.offset = offset
+	}
+	return rewind()
+}
+
+// sync syncs the active segment, after gathering writers for
+// the group if the durability asks for that. It returns the
+// offset up to which the messages are synced.
+func (this *syncer) sync() (message.Offset, error) {
+	options := this.stream.options
+	if options.Durability == SyncGroup && options.SyncInterval > 0 {
+		timer := time.NewTimer(options.SyncInterval)
+		select {
+		case <-timer.C:
+		case <-this.full:
+			timer.Stop()
+		}
+	}
+
+	// messages before the active segment are
+	// synced when the segment is rolled over
+	this.stream.headLock.RLock()
+	active := this.stream.segments[len(this.stream.segments)-1]
+	offset := this.stream.offset
+	this.stream.headLock.RUnlock()
+
+	atomic.StoreInt64(&this.unsynced, 0)
+	if err := active.sync(); err != nil {
+		return offset, err
+	}
+	return offset, this.stream.producers.sync()
+}
+
+// sync syncs the data of the segment. The segment is marked synced
+// before the data is synced, so a message that is published while
+// it syncs marks it unsynced again.
+func (this *segment) sync() error {
+	atomic.StoreInt32(&this.unsynced, 0)
+	if err := this.data.Sync(); err != nil {
+		atomic.StoreInt32(&this.unsynced, 1)
+		return err
+	}
+	return nil
+}
+
+// synced returns true if all messages published
+// to the segment are synced.
+func (this *segment) synced() bool {
+	return atomic.LoadInt32(&this.unsynced) == 0
+}
@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncGroupAcknowledgesSyncedWrites(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		Durability:   SyncGroup,
+		SyncInterval: 5 * time.Millisecond,
+	})
+	s, _ := creator("group")
+	synced := s.(*stream).syncer
+
+	var writers sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		writers.Add(1)
+
+		go func() {
+			defer writers.Done()
+
+			written, err := s.Write(newUnalignedSet(t, 1))
+			assert.Nil(err)
+
+			synced.lock.Lock()
+			assert.True(synced.offset > written.LastOffset(), "acknowledged before synced")
+			synced.lock.Unlock()
+		}()
+	}
+	writers.Wait()
+
+	assert.Equal(message.Offset(16), synced.offset)
+}
@@ -0,0 +1,165 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pjvds/strand/message"
+)
+
+var byteOrder = binary.LittleEndian
+
+const (
+	// INDEX_INTERVAL is the minimum number of bytes
+	// between two entries in the offset index.
+	INDEX_INTERVAL = 4096
+
+	// INDEX_ENTRY_SIZE is the size of an index entry on disk, two
+	// uint64 values: an offset and a position for the offset index,
+	// or a timestamp and an offset for the time index.
+	INDEX_ENTRY_SIZE = 16
+)
+
+type indexEntry struct {
+	offset   message.Offset
+	position int64
+}
+
+// offsetIndex is a sparse index from message
+// offsets to their position in a segment.
+type offsetIndex []indexEntry
+
+// add indexes the message at the given offset and position
+// if it is far enough away from the last entry. It returns
+// whether an entry was added.
+func (this offsetIndex) add(offset message.Offset, position int64) (offsetIndex, bool) {
+	if len(this) > 0 && position-this[len(this)-1].position < INDEX_INTERVAL {
+		return this, false
+	}
+
+	return append(this, indexEntry{
+		offset:   offset,
+		position: position,
+	}), true
+}
+
+// lookup returns the entry with the highest offset that is
+// lower or equal to the given offset. It returns false if
+// there is no such entry.
+func (this offsetIndex) lookup(offset message.Offset) (indexEntry, bool) {
+	i := sort.Search(len(this), func(i int) bool {
+		return this[i].offset > offset
+	})
+
+	if i == 0 {
+		return indexEntry{}, false
+	}
+	return this[i-1], true
+}
+
+// last returns the last entry in the index.
+func (this offsetIndex) last() (indexEntry, bool) {
+	if len(this) == 0 {
+		return indexEntry{}, false
+	}
+	return this[len(this)-1], true
+}
+
+type timeEntry struct {
+	timestamp int64
+	offset    message.Offset
+}
+
+// timeIndex is a sparse index from append timestamps to
+// message offsets in a segment. It has an entry for every
+// entry in the offset index.
+type timeIndex []timeEntry
+
+// lookup returns the entry with the highest timestamp that is
+// lower than the given timestamp. It returns false if there is
+// no such entry.
+func (this timeIndex) lookup(timestamp int64) (timeEntry, bool) {
+	i := sort.Search(len(this), func(i int) bool {
+		return this[i].timestamp >= timestamp
+	})
+
+	if i == 0 {
+		return timeEntry{}, false
+	}
+	return this[i-1], true
+}
+
+// readIndex reads all complete entries from the offset index file.
+func readIndex(file *os.File) (offsetIndex, error) {
+	var index offsetIndex
+	err := readIndexEntries(file, func(offset, position uint64) {
+		index = append(index, indexEntry{
+			offset:   message.Offset(offset),
+			position: int64(position),
+		})
+	})
+	return index, err
+}
+
+// readTimeIndex reads all complete entries from the time index file.
+func readTimeIndex(file *os.File) (timeIndex, error) {
+	var index timeIndex
+	err := readIndexEntries(file, func(timestamp, offset uint64) {
+		index = append(index, timeEntry{
+			timestamp: int64(timestamp),
+			offset:    message.Offset(offset),
+		})
+	})
+	return index, err
+}
+
+func readIndexEntries(file *os.File, entry func(first, second uint64)) error {
+	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+
+	buffer, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	for position := 0; position+INDEX_ENTRY_SIZE <= len(buffer); position += INDEX_ENTRY_SIZE {
+		entry(byteOrder.Uint64(buffer[position:]), byteOrder.Uint64(buffer[position+8:]))
+	}
+	return nil
+}
+
+// writeIndexEntry writes the entry at the given
+// location, counted in entries, in the index file.
+func writeIndexEntry(file *os.File, location int, first, second uint64) error {
+	buffer := make([]byte, INDEX_ENTRY_SIZE)
+	byteOrder.PutUint64(buffer, first)
+	byteOrder.PutUint64(buffer[8:], second)
+
+	_, err := file.WriteAt(buffer, int64(location*INDEX_ENTRY_SIZE))
+	return err
+}
+
+// writeIndex replaces the content of the index files with the given indexes.
+func writeIndex(file *os.File, index offsetIndex, timeFile *os.File, times timeIndex) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if err := timeFile.Truncate(0); err != nil {
+		return err
+	}
+
+	for location, entry := range index {
+		if err := writeIndexEntry(file, location, uint64(entry.offset), uint64(entry.position)); err != nil {
+			return err
+		}
+	}
+	for location, entry := range times {
+		if err := writeIndexEntry(timeFile, location, uint64(entry.timestamp), uint64(entry.offset)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// LOCK_FILENAME is the name of the file in the data directory
+// that is locked by the process that claims the directory.
+const LOCK_FILENAME = ".lock"
+
+// ErrLocked is returned when the directory
+// is claimed by another process.
+var ErrLocked = errors.New("directory is locked by another process")
+
+// DirectoryLock claims a directory for the process that holds it. The
+// lock is released by the operating system when the process exits, so
+// a crashed process doesn't leave the directory claimed.
+type DirectoryLock struct {
+	file *os.File
+}
+
+// Lock claims the directory, it fails with ErrLocked
+// when the directory is claimed by another process.
+func (this Directory) Lock() (*DirectoryLock, error) {
+	file, err := os.OpenFile(filepath.Join(string(this), LOCK_FILENAME), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+
+	return &DirectoryLock{file: file}, nil
+}
+
+// Release releases the claim on the directory.
+func (this *DirectoryLock) Release() error {
+	if err := syscall.Flock(int(this.file.Fd()), syscall.LOCK_UN); err != nil {
+		this.file.Close()
+		return err
+	}
+	return this.file.Close()
+}
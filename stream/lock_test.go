@@ -0,0 +1,26 @@
+package stream
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectoryLock(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	lock, err := directory.Lock()
+	assert.Nil(err)
+
+	_, err = directory.Lock()
+	assert.Equal(ErrLocked, err)
+
+	assert.Nil(lock.Release())
+
+	lock, err = directory.Lock()
+	assert.Nil(err)
+	lock.Release()
+}
@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+)
+
+type Creator func(id Id) (Stream, error)
+
+type Map struct {
+	sync.RWMutex
+	creator Creator
+	streams map[Id]Stream
+
+	// transactions is the log of the transactions in
+	// progress, nil if the map doesn't do transactions
+	transactions *transactionLog
+
+	// closed is set once the map is closed
+	closed bool
+}
+
+func NewMap(creator Creator) *Map {
+	return &Map{
+		creator: creator,
+		streams: make(map[Id]Stream),
+	}
+}
+
+func (this *Map) Get(id Id) (Stream, error) {
+	return this.get(id, this.creator)
+}
+
+// Open gets the stream like Get, but a stream that isn't in memory
+// is opened with the opener instead of the creator of the map. With
+// an opener that doesn't create streams, like the opener of a
+// directory, a stream that doesn't exist is never created, not even
+// when it is deleted while it is opened.
+func (this *Map) Open(id Id, opener Creator) (Stream, error) {
+	return this.get(id, opener)
+}
+
+func (this *Map) get(id Id, creator Creator) (Stream, error) {
+	// try to get the stream from memory
+	if stream, ok := func() (Stream, bool) {
+		this.RLock()
+		defer this.RUnlock()
+
+		stream, ok := this.streams[id]
+		return stream, ok
+	}(); ok {
+		// got it
+		return stream, nil
+	}
+
+	// we don't have the stream in memory,
+	// acquire write lock so we can try
+	// to add it
+	this.Lock()
+	defer this.Unlock()
+
+	// it might be that another routine
+	// acquired the lock before us and
+	// added the stream to memory
+	if stream, ok := this.streams[id]; ok {
+		return stream, nil
+	}
+
+	if this.closed {
+		return nil, ErrClosed
+	}
+
+	created, err := creator(id)
+	if err != nil {
+		return nil, err
+	}
+
+	this.streams[id] = created
+	return created, nil
+}
+
+// Each calls do for every stream in the map. The streams
+// are collected first so do can take its time.
+func (this *Map) Each(do func(id Id, stream Stream)) {
+	this.RLock()
+	streams := make(map[Id]Stream, len(this.streams))
+	for id, stream := range this.streams {
+		streams[id] = stream
+	}
+	this.RUnlock()
+
+	for id, stream := range streams {
+		do(id, stream)
+	}
+}
+
+// EachIn calls do for every stream listed in the directory, not only for
+// the streams in memory. A stream that isn't in memory is opened with the
+// opener and kept in the map, a stream that is deleted in the meantime
+// is skipped.
+func (this *Map) EachIn(directory Directory, opener Creator, do func(id Id, stream Stream)) error {
+	ids, err := directory.List()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		stream, err := this.Open(id, opener)
+		if err == ErrStreamNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		do(id, stream)
+	}
+	return nil
+}
+
+// Close syncs and closes every stream in the map and the transaction
+// log. Writes that are in progress finish first. The streams can't be
+// opened from the map once it is closed. It returns the first error,
+// but closes all streams regardless.
+func (this *Map) Close() error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+
+	var closeErr error
+	for id, stream := range this.streams {
+		closable, ok := stream.(closable)
+		if !ok {
+			continue
+		}
+		if err := closable.close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("failed to close stream %v: %v", id, err)
+		}
+	}
+	this.streams = make(map[Id]Stream)
+
+	if this.transactions != nil {
+		if err := this.transactions.close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("failed to close transaction log: %v", err)
+		}
+	}
+
+	return closeErr
+}
+
+type Id string
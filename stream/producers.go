@@ -0,0 +1,269 @@
+package stream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pjvds/strand/message"
+)
+
+const (
+	// PRODUCERS_FILENAME is the name of the file in the stream
+	// directory that holds the last write of every producer.
+	PRODUCERS_FILENAME = "producers"
+
+	// PRODUCER_RECORD_SIZE is the size of a record in the producers
+	// file: the producer id, the sequence, the first offset, the
+	// message count and the append timestamp, all 64 bit.
+	PRODUCER_RECORD_SIZE = 40
+
+	// PRODUCERS_SNAPSHOT_RECORDS is the number of records that are
+	// appended to the producers file before it is replaced by a
+	// snapshot with a single record for every producer.
+	PRODUCERS_SNAPSHOT_RECORDS = 64 * 1024
+)
+
+// ProducerId identifies an idempotent producer.
+type ProducerId uint64
+
+// SequenceError is returned for a write of an idempotent producer
+// with a sequence that doesn't follow its last write to the stream.
+type SequenceError struct {
+	Stream   Id
+	Producer ProducerId
+	Sequence uint64
+	Expected uint64
+}
+
+func (this SequenceError) Error() string {
+	return fmt.Sprintf("sequence %v of producer %v for stream %v is out of order, expected %v",
+		this.Sequence, this.Producer, this.Stream, this.Expected)
+}
+
+// WithSequence makes a write idempotent. The producer numbers its writes
+// to the stream with a sequence that increases by one for every write. A
+// write with the sequence of the last write of the producer is a retry,
+// it is not appended again but returns the messages aligned at the
+// offsets they were written at.
+func WithSequence(producer ProducerId, sequence uint64) WriteOption {
+	return func(options *writeOptions) {
+		options.producer = producer
+		options.sequence = sequence
+	}
+}
+
+// producerWrite is the last write of a producer to a stream.
+type producerWrite struct {
+	sequence  uint64
+	offset    message.Offset
+	count     int
+	timestamp int64
+}
+
+// producers holds the last write of every producer to a stream. Writes
+// are recorded in an append only file that is replaced by a snapshot
+// once it grows too large.
+type producers struct {
+	directory string
+	expiry    time.Duration
+
+	lock    sync.Mutex
+	file    *os.File
+	writes  map[ProducerId]producerWrite
+	records int
+}
+
+// openProducers opens the producers file in the stream directory. The
+// records of writes at or beyond the head are ignored, their messages
+// are lost in a crash.
+func openProducers(directory string, head message.Offset, expiry time.Duration) (*producers, error) {
+	file, err := os.OpenFile(filepath.Join(directory, PRODUCERS_FILENAME), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer, err := ioutil.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	producers := &producers{
+		directory: directory,
+		expiry:    expiry,
+		file:      file,
+		writes:    make(map[ProducerId]producerWrite),
+	}
+
+	for position := 0; position+PRODUCER_RECORD_SIZE <= len(buffer); position += PRODUCER_RECORD_SIZE {
+		producer, write := readProducerRecord(buffer[position:])
+		if write.offset.AddInt(write.count) > head {
+			continue
+		}
+
+		producers.writes[producer] = write
+		producers.records++
+	}
+
+	// a snapshot drops the torn and lost records
+	if err := producers.snapshot(time.Now()); err != nil {
+		producers.close()
+		return nil, err
+	}
+
+	return producers, nil
+}
+
+// check returns the last write of the producer if the sequence
+// is a retry of it, or an error if the sequence is out of order.
+// A producer that is not known can start at any sequence.
+func (this *producers) check(stream Id, producer ProducerId, sequence uint64, count int) (producerWrite, bool, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	last, ok := this.writes[producer]
+	if !ok {
+		return producerWrite{}, false, nil
+	}
+
+	if sequence == last.sequence && count == last.count {
+		return last, true, nil
+	}
+
+	if sequence != last.sequence+1 {
+		return producerWrite{}, false, SequenceError{
+			Stream:   stream,
+			Producer: producer,
+			Sequence: sequence,
+			Expected: last.sequence + 1,
+		}
+	}
+
+	return producerWrite{}, false, nil
+}
+
+// record appends the write to the producers file. The write is only
+// known as the last write of the producer once it is recorded, a write
+// that fails to be recorded leaves the last write as it was.
+func (this *producers) record(producer ProducerId, write producerWrite) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.records >= PRODUCERS_SNAPSHOT_RECORDS {
+		last, known := this.writes[producer]
+		this.writes[producer] = write
+
+		if err := this.snapshot(time.Unix(0, write.timestamp)); err != nil {
+			if known {
+				this.writes[producer] = last
+			} else {
+				delete(this.writes, producer)
+			}
+			return err
+		}
+		return nil
+	}
+
+	if _, err := this.file.Write(producerRecord(producer, write)); err != nil {
+		// a torn record would misalign the records after it
+		size := int64(this.records) * PRODUCER_RECORD_SIZE
+		if this.file.Truncate(size) == nil {
+			this.file.Seek(size, os.SEEK_SET)
+		}
+		return err
+	}
+
+	this.writes[producer] = write
+	this.records++
+	return nil
+}
+
+// rewind forgets the writes with messages at or after the head,
+// the stream is rewound to it and their messages are dropped.
+func (this *producers) rewind(head message.Offset) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for producer, write := range this.writes {
+		if write.offset.AddInt(write.count) > head {
+			delete(this.writes, producer)
+		}
+	}
+	return this.snapshot(time.Now())
+}
+
+// snapshot replaces the producers file with a file that holds the last
+// write of every producer that wrote within the expiry. It must be
+// called with the lock held.
+func (this *producers) snapshot(now time.Time) error {
+	buffer := make([]byte, 0, len(this.writes)*PRODUCER_RECORD_SIZE)
+	for producer, write := range this.writes {
+		if this.expiry > 0 && now.Sub(time.Unix(0, write.timestamp)) > this.expiry {
+			delete(this.writes, producer)
+			continue
+		}
+		buffer = append(buffer, producerRecord(producer, write)...)
+	}
+
+	filename := filepath.Join(this.directory, PRODUCERS_FILENAME)
+	if err := ioutil.WriteFile(filename+COMPACTION_EXTENSION, buffer, 0666); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename+COMPACTION_EXTENSION, os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := os.Rename(filename+COMPACTION_EXTENSION, filename); err != nil {
+		file.Close()
+		return err
+	}
+
+	this.file.Close()
+	this.file = file
+	this.records = len(this.writes)
+	return nil
+}
+
+func (this *producers) sync() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.file.Sync()
+}
+
+func (this *producers) close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.file.Close()
+}
+
+func producerRecord(producer ProducerId, write producerWrite) []byte {
+	record := make([]byte, PRODUCER_RECORD_SIZE)
+	byteOrder.PutUint64(record, uint64(producer))
+	byteOrder.PutUint64(record[8:], write.sequence)
+	byteOrder.PutUint64(record[16:], uint64(write.offset))
+	byteOrder.PutUint64(record[24:], uint64(write.count))
+	byteOrder.PutUint64(record[32:], uint64(write.timestamp))
+	return record
+}
+
+func readProducerRecord(record []byte) (ProducerId, producerWrite) {
+	return ProducerId(byteOrder.Uint64(record)), producerWrite{
+		sequence:  byteOrder.Uint64(record[8:]),
+		offset:    message.Offset(byteOrder.Uint64(record[16:])),
+		count:     int(byteOrder.Uint64(record[24:])),
+		timestamp: int64(byteOrder.Uint64(record[32:])),
+	}
+}
@@ -0,0 +1,102 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteWithSequenceDeduplicatesRetries(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("idempotent")
+	producer := ProducerId(42)
+
+	first, err := s.Write(newUnalignedSet(t, 3), WithSequence(producer, 1))
+	assert.Nil(err)
+	s.Write(newUnalignedSet(t, 2))
+
+	retry, err := s.Write(newUnalignedSet(t, 3), WithSequence(producer, 1))
+	assert.Nil(err)
+	assert.Equal(first.FirstOffset(), retry.FirstOffset(), "first offset of retry")
+	assert.Equal(first.LastOffset(), retry.LastOffset(), "last offset of retry")
+	assert.Equal(message.Offset(5), s.HeadOffset(), "retry not appended")
+
+	_, err = s.Write(newUnalignedSet(t, 1), WithSequence(producer, 3))
+	if assert.IsType(SequenceError{}, err) {
+		assert.Equal(uint64(2), err.(SequenceError).Expected)
+	}
+
+	second, err := s.Write(newUnalignedSet(t, 1), WithSequence(producer, 2))
+	assert.Nil(err)
+	assert.Equal(message.Offset(5), second.FirstOffset())
+
+	s.(*stream).closeSegments()
+	reopened, err := directory.OpenOrCreateStream("idempotent")
+	assert.Nil(err)
+
+	retry, err = reopened.Write(newUnalignedSet(t, 1), WithSequence(producer, 2))
+	assert.Nil(err)
+	assert.Equal(message.Offset(5), retry.FirstOffset(), "retry after reopen")
+	assert.Equal(message.Offset(6), reopened.HeadOffset(), "retry after reopen not appended")
+}
+
+func TestOpenProducersIgnoresWritesBeyondHead(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("lost")
+	s.Write(newUnalignedSet(t, 2), WithSequence(ProducerId(1), 1))
+	s.Write(newUnalignedSet(t, 2), WithSequence(ProducerId(1), 2))
+
+	// lose the last write in a crash
+	created := s.(*stream)
+	active := created.segments[0]
+	active.data.Truncate(active.position / 2)
+	created.closeSegments()
+
+	reopened, _ := directory.OpenOrCreateStream("lost")
+	assert.Equal(message.Offset(2), reopened.HeadOffset())
+
+	written, err := reopened.Write(newUnalignedSet(t, 2), WithSequence(ProducerId(1), 2))
+	assert.Nil(err)
+	assert.Equal(message.Offset(2), written.FirstOffset(), "lost write is written again")
+	assert.Equal(message.Offset(4), reopened.HeadOffset())
+}
+
+func TestRecordFailureKeepsLastWrite(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	producers, err := openProducers(string(directory), message.EmptyOffset, 0)
+	assert.Nil(err)
+	defer producers.close()
+
+	producer := ProducerId(1)
+	assert.Nil(producers.record(producer, producerWrite{sequence: 1, count: 1}))
+
+	// fail the next write to the producers file
+	writable := producers.file
+	readOnly, err := os.Open(filepath.Join(string(directory), PRODUCERS_FILENAME))
+	assert.Nil(err)
+	producers.file = readOnly
+	assert.NotNil(producers.record(producer, producerWrite{sequence: 2, offset: 1, count: 1}))
+	producers.file = writable
+	readOnly.Close()
+
+	_, retry, err := producers.check("failed", producer, 2, 1)
+	assert.Nil(err)
+	assert.False(retry, "failed write is not a retry")
+
+	last, retry, err := producers.check("failed", producer, 1, 1)
+	assert.Nil(err)
+	assert.True(retry, "last recorded write is a retry")
+	assert.Equal(uint64(1), last.sequence)
+}
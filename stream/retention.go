@@ -0,0 +1,169 @@
+package stream
+
+import (
+	"os"
+	"time"
+
+	"github.com/pjvds/tidy"
+)
+
+var log = tidy.Configure().
+	LogFromLevel(tidy.DEBUG).To(tidy.Console).
+	MustBuild()
+
+// SetLogLevel sets the level from which the streams log.
+// It must be called before the first stream is opened.
+func SetLogLevel(level tidy.Level) {
+	log = tidy.Configure().
+		LogFromLevel(level).To(tidy.Console).
+		MustBuild()
+}
+
+// retainer is implemented by streams
+// that have a retention policy.
+type retainer interface {
+	enforceRetention(now time.Time) (int, error)
+}
+
+// enforceRetention deletes the oldest segments that fall outside the
+// retention policy and returns the number of segments it deleted. The
+// active segment is never deleted, so retention applies to whole
+// segments only.
+func (this *stream) enforceRetention(now time.Time) (int, error) {
+	this.headLock.Lock()
+
+	var expired []*segment
+	for len(this.segments) > 1 && this.expired(this.segments[0], now) {
+		expired = append(expired, this.segments[0])
+		this.segments = this.segments[1:]
+	}
+
+	this.headLock.Unlock()
+
+	// reads in progress finish before their segment is deleted
+	for _, segment := range expired {
+		if err := segment.retire(segment.delete); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(expired), nil
+}
+
+// expired returns true if the oldest segment can be deleted without
+// retaining less than the retention policy asks for. It must be
+// called with the headLock held.
+func (this *stream) expired(oldest *segment, now time.Time) bool {
+	options := this.options
+
+	if options.RetentionMaxAge > 0 && now.Sub(oldest.modified) > options.RetentionMaxAge {
+		return true
+	}
+
+	if options.RetentionMaxBytes > 0 {
+		var size int64
+		for _, segment := range this.segments {
+			size += segment.position
+		}
+
+		if size-oldest.position >= options.RetentionMaxBytes {
+			return true
+		}
+	}
+
+	if options.RetentionMaxMessages > 0 {
+		next := this.segments[1]
+		if uint64(this.offset.Sub(next.baseOffset)) >= options.RetentionMaxMessages {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (this *segment) delete() error {
+	if err := this.close(); err != nil {
+		return err
+	}
+
+	for _, file := range []*os.File{this.data, this.indexFile, this.timeIndexFile} {
+		if err := os.Remove(file.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Janitor enforces the retention policy of the streams
+// in a directory at a regular interval. Streams that
+// aren't opened yet are opened into the map.
+type Janitor struct {
+	streams   *Map
+	directory Directory
+	options   Options
+	interval  time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartJanitor starts a janitor for the streams in the directory, the
+// streams that aren't in the map are opened with the given options.
+func StartJanitor(streams *Map, directory Directory, options Options, interval time.Duration) *Janitor {
+	janitor := &Janitor{
+		streams:   streams,
+		directory: directory,
+		options:   options,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go janitor.run()
+	return janitor
+}
+
+func (this *Janitor) run() {
+	defer close(this.done)
+
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			this.sweep(now)
+		case <-this.stop:
+			return
+		}
+	}
+}
+
+func (this *Janitor) sweep(now time.Time) {
+	opener := this.directory.Opener(this.options)
+	err := this.streams.EachIn(this.directory, opener, func(id Id, stream Stream) {
+		retainer, ok := stream.(retainer)
+		if !ok {
+			return
+		}
+
+		deleted, err := retainer.enforceRetention(now)
+		if err != nil {
+			log.With("stream_id", id).WithError(err).Error("failed to enforce retention")
+			return
+		}
+
+		if deleted > 0 && log.IsDebug() {
+			log.With("stream_id", id).With("segments", deleted).Debug("deleted expired segments")
+		}
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to enforce retention")
+	}
+}
+
+// Stop stops the janitor and waits for a running sweep to finish.
+func (this *Janitor) Stop() {
+	close(this.stop)
+	<-this.done
+}
@@ -0,0 +1,166 @@
+package stream
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionDeletesOldestSegments(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		SegmentMaxBytes:      4 * 1024,
+		RetentionMaxMessages: 1000,
+	})
+
+	s, _ := creator("retention")
+	for i := 0; i < 500; i++ {
+		s.Write(newUnalignedSet(t, 10))
+	}
+
+	retained := s.(*stream)
+	oldest := retained.segments[0]
+
+	deleted, err := retained.enforceRetention(time.Now())
+	assert.Nil(err)
+	assert.True(deleted > 0, "deleted segments")
+
+	start := s.StartOffset()
+	assert.True(s.HeadOffset()-start >= 1000, "retains at least the max messages")
+
+	_, err = s.Read(message.EmptyOffset, 1, 1024)
+	assert.Equal(ErrOffsetOutOfRange, err, "read deleted offset")
+
+	set, err := s.Read(start, 1, 1024)
+	assert.Nil(err)
+	assert.Equal(start, set.FirstOffset(), "read start offset")
+
+	_, err = os.Stat(oldest.data.Name())
+	assert.True(os.IsNotExist(err), "segment file deleted")
+
+	retained.closeSegments()
+	reopened, err := creator("retention")
+	assert.Nil(err)
+	assert.Equal(start, reopened.StartOffset(), "start offset after reopen")
+}
+
+func TestRetentionWaitsForReadsInProgress(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.Creator(Options{
+		SegmentMaxBytes:      4 * 1024,
+		RetentionMaxMessages: 100,
+	})("retention")
+	for i := 0; i < 500; i++ {
+		s.Write(newUnalignedSet(t, 10))
+	}
+	retained := s.(*stream)
+
+	oldest, start, end, err := retained.locate(message.EmptyOffset)
+	assert.Nil(err)
+
+	deleted, err := retained.enforceRetention(time.Now())
+	assert.Nil(err)
+	assert.True(deleted > 0, "deleted segments")
+
+	set, err := oldest.read(message.EmptyOffset, start, end, 1, 1024)
+	assert.Nil(err, "read segment deleted during read")
+	assert.Equal(message.EmptyOffset, set.FirstOffset())
+
+	_, err = os.Stat(oldest.data.Name())
+	assert.Nil(err, "segment file retained during read")
+
+	oldest.release()
+	_, err = os.Stat(oldest.data.Name())
+	assert.True(os.IsNotExist(err), "segment file deleted after read")
+}
+
+func TestReadDuringRetention(t *testing.T) {
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.Creator(Options{
+		SegmentMaxBytes:      1024,
+		RetentionMaxMessages: 50,
+	})("retention")
+	retained := s.(*stream)
+
+	done := make(chan struct{})
+	failed := make(chan error, 1)
+	go func() {
+		defer close(failed)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			for offset := s.StartOffset(); ; {
+				set, err := s.Read(offset, 0, 1024)
+				if err == ErrOffsetOutOfRange {
+					break
+				}
+				if err != nil {
+					failed <- err
+					return
+				}
+				if set.MessageCount() == 0 {
+					break
+				}
+				offset = set.LastOffset().Next()
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		s.Write(newUnalignedSet(t, 10))
+		if _, err := retained.enforceRetention(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+
+	if err := <-failed; err != nil {
+		t.Fatalf("read during retention: %v", err)
+	}
+}
+
+func TestJanitorSweepsStreamsInDirectory(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, err := directory.CreateStream("retention", Options{
+		SegmentMaxBytes:      4 * 1024,
+		RetentionMaxMessages: 100,
+	})
+	assert.Nil(err)
+	for i := 0; i < 500; i++ {
+		s.Write(newUnalignedSet(t, 10))
+	}
+	s.(*stream).close()
+
+	// the stream is not opened in the map
+	streams := NewMap(directory.Creator(DefaultOptions))
+	defer streams.Close()
+	janitor := &Janitor{
+		streams:   streams,
+		directory: directory,
+		options:   DefaultOptions,
+	}
+	janitor.sweep(time.Now())
+
+	swept, err := streams.Get("retention")
+	assert.Nil(err)
+	assert.True(swept.StartOffset() > 0, "deleted expired segments")
+	assert.True(swept.HeadOffset()-swept.StartOffset() >= 100, "retains at least the max messages")
+}
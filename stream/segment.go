@@ -0,0 +1,591 @@
+package stream
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pjvds/strand/message"
+)
+
+const (
+	SEGMENT_EXTENSION    = ".str"
+	INDEX_EXTENSION      = ".idx"
+	TIME_INDEX_EXTENSION = ".tix"
+)
+
+// segment is a part of a stream that holds all messages from its base
+// offset up to the base offset of the next segment. Its files are named
+// after the base offset, so they sort in the order of the stream.
+type segment struct {
+	baseOffset message.Offset
+	created    time.Time
+
+	data          *os.File
+	indexFile     *os.File
+	timeIndexFile *os.File
+
+	// the fields below are guarded by the headLock of the stream
+	nextOffset message.Offset
+	position   int64
+	index      offsetIndex
+	times      timeIndex
+	modified   time.Time
+
+	// timestamp is the append timestamp of the last message
+	timestamp int64
+
+	// unsynced is set when messages are published to the segment and
+	// cleared when it is synced, it is accessed atomically
+	unsynced int32
+
+	// readers counts the reads that are in progress, a segment that
+	// is removed from the stream is retired once the last one is done
+	readersLock sync.Mutex
+	readers     int
+	retired     func() error
+
+	// drained is closed once the last read is done
+	// when a rewind waits for the reads of the segment
+	drained chan struct{}
+}
+
+func segmentFilename(directory string, baseOffset message.Offset, extension string) string {
+	return filepath.Join(directory, fmt.Sprintf("%020d%v", uint64(baseOffset), extension))
+}
+
+// parseSegmentFilename returns the base offset of the segment
+// data file with the given name, or false if it isn't one.
+func parseSegmentFilename(name string) (message.Offset, bool) {
+	if !strings.HasSuffix(name, SEGMENT_EXTENSION) {
+		return message.EmptyOffset, false
+	}
+
+	baseOffset, err := strconv.ParseUint(strings.TrimSuffix(name, SEGMENT_EXTENSION), 10, 64)
+	if err != nil {
+		return message.EmptyOffset, false
+	}
+	return message.Offset(baseOffset), true
+}
+
+func createSegment(directory string, baseOffset message.Offset) (*segment, error) {
+	data, err := os.OpenFile(segmentFilename(directory, baseOffset, SEGMENT_EXTENSION), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	indexFile, err := os.OpenFile(segmentFilename(directory, baseOffset, INDEX_EXTENSION), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+
+	timeIndexFile, err := os.OpenFile(segmentFilename(directory, baseOffset, TIME_INDEX_EXTENSION), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		indexFile.Close()
+		data.Close()
+		return nil, err
+	}
+
+	return &segment{
+		baseOffset:    baseOffset,
+		created:       time.Now(),
+		data:          data,
+		indexFile:     indexFile,
+		timeIndexFile: timeIndexFile,
+		nextOffset:    baseOffset,
+		modified:      time.Now(),
+	}, nil
+}
+
+// openSegment opens an existing segment and recovers its head.
+// Missing index files are rebuilt from the data file.
+func openSegment(directory string, baseOffset message.Offset) (*segment, error) {
+	data, err := os.OpenFile(segmentFilename(directory, baseOffset, SEGMENT_EXTENSION), os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	indexFile, err := os.OpenFile(segmentFilename(directory, baseOffset, INDEX_EXTENSION), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+
+	timeIndexFile, err := os.OpenFile(segmentFilename(directory, baseOffset, TIME_INDEX_EXTENSION), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		indexFile.Close()
+		data.Close()
+		return nil, err
+	}
+
+	segment := &segment{
+		baseOffset:    baseOffset,
+		data:          data,
+		indexFile:     indexFile,
+		timeIndexFile: timeIndexFile,
+	}
+
+	if err := segment.recover(); err != nil {
+		segment.close()
+		return nil, err
+	}
+
+	return segment, nil
+}
+
+// recover scans the message frames after the last index entry to rebuild
+// the head offset and position of the segment. A torn frame at the end of
+// the file, left behind by a crash during a write, is truncated so that
+// new writes continue right after the last complete message.
+func (this *segment) recover() error {
+	info, err := this.data.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	// we don't know when the segment was created,
+	// the last modification is the best guess
+	this.created = info.ModTime()
+	this.modified = info.ModTime()
+
+	index, err := readIndex(this.indexFile)
+	if err != nil {
+		return err
+	}
+
+	times, err := readTimeIndex(this.timeIndexFile)
+	if err != nil {
+		return err
+	}
+
+	// drop the entries that point beyond the data
+	for len(index) > 0 && index[len(index)-1].position >= size {
+		index = index[:len(index)-1]
+	}
+
+	// both indexes have an entry for the same messages,
+	// if they don't the indexes are rebuilt from scratch
+	if len(times) < len(index) {
+		index = nil
+	}
+	times = times[:len(index)]
+
+	start, ok := index.last()
+	if !ok {
+		start = indexEntry{offset: this.baseOffset}
+	}
+
+	result, err := this.scan(index, times, start, size)
+	if err != nil {
+		return err
+	}
+
+	// the message at the last index entry is not valid,
+	// don't trust the index and rebuild it from scratch
+	if ok && result.position == start.position {
+		start = indexEntry{offset: this.baseOffset}
+		if result, err = this.scan(nil, nil, start, size); err != nil {
+			return err
+		}
+	}
+
+	if result.position < size {
+		if err := this.data.Truncate(result.position); err != nil {
+			return err
+		}
+	}
+
+	if err := writeIndex(this.indexFile, result.index, this.timeIndexFile, result.times); err != nil {
+		return err
+	}
+
+	this.nextOffset = result.offset
+	this.position = result.position
+	this.index = result.index
+	this.times = result.times
+	this.timestamp = result.timestamp
+	return nil
+}
+
+type scanResult struct {
+	index     offsetIndex
+	times     timeIndex
+	offset    message.Offset
+	position  int64
+	timestamp int64
+}
+
+// scan walks the message frames from the start entry up to the first
+// invalid frame or the end of the data and adds them to the indexes. A
+// frame with a checksum mismatch is considered torn, but a frame with
+// an unsupported version fails the scan to prevent truncating data
+// that might be written by a newer version. The offsets of the frames
+// must increase, but they may skip the offsets removed by compaction.
+func (this *segment) scan(index offsetIndex, times timeIndex, start indexEntry, size int64) (scanResult, error) {
+	reader := bufio.NewReader(io.NewSectionReader(this.data, start.position, size-start.position))
+	frame := make([]byte, 0, INDEX_INTERVAL)
+
+	result := scanResult{
+		index:    index,
+		times:    times,
+		offset:   start.offset,
+		position: start.position,
+	}
+
+	for result.position+message.MIN_HEADER_SIZE <= size {
+		header, err := reader.Peek(message.MIN_HEADER_SIZE)
+		if err != nil {
+			return scanResult{}, err
+		}
+
+		messageSize, messageOffset := message.ReadHeader(header)
+		if messageSize >= message.LEGACY_HEADER_SIZE && messageSize < message.MIN_HEADER_SIZE &&
+			result.position+int64(messageSize) <= size {
+			// a complete frame that is too small for any version is
+			// a message from before messages were versioned, it is
+			// not truncated, it is not ours to throw away
+			return scanResult{}, CorruptionError{
+				Offset:   messageOffset,
+				Filename: this.data.Name(),
+				Position: result.position,
+				Cause:    fmt.Errorf("message of %v bytes is too small, it might be from before messages were versioned", messageSize),
+			}
+		}
+		if messageSize < message.MIN_HEADER_SIZE ||
+			result.position+int64(messageSize) > size ||
+			messageOffset < result.offset {
+			break
+		}
+
+		if cap(frame) < messageSize {
+			frame = make([]byte, messageSize)
+		}
+		frame = frame[:messageSize]
+
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return scanResult{}, err
+		}
+
+		if err := message.Verify(frame, 0); err != nil {
+			if _, ok := err.(message.VersionError); ok {
+				return scanResult{}, this.corruption(err, result.position)
+			}
+			break
+		}
+
+		timestamp := message.ReadTimestamp(frame)
+
+		var added bool
+		if result.index, added = result.index.add(messageOffset, result.position); added {
+			result.times = append(result.times, timeEntry{
+				timestamp: timestamp,
+				offset:    messageOffset,
+			})
+		}
+
+		result.position += int64(messageSize)
+		result.offset = messageOffset.Next()
+		result.timestamp = timestamp
+	}
+
+	return result, nil
+}
+
+// full returns true if the segment should be rolled
+// before more messages are written to it.
+func (this *segment) full(options Options) bool {
+	if this.position == 0 {
+		return false
+	}
+
+	if options.SegmentMaxBytes > 0 && this.position >= options.SegmentMaxBytes {
+		return true
+	}
+
+	return options.SegmentMaxAge > 0 && time.Since(this.created) >= options.SegmentMaxAge
+}
+
+// write writes the aligned messages at the end of the segment and
+// indexes them if needed. It returns the updated indexes, which the
+// caller must store together with the new head.
+func (this *segment) write(aligned message.AlignedSet, timestamp int64) (offsetIndex, timeIndex, int, error) {
+	written, err := this.data.WriteAt(aligned.GetBuffer(), this.position)
+	if err != nil {
+		return this.index, this.times, written, err
+	}
+
+	index, added := this.index.add(aligned.FirstOffset(), this.position)
+	if !added {
+		return index, this.times, written, nil
+	}
+
+	location := len(index) - 1
+	if err := writeIndexEntry(this.indexFile, location, uint64(aligned.FirstOffset()), uint64(this.position)); err != nil {
+		return this.index, this.times, written, err
+	}
+	if err := writeIndexEntry(this.timeIndexFile, location, uint64(timestamp), uint64(aligned.FirstOffset())); err != nil {
+		return this.index, this.times, written, err
+	}
+
+	times := append(this.times, timeEntry{
+		timestamp: timestamp,
+		offset:    aligned.FirstOffset(),
+	})
+	return index, times, written, nil
+}
+
+// read reads the messages starting at the given offset up to the end
+// position. If the offset is removed by compaction, the read starts at
+// the next message. The set is empty if there is no such message.
+func (this *segment) read(offset message.Offset, start indexEntry, end int64, maxMessages int, maxBytes int) (message.AlignedSet, error) {
+	position, err := this.seek(offset, start, end)
+	if err != nil {
+		return message.AlignedSet{}, err
+	}
+	if position == end {
+		return message.NewAlignedSet(nil)
+	}
+
+	header := make([]byte, message.MIN_HEADER_SIZE)
+	if _, err := this.data.ReadAt(header, position); err != nil {
+		return message.AlignedSet{}, err
+	}
+	firstSize, _ := message.ReadHeader(header)
+
+	length := end - position
+	if length > int64(maxBytes) {
+		length = int64(maxBytes)
+	}
+	if length < int64(firstSize) {
+		length = int64(firstSize)
+	}
+
+	buffer := make([]byte, length)
+	if _, err := this.data.ReadAt(buffer, position); err != nil {
+		return message.AlignedSet{}, err
+	}
+
+	set, err := message.NewAlignedSet(completeMessages(buffer, maxMessages))
+	if err != nil {
+		return message.AlignedSet{}, this.corruption(err, position)
+	}
+	return set, nil
+}
+
+// corruption returns a CorruptionError for an error from verifying the
+// messages in a buffer that was read from the given position, or the
+// error itself if it is not about a corrupt message.
+func (this *segment) corruption(err error, position int64) error {
+	switch cause := err.(type) {
+	case message.ChecksumError:
+		return CorruptionError{
+			Offset:   cause.Offset,
+			Filename: this.data.Name(),
+			Position: position + int64(cause.Position),
+			Cause:    err,
+		}
+	case message.VersionError:
+		return CorruptionError{
+			Offset:   cause.Offset,
+			Filename: this.data.Name(),
+			Position: position + int64(cause.Position),
+			Cause:    err,
+		}
+	}
+	return err
+}
+
+// seek returns the position of the first message at or after the
+// given offset, or the end position if there is no such message. It
+// starts at the given index entry and walks the message headers from
+// there. A header with an invalid size is a CorruptionError, the walk
+// can't continue past it.
+func (this *segment) seek(offset message.Offset, start indexEntry, end int64) (int64, error) {
+	header := make([]byte, message.MIN_HEADER_SIZE)
+	position := start.position
+
+	for position < end {
+		if _, err := this.data.ReadAt(header, position); err != nil {
+			return 0, err
+		}
+
+		size, current := message.ReadHeader(header)
+		if size < message.MIN_HEADER_SIZE {
+			return 0, CorruptionError{
+				Offset:   current,
+				Filename: this.data.Name(),
+				Position: position,
+				Cause:    fmt.Errorf("invalid message size %v", size),
+			}
+		}
+		if current >= offset {
+			break
+		}
+		position += int64(size)
+	}
+
+	return position, nil
+}
+
+func (this *segment) close() error {
+	indexErr := this.indexFile.Close()
+	timeIndexErr := this.timeIndexFile.Close()
+	if err := this.data.Close(); err != nil {
+		return err
+	}
+	if indexErr != nil {
+		return indexErr
+	}
+	return timeIndexErr
+}
+
+// acquire registers a read of the segment, the segment isn't closed or
+// deleted until the read releases it. It must be called with the
+// headLock held, while the segment is still part of the stream.
+func (this *segment) acquire() {
+	this.readersLock.Lock()
+	defer this.readersLock.Unlock()
+
+	this.readers++
+}
+
+// release marks a read of the segment as done. The last read of a
+// segment that is retired in the meantime closes or deletes it.
+func (this *segment) release() {
+	this.readersLock.Lock()
+	this.readers--
+
+	if this.readers == 0 && this.drained != nil {
+		close(this.drained)
+		this.drained = nil
+	}
+
+	retired := this.retired
+	if this.readers > 0 || retired == nil {
+		this.readersLock.Unlock()
+		return
+	}
+	this.retired = nil
+	this.readersLock.Unlock()
+
+	if err := retired(); err != nil {
+		log.With("segment", this.data.Name()).WithError(err).Error("failed to retire segment")
+	}
+}
+
+// retire closes or deletes a segment that is removed from the stream
+// with the given action. The action runs right away if no read is in
+// progress, otherwise the last read runs it and logs its error.
+func (this *segment) retire(action func() error) error {
+	this.readersLock.Lock()
+	if this.readers > 0 {
+		this.retired = action
+		this.readersLock.Unlock()
+		return nil
+	}
+	this.readersLock.Unlock()
+
+	return action()
+}
+
+// drain waits until the reads in progress are done. It must be called
+// with the headLock held, so no new read of the segment starts.
+func (this *segment) drain() {
+	this.readersLock.Lock()
+	if this.readers == 0 {
+		this.readersLock.Unlock()
+		return
+	}
+
+	if this.drained == nil {
+		this.drained = make(chan struct{})
+	}
+	drained := this.drained
+	this.readersLock.Unlock()
+
+	<-drained
+}
+
+// rewind drops the messages at and after the given offset, which
+// becomes the next offset of the segment. The data is truncated and
+// the indexes are rewritten without the entries of the dropped
+// messages. It must be called with the headLock held, once the reads
+// of the segment are drained.
+func (this *segment) rewind(offset message.Offset) error {
+	start, ok := this.index.lookup(offset)
+	if !ok {
+		start = indexEntry{offset: this.baseOffset}
+	}
+
+	position, err := this.seek(offset, start, this.position)
+	if err != nil {
+		return err
+	}
+
+	if err := this.data.Truncate(position); err != nil {
+		return err
+	}
+	if err := this.data.Sync(); err != nil {
+		return err
+	}
+
+	index := this.index
+	for len(index) > 0 && index[len(index)-1].position >= position {
+		index = index[:len(index)-1]
+	}
+	times := this.times[:len(index)]
+
+	// the timestamp of the last message that is kept
+	// is found by scanning from the last index entry
+	last, ok := index.last()
+	if !ok {
+		last = indexEntry{offset: this.baseOffset}
+	}
+	result, err := this.scan(index, times, last, position)
+	if err != nil {
+		return err
+	}
+
+	if err := writeIndex(this.indexFile, result.index, this.timeIndexFile, result.times); err != nil {
+		return err
+	}
+
+	this.nextOffset = offset
+	this.position = position
+	this.index = result.index
+	this.times = result.times
+	this.timestamp = result.timestamp
+	this.modified = time.Now()
+	return nil
+}
+
+// completeMessages slices the buffer to hold only complete
+// messages, with a maximum of maxMessages if it is not 0.
+func completeMessages(buffer []byte, maxMessages int) []byte {
+	position := 0
+	count := 0
+
+	for position+message.MIN_HEADER_SIZE <= len(buffer) {
+		if maxMessages > 0 && count == maxMessages {
+			break
+		}
+
+		size, _ := message.ReadHeader(buffer[position:])
+		if position+size > len(buffer) {
+			break
+		}
+
+		position += size
+		count++
+	}
+
+	return buffer[:position]
+}
@@ -2,130 +2,752 @@ package stream
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pjvds/strand/message"
 )
 
+var ErrOffsetOutOfRange = errors.New("offset out of range")
+
+// ErrClosed is returned for a write to or a read from a stream that is
+// closed, or for a stream that is opened from a map that is closed.
+var ErrClosed = errors.New("stream is closed")
+
+// CorruptionError is returned when a message in
+// a stream fails to verify against its checksum.
+type CorruptionError struct {
+	Stream   Id
+	Offset   message.Offset
+	Filename string
+	Position int64
+	Cause    error
+}
+
+func (this CorruptionError) Error() string {
+	return fmt.Sprintf("corrupt message in stream %v at offset %v: %v at position %v: %v",
+		this.Stream, this.Offset, this.Filename, this.Position, this.Cause)
+}
+
+// HeadMismatchError is returned for a conditional write
+// when the head of the stream is not at the expected offset.
+type HeadMismatchError struct {
+	Stream   Id
+	Expected message.Offset
+	Head     message.Offset
+}
+
+func (this HeadMismatchError) Error() string {
+	return fmt.Sprintf("expected head of stream %v at offset %v, but it is at %v",
+		this.Stream, this.Expected, this.Head)
+}
+
 type Stream interface {
-	Write(messages message.UnalignedSet) (message.Offset, error)
+	// Write appends the messages to the stream and returns
+	// them aligned to the offsets they were written at. The
+	// options set the conditions for the write.
+	Write(messages message.UnalignedSet, options ...WriteOption) (message.AlignedSet, error)
+
+	// Read reads the messages starting at the given offset. It reads
+	// at most maxMessages messages, or all available messages if
+	// maxMessages is 0, and at most maxBytes bytes. A compressed message
+	// is read as a whole and counts as a single message. The first message
+	// is always read completely, even when it is larger than maxBytes.
+	// A read never spans multiple segments. The offsets of a compacted
+	// stream have gaps, a read at a removed offset starts at the next
+	// message that is retained. The messages of aborted transactions
+	// are skipped.
+	Read(offset message.Offset, maxMessages int, maxBytes int) (message.AlignedSet, error)
+
+	// Notify returns a channel that is closed as soon as the
+	// message at the given offset is available for reading,
+	// or once the stream is closed.
+	Notify(offset message.Offset) <-chan struct{}
+
+	// StartOffset returns the offset of the oldest
+	// message that is retained in the stream.
+	StartOffset() message.Offset
+
+	// HeadOffset returns the offset the
+	// next message will be written at.
+	HeadOffset() message.Offset
+
+	// Sync blocks until all messages before the
+	// given offset are synced to disk.
+	Sync(offset message.Offset) error
+
+	// OffsetForTime returns the offset of the first message that
+	// was appended at or after the given timestamp, in unix
+	// nanoseconds, or the head offset if there is no such message.
+	OffsetForTime(timestamp int64) (message.Offset, error)
+
+	// Stat returns the offsets, size and age of the stream.
+	Stat() Stats
+
+	// Truncate drops the messages before the given offset,
+	// which becomes the start offset of the stream.
+	Truncate(offset message.Offset) error
+
+	// Replicate appends messages that are aligned by the leader of the
+	// stream as they are, so both hold the same frames. The messages
+	// must start at or after the head, they can skip the offsets that
+	// the leader removed.
+	Replicate(messages message.AlignedSet) error
+
+	// Rewind drops the messages at and after the given offset, which
+	// becomes the head of the stream. A follower rewinds to the last
+	// message it shares with a new leader before it replicates again.
+	Rewind(offset message.Offset) error
 }
 
+// stream is a directory of segments, ordered by their base offset.
+// Messages are always written to the last, active, segment. It is
+// rolled over to a new segment once it is full.
 type stream struct {
-	file *os.File
+	id        Id
+	directory string
+	options   Options
 
+	segments []*segment
 	offset   message.Offset
-	position int64
+
+	// start is the offset the stream is truncated
+	// to, guarded by the headLock
+	start message.Offset
+
+	// timestamp is the append timestamp of the
+	// last message, guarded by the writeLock
+	timestamp int64
+
+	// appended is closed and replaced every
+	// time the head of the stream advances
+	appended chan struct{}
+
+	syncer    *syncer
+	producers *producers
+
+	// aborted holds the offset ranges of aborted
+	// transactions, guarded by the headLock
+	aborted []offsetRange
+
+	// closed is set once the stream is closed, with both the
+	// writeLock and the headLock held, either guards it
+	closed bool
+
+	// compactLock is held while the stream is compacted, a
+	// rewind waits for it to change the segments in place
+	compactLock sync.Mutex
 
 	writeLock sync.Mutex
+	headLock  sync.RWMutex
 }
 
-func NewStream(filename string) (Stream, error) {
-	file, err := os.Create(filename)
+// NewStream creates a new stream in the given directory.
+func NewStream(directory string, options Options) (Stream, error) {
+	if err := os.Mkdir(directory, 0777); err != nil {
+		return nil, err
+	}
+
+	first, err := createSegment(directory, message.EmptyOffset)
 	if err != nil {
 		return nil, err
 	}
 
-	return &stream{
-		file:     file,
-		offset:   message.EmptyOffset,
-		position: 0,
-	}, nil
+	producers, err := openProducers(directory, message.EmptyOffset, options.ProducerExpiry)
+	if err != nil {
+		first.close()
+		return nil, err
+	}
+
+	stream := &stream{
+		id:        Id(filepath.Base(directory)),
+		directory: directory,
+		options:   options,
+		segments:  []*segment{first},
+		offset:    message.EmptyOffset,
+		appended:  make(chan struct{}),
+		producers: producers,
+	}
+	stream.syncer = newSyncer(stream, stream.offset)
+
+	return stream, nil
+}
+
+// OpenStream opens the existing stream in the given directory
+// and recovers the head offset from its segments.
+func OpenStream(directory string, options Options) (Stream, error) {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	baseOffsets := make([]message.Offset, 0, len(files))
+	for _, file := range files {
+		if baseOffset, ok := parseSegmentFilename(file.Name()); ok {
+			baseOffsets = append(baseOffsets, baseOffset)
+		}
+	}
+	sort.Sort(offsets(baseOffsets))
+
+	stream := &stream{
+		id:        Id(filepath.Base(directory)),
+		directory: directory,
+		options:   options,
+		appended:  make(chan struct{}),
+	}
+
+	for _, baseOffset := range baseOffsets {
+		segment, err := openSegment(directory, baseOffset)
+		if err != nil {
+			stream.closeSegments()
+			return nil, stream.identify(err)
+		}
+
+		if len(stream.segments) > 0 {
+			// compaction might have removed the last
+			// messages of the previous segment
+			previous := stream.segments[len(stream.segments)-1]
+			if previous.nextOffset < baseOffset {
+				previous.nextOffset = baseOffset
+				stream.offset = baseOffset
+			}
+
+			if stream.offset != baseOffset {
+				segment.close()
+				stream.closeSegments()
+				return nil, fmt.Errorf("segment %v does not continue at offset %v", baseOffset, stream.offset)
+			}
+		}
+
+		stream.segments = append(stream.segments, segment)
+		stream.offset = segment.nextOffset
+		if segment.timestamp > stream.timestamp {
+			stream.timestamp = segment.timestamp
+		}
+	}
+
+	if len(stream.segments) == 0 {
+		first, err := createSegment(directory, message.EmptyOffset)
+		if err != nil {
+			return nil, err
+		}
+		stream.segments = []*segment{first}
+	}
+
+	if stream.start, err = readStartOffset(directory); err != nil {
+		stream.closeSegments()
+		return nil, err
+	}
+
+	// the messages the stream is truncated
+	// to might be lost in a crash
+	if stream.start > stream.offset {
+		stream.start = stream.offset
+	}
+
+	if stream.producers, err = openProducers(directory, stream.offset, options.ProducerExpiry); err != nil {
+		stream.closeSegments()
+		return nil, err
+	}
+
+	if stream.aborted, err = readAborted(directory); err != nil {
+		stream.closeSegments()
+		stream.producers.close()
+		return nil, err
+	}
+
+	// a rewind that is interrupted by a crash might leave
+	// aborted ranges behind for offsets after the head
+	if aborted, clipped := clipAborted(stream.aborted, stream.offset); clipped {
+		if err := writeAborted(directory, aborted); err != nil {
+			stream.closeSegments()
+			stream.producers.close()
+			return nil, err
+		}
+		stream.aborted = aborted
+	}
+
+	stream.syncer = newSyncer(stream, stream.offset)
+	return stream, nil
+}
+
+// WriteOption sets a condition for a write.
+type WriteOption func(options *writeOptions)
+
+type writeOptions struct {
+	expectHead bool
+	head       message.Offset
+
+	producer ProducerId
+	sequence uint64
+}
+
+// ExpectHead makes a write fail with a HeadMismatchError unless the head
+// of the stream is at the given offset, so writers that read the stream
+// up to its head can't interleave their writes. Expecting the head at
+// the EmptyOffset makes sure the stream has no messages yet.
+func ExpectHead(offset message.Offset) WriteOption {
+	return func(options *writeOptions) {
+		options.expectHead = true
+		options.head = offset
+	}
+}
+
+func (this *stream) Write(messages message.UnalignedSet, options ...WriteOption) (message.AlignedSet, error) {
+	writeOptions := writeOptions{}
+	for _, option := range options {
+		option(&writeOptions)
+	}
+
+	aligned, err := this.append(messages, writeOptions)
+	if err != nil {
+		return message.AlignedSet{}, err
+	}
+
+	if this.options.Durability != SyncNone {
+		if err := this.Sync(aligned.LastOffset().Next()); err != nil {
+			return message.AlignedSet{}, err
+		}
+	}
+
+	return aligned, nil
 }
 
-func (this *stream) Write(messages message.UnalignedSet) (message.Offset, error) {
+func (this *stream) Replicate(messages message.AlignedSet) error {
+	if messages.MessageCount() == 0 {
+		return nil
+	}
+
+	if err := this.replicate(messages); err != nil {
+		return err
+	}
+
+	if this.options.Durability != SyncNone {
+		return this.Sync(messages.LastOffset().Next())
+	}
+	return nil
+}
+
+func (this *stream) replicate(messages message.AlignedSet) error {
 	this.writeLock.Lock()
 	defer this.writeLock.Unlock()
 
-	aligned := messages.Align(this.offset)
-	buffer := aligned.GetBuffer()
+	if messages.FirstOffset() < this.offset {
+		return fmt.Errorf("replicated messages at offset %v are before the head of stream %v at %v",
+			messages.FirstOffset(), this.id, this.offset)
+	}
+
+	active, err := this.activeSegment()
+	if err != nil {
+		return err
+	}
+
+	// the messages keep the append timestamp of the leader
+	timestamp := messages.Message(messages.FrameCount() - 1).Timestamp()
+
+	index, times, written, err := active.write(messages, timestamp)
+	if err != nil {
+		return err
+	}
+
+	this.headLock.Lock()
+	this.publish(pendingWrite{
+		segment:   active,
+		aligned:   messages,
+		index:     index,
+		times:     times,
+		written:   written,
+		timestamp: timestamp,
+	})
+	this.headLock.Unlock()
+
+	return nil
+}
+
+func (this *stream) Sync(offset message.Offset) error {
+	return this.syncer.wait(offset)
+}
+
+func (this *stream) append(messages message.UnalignedSet, options writeOptions) (message.AlignedSet, error) {
+	if err := this.checkSize(messages); err != nil {
+		return message.AlignedSet{}, err
+	}
+
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+
+	// a retry succeeds, even if the head moved on
+	if options.producer != 0 {
+		last, retry, err := this.producers.check(this.id, options.producer, options.sequence, messages.MessageCount())
+		if err != nil {
+			return message.AlignedSet{}, err
+		}
+		if retry {
+			return messages.Align(last.offset, last.timestamp), nil
+		}
+	}
+
+	// the head only advances while the writeLock is held
+	if options.expectHead && this.offset != options.head {
+		return message.AlignedSet{}, HeadMismatchError{
+			Stream:   this.id,
+			Expected: options.head,
+			Head:     this.offset,
+		}
+	}
+
+	pending, err := this.prepare(messages)
+	if err != nil {
+		return message.AlignedSet{}, err
+	}
+
+	// the write is recorded before the head advances, so it is
+	// synced together with the messages
+	if options.producer != 0 {
+		if err := this.producers.record(options.producer, producerWrite{
+			sequence:  options.sequence,
+			offset:    pending.aligned.FirstOffset(),
+			count:     pending.aligned.MessageCount(),
+			timestamp: pending.timestamp,
+		}); err != nil {
+			return message.AlignedSet{}, err
+		}
+	}
+
+	this.headLock.Lock()
+	this.publish(pending)
+	this.headLock.Unlock()
+
+	return pending.aligned, nil
+}
+
+// pendingWrite holds messages that are written after the
+// head of the stream, but are not visible to readers yet.
+type pendingWrite struct {
+	segment   *segment
+	aligned   message.AlignedSet
+	index     offsetIndex
+	times     timeIndex
+	written   int
+	timestamp int64
+}
+
+// prepare writes the messages after the head of the stream without
+// advancing the head. The next write overwrites them if they are not
+// published. It must be called with the writeLock held.
+func (this *stream) prepare(messages message.UnalignedSet) (pendingWrite, error) {
+	active, err := this.activeSegment()
+	if err != nil {
+		return pendingWrite{}, err
+	}
+
+	// timestamps never go back in time, so
+	// they can be looked up in the time index
+	timestamp := time.Now().UnixNano()
+	if timestamp < this.timestamp {
+		timestamp = this.timestamp
+	}
+
+	aligned := messages.Align(this.offset, timestamp)
 
 	// TODO: cover too lesser writes
-	written, err := this.file.WriteAt(buffer, this.position)
+	index, times, written, err := active.write(aligned, timestamp)
 	if err != nil {
-		return message.EmptyOffset, err
+		return pendingWrite{}, err
 	}
 
-	return this.advanceHead(written, aligned.DeltaOffset()), nil
+	return pendingWrite{
+		segment:   active,
+		aligned:   aligned,
+		index:     index,
+		times:     times,
+		written:   written,
+		timestamp: timestamp,
+	}, nil
 }
 
-func (this *stream) advanceHead(written int, offsetDelta message.Offset) message.Offset {
-	atomic.AddInt64(&this.position, int64(written))
-	newOffset := this.offset.Add(offsetDelta)
-	this.offset = newOffset
+// activeSegment returns the segment to write to,
+// rolling over to a new segment if it is full.
+func (this *stream) activeSegment() (*segment, error) {
+	if this.closed {
+		return nil, ErrClosed
+	}
+
+	this.headLock.RLock()
+	active := this.segments[len(this.segments)-1]
+	this.headLock.RUnlock()
+
+	if !active.full(this.options) {
+		return active, nil
+	}
+
+	// the syncer only syncs the active segment, make sure
+	// all messages are synced before rolling over, also
+	// without durability, since a write can ask to be
+	// synced just before the segment is rolled over
+	if err := active.sync(); err != nil {
+		return nil, err
+	}
 
-	return newOffset
+	rolled, err := createSegment(this.directory, this.offset)
+	if err != nil {
+		return nil, err
+	}
+
+	this.headLock.Lock()
+	this.segments = append(this.segments, rolled)
+	this.headLock.Unlock()
+
+	return rolled, nil
 }
 
-type Creator func(id Id) (Stream, error)
+// publish advances the head over the pending write, which makes its
+// messages visible to readers. It must be called with the writeLock
+// and the headLock held.
+func (this *stream) publish(pending pendingWrite) {
+	this.timestamp = pending.timestamp
+	this.offset = pending.aligned.LastOffset().Next()
+
+	active := pending.segment
+	active.index = pending.index
+	active.times = pending.times
+	active.position += int64(pending.written)
+	active.nextOffset = this.offset
+	active.modified = time.Now()
+	atomic.StoreInt32(&active.unsynced, 1)
+
+	close(this.appended)
+	this.appended = make(chan struct{})
 
-type Map struct {
-	sync.RWMutex
-	creator Creator
-	streams map[Id]Stream
+	this.syncer.written(pending.written)
 }
 
-func NewMap(creator Creator) *Map {
-	return &Map{
-		creator: creator,
-		streams: make(map[Id]Stream),
+var closed = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+func (this *stream) Notify(offset message.Offset) <-chan struct{} {
+	this.headLock.RLock()
+	defer this.headLock.RUnlock()
+
+	if offset < this.offset || this.closed {
+		return closed
 	}
+	return this.appended
+}
+
+func (this *stream) StartOffset() message.Offset {
+	this.headLock.RLock()
+	defer this.headLock.RUnlock()
+
+	return this.startOffset()
 }
 
-func (this *Map) Get(id Id) (Stream, error) {
-	// try to get the stream from memory
-	if stream, ok := func() (Stream, bool) {
-		this.RLock()
-		defer this.RUnlock()
+func (this *stream) HeadOffset() message.Offset {
+	this.headLock.RLock()
+	defer this.headLock.RUnlock()
 
-		stream, ok := this.streams[id]
-		return stream, ok
-	}(); ok {
-		// got it
-		return stream, nil
+	return this.offset
+}
+
+func (this *stream) Read(offset message.Offset, maxMessages int, maxBytes int) (message.AlignedSet, error) {
+	for {
+		segment, start, end, err := this.locate(offset)
+		if err != nil {
+			return message.AlignedSet{}, err
+		}
+		if segment == nil {
+			return message.NewAlignedSet(nil)
+		}
+
+		read, err := segment.read(offset, start, end, maxMessages, maxBytes)
+		segment.release()
+		if err != nil {
+			return message.AlignedSet{}, this.identify(err)
+		}
+
+		set, err := this.skipAborted(read)
+		if err != nil {
+			return message.AlignedSet{}, err
+		}
+		if set.MessageCount() > 0 {
+			return set, nil
+		}
+
+		// the messages read are all aborted,
+		// continue right after them
+		if read.MessageCount() > 0 {
+			offset = read.LastOffset().Next()
+			continue
+		}
+
+		// the rest of the segment is removed by
+		// compaction, continue at the next segment
+		this.headLock.RLock()
+		offset = segment.nextOffset
+		this.headLock.RUnlock()
 	}
+}
 
-	// we don't have the stream in memory,
-	// acquire write lock so we can try
-	// to add it
-	this.Lock()
-	defer this.Unlock()
+func (this *stream) OffsetForTime(timestamp int64) (message.Offset, error) {
+	offset := this.lookupTime(timestamp)
 
-	// it might be that another routine
-	// acquired the lock before us and
-	// added the stream to memory
-	if stream, ok := this.streams[id]; ok {
-		return stream, nil
+	// walk the messages from the closest time index entry
+	for {
+		set, err := this.Read(offset, 0, INDEX_INTERVAL)
+		if err != nil {
+			return message.EmptyOffset, err
+		}
+		if set.MessageCount() == 0 {
+			return offset, nil
+		}
+
+		messages := set.Messages()
+		for frame, ok := messages.Next(); ok; frame, ok = messages.Next() {
+			if frame.Timestamp() >= timestamp {
+				return frame.FirstOffset(), nil
+			}
+		}
+
+		offset = set.LastOffset().Next()
 	}
+}
 
-	created, err := this.creator(id)
-	if err != nil {
-		return nil, err
+// lookupTime returns the offset of the closest time index entry
+// before the given timestamp, or the start offset of the stream
+// if there is no such entry.
+func (this *stream) lookupTime(timestamp int64) message.Offset {
+	this.headLock.RLock()
+	defer this.headLock.RUnlock()
+
+	start := this.startOffset()
+	for i := len(this.segments) - 1; i >= 0; i-- {
+		if entry, ok := this.segments[i].times.lookup(timestamp); ok && entry.offset >= start {
+			return entry.offset
+		}
 	}
 
-	this.streams[id] = created
-	return created, nil
+	return start
 }
 
-type Id string
+// identify fills in the stream of a CorruptionError.
+func (this *stream) identify(err error) error {
+	if corruption, ok := err.(CorruptionError); ok {
+		corruption.Stream = this.id
+		return corruption
+	}
+	return err
+}
 
-type Directory string
+// locate finds the segment that holds the given offset and returns
+// it together with the closest index entry and the end position of
+// the data to read. It returns a nil segment for the head offset. The
+// segment is acquired, the caller must release it once it is read. An
+// offset in a segment that is removed by retention or truncation is
+// out of range.
+func (this *stream) locate(offset message.Offset) (*segment, indexEntry, int64, error) {
+	this.headLock.RLock()
+	defer this.headLock.RUnlock()
 
-func (this Directory) OpenOrCreateStream(id Id) (Stream, error) {
-	directory := string(this)
-	filename := string(id) + ".str"
-	path := filepath.Join(directory, filename)
+	if this.closed {
+		return nil, indexEntry{}, 0, ErrClosed
+	}
+	if offset > this.offset {
+		return nil, indexEntry{}, 0, ErrOffsetOutOfRange
+	}
+	if offset == this.offset {
+		return nil, indexEntry{}, 0, nil
+	}
 
-	if _, err := os.Stat(path); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
+	// the offset might be truncated
+	if offset < this.start {
+		return nil, indexEntry{}, 0, ErrOffsetOutOfRange
+	}
+
+	// the offset might be deleted by retention
+	i := sort.Search(len(this.segments), func(i int) bool {
+		return this.segments[i].baseOffset > offset
+	})
+	if i == 0 {
+		return nil, indexEntry{}, 0, ErrOffsetOutOfRange
+	}
+	segment := this.segments[i-1]
+
+	start, ok := segment.index.lookup(offset)
+	if !ok {
+		start = indexEntry{offset: segment.baseOffset}
+	}
+
+	segment.acquire()
+	return segment, start, segment.position, nil
+}
+
+// close syncs the active segment and the producers to disk and closes
+// the files of the stream. Writes that are in progress finish first,
+// later ones fail with ErrClosed.
+func (this *stream) close() error {
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+
+	if this.closed {
+		return nil
+	}
+
+	this.headLock.Lock()
+	defer this.headLock.Unlock()
+	this.markClosed()
+
+	// a segment is synced when it is rolled over, but that
+	// sync can fail, so every segment left unsynced is synced
+	var syncErr error
+	for _, segment := range this.segments {
+		if segment.synced() {
+			continue
 		}
+		if err := segment.sync(); err != nil && syncErr == nil {
+			syncErr = err
+		}
+	}
+	if err := this.producers.sync(); err != nil && syncErr == nil {
+		syncErr = err
+	}
 
-		return NewStream(path)
+	// reads in progress finish before their segment is closed
+	for _, segment := range this.segments {
+		if err := segment.retire(segment.close); err != nil && syncErr == nil {
+			syncErr = err
+		}
+	}
+	if err := this.producers.close(); err != nil && syncErr == nil {
+		syncErr = err
 	}
+	return syncErr
+}
+
+// markClosed makes later writes and reads fail and wakes the readers
+// that wait for new messages, which are never written. It must be
+// called with the writeLock and the headLock held.
+func (this *stream) markClosed() {
+	this.closed = true
+	close(this.appended)
+}
 
-	return nil, errors.New("open existing stream is still unsupported")
+func (this *stream) closeSegments() {
+	for _, segment := range this.segments {
+		segment.retire(segment.close)
+	}
 }
+
+type offsets []message.Offset
+
+func (this offsets) Len() int           { return len(this) }
+func (this offsets) Less(i, j int) bool { return this[i] < this[j] }
+func (this offsets) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
@@ -0,0 +1,531 @@
+package stream
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenStreamRecoversHead(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	created, err := directory.OpenOrCreateStream("recover")
+	assert.Nil(err)
+
+	created.Write(newUnalignedSet(t, 3))
+	written, err := created.Write(newUnalignedSet(t, 2))
+	assert.Nil(err)
+	assert.Equal(message.Offset(3), written.FirstOffset(), "first offset")
+	assert.Equal(message.Offset(4), written.LastOffset(), "last offset")
+
+	createdStream := created.(*stream)
+	createdStream.closeSegments()
+
+	opened, err := directory.OpenOrCreateStream("recover")
+	assert.Nil(err)
+
+	openedStream := opened.(*stream)
+	assert.Equal(createdStream.offset, openedStream.offset, "offset")
+	assert.Equal(createdStream.segments[0].position, openedStream.segments[0].position, "position")
+}
+
+func TestOpenStreamTruncatesTornFrame(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	created, _ := directory.OpenOrCreateStream("torn")
+	created.Write(newUnalignedSet(t, 3))
+
+	createdStream := created.(*stream)
+	active := createdStream.segments[0]
+	validPosition := active.position
+
+	// simulate a crash halfway a write
+	set := newUnalignedSet(t, 1)
+	torn := set.GetBuffer()
+	active.data.WriteAt(torn[:len(torn)-2], validPosition)
+	createdStream.closeSegments()
+
+	opened, err := directory.OpenOrCreateStream("torn")
+	assert.Nil(err)
+
+	openedStream := opened.(*stream)
+	assert.Equal(message.Offset(3), openedStream.offset, "offset")
+	assert.Equal(validPosition, openedStream.segments[0].position, "position")
+
+	info, _ := os.Stat(filepath.Join(string(directory), "torn", "00000000000000000000.str"))
+	assert.Equal(validPosition, info.Size(), "file size")
+
+	written, err := opened.Write(newUnalignedSet(t, 1))
+	assert.Nil(err)
+	assert.Equal(message.Offset(3), written.FirstOffset())
+}
+
+func TestReadFromOffset(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("read")
+	for i := 0; i < 100; i++ {
+		s.Write(newUnalignedSet(t, 10))
+	}
+
+	set, err := s.Read(message.Offset(512), 5, 1024*1024)
+	assert.Nil(err)
+	assert.Equal(5, set.MessageCount(), "message count")
+	assert.Equal(message.Offset(512), set.FirstOffset(), "first offset")
+	assert.Equal(message.Offset(516), set.LastOffset(), "last offset")
+
+	set, err = s.Read(message.Offset(990), 0, 1)
+	assert.Nil(err)
+	assert.Equal(1, set.MessageCount(), "first message must be read completely")
+
+	set, err = s.Read(message.Offset(1000), 0, 1024)
+	assert.Nil(err)
+	assert.Equal(0, set.MessageCount(), "read at head")
+
+	_, err = s.Read(message.Offset(1001), 0, 1024)
+	assert.Equal(ErrOffsetOutOfRange, err)
+}
+
+func TestSegmentsRollAndReopen(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		SegmentMaxBytes: 64 * 1024,
+	})
+
+	created, _ := creator("segmented")
+	for i := 0; i < 1000; i++ {
+		created.Write(newUnalignedSet(t, 10))
+	}
+
+	createdStream := created.(*stream)
+	assert.True(len(createdStream.segments) > 1, "segments rolled")
+	createdStream.closeSegments()
+
+	// remove an index to see it being rebuilt
+	os.Remove(segmentFilename(createdStream.directory, createdStream.segments[1].baseOffset, INDEX_EXTENSION))
+
+	opened, err := creator("segmented")
+	assert.Nil(err)
+
+	openedStream := opened.(*stream)
+	assert.Equal(len(createdStream.segments), len(openedStream.segments), "segments")
+	assert.Equal(message.Offset(10000), openedStream.offset, "offset")
+
+	for _, segment := range openedStream.segments {
+		set, err := opened.Read(segment.baseOffset+7, 1, 1024)
+		assert.Nil(err)
+		assert.Equal(segment.baseOffset+7, set.FirstOffset(), "read in segment %v", segment.baseOffset)
+	}
+
+	assert.NotEmpty(openedStream.segments[1].index, "rebuilt index")
+}
+
+func TestRollSyncsSegment(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		SegmentMaxBytes: 4 * 1024,
+		Durability:      SyncNone,
+	})
+
+	created, _ := creator("rolled")
+	for i := 0; i < 100; i++ {
+		created.Write(newUnalignedSet(t, 10))
+	}
+
+	s := created.(*stream)
+	assert.True(len(s.segments) > 1, "segments rolled")
+	for _, segment := range s.segments[:len(s.segments)-1] {
+		assert.True(segment.synced(), "segment %v synced", segment.baseOffset)
+	}
+	assert.False(s.segments[len(s.segments)-1].synced(), "active segment synced")
+}
+
+func TestCloseSyncsSegments(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		SegmentMaxBytes: 4 * 1024,
+		Durability:      SyncNone,
+	})
+
+	created, _ := creator("rolled")
+	for i := 0; i < 100; i++ {
+		created.Write(newUnalignedSet(t, 10))
+	}
+
+	s := created.(*stream)
+	assert.True(len(s.segments) > 2, "segments rolled")
+
+	// a segment whose sync failed when it was rolled over
+	atomic.StoreInt32(&s.segments[0].unsynced, 1)
+
+	assert.Nil(s.close())
+	for _, segment := range s.segments {
+		assert.True(segment.synced(), "segment %v synced", segment.baseOffset)
+	}
+}
+
+func TestReadCorruptMessage(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("corrupt")
+	s.Write(newUnalignedSet(t, 3))
+
+	// flip a bit in the body of the second message
+	active := s.(*stream).segments[0]
+	messageSize := active.position / 3
+	body := make([]byte, 1)
+	active.data.ReadAt(body, 2*messageSize-1)
+	body[0] ^= 1
+	active.data.WriteAt(body, 2*messageSize-1)
+
+	_, err := s.Read(message.EmptyOffset, 0, 1024)
+	if assert.IsType(CorruptionError{}, err) {
+		corruption := err.(CorruptionError)
+		assert.Equal(Id("corrupt"), corruption.Stream)
+		assert.Equal(message.Offset(1), corruption.Offset)
+		assert.Equal(messageSize, corruption.Position)
+	}
+}
+
+func TestReadMessageWithInvalidSize(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("corrupt")
+	s.Write(newUnalignedSet(t, 3))
+
+	// zero the size of the second message, seeking
+	// past it would never get further
+	active := s.(*stream).segments[0]
+	messageSize := active.position / 3
+	active.data.WriteAt(make([]byte, message.MESSAGE_SIZE_SIZE), messageSize)
+
+	_, err := s.Read(message.Offset(2), 0, 1024)
+	if assert.IsType(CorruptionError{}, err) {
+		corruption := err.(CorruptionError)
+		assert.Equal(Id("corrupt"), corruption.Stream)
+		assert.Equal(message.Offset(1), corruption.Offset)
+		assert.Equal(messageSize, corruption.Position)
+	}
+}
+
+func TestOffsetForTime(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	creator := directory.Creator(Options{
+		SegmentMaxBytes: 16 * 1024,
+	})
+
+	s, _ := creator("time")
+	before := time.Now().UnixNano()
+
+	var timestamps []int64
+	var offsets []message.Offset
+	for i := 0; i < 20; i++ {
+		time.Sleep(time.Millisecond)
+		timestamps = append(timestamps, time.Now().UnixNano())
+
+		written, _ := s.Write(newUnalignedSet(t, 50))
+		offsets = append(offsets, written.FirstOffset())
+	}
+
+	for i, timestamp := range timestamps {
+		offset, err := s.OffsetForTime(timestamp)
+		assert.Nil(err)
+		assert.Equal(offsets[i], offset, "offset for write %v", i)
+	}
+
+	offset, _ := s.OffsetForTime(before)
+	assert.Equal(message.EmptyOffset, offset, "before first message")
+
+	offset, _ = s.OffsetForTime(time.Now().UnixNano())
+	assert.Equal(s.HeadOffset(), offset, "after last message")
+}
+
+func TestNotifyOnAppend(t *testing.T) {
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("notify")
+	notified := s.Notify(message.EmptyOffset)
+
+	select {
+	case <-notified:
+		t.Fatal("notified before append")
+	default:
+	}
+
+	s.Write(newUnalignedSet(t, 1))
+
+	select {
+	case <-notified:
+	default:
+		t.Fatal("not notified after append")
+	}
+
+	select {
+	case <-s.Notify(message.EmptyOffset):
+	default:
+		t.Fatal("offset is already available")
+	}
+}
+
+func tempDirectory(t *testing.T) Directory {
+	directory, err := ioutil.TempDir("", "strand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Directory(directory)
+}
+
+func newUnalignedSet(t *testing.T, count int) message.UnalignedSet {
+	buffer := message.NewSet()
+
+	for i := 0; i < count; i++ {
+		buffer.Append([]byte("hello world"))
+	}
+
+	set, err := message.NewUnalignedSet(buffer.GetBuffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestReadCompressedSet(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("compressed")
+	s.Write(newUnalignedSet(t, 5))
+
+	plain := message.NewSet()
+	for i := 0; i < 10; i++ {
+		plain.Append([]byte("hello world"))
+	}
+	compressed, _ := plain.Compress(message.Gzip)
+	set, _ := message.NewUnalignedSet(compressed.GetBuffer())
+
+	written, err := s.Write(set)
+	assert.Nil(err)
+	assert.Equal(message.Offset(5), written.FirstOffset(), "first offset")
+	assert.Equal(message.Offset(14), written.LastOffset(), "last offset")
+	s.Write(newUnalignedSet(t, 1))
+	assert.Equal(message.Offset(16), s.HeadOffset(), "head offset")
+
+	s.(*stream).closeSegments()
+	s, _ = directory.OpenOrCreateStream("compressed")
+	assert.Equal(message.Offset(16), s.HeadOffset(), "head offset after reopen")
+
+	read, err := s.Read(message.Offset(8), 1, 1024)
+	assert.Nil(err)
+	assert.Equal(message.Offset(5), read.FirstOffset(), "reads the compressed message as a whole")
+	assert.Equal(message.Offset(14), read.LastOffset())
+
+	read, _ = s.Read(message.Offset(15), 1, 1024)
+	assert.Equal(message.Offset(15), read.FirstOffset(), "after the compressed message")
+}
+
+func TestWriteExpectHead(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	s, _ := directory.OpenOrCreateStream("expect")
+
+	_, err := s.Write(newUnalignedSet(t, 2), ExpectHead(message.EmptyOffset))
+	assert.Nil(err, "stream without messages")
+
+	_, err = s.Write(newUnalignedSet(t, 1), ExpectHead(message.EmptyOffset))
+	if assert.IsType(HeadMismatchError{}, err) {
+		mismatch := err.(HeadMismatchError)
+		assert.Equal(message.EmptyOffset, mismatch.Expected)
+		assert.Equal(message.Offset(2), mismatch.Head)
+	}
+
+	written, err := s.Write(newUnalignedSet(t, 1), ExpectHead(message.Offset(2)))
+	assert.Nil(err)
+	assert.Equal(message.Offset(2), written.FirstOffset())
+	assert.Equal(message.Offset(3), s.HeadOffset(), "failed write didn't append")
+}
+
+func TestReplicate(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	leader, _ := directory.OpenOrCreateStream("leader")
+	follower, _ := directory.OpenOrCreateStream("follower")
+
+	leader.Write(newUnalignedSet(t, 5))
+
+	plain := message.NewSet()
+	for i := 0; i < 10; i++ {
+		plain.Append([]byte("hello world"))
+	}
+	compressed, _ := plain.Compress(message.Gzip)
+	set, _ := message.NewUnalignedSet(compressed.GetBuffer())
+	leader.Write(set)
+	leader.Write(newUnalignedSet(t, 3))
+
+	// the follower starts after the messages the leader dropped
+	assert.Nil(leader.Truncate(message.Offset(3)))
+
+	for offset := leader.StartOffset(); offset < leader.HeadOffset(); {
+		read, err := leader.Read(offset, 2, 1024)
+		assert.Nil(err)
+		assert.Nil(follower.Replicate(read))
+		offset = read.LastOffset().Next()
+	}
+
+	assert.Equal(leader.HeadOffset(), follower.HeadOffset(), "head offset")
+
+	expected, _ := leader.Read(message.Offset(3), 0, 1024)
+	replicated, err := follower.Read(message.EmptyOffset, 0, 1024)
+	assert.Nil(err)
+	assert.Equal(expected.GetBuffer(), replicated.GetBuffer(), "byte identical frames")
+
+	// the messages must follow the head
+	assert.NotNil(follower.Replicate(expected))
+}
+
+func TestNotifyOnClose(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	streams := NewMap(directory.OpenOrCreateStream)
+	s, _ := streams.Get("notify")
+	notified := s.Notify(message.EmptyOffset)
+
+	assert.Nil(streams.Close())
+
+	select {
+	case <-notified:
+	default:
+		t.Fatal("not notified after close")
+	}
+
+	_, err := s.Read(message.EmptyOffset, 0, 1024)
+	assert.Equal(ErrClosed, err, "read after close")
+}
+
+func TestMapClose(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	streams := NewMap(directory.OpenOrCreateStream)
+	assert.Nil(streams.OpenTransactionLog(filepath.Join(string(directory), "transactions")))
+
+	orders, _ := streams.Get("orders")
+	orders.Write(newUnalignedSet(t, 3))
+
+	assert.Nil(streams.Close())
+	assert.Nil(streams.Close(), "closing twice")
+
+	_, err := orders.Write(newUnalignedSet(t, 1))
+	assert.Equal(ErrClosed, err)
+	_, err = streams.Get("orders")
+	assert.Equal(ErrClosed, err)
+	_, err = streams.WriteTransaction(map[Id]message.UnalignedSet{"orders": newUnalignedSet(t, 1)})
+	assert.Equal(ErrClosed, err)
+
+	reopened, err := directory.OpenOrCreateStream("orders")
+	assert.Nil(err)
+	assert.Equal(message.Offset(3), reopened.HeadOffset())
+}
+
+// legacyFrames returns messages from before messages were versioned,
+// with a header of only the size and offset.
+func legacyFrames(bodies ...string) []byte {
+	var buffer []byte
+	for i, body := range bodies {
+		frame := make([]byte, message.LEGACY_HEADER_SIZE+len(body))
+		byteOrder.PutUint32(frame, uint32(len(frame)))
+		byteOrder.PutUint64(frame[message.MESSAGE_SIZE_SIZE:], uint64(i))
+		copy(frame[message.LEGACY_HEADER_SIZE:], body)
+		buffer = append(buffer, frame...)
+	}
+	return buffer
+}
+
+func TestMigrateSingleFileStream(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	bodies := []string{"hello world", "abc", "", "hello again"}
+	filename := filepath.Join(string(directory), "legacy"+SEGMENT_EXTENSION)
+	assert.Nil(ioutil.WriteFile(filename, legacyFrames(bodies...), 0666))
+
+	s, err := directory.OpenOrCreateStream("legacy")
+	assert.Nil(err)
+	assert.Equal(message.Offset(4), s.HeadOffset())
+
+	set, err := s.Read(0, 0, 1024)
+	assert.Nil(err)
+	assert.Equal(4, set.MessageCount())
+	for i, body := range bodies {
+		assert.Equal(message.Offset(i), set.Message(i).Offset())
+		assert.Equal(body, string(set.Message(i).Body()))
+	}
+
+	_, err = os.Stat(filename)
+	assert.True(os.IsNotExist(err), "stream file is migrated")
+
+	_, err = s.Write(newUnalignedSet(t, 1))
+	assert.Nil(err)
+	s.(*stream).close()
+
+	reopened, err := directory.OpenOrCreateStream("legacy")
+	assert.Nil(err)
+	assert.Equal(message.Offset(5), reopened.HeadOffset())
+}
+
+func TestOpenStreamRefusesLegacySegment(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	// a segment from before messages were versioned
+	path := filepath.Join(string(directory), "legacy")
+	os.Mkdir(path, 0777)
+	filename := segmentFilename(path, message.EmptyOffset, SEGMENT_EXTENSION)
+	buffer := legacyFrames("abc", "de")
+	assert.Nil(ioutil.WriteFile(filename, buffer, 0666))
+
+	_, err := directory.OpenOrCreateStream("legacy")
+	_, ok := err.(CorruptionError)
+	assert.True(ok, "open fails with a corruption error: %v", err)
+
+	info, _ := os.Stat(filename)
+	assert.Equal(int64(len(buffer)), info.Size(), "segment is not truncated")
+}
@@ -0,0 +1,259 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pjvds/strand/message"
+)
+
+// PARTITION_SEPARATOR separates the name of a topic from the
+// number of the partition in the id of a partition stream.
+const PARTITION_SEPARATOR = "#"
+
+// MAX_PARTITIONS is the maximum number of partitions of a topic.
+const MAX_PARTITIONS = 1024
+
+var (
+	ErrTopicNotFound = errors.New("topic not found")
+	ErrTopicExists   = errors.New("topic already exists")
+)
+
+// Topic is a logical stream made of a number of partitions. Every
+// partition is a stream of its own, so the partitions of a topic
+// are written and read in parallel. The messages with the same key
+// end up in the same partition, in the order they are written.
+type Topic struct {
+	Name       string
+	Partitions int
+
+	// next is the partition of the next message
+	// without a key, they are spread round robin
+	next uint32
+}
+
+// PartitionId returns the id of the stream
+// that holds the partition of the topic.
+func PartitionId(topic string, partition int) Id {
+	return Id(topic + PARTITION_SEPARATOR + strconv.Itoa(partition))
+}
+
+// ParsePartitionId returns the topic and the partition of a partition
+// stream, or false if the stream is not a partition of a topic.
+func ParsePartitionId(id Id) (string, int, bool) {
+	i := strings.LastIndex(string(id), PARTITION_SEPARATOR)
+	if i < 0 {
+		return "", 0, false
+	}
+
+	partition, err := strconv.Atoi(string(id[i+1:]))
+	if err != nil || partition < 0 {
+		return "", 0, false
+	}
+	return string(id[:i]), partition, true
+}
+
+// Streams returns the ids of the streams of all partitions.
+func (this *Topic) Streams() []Id {
+	ids := make([]Id, this.Partitions)
+	for i := range ids {
+		ids[i] = PartitionId(this.Name, i)
+	}
+	return ids
+}
+
+// Partition returns the partition for a message with the given key.
+// The partition of a key is its FNV-1a hash modulo the number of
+// partitions. Messages without a key are spread round robin.
+func (this *Topic) Partition(key []byte) int {
+	if key == nil {
+		next := atomic.AddUint32(&this.next, 1) - 1
+		return int(next % uint32(this.Partitions))
+	}
+
+	hash := fnv.New32a()
+	hash.Write(key)
+	return int(hash.Sum32() % uint32(this.Partitions))
+}
+
+// Split splits the messages over the partitions by their keys. A
+// compressed message is routed as a whole, by the key of the message
+// that holds the compressed messages.
+func (this *Topic) Split(messages message.UnalignedSet) (map[int]message.UnalignedSet, error) {
+	buffers := make(map[int][]byte)
+
+	frames := messages.Messages()
+	for frame, ok := frames.Next(); ok; frame, ok = frames.Next() {
+		partition := this.Partition(frame.Key())
+		buffers[partition] = append(buffers[partition], frame...)
+	}
+	if err := frames.Err(); err != nil {
+		return nil, err
+	}
+
+	sets := make(map[int]message.UnalignedSet, len(buffers))
+	for partition, buffer := range buffers {
+		set, err := message.NewUnalignedSet(buffer)
+		if err != nil {
+			return nil, err
+		}
+		sets[partition] = set
+	}
+	return sets, nil
+}
+
+// Topics holds the topics in a directory, every topic is a
+// file with its settings named after the topic.
+type Topics struct {
+	directory string
+
+	lock   sync.RWMutex
+	topics map[string]*Topic
+}
+
+// OpenTopics opens the topics in the directory,
+// creating the directory if it doesn't exist.
+func OpenTopics(directory string) (*Topics, error) {
+	if err := os.MkdirAll(directory, 0777); err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := &Topics{
+		directory: directory,
+		topics:    make(map[string]*Topic),
+	}
+
+	for _, info := range infos {
+		if info.IsDir() || strings.HasSuffix(info.Name(), COMPACTION_EXTENSION) {
+			continue
+		}
+
+		filename := filepath.Join(directory, info.Name())
+		buffer, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		topic := &Topic{}
+		if err := json.Unmarshal(buffer, topic); err != nil {
+			return nil, fmt.Errorf("invalid topic in %v: %v", filename, err)
+		}
+		topics.topics[topic.Name] = topic
+	}
+
+	return topics, nil
+}
+
+// Get returns the topic with the given name.
+func (this *Topics) Get(name string) (*Topic, error) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	topic, ok := this.topics[name]
+	if !ok {
+		return nil, ErrTopicNotFound
+	}
+	return topic, nil
+}
+
+// List returns the names of the topics in order.
+func (this *Topics) List() []string {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	names := make([]string, 0, len(this.topics))
+	for name := range this.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create stores a new topic. The streams of its
+// partitions are not created, they are created
+// like any other stream.
+func (this *Topics) Create(name string, partitions int) (*Topic, error) {
+	if partitions < 1 || partitions > MAX_PARTITIONS {
+		return nil, fmt.Errorf("invalid number of partitions %v, a topic has 1 to %v partitions", partitions, MAX_PARTITIONS)
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if _, ok := this.topics[name]; ok {
+		return nil, ErrTopicExists
+	}
+
+	topic := &Topic{
+		Name:       name,
+		Partitions: partitions,
+	}
+	if err := this.write(topic); err != nil {
+		return nil, err
+	}
+
+	this.topics[name] = topic
+	return topic, nil
+}
+
+// Delete removes the topic, but not the streams of its partitions.
+func (this *Topics) Delete(name string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if _, ok := this.topics[name]; !ok {
+		return ErrTopicNotFound
+	}
+
+	if err := os.Remove(filepath.Join(this.directory, name)); err != nil {
+		return err
+	}
+
+	delete(this.topics, name)
+	return nil
+}
+
+// write stores the topic. It is written to a new file
+// that is synced before it is moved in place.
+func (this *Topics) write(topic *Topic) error {
+	filename := filepath.Join(this.directory, topic.Name)
+
+	buffer, err := json.MarshalIndent(topic, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename+COMPACTION_EXTENSION, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(buffer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(filename+COMPACTION_EXTENSION, filename)
+}
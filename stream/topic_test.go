@@ -0,0 +1,101 @@
+package stream
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionId(t *testing.T) {
+	assert := assert.New(t)
+
+	id := PartitionId("orders", 3)
+	assert.Equal(Id("orders#3"), id)
+
+	topic, partition, ok := ParsePartitionId(id)
+	assert.True(ok)
+	assert.Equal("orders", topic)
+	assert.Equal(3, partition)
+
+	_, _, ok = ParsePartitionId("orders")
+	assert.False(ok)
+	_, _, ok = ParsePartitionId("orders#first")
+	assert.False(ok)
+}
+
+func TestTopicSplit(t *testing.T) {
+	assert := assert.New(t)
+	topic := &Topic{Name: "orders", Partitions: 4}
+
+	buffer := message.NewSet()
+	for i := 0; i < 100; i++ {
+		buffer.Append([]byte("keyed"), message.WithKey([]byte(fmt.Sprintf("key-%v", i%10))))
+	}
+	for i := 0; i < 8; i++ {
+		buffer.Append([]byte("unkeyed"))
+	}
+
+	set, err := message.NewUnalignedSet(buffer.GetBuffer())
+	assert.Nil(err)
+
+	sets, err := topic.Split(set)
+	assert.Nil(err)
+
+	total := 0
+	for partition, split := range sets {
+		total += split.MessageCount()
+
+		frames := split.Messages()
+		for frame, ok := frames.Next(); ok; frame, ok = frames.Next() {
+			if key := frame.Key(); key != nil {
+				assert.Equal(topic.Partition(key), partition, "partition of %s", key)
+			}
+		}
+	}
+	assert.Equal(108, total)
+
+	// the messages without a key are spread round robin
+	unkeyed := make(map[int]int)
+	for i := 0; i < 8; i++ {
+		unkeyed[topic.Partition(nil)]++
+	}
+	assert.Equal(map[int]int{0: 2, 1: 2, 2: 2, 3: 2}, unkeyed)
+}
+
+func TestTopics(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	topics, err := OpenTopics(filepath.Join(string(directory), "topics"))
+	assert.Nil(err)
+
+	_, err = topics.Create("orders", 0)
+	assert.NotNil(err)
+
+	created, err := topics.Create("orders", 4)
+	assert.Nil(err)
+	assert.Equal([]Id{"orders#0", "orders#1", "orders#2", "orders#3"}, created.Streams())
+
+	_, err = topics.Create("orders", 2)
+	assert.Equal(ErrTopicExists, err)
+
+	topics.Create("payments", 1)
+	assert.Equal([]string{"orders", "payments"}, topics.List())
+
+	reopened, err := OpenTopics(filepath.Join(string(directory), "topics"))
+	assert.Nil(err)
+
+	topic, err := reopened.Get("orders")
+	assert.Nil(err)
+	assert.Equal(4, topic.Partitions)
+
+	assert.Nil(reopened.Delete("orders"))
+	_, err = reopened.Get("orders")
+	assert.Equal(ErrTopicNotFound, err)
+	assert.Equal(ErrTopicNotFound, reopened.Delete("orders"))
+}
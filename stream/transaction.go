@@ -0,0 +1,531 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pjvds/strand/message"
+)
+
+const (
+	// ABORTED_FILENAME is the name of the file in the stream directory
+	// that holds the offset ranges of aborted transactions.
+	ABORTED_FILENAME = "aborted"
+
+	TRANSACTION_PREPARE = 1
+	TRANSACTION_COMMIT  = 2
+	TRANSACTION_ABORT   = 3
+)
+
+var ErrNoTransactionLog = errors.New("transactions need a transaction log")
+
+var transactionCrcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// offsetRange is an inclusive range of offsets.
+type offsetRange struct {
+	first message.Offset
+	last  message.Offset
+}
+
+// readAborted reads the aborted offset ranges of the stream in the
+// given directory. A stream without aborted transactions has no file.
+func readAborted(directory string) ([]offsetRange, error) {
+	buffer, err := ioutil.ReadFile(filepath.Join(directory, ABORTED_FILENAME))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var aborted []offsetRange
+	for position := 0; position+INDEX_ENTRY_SIZE <= len(buffer); position += INDEX_ENTRY_SIZE {
+		aborted = append(aborted, offsetRange{
+			first: message.Offset(byteOrder.Uint64(buffer[position:])),
+			last:  message.Offset(byteOrder.Uint64(buffer[position+8:])),
+		})
+	}
+	return aborted, nil
+}
+
+// writeAborted replaces the aborted offset ranges of the stream in the
+// directory. The ranges are written to a new file that is synced before
+// it is moved over the old one.
+func writeAborted(directory string, aborted []offsetRange) error {
+	filename := filepath.Join(directory, ABORTED_FILENAME)
+
+	file, err := os.OpenFile(filename+COMPACTION_EXTENSION, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	buffer := make([]byte, len(aborted)*INDEX_ENTRY_SIZE)
+	for i, aborted := range aborted {
+		byteOrder.PutUint64(buffer[i*INDEX_ENTRY_SIZE:], uint64(aborted.first))
+		byteOrder.PutUint64(buffer[i*INDEX_ENTRY_SIZE+8:], uint64(aborted.last))
+	}
+
+	if _, err := file.Write(buffer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(filename+COMPACTION_EXTENSION, filename)
+}
+
+// clipAborted returns the aborted ranges without the offsets at and
+// after the head, and whether any range is clipped.
+func clipAborted(aborted []offsetRange, head message.Offset) ([]offsetRange, bool) {
+	i := sort.Search(len(aborted), func(i int) bool {
+		return aborted[i].last >= head
+	})
+	if i == len(aborted) {
+		return aborted, false
+	}
+
+	clipped := append([]offsetRange(nil), aborted[:i]...)
+	if aborted[i].first < head {
+		clipped = append(clipped, offsetRange{
+			first: aborted[i].first,
+			last:  head - 1,
+		})
+	}
+	return clipped, true
+}
+
+// markAborted records the offsets as aborted, readers skip them from
+// now on. The ranges are marked in order, so they stay sorted. It must
+// be called with the writeLock held.
+func (this *stream) markAborted(first message.Offset, last message.Offset) error {
+	file, err := os.OpenFile(filepath.Join(this.directory, ABORTED_FILENAME), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry := make([]byte, INDEX_ENTRY_SIZE)
+	byteOrder.PutUint64(entry, uint64(first))
+	byteOrder.PutUint64(entry[8:], uint64(last))
+
+	if _, err := file.Write(entry); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	this.headLock.Lock()
+	this.aborted = append(this.aborted, offsetRange{
+		first: first,
+		last:  last,
+	})
+	this.headLock.Unlock()
+	return nil
+}
+
+// abort publishes a pending write as aborted, its offsets are
+// used but readers skip its messages. It must be called with
+// the writeLock held.
+func (this *stream) abort(pending pendingWrite) error {
+	if err := this.markAborted(pending.aligned.FirstOffset(), pending.aligned.LastOffset()); err != nil {
+		return err
+	}
+
+	this.headLock.Lock()
+	this.publish(pending)
+	this.headLock.Unlock()
+	return nil
+}
+
+// skipAborted returns the set without the messages of aborted
+// transactions, or the set itself if it has none of them.
+func (this *stream) skipAborted(set message.AlignedSet) (message.AlignedSet, error) {
+	this.headLock.RLock()
+	aborted := this.aborted
+	this.headLock.RUnlock()
+
+	first, last := set.FirstOffset(), set.LastOffset()
+	i := sort.Search(len(aborted), func(i int) bool {
+		return aborted[i].last >= first
+	})
+	if i == len(aborted) || aborted[i].first > last {
+		return set, nil
+	}
+
+	buffer := make([]byte, 0, len(set.GetBuffer()))
+	messages := set.Messages()
+	for frame, ok := messages.Next(); ok; frame, ok = messages.Next() {
+		for i < len(aborted) && aborted[i].last < frame.Offset() {
+			i++
+		}
+		if i < len(aborted) && aborted[i].first <= frame.Offset() {
+			continue
+		}
+		buffer = append(buffer, frame...)
+	}
+
+	return message.NewAlignedSet(buffer)
+}
+
+// transactionWrite is the write of a transaction to a single stream.
+type transactionWrite struct {
+	stream Id
+	offset message.Offset
+	count  int
+}
+
+// transactionLog records the transactions that are in progress, so
+// the transactions that are interrupted by a crash can be aborted.
+// It only holds records while transactions are in progress.
+type transactionLog struct {
+	lock     sync.Mutex
+	file     *os.File
+	next     uint64
+	progress map[uint64]bool
+}
+
+// OpenTransactionLog opens the transaction log of the map, creating it
+// if it doesn't exist. The transactions that were in progress when the
+// log was closed are aborted.
+func (this *Map) OpenTransactionLog(filename string) error {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	interrupted, err := readTransactionLog(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	for _, writes := range interrupted {
+		for _, write := range writes {
+			if err := this.abortInterrupted(write); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return err
+	}
+
+	this.Lock()
+	this.transactions = &transactionLog{
+		file:     file,
+		progress: make(map[uint64]bool),
+	}
+	this.Unlock()
+	return nil
+}
+
+// abortInterrupted marks the messages that an interrupted transaction
+// wrote to the stream as aborted. Nothing is written to the stream
+// while a transaction is in progress, so its messages are at the head
+// of the stream, if they survived the crash.
+func (this *Map) abortInterrupted(write transactionWrite) error {
+	s, err := this.Get(write.stream)
+	if err != nil {
+		return err
+	}
+
+	interrupted, ok := s.(*stream)
+	if !ok {
+		return fmt.Errorf("stream %v does not support transactions", write.stream)
+	}
+
+	interrupted.writeLock.Lock()
+	defer interrupted.writeLock.Unlock()
+
+	head := interrupted.offset
+	if head <= write.offset {
+		return nil
+	}
+
+	last := write.offset.AddInt(write.count - 1)
+	if last >= head {
+		last = head - 1
+	}
+
+	if log.IsInfo() {
+		log.With("stream_id", write.stream).With("first", write.offset).With("last", last).Info("aborting interrupted transaction")
+	}
+	return interrupted.markAborted(write.offset, last)
+}
+
+// WriteTransaction writes the message sets to their streams atomically.
+// Readers see the messages of all streams, or none of them if the
+// transaction fails. The messages are synced to disk before the
+// transaction commits, regardless of the durability of the streams.
+func (this *Map) WriteTransaction(sets map[Id]message.UnalignedSet) (map[Id]message.AlignedSet, error) {
+	this.RLock()
+	transactions := this.transactions
+	closed := this.closed
+	this.RUnlock()
+
+	if closed {
+		return nil, ErrClosed
+	}
+	if transactions == nil {
+		return nil, ErrNoTransactionLog
+	}
+
+	// the streams are locked in order to prevent a
+	// deadlock with transactions on the same streams
+	ids := make([]string, 0, len(sets))
+	for id, set := range sets {
+		if set.MessageCount() == 0 {
+			return nil, fmt.Errorf("message set for stream %v is empty", id)
+		}
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	streams := make([]*stream, 0, len(ids))
+	for _, id := range ids {
+		s, err := this.Get(Id(id))
+		if err != nil {
+			return nil, err
+		}
+
+		transactional, ok := s.(*stream)
+		if !ok {
+			return nil, fmt.Errorf("stream %v does not support transactions", id)
+		}
+		if err := transactional.checkSize(sets[Id(id)]); err != nil {
+			return nil, err
+		}
+		streams = append(streams, transactional)
+	}
+
+	for _, stream := range streams {
+		stream.writeLock.Lock()
+		defer stream.writeLock.Unlock()
+	}
+
+	writes := make([]transactionWrite, 0, len(streams))
+	for _, stream := range streams {
+		set := sets[stream.id]
+		writes = append(writes, transactionWrite{
+			stream: stream.id,
+			offset: stream.offset,
+			count:  set.MessageCount(),
+		})
+	}
+
+	transaction, err := transactions.prepare(writes)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]pendingWrite, 0, len(streams))
+	for _, stream := range streams {
+		prepared, err := stream.prepare(sets[stream.id])
+		if err == nil {
+			pending = append(pending, prepared)
+			err = prepared.segment.sync()
+		}
+
+		if err != nil {
+			return nil, transactions.abort(transaction, streams, pending, err)
+		}
+	}
+
+	if err := transactions.commit(transaction); err != nil {
+		return nil, transactions.abort(transaction, streams, pending, err)
+	}
+
+	for _, stream := range streams {
+		stream.headLock.Lock()
+	}
+
+	written := make(map[Id]message.AlignedSet, len(streams))
+	for i, stream := range streams {
+		stream.publish(pending[i])
+		written[stream.id] = pending[i].aligned
+	}
+
+	for _, stream := range streams {
+		stream.headLock.Unlock()
+	}
+
+	transactions.finish(transaction)
+	return written, nil
+}
+
+// readTransactionLog returns the writes of the transactions in the log
+// that didn't commit or abort. A torn record at the end is ignored.
+func readTransactionLog(file *os.File) (map[uint64][]transactionWrite, error) {
+	buffer, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	interrupted := make(map[uint64][]transactionWrite)
+	for position := 0; position+8 <= len(buffer); {
+		size := int(byteOrder.Uint32(buffer[position:]))
+		if size < 9 || position+8+size > len(buffer) {
+			break
+		}
+
+		record := buffer[position+8 : position+8+size]
+		if byteOrder.Uint32(buffer[position+4:]) != crc32.Checksum(record, transactionCrcTable) {
+			break
+		}
+
+		transaction := byteOrder.Uint64(record[1:])
+		switch record[0] {
+		case TRANSACTION_PREPARE:
+			writes, ok := decodeTransactionWrites(record[9:])
+			if !ok {
+				return nil, fmt.Errorf("invalid transaction record at %v", position)
+			}
+			interrupted[transaction] = writes
+		case TRANSACTION_COMMIT, TRANSACTION_ABORT:
+			delete(interrupted, transaction)
+		}
+
+		position += 8 + size
+	}
+
+	return interrupted, nil
+}
+
+func decodeTransactionWrites(buffer []byte) ([]transactionWrite, bool) {
+	var writes []transactionWrite
+	for position := 0; position < len(buffer); {
+		if position+2 > len(buffer) {
+			return nil, false
+		}
+		size := int(byteOrder.Uint16(buffer[position:]))
+		position += 2
+
+		if position+size+16 > len(buffer) {
+			return nil, false
+		}
+		writes = append(writes, transactionWrite{
+			stream: Id(buffer[position : position+size]),
+			offset: message.Offset(byteOrder.Uint64(buffer[position+size:])),
+			count:  int(byteOrder.Uint64(buffer[position+size+8:])),
+		})
+		position += size + 16
+	}
+	return writes, true
+}
+
+// prepare records the writes of a new transaction before they are
+// written, so they can be aborted after a crash.
+func (this *transactionLog) prepare(writes []transactionWrite) (uint64, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.next++
+	transaction := this.next
+
+	var buffer []byte
+	for _, write := range writes {
+		entry := make([]byte, 2+len(write.stream)+16)
+		byteOrder.PutUint16(entry, uint16(len(write.stream)))
+		copy(entry[2:], write.stream)
+		byteOrder.PutUint64(entry[2+len(write.stream):], uint64(write.offset))
+		byteOrder.PutUint64(entry[2+len(write.stream)+8:], uint64(write.count))
+		buffer = append(buffer, entry...)
+	}
+
+	if err := this.write(TRANSACTION_PREPARE, transaction, buffer); err != nil {
+		return 0, err
+	}
+
+	this.progress[transaction] = true
+	return transaction, nil
+}
+
+// commit records that the transaction is complete. A transaction
+// that is committed is never aborted.
+func (this *transactionLog) commit(transaction uint64) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.write(TRANSACTION_COMMIT, transaction, nil)
+}
+
+// abort publishes the pending writes of the transaction as aborted and
+// returns the error that failed the transaction. If the pending writes
+// can't be aborted, the transaction is left in the log to be aborted
+// when the log is opened again.
+func (this *transactionLog) abort(transaction uint64, streams []*stream, pending []pendingWrite, cause error) error {
+	for i, write := range pending {
+		if err := streams[i].abort(write); err != nil {
+			return cause
+		}
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if err := this.write(TRANSACTION_ABORT, transaction, nil); err == nil {
+		this.end(transaction)
+	}
+	return cause
+}
+
+// finish forgets a committed transaction.
+func (this *transactionLog) finish(transaction uint64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.end(transaction)
+}
+
+// end forgets a transaction and empties the log once no transaction
+// is in progress. It must be called with the lock held.
+func (this *transactionLog) end(transaction uint64) {
+	delete(this.progress, transaction)
+
+	if len(this.progress) == 0 {
+		this.file.Truncate(0)
+	}
+}
+
+// close closes the log. Transactions are only written while their
+// streams are locked, so none are in progress once the streams of
+// the map are closed and the log is empty.
+func (this *transactionLog) close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.file.Close()
+}
+
+// write appends a record to the log and syncs it. It must
+// be called with the lock held.
+func (this *transactionLog) write(kind byte, transaction uint64, body []byte) error {
+	record := make([]byte, 8+9+len(body))
+	record[8] = kind
+	byteOrder.PutUint64(record[9:], transaction)
+	copy(record[17:], body)
+
+	byteOrder.PutUint32(record, uint32(len(record)-8))
+	byteOrder.PutUint32(record[4:], crc32.Checksum(record[8:], transactionCrcTable))
+
+	if _, err := this.file.Write(record); err != nil {
+		return err
+	}
+	return this.file.Sync()
+}
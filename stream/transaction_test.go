@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pjvds/strand/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTransaction(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	streams := NewMap(directory.OpenOrCreateStream)
+	assert.Nil(streams.OpenTransactionLog(filepath.Join(string(directory), "transactions")))
+
+	billing, _ := streams.Get("billing")
+	billing.Write(newUnalignedSet(t, 2))
+
+	written, err := streams.WriteTransaction(map[Id]message.UnalignedSet{
+		"orders":  newUnalignedSet(t, 3),
+		"billing": newUnalignedSet(t, 1),
+	})
+	assert.Nil(err)
+	writtenOrders, writtenBilling := written["orders"], written["billing"]
+	assert.Equal(message.Offset(0), writtenOrders.FirstOffset(), "orders")
+	assert.Equal(message.Offset(2), writtenBilling.FirstOffset(), "billing")
+
+	orders, _ := streams.Get("orders")
+	assert.Equal(message.Offset(3), orders.HeadOffset())
+	assert.Equal(message.Offset(3), billing.HeadOffset())
+
+	info, _ := os.Stat(filepath.Join(string(directory), "transactions"))
+	assert.Equal(int64(0), info.Size(), "log is empty without transactions in progress")
+}
+
+func TestOpenTransactionLogAbortsInterruptedTransaction(t *testing.T) {
+	assert := assert.New(t)
+	directory := tempDirectory(t)
+	defer os.RemoveAll(string(directory))
+
+	filename := filepath.Join(string(directory), "transactions")
+	streams := NewMap(directory.OpenOrCreateStream)
+	streams.OpenTransactionLog(filename)
+
+	s, _ := streams.Get("orders")
+	s.Write(newUnalignedSet(t, 2))
+
+	// crash after the messages of the transaction are written
+	interrupted := s.(*stream)
+	streams.transactions.prepare([]transactionWrite{{
+		stream: "orders",
+		offset: interrupted.offset,
+		count:  3,
+	}})
+	pending, _ := interrupted.prepare(newUnalignedSet(t, 3))
+	pending.segment.sync()
+	interrupted.closeSegments()
+
+	recovered := NewMap(directory.OpenOrCreateStream)
+	assert.Nil(recovered.OpenTransactionLog(filename))
+
+	s, _ = recovered.Get("orders")
+	assert.Equal(message.Offset(5), s.HeadOffset(), "aborted messages take their offsets")
+
+	written, _ := s.Write(newUnalignedSet(t, 1))
+	assert.Equal(message.Offset(5), written.FirstOffset())
+
+	set, err := s.Read(message.EmptyOffset, 0, 1024*1024)
+	assert.Nil(err)
+	assert.Equal(3, set.MessageCount(), "messages around the transaction")
+	assert.Equal(message.Offset(5), set.LastOffset())
+
+	set, err = s.Read(message.Offset(2), 0, 1024*1024)
+	assert.Nil(err)
+	assert.Equal(1, set.MessageCount(), "aborted messages are skipped")
+	assert.Equal(message.Offset(5), set.FirstOffset())
+}